@@ -40,6 +40,8 @@ func main() {
 		runCollection()
 	case "storage":
 		runStorage()
+	case "keys":
+		runKeys()
 	case "init":
 		runInit()
 	case "export":
@@ -67,6 +69,7 @@ func printUsage() {
 	fmt.Println("  admin <subcommand>          Manage admin users")
 	fmt.Println("  collection <subcommand>     Manage collections")
 	fmt.Println("  storage <subcommand>        Manage storage")
+	fmt.Println("  keys <subcommand>           Manage JWT signing keys")
 	fmt.Println("  backup <subcommand>         Backup and restore operations")
 	fmt.Println("  migrate <subcommand>        Database migration operations")
 	fmt.Println("  export <format>             Export collections and data")
@@ -169,6 +172,12 @@ func runAdmin() {
 }
 
 func runServer(cfg *core.Config) {
+	// The default secret is public, so tokens signed with it prove nothing.
+	if cfg.JWTSecret == "" || cfg.JWTSecret == core.DefaultJWTSecret {
+		fmt.Fprintln(os.Stderr, "Error: refusing to start with the default jwt_secret; set jwt_secret in config.json, VAULT_JWT_SECRET or --jwt-secret, or run vault init")
+		os.Exit(1)
+	}
+
 	// Import server package
 	app := server.NewApp(cfg)
 	app.Run()
@@ -193,6 +202,24 @@ func runBackup() {
 	}
 }
 
+func runKeys() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: vault keys <subcommand> [options]")
+		fmt.Println("Subcommands:")
+		fmt.Println("  list")
+		fmt.Println("  rotate [--alg RS256|EdDSA]")
+		os.Exit(1)
+	}
+
+	cfg := core.LoadConfig()
+
+	keysCmd := cli.NewKeysCommand(cfg)
+	if err := keysCmd.Run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func runVersion() {
 	fmt.Printf("Vault version %s\n", Version)
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/errors"
 	"github.com/zulfikawr/vault/internal/models"
 	"github.com/zulfikawr/vault/internal/service"
@@ -11,12 +13,14 @@ import (
 
 type AdminHandler struct {
 	collectionService *service.CollectionService
+	fileService       *service.FileService
 	sqlService        *service.SqlService
 }
 
-func NewAdminHandler(collectionService *service.CollectionService, sqlService *service.SqlService) *AdminHandler {
+func NewAdminHandler(collectionService *service.CollectionService, fileService *service.FileService, sqlService *service.SqlService) *AdminHandler {
 	return &AdminHandler{
 		collectionService: collectionService,
+		fileService:       fileService,
 		sqlService:        sqlService,
 	}
 }
@@ -55,6 +59,10 @@ func (h *AdminHandler) CreateCollection(w http.ResponseWriter, r *http.Request)
 		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
 		return
 	}
+	if err := checkSystemCollection(r, col.Name); err != nil {
+		errors.SendError(w, err)
+		return
+	}
 
 	if err := h.collectionService.CreateCollection(r.Context(), &col); err != nil {
 		errors.SendError(w, err)
@@ -79,11 +87,35 @@ func (h *AdminHandler) UpdateCollection(w http.ResponseWriter, r *http.Request)
 
 	// Ensure the ID from the path is used
 	col.ID = id
+	for _, existing := range h.collectionService.ListCollections() {
+		if existing.ID == id || existing.Name == col.Name {
+			if err := checkSystemCollection(r, existing.Name); err != nil {
+				errors.SendError(w, err)
+				return
+			}
+		}
+	}
+	if err := checkSystemCollection(r, col.Name); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	// Files of dropped file fields are collected before their columns go.
+	var orphaned []string
+	if existing, ok := h.collectionService.GetCollection(col.Name); ok {
+		paths, err := h.fileService.RemovedFieldFiles(r.Context(), existing, &col)
+		if err != nil {
+			errors.SendError(w, err)
+			return
+		}
+		orphaned = paths
+	}
 
 	if err := h.collectionService.CreateCollection(r.Context(), &col); err != nil {
 		errors.SendError(w, err)
 		return
 	}
+	h.fileService.DeleteFiles(r.Context(), orphaned)
 
 	SendJSON(w, http.StatusOK, col, nil)
 }
@@ -111,11 +143,32 @@ func (h *AdminHandler) DeleteCollection(w http.ResponseWriter, r *http.Request)
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if err := checkSystemCollection(r, name); err != nil {
+		errors.SendError(w, err)
+		return
+	}
 
 	if err := h.collectionService.DeleteCollection(r.Context(), name); err != nil {
 		errors.SendError(w, err)
 		return
 	}
+	h.fileService.DeleteCollectionFiles(r.Context(), name)
 
 	SendJSON(w, http.StatusOK, map[string]string{"message": "Collection deleted successfully"}, nil)
 }
+
+// checkSystemCollection rejects changes to a system collection unless the
+// caller is an admin. Their schema and rules are all that guard the admin
+// accounts, roles and keys, which a role granting collections.write must not
+// reach.
+func checkSystemCollection(r *http.Request, name string) error {
+	if !models.IsSystemCollection(name) {
+		return nil
+	}
+	if claims, ok := core.GetAuth(r.Context()).(*auth.Claims); ok && claims.IsAdmin() {
+		return nil
+	}
+	return errors.NewError(http.StatusForbidden, "FORBIDDEN", "Only admins can change system collections").WithDetails(map[string]any{
+		"collection": name,
+	})
+}
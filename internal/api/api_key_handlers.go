@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// List returns API keys, optionally only those of the record given by the
+// collection and record_id query parameters.
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	collection := r.URL.Query().Get("collection")
+	if collection == "" {
+		collection = "users"
+	}
+
+	keys, err := h.apiKeyService.List(r.Context(), collection, r.URL.Query().Get("record_id"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, keys, nil)
+}
+
+// Create issues an API key. The response is the only time the key is shown.
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name       string   `json:"name"`
+		Collection string   `json:"collection"`
+		RecordID   string   `json:"record_id"`
+		Scopes     []string `json:"scopes"`
+		Expires    string   `json:"expires"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	input := service.APIKeyInput{Name: req.Name, Collection: req.Collection, RecordID: req.RecordID, Scopes: req.Scopes}
+	if req.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, req.Expires)
+		if err != nil {
+			errors.SendError(w, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(map[string]any{
+				"expires": "must be an RFC 3339 date",
+			}))
+			return
+		}
+		input.Expires = expires
+	}
+
+	key, apiKey, err := h.apiKeyService.Create(r.Context(), input)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	SendJSON(w, http.StatusCreated, map[string]any{
+		"key":     key,
+		"api_key": apiKey,
+	}, nil)
+}
+
+// Revoke deletes an API key.
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := h.apiKeyService.Revoke(r.Context(), r.PathValue("id")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/scan"
+	"github.com/zulfikawr/vault/internal/service"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+// testAPI holds the services behind the handlers under test.
+type testAPI struct {
+	config      *core.Config
+	registry    *db.SchemaRegistry
+	collections *service.CollectionService
+	records     *service.RecordService
+	roles       *service.RoleService
+	files       *service.FileService
+	store       storage.Storage
+}
+
+func newTestAPI(t *testing.T, cols ...*models.Collection) *testAPI {
+	t.Helper()
+	ctx := context.Background()
+	database, err := db.Connect(ctx, filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	registry := db.NewSchemaRegistry(database)
+	collections := service.NewCollectionService(registry, db.NewMigrationEngine(database))
+	if err := collections.InitSystem(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range cols {
+		if err := collections.CreateCollection(ctx, col); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service.RegisterAuthHooks(registry.GetCollections())
+
+	records := service.NewRecordService(db.NewRepository(database, registry), nil)
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &core.Config{JWTSecret: "test-secret", JWTExpiry: 1, MaxFileUploadSize: 1 << 20}
+	return &testAPI{
+		config:      config,
+		registry:    registry,
+		collections: collections,
+		records:     records,
+		roles:       service.NewRoleService(records),
+		files:       service.NewFileService(records, store, config, service.NewQuotaService(records, config), scan.NewRules(nil)),
+		store:       store,
+	}
+}
+
+// serve sends the request to the handler registered for the pattern, as the
+// auth record when claims is not nil.
+func serve(pattern string, handler http.HandlerFunc, r *http.Request, claims *auth.Claims) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, handler)
+	if claims != nil {
+		r = r.WithContext(core.WithAuth(r.Context(), claims))
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// decode returns the data of a JSON response.
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func errorCode(err error) string {
+	if e, ok := err.(*errors.VaultError); ok {
+		return e.Code
+	}
+	return ""
+}
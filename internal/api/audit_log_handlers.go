@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+type AuditLogHandler struct {
+	recordService *service.RecordService
+}
+
+func NewAuditLogHandler(recordService *service.RecordService) *AuditLogHandler {
+	return &AuditLogHandler{recordService: recordService}
+}
+
+// List returns the audit log, the latest entries first, a page at a time
+// with ?page and ?perPage. ?action= keeps the entries of one action.
+func (h *AuditLogHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	perPage, _ := strconv.Atoi(q.Get("perPage"))
+	params := db.QueryParams{Sort: "-timestamp", Page: max(page, 1), PerPage: perPage}
+	if params.PerPage <= 0 {
+		params.PerPage = 30
+	}
+	if action := q.Get("action"); action != "" {
+		params.Filter = "action = " + db.QuoteFilterValue(action)
+	}
+
+	entries, total, err := h.recordService.ListRecords(r.Context(), models.AuditLogsCollection, params)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, entries, map[string]any{
+		"page":       params.Page,
+		"perPage":    params.PerPage,
+		"totalItems": total,
+	})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/api/middleware"
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestAuditLogPermission(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+	require := func(permission string, handler http.HandlerFunc) http.HandlerFunc {
+		return middleware.RequirePermission(api.roles, permission)(handler).ServeHTTP
+	}
+
+	if _, err := api.roles.CreateRole(ctx, &models.Role{Name: "support", Permissions: []string{models.PermissionAuditLogsRead}}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.records.CreateRecord(ctx, "users", map[string]any{
+		"email": "s@x.io", "username": "s", "password": "password123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.roles.AssignRole(ctx, "users", user.ID, "support"); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"lockout_cleared", "quarantine_released"} {
+		if _, err := api.records.CreateRecord(ctx, models.AuditLogsCollection, map[string]any{
+			"action": action, "resource": "r", "admin_id": "_admins/a1", "timestamp": time.Now().Format(time.RFC3339),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	claims := &auth.Claims{RecordID: user.ID, Collection: "users", Type: auth.TokenTypeAuth}
+
+	// A support role reads the audit log...
+	h := NewAuditLogHandler(api.records)
+	w := serve("GET /api/admin/audit-logs", require(models.PermissionAuditLogsRead, h.List), httptest.NewRequest("GET", "/api/admin/audit-logs?action=lockout_cleared", nil), claims)
+	if body := decode(t, w); w.Code != 200 || body["totalItems"] != float64(1) {
+		t.Errorf("expected the role to read the audit log, got %d %v", w.Code, body)
+	}
+	// ...but cannot execute SQL.
+	admin := NewAdminHandler(api.collections, api.files, nil)
+	w = serve("POST /api/admin/query", require(models.PermissionQueryExecute, admin.ExecuteQuery), httptest.NewRequest("POST", "/api/admin/query", strings.NewReader(`{"query": "SELECT 1"}`)), claims)
+	if w.Code != 403 {
+		t.Errorf("expected the query to be forbidden, got %d %s", w.Code, w.Body)
+	}
+	other := &auth.Claims{RecordID: "u2", Collection: "users", Type: auth.TokenTypeAuth}
+	if w := serve("GET /api/admin/audit-logs", require(models.PermissionAuditLogsRead, h.List), httptest.NewRequest("GET", "/api/admin/audit-logs", nil), other); w.Code != 403 {
+		t.Errorf("expected records without the role to be forbidden, got %d", w.Code)
+	}
+}
@@ -3,40 +3,90 @@ package api
 import (
 	"encoding/json"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/zulfikawr/vault/internal/api/middleware"
 	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/db"
 	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/rules"
 	"github.com/zulfikawr/vault/internal/service"
 )
 
 type AuthHandler struct {
-	recordService *service.RecordService
-	config        *core.Config
+	recordService  *service.RecordService
+	accountService *service.AccountService
+	sessionService *service.SessionService
+	oauthService   *service.OAuthService
+	mfaService     *service.MFAService
+	lockoutService *service.LockoutService
+	keys           *auth.KeySet
+	config         *core.Config
 }
 
-func NewAuthHandler(rs *service.RecordService, config *core.Config) *AuthHandler {
+func NewAuthHandler(rs *service.RecordService, accountService *service.AccountService, sessionService *service.SessionService, oauthService *service.OAuthService, mfaService *service.MFAService, lockoutService *service.LockoutService, keys *auth.KeySet, config *core.Config) *AuthHandler {
 	return &AuthHandler{
-		recordService: rs,
-		config:        config,
+		recordService:  rs,
+		accountService: accountService,
+		sessionService: sessionService,
+		oauthService:   oauthService,
+		mfaService:     mfaService,
+		lockoutService: lockoutService,
+		keys:           keys,
+		config:         config,
 	}
 }
 
 type LoginRequest struct {
 	Identity string `json:"identity"` // email or username
 	Password string `json:"password"`
+
+	// Session is "cookie" to start a dashboard cookie session instead of
+	// issuing tokens. Only admins can use cookie sessions.
+	Session string `json:"session"`
+}
+
+// authCollection resolves the auth collection named in the request path.
+// Only collections of type auth expose the auth endpoints.
+func (h *AuthHandler) authCollection(w http.ResponseWriter, r *http.Request) (*models.Collection, bool) {
+	col, ok := h.recordService.Lookup().Collection(r.PathValue("collection"))
+	if !ok || col.Type != models.CollectionTypeAuth {
+		errors.SendError(w, errors.NewError(http.StatusNotFound, "AUTH_COLLECTION_NOT_FOUND", "Auth collection not found"))
+		return nil, false
+	}
+	return col, true
 }
 
+// Login authenticates a record of the auth collection in the path.
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+	h.authWithPassword(w, r, col.Name)
+}
+
+// AdminLogin authenticates a dashboard administrator. Only tokens issued here
+// carry the admin claim, which passes every admin route and API rule.
+func (h *AuthHandler) AdminLogin(w http.ResponseWriter, r *http.Request) {
+	h.authWithPassword(w, r, models.AdminsCollection)
+}
+
+func (h *AuthHandler) authWithPassword(w http.ResponseWriter, r *http.Request, collection string) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
 		return
 	}
+	if req.Session != "" && (req.Session != service.SessionKindCookie || collection != models.AdminsCollection) {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Cookie sessions are only available to admins"))
+		return
+	}
 
 	// This is a simplified lookup. In a real scenario, we'd use the QueryBuilder to find by email or username.
 	// For now, let's assume we have a way to find a record by a filter.
@@ -44,40 +94,73 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// Find user by email
 	// In Phase 5 we implemented a simple filter parser that requires valid field names.
-	records, _, err := h.recordService.ListRecords(r.Context(), "users", db.QueryParams{Filter: "email = " + req.Identity})
+	records, _, err := h.recordService.ListRecords(r.Context(), collection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(req.Identity)})
 	if err != nil || len(records) == 0 {
 		// If not found by email, try username
-		records, _, err = h.recordService.ListRecords(r.Context(), "users", db.QueryParams{Filter: "username = " + req.Identity})
+		records, _, err = h.recordService.ListRecords(r.Context(), collection, db.QueryParams{Filter: "username = " + db.QuoteFilterValue(req.Identity)})
 	}
 
-	if err != nil || len(records) == 0 {
+	// Failed logins are counted against the record's email, so that
+	// alternating between email and username does not double the attempts.
+	identity := req.Identity
+	if err == nil && len(records) > 0 && records[0].GetString("email") != "" {
+		identity = records[0].GetString("email")
+	}
+	// The attempt counts as failed until the password matches, so that
+	// parallel guesses cannot get past the lockout.
+	ip := sessionClient(r).IP
+	if wait, lockErr := h.lockoutService.Reserve(r.Context(), collection, identity, ip); lockErr != nil {
+		errors.SendError(w, lockErr)
+		return
+	} else if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		errors.SendError(w, service.LoginLockedError(wait))
+		return
+	}
+
+	if err != nil || len(records) == 0 || !auth.ComparePasswords(records[0].GetString("password"), req.Password) {
 		errors.SendError(w, errors.NewError(http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid identity or password"))
 		return
 	}
 
-	userRecord := records[0]
-	hashedPassword := userRecord.GetString("password")
+	if err := h.lockoutService.Refund(r.Context(), collection, identity, ip); err != nil {
+		errors.Log(r.Context(), err, "clear failed logins")
+	}
 
-	if !auth.ComparePasswords(hashedPassword, req.Password) {
-		errors.SendError(w, errors.NewError(http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid identity or password"))
+	if req.Session == service.SessionKindCookie {
+		h.signInWithCookie(w, r, collection, records[0])
 		return
 	}
 
-	// Update lastLogin timestamp
-	_, err = h.recordService.UpdateRecord(r.Context(), "users", userRecord.ID, map[string]any{
-		"lastLogin": time.Now().Format(time.RFC3339),
-	})
+	h.completeLogin(w, r, collection, records[0], nil)
+}
+
+// completeLogin signs the record in, unless it has to pass an MFA challenge
+// first, in which case the response carries the challenge token instead.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, collection string, userRecord *models.Record, meta map[string]any) {
+	challenge, err := h.mfaService.Challenge(r.Context(), userRecord)
 	if err != nil {
-		slog.Warn("Failed to update lastLogin", "error", err)
+		errors.SendError(w, err)
+		return
 	}
-
-	// Refresh the user record to get updated lastLogin
-	records, _, err = h.recordService.ListRecords(r.Context(), "users", db.QueryParams{Filter: "id = " + userRecord.ID})
-	if err == nil && len(records) > 0 {
-		userRecord = records[0]
+	if challenge != nil {
+		SendJSON(w, http.StatusOK, map[string]any{
+			"mfa_required": true,
+			"mfa_token":    challenge.Token,
+			"mfa_enrolled": challenge.Enrolled,
+			"expires":      challenge.Expires,
+		}, nil)
+		return
 	}
+	h.signIn(w, r, collection, userRecord, meta)
+}
+
+// signIn records the login and responds with a token and the first refresh
+// token of a new session. meta is added to the response when not nil.
+func (h *AuthHandler) signIn(w http.ResponseWriter, r *http.Request, collection string, userRecord *models.Record, meta map[string]any) {
+	userRecord = h.recordLogin(r, collection, userRecord)
 
-	token, err := auth.GenerateToken(r.Context(), userRecord, h.config.JWTSecret, h.config.JWTExpiry)
+	token, err := auth.GenerateToken(r.Context(), userRecord, h.keys, h.config.JWTExpiry)
 	if err != nil {
 		errors.SendError(w, err)
 		return
@@ -85,52 +168,120 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	userRecord.HideField("password")
 
-	// Generate Refresh Token
-	refreshToken := uuid.New().String()
-	_, err = h.recordService.CreateRecord(r.Context(), "_refresh_tokens", map[string]any{
-		"token":   refreshToken,
-		"user_id": userRecord.ID,
-		"expires": time.Now().Add(7 * 24 * time.Hour).Format(time.RFC3339),
-	})
+	refreshToken, err := h.sessionService.Start(r.Context(), collection, userRecord.ID, sessionClient(r))
 	if err != nil {
 		errors.SendError(w, err)
 		return
 	}
 
-	SendJSON(w, http.StatusOK, map[string]any{
+	response := map[string]any{
 		"token":         token,
 		"refresh_token": refreshToken,
 		"record":        userRecord,
+	}
+	if meta != nil {
+		response["meta"] = meta
+	}
+	SendJSON(w, http.StatusOK, response, nil)
+}
+
+// signInWithCookie starts a cookie session for the record and sets its
+// HttpOnly cookie. The response carries the record and the CSRF token the
+// browser has to send with state-changing requests.
+func (h *AuthHandler) signInWithCookie(w http.ResponseWriter, r *http.Request, collection string, userRecord *models.Record) {
+	userRecord = h.recordLogin(r, collection, userRecord)
+
+	token, expires, err := h.sessionService.StartCookie(r.Context(), collection, userRecord.ID, sessionClient(r))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	csrfToken, err := middleware.CSRFToken(w, r)
+	if err != nil {
+		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "CSRF_TOKEN_FAILED", "Failed to issue CSRF token"))
+		return
+	}
+	middleware.SetSessionCookie(w, r, token, expires)
+
+	userRecord.HideField("password")
+	SendJSON(w, http.StatusOK, map[string]any{
+		"record":     userRecord,
+		"csrf_token": csrfToken,
+		"expires":    expires.Format(time.RFC3339),
 	}, nil)
 }
 
+// recordLogin updates the record's lastLogin timestamp and returns the
+// updated record.
+func (h *AuthHandler) recordLogin(r *http.Request, collection string, userRecord *models.Record) *models.Record {
+	_, err := h.recordService.UpdateRecord(r.Context(), collection, userRecord.ID, map[string]any{
+		"lastLogin": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		slog.Warn("Failed to update lastLogin", "error", err)
+	}
+
+	if refreshed, err := h.recordService.FindRecordByID(r.Context(), collection, userRecord.ID); err == nil {
+		return refreshed
+	}
+	return userRecord
+}
+
+// AdminMe returns the authenticated admin, which lets the dashboard check
+// whether its session cookie is still valid.
+func (h *AuthHandler) AdminMe(w http.ResponseWriter, r *http.Request) {
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if !ok || claims == nil || !claims.IsAdmin() {
+		errors.SendError(w, errors.NewError(http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required"))
+		return
+	}
+
+	record, err := h.recordService.FindRecordByID(r.Context(), models.AdminsCollection, claims.RecordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	record.HideField("password")
+	SendJSON(w, http.StatusOK, record, nil)
+}
+
+// Refresh issues a new token from a refresh token issued by the same auth
+// collection.
 func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		RefreshToken string `json:"refresh_token"`
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
 	}
+	h.refresh(w, r, col.Name)
+}
+
+// AdminRefresh issues a new admin token from a refresh token obtained
+// through AdminLogin.
+func (h *AuthHandler) AdminRefresh(w http.ResponseWriter, r *http.Request) {
+	h.refresh(w, r, models.AdminsCollection)
+}
+
+func (h *AuthHandler) refresh(w http.ResponseWriter, r *http.Request, collection string) {
+	var req refreshTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
 		return
 	}
 
-	// Lookup refresh token
-	records, _, err := h.recordService.ListRecords(r.Context(), "_refresh_tokens", db.QueryParams{Filter: "token = " + req.RefreshToken})
-	if err != nil || len(records) == 0 {
-		errors.SendError(w, errors.NewError(http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid or expired refresh token"))
+	// The presented token is spent; the response carries its successor.
+	userID, refreshToken, err := h.sessionService.Rotate(r.Context(), collection, req.RefreshToken, sessionClient(r))
+	if err != nil {
+		errors.SendError(w, err)
 		return
 	}
 
-	refreshTokenRecord := records[0]
-	// Check expiry (omitted for brevity, but should be checked)
-
-	userID := refreshTokenRecord.GetString("user_id")
-	userRecord, err := h.recordService.FindRecordByID(r.Context(), "users", userID)
+	userRecord, err := h.recordService.FindRecordByID(r.Context(), collection, userID)
 	if err != nil {
 		errors.SendError(w, errors.NewError(http.StatusUnauthorized, "USER_NOT_FOUND", "Associated user not found"))
 		return
 	}
 
-	newToken, err := auth.GenerateToken(r.Context(), userRecord, h.config.JWTSecret, h.config.JWTExpiry)
+	newToken, err := auth.GenerateToken(r.Context(), userRecord, h.keys, h.config.JWTExpiry)
 	if err != nil {
 		errors.SendError(w, err)
 		return
@@ -138,12 +289,136 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	userRecord.HideField("password")
 	SendJSON(w, http.StatusOK, map[string]any{
-		"token":  newToken,
-		"record": userRecord,
+		"token":         newToken,
+		"refresh_token": refreshToken,
+		"record":        userRecord,
 	}, nil)
 }
 
+// Logout ends the session of a refresh token issued by the auth collection.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+	h.logout(w, r, col.Name)
+}
+
+// AdminLogout ends the session of a refresh token obtained through
+// AdminLogin.
+func (h *AuthHandler) AdminLogout(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, models.AdminsCollection)
+}
+
+func (h *AuthHandler) logout(w http.ResponseWriter, r *http.Request, collection string) {
+	// Cookie sessions end with their cookie; no refresh token is involved.
+	if cookie, err := r.Cookie(middleware.SessionCookieName); err == nil && collection == models.AdminsCollection {
+		if err := h.sessionService.End(r.Context(), collection, cookie.Value); err != nil {
+			slog.Debug("Session cookie already ended", "error", err)
+		}
+		middleware.ClearSessionCookie(w, r)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	if err := h.sessionService.End(r.Context(), collection, req.RefreshToken); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sessionClient describes the client making the request for session listings.
+func sessionClient(r *http.Request) service.SessionClient {
+	return service.SessionClient{UserAgent: r.UserAgent(), IP: middleware.ClientIP(r)}
+}
+
+// Register creates a record in the auth collection, subject to the
+// collection's create rule.
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var data map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	// Roles, login metadata and verification are never set by the registrant.
+	delete(data, "roles")
+	delete(data, "lastLogin")
+	delete(data, "verified")
+
+	if col.CreateRule != nil && *col.CreateRule != "" {
+		evalCtx := service.GetEvaluationContext(r, h.recordService.Lookup(), col.Name, nil)
+		evalCtx.Data = data
+		allowed, err := rules.Evaluate(*col.CreateRule, evalCtx)
+		if !allowed || err != nil {
+			errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "Registration is not allowed for this collection"))
+			return
+		}
+	}
+
+	if err := service.ValidateRecord(col, data); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	password, _ := data["password"].(string)
+	if len(password) < service.MinPasswordLength {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(map[string]any{
+			"password": "must be at least 8 characters",
+		}))
+		return
+	}
+
+	for _, field := range []string{"email", "username"} {
+		value, _ := data[field].(string)
+		records, _, err := h.recordService.ListRecords(r.Context(), col.Name, db.QueryParams{Filter: field + " = " + db.QuoteFilterValue(value), PerPage: 1})
+		if err != nil {
+			errors.SendError(w, err)
+			return
+		}
+		if len(records) > 0 {
+			errors.SendError(w, errors.NewError(http.StatusConflict, "IDENTITY_TAKEN", "Email or username is already in use").WithDetails(map[string]any{
+				field: "already in use",
+			}))
+			return
+		}
+	}
+
+	record, err := h.recordService.CreateRecord(r.Context(), col.Name, data)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	record.HideField("password")
+	SendJSON(w, http.StatusCreated, record, nil)
+}
+
+// RequestPasswordReset mails a password reset link. The response is the
+// same whether or not the email belongs to a record.
 func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
 	var req struct {
 		Email string `json:"email"`
 	}
@@ -152,25 +427,22 @@ func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// 1. Find user
-	records, _, err := h.recordService.ListRecords(r.Context(), "users", db.QueryParams{Filter: "email = " + req.Email})
-	if err != nil || len(records) == 0 {
-		// Silent fail for security: don't reveal if email exists
-		SendJSON(w, http.StatusOK, map[string]string{"message": "If the email exists, a reset link will be sent"}, nil)
+	if err := h.accountService.RequestPasswordReset(r.Context(), col.Name, req.Email); err != nil {
+		errors.SendError(w, err)
 		return
 	}
 
-	// 2. Generate a temporary token (mocked for this checkpoint)
-	resetToken := uuid.New().String()
-
-	// In a real implementation, we'd save this to a 'password_resets' collection with an expiry.
-	// For now, we log it (representing the "email" being sent).
-	slog.Info("Password reset requested", "email", req.Email, "token", resetToken, "request_id", core.GetRequestID(r.Context()))
-
 	SendJSON(w, http.StatusOK, map[string]string{"message": "If the email exists, a reset link will be sent"}, nil)
 }
 
+// ConfirmPasswordReset sets a new password using a reset token and signs the
+// record out of every session.
 func (h *AuthHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
 	var req struct {
 		Token       string `json:"token"`
 		NewPassword string `json:"password"`
@@ -180,7 +452,79 @@ func (h *AuthHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// In a real implementation, we'd verify the token from the DB.
-	// Since we don't have the table yet, we'll return an error for now to show logic is present.
-	errors.SendError(w, errors.NewError(http.StatusNotImplemented, "RESET_NOT_FULLY_IMPLEMENTED", "Token verification table not yet migrated"))
+	if err := h.accountService.ConfirmPasswordReset(r.Context(), col.Name, req.Token, req.NewPassword); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestVerification mails an email verification link. The response is the
+// same whether or not the email belongs to a record.
+func (h *AuthHandler) RequestVerification(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	if err := h.accountService.RequestVerification(r.Context(), col.Name, req.Email); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	SendJSON(w, http.StatusOK, map[string]string{"message": "If the email exists, a verification link will be sent"}, nil)
+}
+
+// ConfirmVerification marks the record verified using a verification token.
+func (h *AuthHandler) ConfirmVerification(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	record, err := h.accountService.ConfirmVerification(r.Context(), col.Name, req.Token)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	record.HideField("password")
+	SendJSON(w, http.StatusOK, record, nil)
+}
+
+// JWKS publishes the public keys that verify access tokens, so that other
+// services can verify them without a shared secret.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(h.keys.JWKS())
+}
+
+// CSRFToken returns the CSRF token browsers echo in the X-CSRF-Token header
+// of state-changing requests, setting its cookie if needed.
+func (h *AuthHandler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	token, err := middleware.CSRFToken(w, r)
+	if err != nil {
+		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "CSRF_TOKEN_FAILED", "Failed to issue CSRF token"))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	SendJSON(w, http.StatusOK, map[string]string{"csrf_token": token}, nil)
 }
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+func newTestAuthHandler(t *testing.T, api *testAPI) *AuthHandler {
+	t.Helper()
+	mailer, err := service.NewOutboxMailer(filepath.Join(t.TempDir(), "outbox.log"), "vault@x.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := service.NewSessionService(api.records)
+	accounts := service.NewAccountService(api.records, sessions, mailer, service.NewMailTemplates(t.TempDir()), "http://localhost")
+	lockouts := service.NewLockoutService(api.records, api.config)
+	return NewAuthHandler(api.records, accounts, sessions,
+		service.NewOAuthService(api.records, api.config, nil),
+		service.NewMFAService(api.records, lockouts, service.MFAIssuer, service.MFAKey(api.config.JWTSecret)),
+		lockouts,
+		auth.NewHMACKeySet(api.config.JWTSecret), api.config)
+}
+
+func TestAuthCollections(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t,
+		&models.Collection{Name: "members", Type: models.CollectionTypeAuth},
+		&models.Collection{Name: "posts", Type: models.CollectionTypeBase, Fields: []models.Field{{Name: "title", Type: models.FieldTypeText}}},
+	)
+	h := newTestAuthHandler(t, api)
+	post := func(handler, collection, body string) (int, map[string]any) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/collections/"+collection+"/"+handler, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		fn := h.Login
+		if handler == "auth-register" {
+			fn = h.Register
+		}
+		w := serve("POST /api/collections/{collection}/"+handler, fn, r, nil)
+		return w.Code, decode(t, w)
+	}
+
+	// Registration drops the fields a registrant may not set.
+	code, body := post("auth-register", "members", `{"email":"m@x.io","username":"m","password":"password123","roles":["owner"],"verified":true,"lastLogin":"2020-01-01T00:00:00Z"}`)
+	if code != 201 {
+		t.Fatalf("expected the registration to succeed, got %d %v", code, body)
+	}
+	id := body["data"].(map[string]any)["id"].(string)
+	member, err := api.records.FindRecordByID(ctx, "members", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := service.RoleNames(member.Data["roles"]); len(roles) != 0 || member.Data["verified"] == true || member.Data["lastLogin"] != nil {
+		t.Errorf("expected roles, verified and lastLogin to be dropped, got %v", member.Data)
+	}
+
+	// Records log in against their own auth collection only.
+	code, body = post("auth-with-password", "members", `{"identity":"m@x.io","password":"password123"}`)
+	if code != 200 {
+		t.Fatalf("expected the login to succeed, got %d %v", code, body)
+	}
+	data := body["data"].(map[string]any)
+	if data["token"] == "" || data["record"].(map[string]any)["collection"] != "members" {
+		t.Errorf("expected a token for the member, got %v", data)
+	}
+	if code, body = post("auth-with-password", "users", `{"identity":"m@x.io","password":"password123"}`); code != 401 {
+		t.Errorf("expected the member to be unknown to users, got %d %v", code, body)
+	}
+
+	// Base and system collections have no auth endpoints.
+	for _, collection := range []string{"posts", models.AdminsCollection, "missing"} {
+		for _, handler := range []string{"auth-with-password", "auth-register"} {
+			code, body := post(handler, collection, `{"identity":"m@x.io","password":"password123","email":"x@x.io","username":"x"}`)
+			if code != 404 || body["error"].(map[string]any)["code"] != "AUTH_COLLECTION_NOT_FOUND" {
+				t.Errorf("%s %s: expected AUTH_COLLECTION_NOT_FOUND, got %d %v", handler, collection, code, body)
+			}
+		}
+	}
+}
@@ -2,23 +2,34 @@ package api
 
 import (
 	"encoding/json"
+	stderrors "errors"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 
+	"github.com/google/uuid"
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/db"
 	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
 	"github.com/zulfikawr/vault/internal/rules"
 	"github.com/zulfikawr/vault/internal/service"
 )
 
 type CollectionHandler struct {
 	recordService *service.RecordService
+	roleService   *service.RoleService
+	fileService   *service.FileService
 	registry      *db.SchemaRegistry
 }
 
-func NewCollectionHandler(recordService *service.RecordService, registry *db.SchemaRegistry) *CollectionHandler {
+func NewCollectionHandler(recordService *service.RecordService, roleService *service.RoleService, fileService *service.FileService, registry *db.SchemaRegistry) *CollectionHandler {
 	return &CollectionHandler{
 		recordService: recordService,
+		roleService:   roleService,
+		fileService:   fileService,
 		registry:      registry,
 	}
 }
@@ -30,20 +41,25 @@ func (h *CollectionHandler) List(w http.ResponseWriter, r *http.Request) {
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if !inScope(w, r, collectionName, models.ActionList) {
+		return
+	}
 
-	// For Phase 5, if listRule is nil/empty, it's public.
-	// If it's set, we check basic auth for now.
-	// (Step 3 will implement full SQL-level filtering)
-	if col.ListRule != nil && *col.ListRule != "" {
-		evalCtx := service.GetEvaluationContext(r, nil)
-		allowed, err := rules.Evaluate(*col.ListRule, evalCtx)
-		if !allowed || err != nil {
+	params := h.parseQueryParams(r)
+
+	// The list rule is pushed down into SQL so each caller only sees (and
+	// counts) the rows they are permitted to see. A role grant lifts it.
+	if col.ListRule != nil && *col.ListRule != "" && !h.granted(r, collectionName, models.ActionList) {
+		evalCtx := service.GetEvaluationContext(r, h.recordService.Lookup(), collectionName, nil)
+		clause, args, err := rules.ToSQL(*col.ListRule, evalCtx, col)
+		if err != nil {
 			errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to list this collection"))
 			return
 		}
+		params.RuleFilter = clause
+		params.RuleArgs = args
 	}
 
-	params := h.parseQueryParams(r)
 	records, total, err := h.recordService.ListRecords(r.Context(), collectionName, params)
 	if err != nil {
 		errors.SendError(w, err)
@@ -51,7 +67,7 @@ func (h *CollectionHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, record := range records {
-		if collectionName == "users" {
+		if hasPassword(col) {
 			record.HideField("password")
 		}
 	}
@@ -72,6 +88,9 @@ func (h *CollectionHandler) View(w http.ResponseWriter, r *http.Request) {
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if !inScope(w, r, collectionName, models.ActionView) {
+		return
+	}
 
 	record, err := h.recordService.FindRecordByID(r.Context(), collectionName, id)
 	if err != nil {
@@ -79,17 +98,18 @@ func (h *CollectionHandler) View(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Rule Check
-	if col.ViewRule != nil && *col.ViewRule != "" {
-		evalCtx := service.GetEvaluationContext(r, record.Data)
-		allowed, err := rules.Evaluate(*col.ViewRule, evalCtx)
-		if !allowed || err != nil {
-			errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to view this record"))
-			return
-		}
+	// Rule Check (evaluated in SQL against the stored row)
+	allowed, err := canView(r, h.recordService, h.roleService, col, record)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if !allowed {
+		errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to view this record"))
+		return
 	}
 
-	if collectionName == "users" {
+	if hasPassword(col) {
 		record.HideField("password")
 	}
 
@@ -104,16 +124,33 @@ func (h *CollectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if !inScope(w, r, collectionName, models.ActionCreate) {
+		return
+	}
 
-	var data map[string]any
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
+	data, uploads, err := h.decodeRecord(w, r, col)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	if err := h.checkRolesField(r, col, data); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if err := h.checkVerifiedField(r, col, data); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	files, err := h.fileService.Prepare(col, nil, data, uploads)
+	if err != nil {
+		errors.SendError(w, err)
 		return
 	}
 
 	// Rule Check (Pre-create check)
-	if col.CreateRule != nil && *col.CreateRule != "" {
-		evalCtx := service.GetEvaluationContext(r, nil)
+	if col.CreateRule != nil && *col.CreateRule != "" && !h.granted(r, collectionName, models.ActionCreate) {
+		evalCtx := service.GetEvaluationContext(r, h.recordService.Lookup(), collectionName, nil)
 		evalCtx.Data = data // Inject incoming data
 		allowed, err := rules.Evaluate(*col.CreateRule, evalCtx)
 		if !allowed || err != nil {
@@ -127,13 +164,21 @@ func (h *CollectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, err := h.recordService.CreateRecord(r.Context(), collectionName, data)
+	// The files are stored first, under the ID the record is created with.
+	id := uuid.New().String()
+	if err := h.fileService.Save(r.Context(), collectionName, id, uploadOwner(r), files); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	record, err := h.recordService.CreateRecordWithID(r.Context(), collectionName, id, data)
 	if err != nil {
+		h.fileService.Discard(r.Context(), collectionName, id, files)
 		errors.SendError(w, err)
 		return
 	}
 
-	if collectionName == "users" {
+	if hasPassword(col) {
 		record.HideField("password")
 	}
 
@@ -149,10 +194,13 @@ func (h *CollectionHandler) Update(w http.ResponseWriter, r *http.Request) {
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if !inScope(w, r, collectionName, models.ActionUpdate) {
+		return
+	}
 
-	var data map[string]any
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
+	data, uploads, err := h.decodeRecord(w, r, col)
+	if err != nil {
+		errors.SendError(w, err)
 		return
 	}
 
@@ -163,24 +211,47 @@ func (h *CollectionHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.checkRolesField(r, col, data); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if err := h.checkVerifiedField(r, col, data); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	files, err := h.fileService.Prepare(col, existing, data, uploads)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
 	// Rule Check
-	if col.UpdateRule != nil && *col.UpdateRule != "" {
-		evalCtx := service.GetEvaluationContext(r, existing.Data)
-		evalCtx.Data = data
-		allowed, err := rules.Evaluate(*col.UpdateRule, evalCtx)
-		if !allowed || err != nil {
-			errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to update this record"))
-			return
+	if !canUpdate(r, h.recordService, h.roleService, col, existing, data) {
+		errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to update this record"))
+		return
+	}
+
+	// A changed email must be verified again.
+	if email, ok := data["email"].(string); ok && col.Type == models.CollectionTypeAuth && email != existing.GetString("email") {
+		if _, set := data["verified"]; !set {
+			data["verified"] = false
 		}
 	}
 
+	if err := h.fileService.Save(r.Context(), collectionName, id, uploadOwner(r), files); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
 	record, err := h.recordService.UpdateRecord(r.Context(), collectionName, id, data)
 	if err != nil {
+		h.fileService.Discard(r.Context(), collectionName, id, files)
 		errors.SendError(w, err)
 		return
 	}
+	h.fileService.Commit(r.Context(), collectionName, id, files)
 
-	if collectionName == "users" {
+	if hasPassword(col) {
 		record.HideField("password")
 	}
 
@@ -196,6 +267,9 @@ func (h *CollectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if !inScope(w, r, collectionName, models.ActionDelete) {
+		return
+	}
 
 	// Fetch current for rule evaluation
 	existing, err := h.recordService.FindRecordByID(r.Context(), collectionName, id)
@@ -205,8 +279,8 @@ func (h *CollectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Rule Check
-	if col.DeleteRule != nil && *col.DeleteRule != "" {
-		evalCtx := service.GetEvaluationContext(r, existing.Data)
+	if col.DeleteRule != nil && *col.DeleteRule != "" && !h.granted(r, collectionName, models.ActionDelete) {
+		evalCtx := service.GetEvaluationContext(r, h.recordService.Lookup(), collectionName, existing.Values())
 		allowed, err := rules.Evaluate(*col.DeleteRule, evalCtx)
 		if !allowed || err != nil {
 			errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to delete this record"))
@@ -218,6 +292,7 @@ func (h *CollectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		errors.SendError(w, err)
 		return
 	}
+	h.fileService.DeleteRecordFiles(r.Context(), col, id)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -229,6 +304,9 @@ func (h *CollectionHandler) BatchDelete(w http.ResponseWriter, r *http.Request)
 		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
 		return
 	}
+	if !inScope(w, r, collectionName, models.ActionDelete) {
+		return
+	}
 
 	var req struct {
 		IDs []string `json:"ids"`
@@ -243,6 +321,7 @@ func (h *CollectionHandler) BatchDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	granted := h.granted(r, collectionName, models.ActionDelete)
 	for _, id := range req.IDs {
 		// Fetch current for rule evaluation
 		existing, err := h.recordService.FindRecordByID(r.Context(), collectionName, id)
@@ -251,15 +330,17 @@ func (h *CollectionHandler) BatchDelete(w http.ResponseWriter, r *http.Request)
 		}
 
 		// Rule Check
-		if col.DeleteRule != nil && *col.DeleteRule != "" {
-			evalCtx := service.GetEvaluationContext(r, existing.Data)
+		if col.DeleteRule != nil && *col.DeleteRule != "" && !granted {
+			evalCtx := service.GetEvaluationContext(r, h.recordService.Lookup(), collectionName, existing.Values())
 			allowed, err := rules.Evaluate(*col.DeleteRule, evalCtx)
 			if !allowed || err != nil {
 				continue // Skip if forbidden
 			}
 		}
 
-		_ = h.recordService.DeleteRecord(r.Context(), collectionName, id)
+		if err := h.recordService.DeleteRecord(r.Context(), collectionName, id); err == nil {
+			h.fileService.DeleteRecordFiles(r.Context(), col, id)
+		}
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -279,3 +360,173 @@ func (h *CollectionHandler) parseQueryParams(r *http.Request) db.QueryParams {
 		Expand:  q.Get("expand"),
 	}
 }
+
+// hasPassword reports whether records of the collection carry a password hash
+// that must never be returned to clients.
+func hasPassword(col *models.Collection) bool {
+	return col.Type == models.CollectionTypeAuth || col.Name == models.AdminsCollection
+}
+
+// inScope rejects requests made with an API key whose scopes do not cover
+// the action on the collection.
+func inScope(w http.ResponseWriter, r *http.Request, collection, action string) bool {
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if !ok || claims == nil || claims.Allows(collection, action) {
+		return true
+	}
+	errors.SendError(w, errors.NewError(http.StatusForbidden, "API_KEY_SCOPE_DENIED", "The API key is not scoped for this action").WithDetails(map[string]any{
+		"scope": collection + ":" + action,
+	}))
+	return false
+}
+
+// granted reports whether the caller's roles grant the action on the
+// collection, in which case the collection's API rule is not applied.
+func (h *CollectionHandler) granted(r *http.Request, collection, action string) bool {
+	return roleGranted(r, h.roleService, collection, action)
+}
+
+func roleGranted(r *http.Request, roles *service.RoleService, collection, action string) bool {
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if !ok || claims == nil || roles == nil {
+		return false
+	}
+	return roles.CanAccess(r.Context(), claims, collection, action)
+}
+
+// canView reports whether the caller may view the record: the collection's
+// view rule, evaluated in SQL against the stored row, must match it unless
+// the caller's roles grant the view action.
+func canView(r *http.Request, records *service.RecordService, roles *service.RoleService, col *models.Collection, record *models.Record) (bool, error) {
+	if col.ViewRule == nil || *col.ViewRule == "" || roleGranted(r, roles, col.Name, models.ActionView) {
+		return true, nil
+	}
+	evalCtx := service.GetEvaluationContext(r, records.Lookup(), col.Name, record.Values())
+	clause, args, err := rules.ToSQL(*col.ViewRule, evalCtx, col)
+	if err != nil {
+		return false, nil
+	}
+	if clause == "" {
+		return true, nil
+	}
+	_, total, err := records.ListRecords(r.Context(), col.Name, db.QueryParams{
+		Filter:     "id = " + db.QuoteFilterValue(record.ID),
+		PerPage:    1,
+		RuleFilter: clause,
+		RuleArgs:   args,
+	})
+	if err != nil {
+		return false, err
+	}
+	return total > 0, nil
+}
+
+// canUpdate reports whether the caller may write data to the record: the
+// collection's update rule must allow it unless the caller's roles grant the
+// update action.
+func canUpdate(r *http.Request, records *service.RecordService, roles *service.RoleService, col *models.Collection, record *models.Record, data map[string]any) bool {
+	if col.UpdateRule == nil || *col.UpdateRule == "" || roleGranted(r, roles, col.Name, models.ActionUpdate) {
+		return true
+	}
+	evalCtx := service.GetEvaluationContext(r, records.Lookup(), col.Name, record.Values())
+	evalCtx.Data = data
+	allowed, err := rules.Evaluate(*col.UpdateRule, evalCtx)
+	return allowed && err == nil
+}
+
+// decodeRecord reads a record's data from a JSON or a multipart/form-data
+// body. Multipart bodies carry the data as form values, converted to the
+// collection's field types, and files for its file fields.
+func (h *CollectionHandler) decodeRecord(w http.ResponseWriter, r *http.Request, col *models.Collection) (map[string]any, map[string][]*multipart.FileHeader, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+		var data map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			return nil, nil, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body")
+		}
+		return data, nil, nil
+	}
+
+	// Allow each file field its largest files, plus room for the values.
+	limit := int64(1 << 20)
+	for i := range col.Fields {
+		if field := &col.Fields[i]; field.Type == models.FieldTypeFile {
+			limit += h.fileService.MaxSize(field) * int64(max(field.FileOptions().MaxSelect, 1))
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			return nil, nil, errors.NewError(http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", "Request body exceeds maximum allowed size")
+		}
+		return nil, nil, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body")
+	}
+
+	data := make(map[string]any)
+	for name, values := range r.MultipartForm.Value {
+		if len(values) > 0 {
+			data[name] = formValue(col, name, values)
+		}
+	}
+	return data, r.MultipartForm.File, nil
+}
+
+// multipartMemory is how much of a multipart body is held in memory; larger
+// files are spooled to disk.
+const multipartMemory = 32 << 20
+
+// formValue converts a form value to the type of the collection's field.
+// Values that do not parse are kept as strings for validation to report.
+func formValue(col *models.Collection, name string, values []string) any {
+	value := values[0]
+	for _, field := range col.Fields {
+		if field.Name != name {
+			continue
+		}
+		switch field.Type {
+		case models.FieldTypeNumber:
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				return n
+			}
+		case models.FieldTypeBool:
+			if b, err := strconv.ParseBool(value); err == nil {
+				return b
+			}
+		case models.FieldTypeFile:
+			// Repeated values list the files to keep.
+			names := make([]string, 0, len(values))
+			for _, v := range values {
+				if v != "" {
+					names = append(names, v)
+				}
+			}
+			return names
+		}
+	}
+	return value
+}
+
+// checkRolesField rejects writes to an auth record's roles unless the caller
+// may manage roles, so users cannot grant themselves access.
+func (h *CollectionHandler) checkRolesField(r *http.Request, col *models.Collection, data map[string]any) error {
+	if _, ok := data["roles"]; !ok || col.Type != models.CollectionTypeAuth {
+		return nil
+	}
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if ok && claims != nil && h.roleService != nil && h.roleService.HasPermission(r.Context(), claims, models.PermissionRolesManage) {
+		return nil
+	}
+	return errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to assign roles")
+}
+
+// checkVerifiedField rejects writes to an auth record's verified flag unless
+// the caller is an admin; records are otherwise verified by email only.
+func (h *CollectionHandler) checkVerifiedField(r *http.Request, col *models.Collection, data map[string]any) error {
+	if _, ok := data["verified"]; !ok || col.Type != models.CollectionTypeAuth {
+		return nil
+	}
+	if claims, ok := core.GetAuth(r.Context()).(*auth.Claims); ok && claims.IsAdmin() {
+		return nil
+	}
+	return errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to change verification")
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestRoleGrants(t *testing.T) {
+	ctx := context.Background()
+	adminOnly := "@request.auth.collection = '_admins'"
+	posts := &models.Collection{Name: "posts", Type: models.CollectionTypeBase, ListRule: &adminOnly, ViewRule: &adminOnly,
+		Fields: []models.Field{{Name: "title", Type: models.FieldTypeText}}}
+	api := newTestAPI(t, posts)
+	h := NewCollectionHandler(api.records, api.roles, api.files, api.registry)
+
+	if _, err := api.roles.CreateRole(ctx, &models.Role{Name: "bad", Collections: map[string][]string{models.AdminsCollection: {"list"}}}); errorCode(err) != "INVALID_ROLE" {
+		t.Errorf("expected a system collection grant to be rejected, got %v", err)
+	}
+	if _, err := api.roles.CreateRole(ctx, &models.Role{Name: "staff", Collections: map[string][]string{models.RoleWildcard: {models.RoleWildcard}}}); err != nil {
+		t.Fatal(err)
+	}
+	// A role stored before system collections were refused grants nothing
+	// on them either.
+	if _, err := api.records.CreateRecord(ctx, models.RolesCollection, map[string]any{
+		"name": "legacy", "collections": `{"_admins": ["*"]}`, "permissions": "[]",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.records.CreateRecord(ctx, "users", map[string]any{
+		"email": "u@x.io", "username": "u", "password": "password123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []string{"staff", "legacy"} {
+		if err := api.roles.AssignRole(ctx, "users", user.ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin, err := api.records.CreateRecord(ctx, models.AdminsCollection, map[string]any{
+		"email": "a@x.io", "username": "a", "password": "password123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := api.records.CreateRecord(ctx, "posts", map[string]any{"title": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &auth.Claims{RecordID: user.ID, Collection: "users", Type: auth.TokenTypeAuth}
+
+	// The wildcard grant lifts the rules of ordinary collections...
+	w := serve("GET /api/collections/{collection}/records/{id}", h.View, httptest.NewRequest("GET", "/api/collections/posts/records/"+post.ID, nil), claims)
+	if w.Code != 200 {
+		t.Errorf("expected the granted view to succeed, got %d %s", w.Code, w.Body)
+	}
+	// ...but never those of system collections.
+	for _, col := range []string{models.AdminsCollection, models.RolesCollection, models.MFACollection, models.APIKeysCollection, models.RefreshTokensCollection} {
+		w = serve("GET /api/collections/{collection}/records", h.List, httptest.NewRequest("GET", "/api/collections/"+col+"/records", nil), claims)
+		if body := decode(t, w); w.Code != 200 || body["totalItems"] != float64(0) {
+			t.Errorf("expected %s to list nothing, got %d %v", col, w.Code, body)
+		}
+	}
+	w = serve("GET /api/collections/{collection}/records/{id}", h.View, httptest.NewRequest("GET", "/api/collections/_admins/records/"+admin.ID, nil), claims)
+	if w.Code != 403 {
+		t.Errorf("expected viewing an admin to be forbidden, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestSystemCollectionSchema(t *testing.T) {
+	api := newTestAPI(t)
+	h := NewAdminHandler(api.collections, api.files, nil)
+	claims := &auth.Claims{RecordID: "u1", Collection: "users", Type: auth.TokenTypeAuth}
+	adminsID := ""
+	if col, ok := api.registry.GetCollection(models.AdminsCollection); ok {
+		adminsID = col.ID
+	}
+
+	// Opening _admins to everyone would let anyone create an admin.
+	open := `{"name": "_admins", "type": "auth", "create_rule": ""}`
+	requests := []struct {
+		pattern string
+		handler http.HandlerFunc
+		r       *http.Request
+	}{
+		{"POST /api/admin/collections", h.CreateCollection, httptest.NewRequest("POST", "/api/admin/collections", strings.NewReader(open))},
+		{"PATCH /api/admin/collections/{id}", h.UpdateCollection, httptest.NewRequest("PATCH", "/api/admin/collections/"+adminsID, strings.NewReader(open))},
+		{"PATCH /api/admin/collections/{id}", h.UpdateCollection, httptest.NewRequest("PATCH", "/api/admin/collections/"+adminsID, strings.NewReader(`{"name": "renamed"}`))},
+		{"DELETE /api/admin/collections/{name}", h.DeleteCollection, httptest.NewRequest("DELETE", "/api/admin/collections/_roles", nil)},
+	}
+	for _, req := range requests {
+		if w := serve(req.pattern, req.handler, req.r, claims); w.Code != 403 {
+			t.Errorf("%s: expected 403, got %d %s", req.r.URL, w.Code, w.Body)
+		}
+	}
+	if col, ok := api.registry.GetCollection(models.AdminsCollection); !ok || col.CreateRule == nil || *col.CreateRule == "" {
+		t.Errorf("expected _admins to keep its rules, got %+v", col)
+	}
+	if _, ok := api.registry.GetCollection(models.RolesCollection); !ok {
+		t.Error("expected _roles to remain")
+	}
+
+	// Other collections stay open to the collections.write permission.
+	w := serve("POST /api/admin/collections", h.CreateCollection, httptest.NewRequest("POST", "/api/admin/collections", strings.NewReader(`{"name": "notes", "type": "base"}`)), claims)
+	if w.Code != 201 {
+		t.Errorf("expected an ordinary collection to be created, got %d %s", w.Code, w.Body)
+	}
+	// Admins may still change system collections.
+	admin := &auth.Claims{RecordID: "a1", Collection: models.AdminsCollection, Type: auth.TokenTypeAdmin}
+	w = serve("DELETE /api/admin/collections/{name}", h.DeleteCollection, httptest.NewRequest("DELETE", "/api/admin/collections/_quarantine", nil), admin)
+	if w.Code != 200 {
+		t.Errorf("expected an admin to delete a system collection, got %d %s", w.Code, w.Body)
+	}
+}
@@ -3,24 +3,42 @@ package api
 import (
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/google/uuid"
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
 	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
 	"github.com/zulfikawr/vault/internal/storage"
 )
 
 type FileHandler struct {
 	storage       storage.Storage
-	maxUploadSize int64
+	recordService *service.RecordService
+	roleService   *service.RoleService
+	fileService   *service.FileService
+	registry      *db.SchemaRegistry
+	config        *core.Config
+	tokenKey      []byte
 }
 
-func NewFileHandler(s storage.Storage, maxUploadSize int64) *FileHandler {
+func NewFileHandler(s storage.Storage, recordService *service.RecordService, roleService *service.RoleService, fileService *service.FileService, registry *db.SchemaRegistry, config *core.Config) *FileHandler {
 	return &FileHandler{
 		storage:       s,
-		maxUploadSize: maxUploadSize,
+		recordService: recordService,
+		roleService:   roleService,
+		fileService:   fileService,
+		registry:      registry,
+		config:        config,
+		tokenKey:      auth.FileTokenKey(config.JWTSecret),
 	}
 }
 
@@ -29,127 +47,297 @@ func (h *FileHandler) Serve(w http.ResponseWriter, r *http.Request) {
 	recordID := r.PathValue("id")
 	filename := r.PathValue("filename")
 
-	path := filepath.Join(collection, recordID, filename)
+	field, path, err := h.authorize(r, collection, recordID, filename)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	protected := field.FileOptions().Protected
 
-	file, err := h.storage.Retrieve(r.Context(), path)
+	info, err := h.storage.Stat(r.Context(), path)
 	if err != nil {
 		errors.SendError(w, err)
 		return
 	}
+	if info.IsDir {
+		errors.SendError(w, errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "File not found"))
+		return
+	}
+
+	// Thumbnails and converted images are served in place of the original.
+	if thumb, format := r.URL.Query().Get("thumb"), r.URL.Query().Get("format"); thumb != "" || format != "" {
+		transformed, err := h.fileService.Thumb(r.Context(), field, path, thumb, format)
+		if err != nil {
+			errors.SendError(w, err)
+			return
+		}
+		if transformed != path {
+			path = transformed
+			filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + filepath.Ext(path)
+			if info, err = h.storage.Stat(r.Context(), path); err != nil {
+				errors.SendError(w, err)
+				return
+			}
+		}
+	}
+
+	file := storage.NewSeeker(r.Context(), h.storage, path, info.Size)
 	defer errors.Defer(r.Context(), file.Close, "close file", "path", path)
 
 	// Read first 512 bytes for content type detection
 	buffer := make([]byte, 512)
-	n, _ := file.Read(buffer)
+	n, _ := io.ReadFull(file, buffer)
 	contentType := http.DetectContentType(buffer[:n])
 
 	// Reset file pointer
-	if seeker, ok := file.(io.Seeker); ok {
-		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
-			errors.Log(r.Context(), err, "seek file", "path", path)
-		}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		errors.Log(r.Context(), err, "seek file", "path", path)
 	}
 
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Cache-Control", "public, max-age=31536000")
-	if _, err := io.Copy(w, file); err != nil {
-		errors.Log(r.Context(), err, "copy file to response", "collection", collection, "file", filename)
+	w.Header().Set("Content-Disposition", contentDisposition(r, filename, contentType))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Clients revalidate with the ETag, which answers 304 while the file is
+	// unchanged.
+	if protected {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
 	}
+
+	// ServeContent answers Range, If-Range and the conditional headers.
+	http.ServeContent(w, r, filename, info.ModTime, file)
 }
 
-func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
-	// Enforce max upload size
-	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize)
-	if err := r.ParseMultipartForm(h.maxUploadSize); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusBadRequest, "FILE_TOO_LARGE", "File exceeds maximum allowed size"))
-		return
-	}
+// Token mints a short-lived token for a file, for URLs that cannot carry
+// credentials such as image and video sources.
+func (h *FileHandler) Token(w http.ResponseWriter, r *http.Request) {
+	collection := r.PathValue("collection")
+	recordID := r.PathValue("id")
+	filename := r.PathValue("filename")
 
-	file, header, err := r.FormFile("file")
+	col, record, _, path, err := h.find(r, collection, recordID, filename)
 	if err != nil {
-		errors.SendError(w, errors.NewError(http.StatusBadRequest, "FILE_REQUIRED", "No file provided"))
+		errors.SendError(w, err)
+		return
+	}
+	if err := h.checkView(r, col, record); err != nil {
+		errors.SendError(w, err)
 		return
 	}
-	defer errors.Defer(r.Context(), file.Close, "close uploaded file", "filename", header.Filename)
 
-	// Validate content type
-	buff := make([]byte, 512)
-	if _, err := file.Read(buff); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "FILE_READ_ERROR", "Failed to read file header"))
+	if _, err := h.storage.Stat(r.Context(), path); err != nil {
+		errors.SendError(w, err)
 		return
 	}
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "FILE_SEEK_ERROR", "Failed to seek file"))
+
+	expires := time.Now().Add(auth.FileTokenTTL)
+	token := auth.SignFileToken(h.tokenKey, path, expires)
+	SendJSON(w, http.StatusOK, map[string]any{
+		"token":   token,
+		"expires": expires.UTC().Format(time.RFC3339),
+		"url":     fmt.Sprintf("/api/files/%s/%s/%s?token=%s", url.PathEscape(collection), url.PathEscape(recordID), url.PathEscape(filename), url.QueryEscape(token)),
+	}, nil)
+}
+
+// authorize checks access to a file and returns the file field holding it
+// and its storage path. Files of protected fields need a valid file token or
+// a caller who may view the record; other files are public.
+func (h *FileHandler) authorize(r *http.Request, collection, recordID, filename string) (*models.Field, string, error) {
+	col, record, field, path, err := h.find(r, collection, recordID, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if !field.FileOptions().Protected {
+		return field, path, nil
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" && auth.VerifyFileToken(h.tokenKey, path, token, time.Now()) {
+		return field, path, nil
+	}
+	return field, path, h.checkView(r, col, record)
+}
+
+// find returns the collection, record and file field holding a file, and
+// its storage path, built from the names the record holds. Files of system
+// collections, names that could leave the record's directory and files no
+// field holds are not found.
+func (h *FileHandler) find(r *http.Request, collection, recordID, filename string) (*models.Collection, *models.Record, *models.Field, string, error) {
+	notFound := errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "File not found")
+	if models.IsSystemCollection(collection) || !validFilename(filename) {
+		return nil, nil, nil, "", notFound
+	}
+	col, ok := h.registry.GetCollection(collection)
+	if !ok {
+		return nil, nil, nil, "", notFound
+	}
+	record, err := h.recordService.FindRecordByID(r.Context(), col.Name, recordID)
+	if err != nil {
+		return nil, nil, nil, "", notFound
+	}
+	field := service.FileField(col, record, filename)
+	if field == nil {
+		return nil, nil, nil, "", notFound
+	}
+	return col, record, field, service.FilePath(col.Name, record.ID, filename), nil
+}
+
+// validFilename reports whether a file name stays within its record's
+// directory.
+func validFilename(filename string) bool {
+	return filename != "" && !strings.ContainsAny(filename, `/\`) && !strings.Contains(filename, "..")
+}
+
+// checkView requires an authenticated caller who may view the record.
+func (h *FileHandler) checkView(r *http.Request, col *models.Collection, record *models.Record) error {
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if !ok || claims == nil {
+		return errors.NewError(http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	}
+	if !claims.Allows(col.Name, models.ActionView) {
+		return errors.NewError(http.StatusForbidden, "API_KEY_SCOPE_DENIED", "The API key is not scoped for this action").WithDetails(map[string]any{
+			"scope": col.Name + ":" + models.ActionView,
+		})
+	}
+	allowed, err := canView(r, h.recordService, h.roleService, col, record)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to view this file")
+	}
+	return nil
+}
+
+// contentDisposition shows images inline, and sends other files, which a
+// browser could run scripts in, as attachments, as it does every file when
+// the download query parameter is set. A download value other than 1 or true
+// names the saved file.
+func contentDisposition(r *http.Request, filename, contentType string) string {
+	disposition := "inline"
+	if !strings.HasPrefix(contentType, "image/") {
+		disposition = "attachment"
+	}
+	if r.URL.Query().Has("download") {
+		disposition = "attachment"
+		if name := r.URL.Query().Get("download"); name != "" && name != "1" && name != "true" {
+			filename = filepath.Base(name)
+		}
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// Upload adds a file to a file field of an existing record, which the caller
+// must be allowed to update. The field may be omitted when the collection
+// has a single file field.
+func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize()+1<<20)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "FILE_TOO_LARGE", "File exceeds maximum allowed size"))
 		return
 	}
 
-	// Validate mime type
-	mimeType := http.DetectContentType(buff)
-	if isBlockedMimeType(mimeType) {
-		errors.SendError(w, errors.NewError(http.StatusBadRequest, "FILE_TYPE_NOT_ALLOWED", fmt.Sprintf("File type %s is not allowed", mimeType)))
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "FILE_REQUIRED", "No file provided"))
 		return
 	}
 
 	collection := r.FormValue("collection")
 	recordID := r.FormValue("recordID")
-	preserveName := r.FormValue("preserve_name") == "true"
-
 	if collection == "" || recordID == "" {
 		errors.SendError(w, errors.NewError(http.StatusBadRequest, "MISSING_PARAMS", "collection and recordID are required"))
 		return
 	}
 
-	// Generate a safe unique name or use original sanitized name
-	var safeName string
-	if preserveName {
-		// Basic sanitization: remove path traversal, special characters
-		safeName = sanitizeFileName(header.Filename)
-	} else {
-		ext := filepath.Ext(header.Filename)
-		safeName = fmt.Sprintf("%s%s", uuid.New().String(), ext)
+	col, ok := h.registry.GetCollection(collection)
+	if !ok {
+		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
+		return
+	}
+	if !inScope(w, r, collection, models.ActionUpdate) {
+		return
+	}
+	field := r.FormValue("field")
+	if field == "" {
+		field = soleFileField(col)
+	}
+	if field == "" {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(map[string]any{
+			"field": "name the file field to upload to",
+		}))
+		return
 	}
-	path := filepath.Join(collection, recordID, safeName)
 
-	if err := h.storage.Save(r.Context(), path, file); err != nil {
+	existing, err := h.recordService.FindRecordByID(r.Context(), collection, recordID)
+	if err != nil {
 		errors.SendError(w, err)
 		return
 	}
 
+	data := make(map[string]any)
+	changes, err := h.fileService.Prepare(col, existing, data, map[string][]*multipart.FileHeader{field: files[:1]})
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if !canUpdate(r, h.recordService, h.roleService, col, existing, data) {
+		errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to update this record"))
+		return
+	}
+
+	if err := h.fileService.Save(r.Context(), collection, recordID, uploadOwner(r), changes); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if _, err := h.recordService.UpdateRecord(r.Context(), collection, recordID, data); err != nil {
+		h.fileService.Discard(r.Context(), collection, recordID, changes)
+		errors.SendError(w, err)
+		return
+	}
+	h.fileService.Commit(r.Context(), collection, recordID, changes)
+
+	name := changes.Names()[0]
 	SendJSON(w, http.StatusCreated, map[string]any{
-		"name": safeName,
-		"size": header.Size,
-		"mime": header.Header.Get("Content-Type"),
-		"url":  fmt.Sprintf("/api/files/%s/%s/%s", collection, recordID, safeName),
+		"name":  name,
+		"field": field,
+		"size":  files[0].Size,
+		"mime":  files[0].Header.Get("Content-Type"),
+		"url":   fmt.Sprintf("/api/files/%s/%s/%s", collection, recordID, name),
 	}, nil)
 }
 
-func isBlockedMimeType(mimeType string) bool {
-	// Block potentially dangerous file types
-	blocked := map[string]bool{
-		"application/x-dosexec":    true, // Windows Executables
-		"application/x-msdownload": true, // DLLs, etc.
-		"application/x-sh":         true, // Shell scripts
-		"text/html":                true, // Prevent Stored XSS
-		"text/javascript":          true, // JS files
-	}
-	// Check exact match or prefix
-	if blocked[mimeType] {
-		return true
+// maxUploadSize is the largest file any file field accepts.
+func (h *FileHandler) maxUploadSize() int64 {
+	size := h.config.MaxFileUploadSize
+	for _, col := range h.registry.GetCollections() {
+		for i := range col.Fields {
+			if field := &col.Fields[i]; field.Type == models.FieldTypeFile {
+				size = max(size, h.fileService.MaxSize(field))
+			}
+		}
 	}
-	return false
+	return size
 }
 
-func sanitizeFileName(name string) string {
-	name = filepath.Base(name)
-	name = strings.ReplaceAll(name, "..", "")
-	// Remove non-alphanumeric (keep ., -, _)
-	var result strings.Builder
-	for _, r := range name {
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
-			result.WriteRune(r)
-		} else {
-			result.WriteRune('_')
+// soleFileField returns the name of the collection's only file field, or ""
+// when it has none or several.
+func soleFileField(col *models.Collection) string {
+	name := ""
+	for _, field := range col.Fields {
+		if field.Type != models.FieldTypeFile {
+			continue
+		}
+		if name != "" {
+			return ""
 		}
+		name = field.Name
 	}
-	return result.String()
+	return name
 }
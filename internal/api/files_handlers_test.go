@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestServeFile(t *testing.T) {
+	ctx := context.Background()
+	adminOnly := "@request.auth.collection = '_admins'"
+	docs := &models.Collection{Name: "docs", Type: models.CollectionTypeBase, ViewRule: &adminOnly, Fields: []models.Field{
+		{Name: "secret", Type: models.FieldTypeFile, Options: map[string]any{"protected": true}},
+	}}
+	posts := &models.Collection{Name: "posts", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "cover", Type: models.FieldTypeFile},
+	}}
+	api := newTestAPI(t, docs, posts)
+	h := NewFileHandler(api.store, api.records, api.roles, api.files, api.registry, api.config)
+	for path, content := range map[string]string{
+		"docs/rec1/secret.txt": "secret",
+		"posts/rec2/cover.txt": "cover",
+		"posts/rec2/stray.txt": "stray",
+		"posts/rec3/cover.png": "\x89PNG\r\n\x1a\n",
+		"_uploads/up1/chunk_0": "chunk",
+		"_quarantine/q1":       "quarantined",
+	} {
+		if err := api.store.Save(ctx, path, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := api.records.CreateRecordWithID(ctx, "docs", "rec1", map[string]any{"secret": "secret.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.records.CreateRecordWithID(ctx, "posts", "rec2", map[string]any{"cover": "cover.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.records.CreateRecordWithID(ctx, "posts", "rec3", map[string]any{"cover": "cover.png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string) (int, string) {
+		t.Helper()
+		w := serve("GET /api/files/{collection}/{id}/{filename}", h.Serve, httptest.NewRequest("GET", target, nil), nil)
+		return w.Code, w.Body.String()
+	}
+
+	w := serve("GET /api/files/{collection}/{id}/{filename}", h.Serve, httptest.NewRequest("GET", "/api/files/posts/rec2/cover.txt", nil), nil)
+	if w.Code != 200 || w.Body.String() != "cover" {
+		t.Errorf("expected the public file, got %d %q", w.Code, w.Body)
+	}
+	// Only images are shown inline.
+	if disposition := w.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected a text file to be sent as an attachment, got %q", disposition)
+	}
+	w = serve("GET /api/files/{collection}/{id}/{filename}", h.Serve, httptest.NewRequest("GET", "/api/files/posts/rec3/cover.png", nil), nil)
+	if disposition := w.Header().Get("Content-Disposition"); w.Code != 200 || !strings.HasPrefix(disposition, "inline") {
+		t.Errorf("expected an image to be shown inline, got %d %q", w.Code, disposition)
+	}
+	if code, _ := get("/api/files/docs/rec1/secret.txt"); code != 401 {
+		t.Errorf("expected the protected file to need authentication, got %d", code)
+	}
+	token := auth.SignFileToken(auth.FileTokenKey(api.config.JWTSecret), "docs/rec1/secret.txt", time.Now().Add(time.Minute))
+	if code, body := get("/api/files/docs/rec1/secret.txt?token=" + token); code != 200 || body != "secret" {
+		t.Errorf("expected the file token to grant access, got %d %q", code, body)
+	}
+
+	for _, target := range []string{
+		// Escaped separators cannot reach the files of another record...
+		"/api/files/posts/rec2/..%2F..%2Fdocs%2Frec1%2Fsecret.txt",
+		"/api/files/posts/rec2/..%5C..%5Cdocs%5Crec1%5Csecret.txt",
+		// ...nor files of a missing record or collection...
+		"/api/files/posts/missing/..%2F..%2Fdocs%2Frec1%2Fsecret.txt",
+		"/api/files/missing/rec2/cover.txt",
+		// ...nor system collections...
+		"/api/files/_uploads/up1/chunk_0",
+		"/api/files/_quarantine/q1/q1",
+		// ...nor files no field of the record holds.
+		"/api/files/posts/rec2/stray.txt",
+	} {
+		if code, _ := get(target); code != 404 {
+			t.Errorf("%s: expected 404, got %d", target, code)
+		}
+	}
+}
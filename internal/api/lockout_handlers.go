@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+type LockoutHandler struct {
+	lockoutService *service.LockoutService
+}
+
+func NewLockoutHandler(lockoutService *service.LockoutService) *LockoutHandler {
+	return &LockoutHandler{lockoutService: lockoutService}
+}
+
+// List returns the failed-login counters. With ?locked=true only counters
+// that currently block logins are returned.
+func (h *LockoutHandler) List(w http.ResponseWriter, r *http.Request) {
+	attempts, err := h.lockoutService.List(r.Context(), r.URL.Query().Get("locked") == "true")
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, attempts, nil)
+}
+
+// Clear deletes a failed-login counter, lifting its lockout.
+func (h *LockoutHandler) Clear(w http.ResponseWriter, r *http.Request) {
+	if err := h.lockoutService.Clear(r.Context(), r.PathValue("id")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
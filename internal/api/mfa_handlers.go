@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+type mfaRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// AuthWithMFA completes a login that returned an MFA challenge, with a code
+// from the authenticator or a recovery code. A record that enrolled during
+// the challenge is activated here and its recovery codes are returned in
+// the response meta.
+func (h *AuthHandler) AuthWithMFA(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+
+	record, recoveryCodes, err := h.mfaService.CompleteChallenge(r.Context(), col.Name, req.MFAToken, req.Code, req.RecoveryCode)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	var meta map[string]any
+	if recoveryCodes != nil {
+		meta = map[string]any{"recovery_codes": recoveryCodes}
+	}
+	h.signIn(w, r, col.Name, record, meta)
+}
+
+// MFAStatus returns the MFA setup of the authenticated record.
+func (h *AuthHandler) MFAStatus(w http.ResponseWriter, r *http.Request) {
+	record, ok := h.mfaRecord(w, r, "")
+	if !ok {
+		return
+	}
+
+	status, err := h.mfaService.Status(r.Context(), record)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, status, nil)
+}
+
+// EnrollMFA returns a new TOTP secret and its provisioning URI. Records that
+// must enroll before their first MFA login authorize with the mfa_token of
+// the challenge instead of a token.
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	record, ok := h.mfaRecord(w, r, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(r.Context(), record)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, enrollment, nil)
+}
+
+// ActivateMFA confirms the enrollment with a code and returns the recovery
+// codes.
+func (h *AuthHandler) ActivateMFA(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	record, ok := h.mfaRecord(w, r, "")
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfaService.Activate(r.Context(), record, req.Code)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, map[string]any{"recovery_codes": codes}, nil)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the authenticated
+// record.
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	record, ok := h.mfaRecord(w, r, "")
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), record, req.Code)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, map[string]any{"recovery_codes": codes}, nil)
+}
+
+// DisableMFA turns MFA off for the authenticated record.
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFARequest(w, r)
+	if !ok {
+		return
+	}
+	record, ok := h.mfaRecord(w, r, "")
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), record, req.Code, req.RecoveryCode); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mfaRecord resolves the record whose MFA is managed: the record of the
+// challenge when mfaToken is given, otherwise the authenticated record.
+func (h *AuthHandler) mfaRecord(w http.ResponseWriter, r *http.Request, mfaToken string) (*models.Record, bool) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if mfaToken != "" {
+		record, err := h.mfaService.ChallengeRecord(r.Context(), col.Name, mfaToken)
+		if err != nil {
+			errors.SendError(w, err)
+			return nil, false
+		}
+		return record, true
+	}
+
+	claims, ok := ownClaims(w, r, "You can only manage your own MFA")
+	if !ok {
+		return nil, false
+	}
+	record, err := h.recordService.FindRecordByID(r.Context(), col.Name, claims.RecordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return nil, false
+	}
+	return record, true
+}
+
+func decodeMFARequest(w http.ResponseWriter, r *http.Request) (*mfaRequest, bool) {
+	var req mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return nil, false
+	}
+	return &req, true
+}
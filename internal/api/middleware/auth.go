@@ -1,25 +1,64 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/errors"
 )
 
-func AuthMiddleware(secret string) Middleware {
+// APIKeyResolver resolves the claims of an API key presented by a client.
+type APIKeyResolver interface {
+	Resolve(ctx context.Context, key, ip string) (*auth.Claims, error)
+}
+
+// CookieSessionResolver resolves the claims of a session cookie.
+type CookieSessionResolver interface {
+	ResolveCookie(ctx context.Context, token string) (*auth.Claims, error)
+}
+
+// SessionCookieName is the HttpOnly cookie holding a dashboard session.
+const SessionCookieName = "vault_session"
+
+// AuthMiddleware authenticates requests carrying a bearer token or, when
+// apiKeys is set, an API key in the X-API-Key header. Without either header,
+// a session cookie is resolved through sessions when set.
+func AuthMiddleware(keys *auth.KeySet, apiKeys APIKeyResolver, sessions CookieSessionResolver) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := r.Header.Get(auth.APIKeyHeader); apiKey != "" && apiKeys != nil {
+				claims, err := apiKeys.Resolve(r.Context(), apiKey, ClientIP(r))
+				if err != nil {
+					errors.SendError(w, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(core.WithAuth(r.Context(), claims)))
+				return
+			}
+
 			tokenStr := r.Header.Get("Authorization")
 			if len(tokenStr) > 7 && tokenStr[:7] == "Bearer " {
 				tokenStr = tokenStr[7:]
+			} else if cookie, err := r.Cookie(SessionCookieName); err == nil && tokenStr == "" && sessions != nil {
+				claims, err := sessions.ResolveCookie(r.Context(), cookie.Value)
+				if err != nil {
+					// A stale cookie leaves the request anonymous, so that
+					// the dashboard can still load its login page.
+					ClearSessionCookie(w, r)
+					next.ServeHTTP(w, r)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(core.WithAuth(r.Context(), claims)))
+				return
 			} else {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			claims, err := auth.ValidateToken(r.Context(), tokenStr, secret)
+			claims, err := auth.ValidateToken(r.Context(), tokenStr, keys)
 			if err != nil {
 				errors.SendError(w, err)
 				return
@@ -40,8 +79,7 @@ func AdminOnly(next http.Handler) http.Handler {
 			return
 		}
 
-		// Simple rule: any user in 'users' collection is admin for this prototype
-		if claims.Collection != "users" {
+		if !claims.IsAdmin() {
 			errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "Admin access required"))
 			return
 		}
@@ -49,3 +87,63 @@ func AdminOnly(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// PermissionChecker resolves the admin API permissions granted to an
+// authenticated record through its roles.
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, claims *auth.Claims, permission string) bool
+}
+
+// RequirePermission allows admins and records whose roles grant the given
+// permission.
+func RequirePermission(checker PermissionChecker, permission string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authClaims := core.GetAuth(r.Context())
+			claims, ok := authClaims.(*auth.Claims)
+			if !ok || claims == nil {
+				errors.SendError(w, errors.NewError(http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required"))
+				return
+			}
+
+			if claims.IsAPIKey() {
+				errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "API keys cannot access the admin API"))
+				return
+			}
+
+			if !claims.IsAdmin() && !checker.HasPermission(r.Context(), claims, permission) {
+				errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "Missing permission: "+permission).WithDetails(map[string]any{"permission": permission}))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetSessionCookie stores a session token in an HttpOnly cookie that
+// expires with the session.
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   IsSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookie removes the session cookie from the browser.
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   IsSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -1,11 +1,16 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/models"
 )
 
 func TestRequestIDMiddleware(t *testing.T) {
@@ -53,3 +58,242 @@ func TestChain(t *testing.T) {
 		t.Errorf("unexpected chain order: %v", calls)
 	}
 }
+
+func TestAdminOnly(t *testing.T) {
+	handler := AdminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		claims   *auth.Claims
+		expected int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", &auth.Claims{RecordID: "u1", Collection: "users", Type: auth.TokenTypeAuth}, http.StatusForbidden},
+		{"user claiming admin type", &auth.Claims{RecordID: "u1", Collection: "users", Type: auth.TokenTypeAdmin}, http.StatusForbidden},
+		{"admin", &auth.Claims{RecordID: "a1", Collection: models.AdminsCollection, Type: auth.TokenTypeAdmin}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.claims != nil {
+			req = req.WithContext(core.WithAuth(req.Context(), tt.claims))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
+
+type fakeChecker map[string]bool
+
+func (f fakeChecker) HasPermission(ctx context.Context, claims *auth.Claims, permission string) bool {
+	return f[claims.RecordID+":"+permission]
+}
+
+func TestRequirePermission(t *testing.T) {
+	checker := fakeChecker{"support:logs.read": true}
+	handler := RequirePermission(checker, "query.execute")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	logsHandler := RequirePermission(checker, "logs.read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	support := &auth.Claims{RecordID: "support", Collection: "users", Type: auth.TokenTypeAuth}
+	admin := &auth.Claims{RecordID: "a1", Collection: models.AdminsCollection, Type: auth.TokenTypeAdmin}
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		claims   *auth.Claims
+		expected int
+	}{
+		{"anonymous", handler, nil, http.StatusUnauthorized},
+		{"support without permission", handler, support, http.StatusForbidden},
+		{"support with permission", logsHandler, support, http.StatusOK},
+		{"admin", handler, admin, http.StatusOK},
+		{"api key", logsHandler, &auth.Claims{RecordID: "support", Collection: "users", Type: auth.TokenTypeAPIKey}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.claims != nil {
+			req = req.WithContext(core.WithAuth(req.Context(), tt.claims))
+		}
+		w := httptest.NewRecorder()
+		tt.handler.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
+
+type fakeResolver map[string]*auth.Claims
+
+func (f fakeResolver) Resolve(ctx context.Context, key, ip string) (*auth.Claims, error) {
+	if claims, ok := f[key]; ok {
+		return claims, nil
+	}
+	return nil, fmt.Errorf("invalid api key")
+}
+
+func TestAuthMiddlewareAPIKey(t *testing.T) {
+	resolver := fakeResolver{"vk_valid": {RecordID: "bot", Collection: "users", Type: auth.TokenTypeAPIKey, Scopes: []string{"posts:list"}}}
+	var seen *auth.Claims
+	handler := AuthMiddleware(nil, resolver, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = core.GetAuth(r.Context()).(*auth.Claims)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(auth.APIKeyHeader, "vk_valid")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || seen == nil || !seen.IsAPIKey() {
+		t.Fatalf("expected the key to authenticate, got %d", w.Code)
+	}
+	if !seen.Allows("posts", "list") || seen.Allows("posts", "delete") || seen.Allows("users", "list") {
+		t.Errorf("unexpected scopes %v", seen.Scopes)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(auth.APIKeyHeader, "vk_unknown")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Error("expected an unknown key to be rejected")
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	handler := CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	token, err := CSRFToken(w, httptest.NewRequest("GET", "/api/csrf-token", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := w.Result().Cookies()[0]
+	session := &http.Cookie{Name: "vault_session", Value: "s1"}
+
+	tests := []struct {
+		name     string
+		method   string
+		cookies  []*http.Cookie
+		headers  map[string]string
+		expected int
+	}{
+		{"safe method", "GET", []*http.Cookie{session}, nil, http.StatusOK},
+		{"no cookies", "POST", nil, nil, http.StatusOK},
+		{"bearer token", "POST", []*http.Cookie{session}, map[string]string{"Authorization": "Bearer t"}, http.StatusOK},
+		{"api key", "POST", []*http.Cookie{session}, map[string]string{auth.APIKeyHeader: "vk_1"}, http.StatusOK},
+		{"missing token", "POST", []*http.Cookie{session, cookie}, nil, http.StatusForbidden},
+		{"token without cookie", "POST", []*http.Cookie{session}, map[string]string{CSRFHeader: token}, http.StatusForbidden},
+		{"wrong token", "DELETE", []*http.Cookie{session, cookie}, map[string]string{CSRFHeader: strings.Repeat("0", 64)}, http.StatusForbidden},
+		{"matching token", "PATCH", []*http.Cookie{session, cookie}, map[string]string{CSRFHeader: token}, http.StatusOK},
+		{"form token", "POST", []*http.Cookie{session, cookie}, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		// The body is never read, even when it holds the token.
+		req := httptest.NewRequest(tt.method, "/", strings.NewReader("csrf_token="+token))
+		for _, c := range tt.cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+
+	// An existing cookie is reused.
+	req := httptest.NewRequest("GET", "/api/csrf-token", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	if again, _ := CSRFToken(w, req); again != token || len(w.Result().Cookies()) != 0 {
+		t.Error("expected the existing token to be reused")
+	}
+}
+
+type fakeSessions map[string]*auth.Claims
+
+func (f fakeSessions) ResolveCookie(ctx context.Context, token string) (*auth.Claims, error) {
+	if claims, ok := f[token]; ok {
+		return claims, nil
+	}
+	return nil, fmt.Errorf("invalid session")
+}
+
+func TestAuthMiddlewareSessionCookie(t *testing.T) {
+	sessions := fakeSessions{"s1": {RecordID: "a1", Collection: models.AdminsCollection, Type: auth.TokenTypeAdmin}}
+	var seen *auth.Claims
+	handler := AuthMiddleware(nil, nil, sessions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = core.GetAuth(r.Context()).(*auth.Claims)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "s1"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || seen == nil || !seen.IsAdmin() {
+		t.Fatalf("expected the cookie to authenticate, got %d", w.Code)
+	}
+
+	// A stale cookie is cleared and the request stays anonymous.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "stale"})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || seen != nil || len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected a stale cookie to be cleared, got %d %v", w.Code, cookies)
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("expected an invalid proxy to be rejected")
+	}
+
+	tests := []struct {
+		name, remote, forwarded, ip string
+	}{
+		{"direct", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"spoofed without a proxy", "203.0.113.7:5000", "1.2.3.4", "203.0.113.7"},
+		{"through a proxy", "10.0.0.2:5000", "203.0.113.7", "203.0.113.7"},
+		{"spoofed through a proxy", "10.0.0.2:5000", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"through proxies", "192.168.1.1:5000", "1.2.3.4, 203.0.113.7, 10.1.1.1", "203.0.113.7"},
+		{"malformed hop", "10.0.0.2:5000", "203.0.113.7, junk, 10.1.1.1", "10.1.1.1"},
+		{"no header", "10.0.0.2:5000", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		var ip string
+		handler := ClientIPMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip = ClientIP(r)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if ip != tt.ip {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.ip, ip)
+		}
+	}
+}
@@ -89,13 +89,7 @@ func RateLimitMiddleware(limit int) func(http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := r.RemoteAddr
-			// Handle X-Forwarded-For if behind proxy
-			if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-				ip = forwarded
-			}
-
-			if !rl.Allow(ip) {
+			if !rl.Allow(ClientIP(r)) {
 				errors.SendError(w, errors.NewError(http.StatusTooManyRequests, "RATE_LIMIT_EXCEEDED", "Too many requests"))
 				return
 			}
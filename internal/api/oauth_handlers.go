@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/rules"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+// AuthMethods lists how records of the auth collection can sign in. Each
+// OAuth2 provider comes with a fresh state and PKCE code verifier for the
+// client to keep until the provider redirects back.
+func (h *AuthHandler) AuthMethods(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
+	providers, err := h.oauthService.AuthMethods(r.Context(), col.Name, r.URL.Query().Get("redirect_url"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	SendJSON(w, http.StatusOK, map[string]any{
+		"password": true,
+		"oauth2":   providers,
+	}, nil)
+}
+
+type oauthLoginRequest struct {
+	Provider     string `json:"provider"`
+	Code         string `json:"code"`
+	CodeVerifier string `json:"code_verifier"`
+	RedirectURL  string `json:"redirect_url"`
+}
+
+// AuthWithOAuth2 completes a provider sign-in with the authorization code and
+// signs in the linked record. Unknown accounts are linked to the record with
+// the same verified email or registered, subject to the create rule.
+func (h *AuthHandler) AuthWithOAuth2(w http.ResponseWriter, r *http.Request) {
+	col, ok := h.authCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var req oauthLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	canCreate := func(data map[string]any) bool {
+		if col.CreateRule == nil || *col.CreateRule == "" {
+			return true
+		}
+		evalCtx := service.GetEvaluationContext(r, h.recordService.Lookup(), col.Name, nil)
+		evalCtx.Data = data
+		allowed, err := rules.Evaluate(*col.CreateRule, evalCtx)
+		return allowed && err == nil
+	}
+
+	result, err := h.oauthService.Authenticate(r.Context(), col.Name, req.Provider, req.Code, req.CodeVerifier, req.RedirectURL, canCreate)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	h.completeLogin(w, r, col.Name, result.Record, map[string]any{
+		"provider": req.Provider,
+		"id":       result.Identity.Subject,
+		"email":    result.Identity.Email,
+		"name":     result.Identity.Name,
+		"is_new":   result.IsNew,
+	})
+}
+
+// ListIdentities returns the provider accounts linked to the authenticated
+// record.
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	claims, ok := ownClaims(w, r, "You can only manage your own identities")
+	if !ok {
+		return
+	}
+
+	identities, err := h.oauthService.ListIdentities(r.Context(), claims.Collection, claims.RecordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, identities, nil)
+}
+
+// LinkIdentity completes a provider sign-in like AuthWithOAuth2, but links the
+// provider account to the authenticated record instead of signing in.
+func (h *AuthHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, ok := ownClaims(w, r, "You can only manage your own identities")
+	if !ok {
+		return
+	}
+
+	var req oauthLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Failed to decode request body"))
+		return
+	}
+
+	identity, err := h.oauthService.Link(r.Context(), claims.Collection, claims.RecordID, req.Provider, req.Code, req.CodeVerifier, req.RedirectURL)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, identity, nil)
+}
+
+// UnlinkIdentity removes a provider account from the authenticated record.
+func (h *AuthHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, ok := ownClaims(w, r, "You can only manage your own identities")
+	if !ok {
+		return
+	}
+
+	if err := h.oauthService.Unlink(r.Context(), claims.Collection, claims.RecordID, r.PathValue("id")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+type QuarantineHandler struct {
+	quarantineService *service.QuarantineService
+}
+
+func NewQuarantineHandler(quarantineService *service.QuarantineService) *QuarantineHandler {
+	return &QuarantineHandler{quarantineService: quarantineService}
+}
+
+// List returns the quarantined uploads, of one collection with
+// ?collection={name}.
+func (h *QuarantineHandler) List(w http.ResponseWriter, r *http.Request) {
+	files, err := h.quarantineService.List(r.Context(), r.URL.Query().Get("collection"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, files, nil)
+}
+
+// View returns a quarantined upload.
+func (h *QuarantineHandler) View(w http.ResponseWriter, r *http.Request) {
+	file, err := h.quarantineService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, file, nil)
+}
+
+// Download sends the content of a quarantined upload as an attachment, never
+// in a form a browser would render or run.
+func (h *QuarantineHandler) Download(w http.ResponseWriter, r *http.Request) {
+	file, err := h.quarantineService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	content, err := h.quarantineService.Open(r.Context(), file)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	defer errors.Defer(r.Context(), content.Close, "close quarantined file", "id", file.ID)
+
+	disposition := "attachment"
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename}); value != "" {
+		disposition = value
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, content); err != nil {
+		errors.Log(r.Context(), err, "send quarantined file", "id", file.ID)
+	}
+}
+
+// Release attaches a quarantined upload to the record it was uploaded to, or
+// to the record_id of the optional body, and returns the updated record.
+func (h *QuarantineHandler) Release(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RecordID string `json:"record_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
+		return
+	}
+	file, err := h.quarantineService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	record, err := h.quarantineService.Release(r.Context(), file, body.RecordID, uploadOwner(r))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, record, nil)
+}
+
+// Delete removes a quarantined upload for good.
+func (h *QuarantineHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	file, err := h.quarantineService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if err := h.quarantineService.Delete(r.Context(), file, uploadOwner(r)); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
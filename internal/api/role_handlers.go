@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+type RoleHandler struct {
+	roleService *service.RoleService
+}
+
+func NewRoleHandler(roleService *service.RoleService) *RoleHandler {
+	return &RoleHandler{roleService: roleService}
+}
+
+type roleAssignmentRequest struct {
+	Collection string `json:"collection"`
+	RecordID   string `json:"record_id"`
+}
+
+func (h *RoleHandler) List(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleService.ListRoles(r.Context())
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, roles, nil)
+}
+
+func (h *RoleHandler) View(w http.ResponseWriter, r *http.Request) {
+	role, err := h.roleService.GetRole(r.Context(), r.PathValue("name"))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, role, nil)
+}
+
+func (h *RoleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
+		return
+	}
+
+	created, err := h.roleService.CreateRole(r.Context(), &role)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusCreated, created, nil)
+}
+
+func (h *RoleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
+		return
+	}
+
+	updated, err := h.roleService.UpdateRole(r.Context(), r.PathValue("name"), &role)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, updated, nil)
+}
+
+func (h *RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.roleService.DeleteRole(r.Context(), r.PathValue("name")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RoleHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRoleAssignment(w, r)
+	if !ok {
+		return
+	}
+	if err := h.roleService.AssignRole(r.Context(), req.Collection, req.RecordID, r.PathValue("name")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RoleHandler) Unassign(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRoleAssignment(w, r)
+	if !ok {
+		return
+	}
+	if err := h.roleService.UnassignRole(r.Context(), req.Collection, req.RecordID, r.PathValue("name")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeRoleAssignment(w http.ResponseWriter, r *http.Request) (*roleAssignmentRequest, bool) {
+	var req roleAssignmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_BODY", "Failed to decode request body"))
+		return nil, false
+	}
+	if req.Collection == "" {
+		req.Collection = "users"
+	}
+	if req.RecordID == "" {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "MISSING_RECORD_ID", "record_id is required"))
+		return nil, false
+	}
+	return &req, true
+}
@@ -4,8 +4,10 @@ import (
 	"net/http"
 
 	"github.com/zulfikawr/vault/internal/api/middleware"
+	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
 	"github.com/zulfikawr/vault/internal/realtime"
 	"github.com/zulfikawr/vault/internal/service"
 	"github.com/zulfikawr/vault/internal/storage"
@@ -15,6 +17,18 @@ import (
 func NewRouter(
 	recordService *service.RecordService,
 	collectionService *service.CollectionService,
+	roleService *service.RoleService,
+	accountService *service.AccountService,
+	sessionService *service.SessionService,
+	oauthService *service.OAuthService,
+	mfaService *service.MFAService,
+	lockoutService *service.LockoutService,
+	apiKeyService *service.APIKeyService,
+	fileService *service.FileService,
+	uploadService *service.UploadService,
+	quotaService *service.QuotaService,
+	quarantineService *service.QuarantineService,
+	keys *auth.KeySet,
 	sqlService *service.SqlService,
 	registry *db.SchemaRegistry,
 	store storage.Storage,
@@ -23,14 +37,21 @@ func NewRouter(
 ) *http.ServeMux {
 	mux := http.NewServeMux()
 
-	authHandler := NewAuthHandler(recordService, config)
-	crudHandler := NewCollectionHandler(recordService, registry)
-	fileHandler := NewFileHandler(store, config.MaxFileUploadSize)
+	authHandler := NewAuthHandler(recordService, accountService, sessionService, oauthService, mfaService, lockoutService, keys, config)
+	crudHandler := NewCollectionHandler(recordService, roleService, fileService, registry)
+	fileHandler := NewFileHandler(store, recordService, roleService, fileService, registry, config)
+	uploadHandler := NewUploadHandler(uploadService, fileService, recordService, roleService, registry)
 	realtimeHandler := NewRealtimeHandler(hub)
-	adminHandler := NewAdminHandler(collectionService, sqlService)
+	adminHandler := NewAdminHandler(collectionService, fileService, sqlService)
 	logsHandler := NewLogsHandler()
 	settingsHandler := NewSettingsHandler(config)
-	storageHandler := NewStorageHandler(config.DataDir + "/storage")
+	storageHandler := NewStorageHandler(store, quotaService)
+	roleHandler := NewRoleHandler(roleService)
+	sessionHandler := NewSessionHandler(sessionService, recordService)
+	apiKeyHandler := NewAPIKeyHandler(apiKeyService)
+	lockoutHandler := NewLockoutHandler(lockoutService)
+	quarantineHandler := NewQuarantineHandler(quarantineService)
+	auditLogHandler := NewAuditLogHandler(recordService)
 
 	// Base routes
 	uiHandler := ui.Handler()
@@ -49,11 +70,39 @@ func NewRouter(
 		}, nil)
 	})
 
-	// Auth routes
-	mux.HandleFunc("POST /api/collections/users/auth-with-password", authHandler.Login)
-	mux.HandleFunc("POST /api/collections/users/auth-refresh", authHandler.Refresh)
-	mux.HandleFunc("POST /api/collections/users/request-password-reset", authHandler.RequestPasswordReset)
-	mux.HandleFunc("POST /api/collections/users/confirm-password-reset", authHandler.ConfirmPasswordReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", authHandler.JWKS)
+	mux.HandleFunc("GET /api/csrf-token", authHandler.CSRFToken)
+
+	// Auth routes. Endpoints that check credentials or send mail share a
+	// per-IP rate limit.
+	limited := middleware.RateLimitMiddleware(config.RateLimitPerMin)
+	mux.Handle("POST /api/collections/{collection}/auth-with-password", limited(http.HandlerFunc(authHandler.Login)))
+	mux.HandleFunc("GET /api/collections/{collection}/auth-methods", authHandler.AuthMethods)
+	mux.Handle("POST /api/collections/{collection}/auth-with-oauth2", limited(http.HandlerFunc(authHandler.AuthWithOAuth2)))
+	mux.Handle("POST /api/collections/{collection}/auth-with-mfa", limited(http.HandlerFunc(authHandler.AuthWithMFA)))
+	mux.HandleFunc("POST /api/collections/{collection}/auth-refresh", authHandler.Refresh)
+	mux.HandleFunc("POST /api/collections/{collection}/auth-logout", authHandler.Logout)
+	mux.Handle("POST /api/collections/{collection}/auth-register", limited(http.HandlerFunc(authHandler.Register)))
+	mux.Handle("POST /api/collections/{collection}/request-password-reset", limited(http.HandlerFunc(authHandler.RequestPasswordReset)))
+	mux.Handle("POST /api/collections/{collection}/confirm-password-reset", limited(http.HandlerFunc(authHandler.ConfirmPasswordReset)))
+	mux.Handle("POST /api/collections/{collection}/request-verification", limited(http.HandlerFunc(authHandler.RequestVerification)))
+	mux.HandleFunc("POST /api/collections/{collection}/confirm-verification", authHandler.ConfirmVerification)
+	mux.Handle("POST /api/admins/auth-with-password", limited(http.HandlerFunc(authHandler.AdminLogin)))
+	mux.HandleFunc("POST /api/admins/auth-refresh", authHandler.AdminRefresh)
+	mux.HandleFunc("POST /api/admins/auth-logout", authHandler.AdminLogout)
+	mux.HandleFunc("GET /api/admins/me", authHandler.AdminMe)
+
+	// Session routes
+	mux.HandleFunc("GET /api/collections/{collection}/sessions", sessionHandler.List)
+	mux.HandleFunc("DELETE /api/collections/{collection}/sessions/{id}", sessionHandler.Revoke)
+	mux.HandleFunc("GET /api/collections/{collection}/mfa", authHandler.MFAStatus)
+	mux.HandleFunc("POST /api/collections/{collection}/mfa/enroll", authHandler.EnrollMFA)
+	mux.HandleFunc("POST /api/collections/{collection}/mfa/activate", authHandler.ActivateMFA)
+	mux.HandleFunc("POST /api/collections/{collection}/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+	mux.HandleFunc("POST /api/collections/{collection}/mfa/disable", authHandler.DisableMFA)
+	mux.HandleFunc("GET /api/collections/{collection}/identities", authHandler.ListIdentities)
+	mux.Handle("POST /api/collections/{collection}/identities", limited(http.HandlerFunc(authHandler.LinkIdentity)))
+	mux.HandleFunc("DELETE /api/collections/{collection}/identities/{id}", authHandler.UnlinkIdentity)
 
 	// CRUD routes (Dynamic)
 	mux.HandleFunc("GET /api/collections/{collection}/records", crudHandler.List)
@@ -65,31 +114,63 @@ func NewRouter(
 
 	// File routes
 	mux.HandleFunc("GET /api/files/{collection}/{id}/{filename}", fileHandler.Serve)
+	mux.HandleFunc("POST /api/files/{collection}/{id}/{filename}/token", fileHandler.Token)
 	mux.HandleFunc("POST /api/files", fileHandler.Upload)
 
+	// Resumable upload routes
+	mux.HandleFunc("POST /api/uploads", uploadHandler.Create)
+	mux.HandleFunc("HEAD /api/uploads/{id}", uploadHandler.Head)
+	mux.HandleFunc("PATCH /api/uploads/{id}", uploadHandler.Patch)
+	mux.HandleFunc("DELETE /api/uploads/{id}", uploadHandler.Delete)
+	mux.HandleFunc("POST /api/uploads/{id}/finalize", uploadHandler.Finalize)
+
 	// Realtime routes
 	mux.HandleFunc("GET /api/realtime", realtimeHandler.Connect)
 
-	// Admin routes (Protected by AdminOnly)
+	// Admin routes. Admins may call every route; other auth records need a
+	// role granting the route's permission.
 	adminRouter := http.NewServeMux()
-	adminRouter.HandleFunc("GET /collections", adminHandler.ListCollections)
-	adminRouter.HandleFunc("POST /collections", adminHandler.CreateCollection)
-	adminRouter.HandleFunc("PATCH /collections/{id}", adminHandler.UpdateCollection)
-	adminRouter.HandleFunc("DELETE /collections/{name}", adminHandler.DeleteCollection)
-	adminRouter.HandleFunc("GET /settings", settingsHandler.GetSettings)
-	adminRouter.HandleFunc("PATCH /settings", settingsHandler.UpdateSettings)
-	adminRouter.HandleFunc("POST /backups", adminHandler.CreateBackup)
-	adminRouter.HandleFunc("GET /logs", logsHandler.GetLogs)
-	adminRouter.HandleFunc("DELETE /logs", logsHandler.ClearLogs)
-	adminRouter.HandleFunc("GET /storage", storageHandler.List)
-	adminRouter.HandleFunc("GET /storage/stats", storageHandler.Stats)
-	adminRouter.HandleFunc("DELETE /storage", storageHandler.Delete)
-	adminRouter.HandleFunc("POST /storage/rename", storageHandler.Rename)
-	adminRouter.HandleFunc("POST /storage/mkdir", storageHandler.CreateDir)
-	adminRouter.HandleFunc("POST /query", adminHandler.ExecuteQuery)
+	require := func(permission string, handler http.HandlerFunc) http.Handler {
+		return middleware.RequirePermission(roleService, permission)(handler)
+	}
+	adminRouter.Handle("GET /collections", require(models.PermissionCollectionsRead, adminHandler.ListCollections))
+	adminRouter.Handle("POST /collections", require(models.PermissionCollectionsWrite, adminHandler.CreateCollection))
+	adminRouter.Handle("PATCH /collections/{id}", require(models.PermissionCollectionsWrite, adminHandler.UpdateCollection))
+	adminRouter.Handle("DELETE /collections/{name}", require(models.PermissionCollectionsWrite, adminHandler.DeleteCollection))
+	adminRouter.Handle("GET /settings", require(models.PermissionSettingsRead, settingsHandler.GetSettings))
+	adminRouter.Handle("PATCH /settings", require(models.PermissionSettingsWrite, settingsHandler.UpdateSettings))
+	adminRouter.Handle("POST /backups", require(models.PermissionBackupsCreate, adminHandler.CreateBackup))
+	adminRouter.Handle("GET /logs", require(models.PermissionLogsRead, logsHandler.GetLogs))
+	adminRouter.Handle("DELETE /logs", require(models.PermissionLogsDelete, logsHandler.ClearLogs))
+	adminRouter.Handle("GET /audit-logs", require(models.PermissionAuditLogsRead, auditLogHandler.List))
+	adminRouter.Handle("GET /storage", require(models.PermissionStorageRead, storageHandler.List))
+	adminRouter.Handle("GET /storage/stats", require(models.PermissionStorageRead, storageHandler.Stats))
+	adminRouter.Handle("DELETE /storage", require(models.PermissionStorageWrite, storageHandler.Delete))
+	adminRouter.Handle("POST /storage/rename", require(models.PermissionStorageWrite, storageHandler.Rename))
+	adminRouter.Handle("POST /storage/mkdir", require(models.PermissionStorageWrite, storageHandler.CreateDir))
+	adminRouter.Handle("POST /query", require(models.PermissionQueryExecute, adminHandler.ExecuteQuery))
+	adminRouter.Handle("GET /roles", require(models.PermissionRolesManage, roleHandler.List))
+	adminRouter.Handle("POST /roles", require(models.PermissionRolesManage, roleHandler.Create))
+	adminRouter.Handle("GET /roles/{name}", require(models.PermissionRolesManage, roleHandler.View))
+	adminRouter.Handle("PATCH /roles/{name}", require(models.PermissionRolesManage, roleHandler.Update))
+	adminRouter.Handle("DELETE /roles/{name}", require(models.PermissionRolesManage, roleHandler.Delete))
+	adminRouter.Handle("POST /roles/{name}/assign", require(models.PermissionRolesManage, roleHandler.Assign))
+	adminRouter.Handle("POST /roles/{name}/unassign", require(models.PermissionRolesManage, roleHandler.Unassign))
+	adminRouter.Handle("GET /sessions", require(models.PermissionSessionsManage, sessionHandler.AdminList))
+	adminRouter.Handle("DELETE /sessions", require(models.PermissionSessionsManage, sessionHandler.AdminRevokeAll))
+	adminRouter.Handle("GET /api-keys", require(models.PermissionAPIKeysManage, apiKeyHandler.List))
+	adminRouter.Handle("POST /api-keys", require(models.PermissionAPIKeysManage, apiKeyHandler.Create))
+	adminRouter.Handle("DELETE /api-keys/{id}", require(models.PermissionAPIKeysManage, apiKeyHandler.Revoke))
+	adminRouter.Handle("GET /lockouts", require(models.PermissionLockoutsManage, lockoutHandler.List))
+	adminRouter.Handle("DELETE /lockouts/{id}", require(models.PermissionLockoutsManage, lockoutHandler.Clear))
+	adminRouter.Handle("GET /quarantine", require(models.PermissionQuarantineManage, quarantineHandler.List))
+	adminRouter.Handle("GET /quarantine/{id}", require(models.PermissionQuarantineManage, quarantineHandler.View))
+	adminRouter.Handle("GET /quarantine/{id}/file", require(models.PermissionQuarantineManage, quarantineHandler.Download))
+	adminRouter.Handle("POST /quarantine/{id}/release", require(models.PermissionQuarantineManage, quarantineHandler.Release))
+	adminRouter.Handle("DELETE /quarantine/{id}", require(models.PermissionQuarantineManage, quarantineHandler.Delete))
 
 	// Apply rate limiting to admin operations
-	mux.Handle("/api/admin/", http.StripPrefix("/api/admin", middleware.RateLimitMiddleware(config.RateLimitPerMin)(middleware.AdminOnly(adminRouter))))
+	mux.Handle("/api/admin/", http.StripPrefix("/api/admin", middleware.RateLimitMiddleware(config.RateLimitPerMin)(adminRouter)))
 
 	return mux
 }
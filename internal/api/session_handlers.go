@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+type SessionHandler struct {
+	sessionService *service.SessionService
+	recordService  *service.RecordService
+}
+
+func NewSessionHandler(sessionService *service.SessionService, recordService *service.RecordService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		recordService:  recordService,
+	}
+}
+
+// List returns the sessions of the authenticated record.
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionService.List(r.Context(), claims.Collection, claims.RecordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, sessions, nil)
+}
+
+// Revoke ends one session of the authenticated record.
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.Revoke(r.Context(), claims.Collection, claims.RecordID, r.PathValue("id")); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminList returns the sessions of any auth record, given by the
+// collection and record_id query parameters.
+func (h *SessionHandler) AdminList(w http.ResponseWriter, r *http.Request) {
+	collection, recordID, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionService.List(r.Context(), collection, recordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, sessions, nil)
+}
+
+// AdminRevokeAll ends every session of an auth record, given by the
+// collection and record_id query parameters.
+func (h *SessionHandler) AdminRevokeAll(w http.ResponseWriter, r *http.Request) {
+	collection, recordID, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.sessionService.RevokeAll(r.Context(), collection, recordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	SendJSON(w, http.StatusOK, map[string]int{"revoked": revoked}, nil)
+}
+
+func (h *SessionHandler) owner(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	return ownClaims(w, r, "You can only manage your own sessions")
+}
+
+// ownClaims returns the caller's claims when they belong to the auth
+// collection in the path. API keys cannot manage the account they act for.
+func ownClaims(w http.ResponseWriter, r *http.Request, forbidden string) (*auth.Claims, bool) {
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if !ok || claims == nil {
+		errors.SendError(w, errors.NewError(http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required"))
+		return nil, false
+	}
+	if claims.Collection != r.PathValue("collection") || claims.IsAPIKey() {
+		errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", forbidden))
+		return nil, false
+	}
+	return claims, true
+}
+
+func (h *SessionHandler) target(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	collection := r.URL.Query().Get("collection")
+	if collection == "" {
+		collection = "users"
+	}
+	recordID := r.URL.Query().Get("record_id")
+	if recordID == "" {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "MISSING_RECORD_ID", "record_id is required"))
+		return "", "", false
+	}
+	if _, err := h.recordService.FindRecordByID(r.Context(), collection, recordID); err != nil {
+		errors.SendError(w, err)
+		return "", "", false
+	}
+	return collection, recordID, true
+}
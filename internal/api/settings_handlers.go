@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	"slices"
 
+	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/errors"
 )
@@ -17,8 +19,32 @@ func NewSettingsHandler(config *core.Config) *SettingsHandler {
 	return &SettingsHandler{config: config}
 }
 
+// maskedSecret stands in for a secret setting in responses. Sending it back
+// keeps the stored secret.
+const maskedSecret = "********"
+
+// GetSettings returns the configuration. The jwt_secret, which can sign
+// tokens for any record including admins, is only shown to admins. The
+// secrets of external services are write-only and masked for everyone.
 func (h *SettingsHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
-	SendJSON(w, http.StatusOK, h.config, nil)
+	settings := *h.config
+	if claims, ok := core.GetAuth(r.Context()).(*auth.Claims); !ok || claims == nil || !claims.IsAdmin() {
+		settings.JWTSecret = ""
+	}
+	settings.S3SecretKey = mask(settings.S3SecretKey)
+	settings.SMTPPassword = mask(settings.SMTPPassword)
+	settings.OAuthProviders = slices.Clone(settings.OAuthProviders)
+	for i := range settings.OAuthProviders {
+		settings.OAuthProviders[i].ClientSecret = mask(settings.OAuthProviders[i].ClientSecret)
+	}
+	SendJSON(w, http.StatusOK, settings, nil)
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return maskedSecret
 }
 
 func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
@@ -50,9 +76,59 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 	if rateLimit, ok := updates["rate_limit_per_min"].(float64); ok {
 		h.config.RateLimitPerMin = int(rateLimit)
 	}
+	if maxAttempts, ok := updates["login_max_attempts"].(float64); ok {
+		h.config.LoginMaxAttempts = int(maxAttempts)
+	}
+	if maxAttempts, ok := updates["login_max_attempts_per_ip"].(float64); ok {
+		h.config.LoginMaxAttemptsPerIP = int(maxAttempts)
+	}
+	if lockout, ok := updates["login_lockout_minutes"].(float64); ok {
+		h.config.LoginLockoutMinutes = int(lockout)
+	}
+	if expiry, ok := updates["upload_expiry_hours"].(float64); ok {
+		h.config.UploadExpiryHours = int(expiry)
+	}
+	if quota, ok := updates["collection_quota_bytes"].(float64); ok {
+		h.config.CollectionQuotaBytes = int64(quota)
+	}
+	if quota, ok := updates["collection_quota_files"].(float64); ok {
+		h.config.CollectionQuotaFiles = int(quota)
+	}
+	if quota, ok := updates["user_quota_bytes"].(float64); ok {
+		h.config.UserQuotaBytes = int64(quota)
+	}
+	if quota, ok := updates["user_quota_files"].(float64); ok {
+		h.config.UserQuotaFiles = int(quota)
+	}
 	if tlsEnabled, ok := updates["tls_enabled"].(bool); ok {
 		h.config.TLSEnabled = tlsEnabled
 	}
+	if rawProviders, ok := updates["oauth_providers"]; ok {
+		var providers []core.OAuthProvider
+		encoded, _ := json.Marshal(rawProviders)
+		if err := json.Unmarshal(encoded, &providers); err != nil {
+			errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_REQUEST", "Invalid oauth_providers"))
+			return
+		}
+		for i, provider := range providers {
+			// A masked secret keeps the one stored for the provider.
+			if provider.ClientSecret == maskedSecret {
+				providers[i].ClientSecret = ""
+				for _, stored := range h.config.OAuthProviders {
+					if stored.Name == provider.Name {
+						providers[i].ClientSecret = stored.ClientSecret
+					}
+				}
+			}
+			if provider.Name == "" || provider.ClientID == "" || (provider.Issuer == "" && (provider.AuthURL == "" || provider.TokenURL == "")) {
+				errors.SendError(w, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(map[string]any{
+					"oauth_providers": "each provider needs a name, a client_id and an issuer or auth_url and token_url",
+				}))
+				return
+			}
+		}
+		h.config.OAuthProviders = providers
+	}
 
 	// Save to config.json
 	configData, err := json.MarshalIndent(h.config, "", "  ")
@@ -60,7 +136,7 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "CONFIG_MARSHAL_FAILED", "Failed to marshal config"))
 		return
 	}
-	if err := os.WriteFile("config.json", configData, 0644); err != nil {
+	if err := writeConfigFile("config.json", configData); err != nil {
 		errors.Log(r.Context(), err, "write config file")
 		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "CONFIG_WRITE_FAILED", "Failed to write config file"))
 		return
@@ -68,3 +144,13 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 
 	SendJSON(w, http.StatusOK, map[string]string{"message": "Settings updated"}, nil)
 }
+
+// writeConfigFile replaces the config file with one only its owner can
+// read, since it holds secrets.
+func writeConfigFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestGetSettings(t *testing.T) {
+	h := NewSettingsHandler(&core.Config{JWTSecret: "test-secret", Port: 8090})
+	get := func(claims *auth.Claims) map[string]any {
+		t.Helper()
+		w := serve("GET /api/admin/settings", h.GetSettings, httptest.NewRequest("GET", "/api/admin/settings", nil), claims)
+		if w.Code != 200 {
+			t.Fatalf("expected 200, got %d %s", w.Code, w.Body)
+		}
+		return decode(t, w)["data"].(map[string]any)
+	}
+
+	// A role granting settings.read must not yield the key to admin tokens.
+	settings := get(&auth.Claims{RecordID: "u1", Collection: "users", Type: auth.TokenTypeAuth})
+	if settings["jwt_secret"] != "" || settings["port"] != float64(8090) {
+		t.Errorf("expected the settings without jwt_secret, got %v", settings)
+	}
+	if settings := get(&auth.Claims{RecordID: "a1", Collection: models.AdminsCollection, Type: auth.TokenTypeAdmin}); settings["jwt_secret"] != "test-secret" {
+		t.Errorf("expected admins to see jwt_secret, got %v", settings["jwt_secret"])
+	}
+}
+
+func TestSettingsSecrets(t *testing.T) {
+	t.Chdir(t.TempDir())
+	config := &core.Config{
+		JWTSecret:    "test-secret",
+		S3SecretKey:  "s3-secret",
+		SMTPPassword: "smtp-secret",
+		OAuthProviders: []core.OAuthProvider{
+			{Name: "github", ClientID: "id", ClientSecret: "oauth-secret", AuthURL: "https://a", TokenURL: "https://t"},
+		},
+	}
+	h := NewSettingsHandler(config)
+	admin := &auth.Claims{RecordID: "a1", Collection: models.AdminsCollection, Type: auth.TokenTypeAdmin}
+
+	w := serve("GET /api/admin/settings", h.GetSettings, httptest.NewRequest("GET", "/api/admin/settings", nil), admin)
+	body := w.Body.String()
+	if !strings.Contains(body, `"s3_secret_key":"********"`) {
+		t.Errorf("expected the masked secret, got %s", body)
+	}
+	for _, secret := range []string{"s3-secret", "smtp-secret", "oauth-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("expected %s to be masked, got %s", secret, body)
+		}
+	}
+
+	// Sending the masked settings back keeps the stored secrets.
+	w = serve("PATCH /api/admin/settings", h.UpdateSettings, httptest.NewRequest("PATCH", "/api/admin/settings", strings.NewReader(`{
+		"oauth_providers": [{"name": "github", "client_id": "id", "client_secret": "********", "auth_url": "https://a", "token_url": "https://t"}]
+	}`)), admin)
+	if w.Code != 200 {
+		t.Fatalf("expected the update to succeed, got %d %s", w.Code, w.Body)
+	}
+	if secret := config.OAuthProviders[0].ClientSecret; secret != "oauth-secret" {
+		t.Errorf("expected the stored client secret to be kept, got %q", secret)
+	}
+	info, err := os.Stat("config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("expected config.json to be private, got %v", mode)
+	}
+}
@@ -2,21 +2,23 @@ package api
 
 import (
 	"encoding/json"
-	"io/fs"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
+	"github.com/zulfikawr/vault/internal/storage"
 )
 
 type StorageHandler struct {
-	basePath string
+	store  storage.Storage
+	quotas *service.QuotaService
 }
 
-func NewStorageHandler(basePath string) *StorageHandler {
-	return &StorageHandler{basePath: basePath}
+func NewStorageHandler(store storage.Storage, quotas *service.QuotaService) *StorageHandler {
+	return &StorageHandler{store: store, quotas: quotas}
 }
 
 type FileInfo struct {
@@ -29,11 +31,23 @@ type FileInfo struct {
 }
 
 type StorageStats struct {
-	TotalFiles       int   `json:"total_files"`
-	TotalSize        int64 `json:"total_size"`
-	TotalCollections int   `json:"total_collections"`
+	TotalFiles       int                  `json:"total_files"`
+	TotalSize        int64                `json:"total_size"`
+	TotalCollections int                  `json:"total_collections"`
+	Dedupe           *storage.DedupeStats `json:"dedupe,omitempty"`
+	Usage            *StorageUsage        `json:"usage"`
 }
 
+// StorageUsage reports the storage used by every collection and by the auth
+// records that uploaded the most, with their quotas.
+type StorageUsage struct {
+	Collections []*models.StorageUsage `json:"collections"`
+	Users       []*models.StorageUsage `json:"users"`
+}
+
+// usageUsers is the number of auth records reported in the storage stats.
+const usageUsers = 100
+
 type StorageListResponse struct {
 	Files   []FileInfo    `json:"files"`
 	Folders []FileInfo    `json:"folders"`
@@ -52,37 +66,24 @@ func (h *StorageHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fullPath := filepath.Join(h.basePath, path)
-
-	entries, err := os.ReadDir(fullPath)
+	entries, err := h.store.List(r.Context(), path, false)
 	if err != nil {
-		if os.IsNotExist(err) {
-			SendJSON(w, http.StatusOK, StorageListResponse{Files: []FileInfo{}, Folders: []FileInfo{}}, nil)
-			return
-		}
-		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "READ_DIR_FAILED", "Failed to read directory"))
+		errors.SendError(w, err)
 		return
 	}
 
-	var files, folders []FileInfo
-
+	files, folders := []FileInfo{}, []FileInfo{}
 	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		relPath := filepath.Join(path, entry.Name())
 		fileInfo := FileInfo{
-			Name:     entry.Name(),
-			Path:     relPath,
-			Size:     info.Size(),
-			IsDir:    entry.IsDir(),
-			Modified: info.ModTime().Unix(),
+			Name:     entry.Name,
+			Path:     entry.Path,
+			Size:     entry.Size,
+			IsDir:    entry.IsDir,
+			Modified: entry.ModTime.Unix(),
 		}
 
-		if !entry.IsDir() {
-			fileInfo.MimeType = detectMimeType(entry.Name())
+		if !entry.IsDir {
+			fileInfo.MimeType = entry.ContentType
 			files = append(files, fileInfo)
 		} else {
 			folders = append(folders, fileInfo)
@@ -99,29 +100,46 @@ func (h *StorageHandler) Stats(w http.ResponseWriter, r *http.Request) {
 	stats := &StorageStats{}
 
 	// Count collections (top-level directories)
-	entries, err := os.ReadDir(h.basePath)
-	if err == nil {
-		for _, entry := range entries {
-			if entry.IsDir() {
-				stats.TotalCollections++
-			}
+	entries, err := h.store.List(r.Context(), "", false)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	for _, entry := range entries {
+		// Directories starting with an underscore hold system files.
+		if entry.IsDir && !strings.HasPrefix(entry.Name, "_") {
+			stats.TotalCollections++
 		}
 	}
 
-	// Walk entire storage to count files and size
-	if err := filepath.WalkDir(h.basePath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
+	// List entire storage to count files and size
+	entries, err = h.store.List(r.Context(), "", true)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir {
+			stats.TotalFiles++
+			stats.TotalSize += entry.Size
 		}
-		info, err := d.Info()
-		if err != nil {
-			return nil
+	}
+
+	if dedupe, ok := h.store.(*storage.Dedupe); ok {
+		if stats.Dedupe, err = dedupe.Stats(r.Context()); err != nil {
+			errors.SendError(w, err)
+			return
 		}
-		stats.TotalFiles++
-		stats.TotalSize += info.Size()
-		return nil
-	}); err != nil {
-		errors.Log(r.Context(), err, "walk storage directory", "path", h.basePath)
+	}
+
+	stats.Usage = &StorageUsage{}
+	if stats.Usage.Collections, err = h.quotas.List(r.Context(), models.UsageScopeCollection, 0); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if stats.Usage.Users, err = h.quotas.List(r.Context(), models.UsageScopeUser, usageUsers); err != nil {
+		errors.SendError(w, err)
+		return
 	}
 
 	SendJSON(w, http.StatusOK, stats, nil)
@@ -155,20 +173,25 @@ func (h *StorageHandler) Delete(w http.ResponseWriter, r *http.Request) {
 			continue // Skip invalid paths
 		}
 
-		fullPath := filepath.Join(h.basePath, p)
-
 		// Check if path exists
-		fileInfo, err := os.Stat(fullPath)
+		fileInfo, err := h.store.Stat(r.Context(), p)
 		if err != nil {
 			continue // Skip non-existent paths
 		}
 
-		if fileInfo.IsDir() {
+		if fileInfo.IsDir {
 			if req.Recursive {
-				_ = os.RemoveAll(fullPath)
+				if _, _, err := storage.RemoveAll(r.Context(), h.store, p); err != nil {
+					errors.Log(r.Context(), err, "delete storage directory", "path", p)
+				} else {
+					h.release(r, p)
+				}
 			}
+		} else if err := h.store.Delete(r.Context(), p); err != nil {
+			errors.Log(r.Context(), err, "delete storage file", "path", p)
 		} else {
-			_ = os.Remove(fullPath)
+			h.removeThumbs(r, p)
+			h.release(r, p)
 		}
 	}
 
@@ -196,27 +219,49 @@ func (h *StorageHandler) Rename(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	oldFullPath := filepath.Join(h.basePath, req.OldPath)
-	newFullPath := filepath.Join(filepath.Dir(oldFullPath), req.NewName)
+	newPath := path.Join(path.Dir(path.Clean("/"+req.OldPath)), req.NewName)
 
-	if _, err := os.Stat(oldFullPath); os.IsNotExist(err) {
-		errors.SendError(w, errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "Original file not found"))
+	if _, err := h.store.Stat(r.Context(), req.OldPath); err != nil {
+		errors.SendError(w, err)
 		return
 	}
 
-	if _, err := os.Stat(newFullPath); err == nil {
+	if exists, err := h.store.Exists(r.Context(), newPath); err != nil {
+		errors.SendError(w, err)
+		return
+	} else if exists {
 		errors.SendError(w, errors.NewError(http.StatusConflict, "FILE_ALREADY_EXISTS", "File with the same name already exists in destination"))
 		return
 	}
 
-	if err := os.Rename(oldFullPath, newFullPath); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "RENAME_FAILED", "Failed to rename"))
+	if err := h.store.Rename(r.Context(), req.OldPath, newPath); err != nil {
+		errors.SendError(w, err)
 		return
 	}
+	h.removeThumbs(r, req.OldPath)
+	if err := h.quotas.Move(r.Context(), req.OldPath, newPath); err != nil {
+		errors.Log(r.Context(), err, "move storage usage", "path", req.OldPath)
+	}
 
 	SendJSON(w, http.StatusOK, map[string]string{"message": "File renamed successfully"}, nil)
 }
 
+// removeThumbs removes the cached thumbnails of a file that was deleted or
+// moved away.
+func (h *StorageHandler) removeThumbs(r *http.Request, file string) {
+	if _, _, err := storage.RemoveAll(r.Context(), h.store, service.ThumbsDir(file)); err != nil {
+		errors.Log(r.Context(), err, "delete thumbnails", "path", file)
+	}
+}
+
+// release stops counting the deleted files at or below the path in the
+// storage usage.
+func (h *StorageHandler) release(r *http.Request, path string) {
+	if err := h.quotas.Release(r.Context(), path); err != nil {
+		errors.Log(r.Context(), err, "release storage usage", "path", path)
+	}
+}
+
 func (h *StorageHandler) CreateDir(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Path string `json:"path"`
@@ -233,40 +278,10 @@ func (h *StorageHandler) CreateDir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fullPath := filepath.Join(h.basePath, req.Path, req.Name)
-
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
-		errors.SendError(w, errors.NewError(http.StatusInternalServerError, "DIR_CREATE_FAILED", "Failed to create directory"))
+	if err := h.store.CreateDir(r.Context(), path.Join(req.Path, req.Name)); err != nil {
+		errors.SendError(w, err)
 		return
 	}
 
 	SendJSON(w, http.StatusCreated, map[string]string{"message": "Directory created successfully"}, nil)
 }
-
-func detectMimeType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	mimeTypes := map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".webp": "image/webp",
-		".svg":  "image/svg+xml",
-		".pdf":  "application/pdf",
-		".doc":  "application/msword",
-		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
-		".xls":  "application/vnd.ms-excel",
-		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
-		".zip":  "application/zip",
-		".mp3":  "audio/mpeg",
-		".mp4":  "video/mp4",
-		".txt":  "text/plain",
-		".json": "application/json",
-		".xml":  "application/xml",
-	}
-
-	if mime, ok := mimeTypes[ext]; ok {
-		return mime
-	}
-	return "application/octet-stream"
-}
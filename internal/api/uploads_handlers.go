@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+// tusVersion is the version of the tus resumable upload protocol the upload
+// routes follow for creating uploads, sending chunks and checking offsets.
+const tusVersion = "1.0.0"
+
+// uploadSecretHeader carries the secret a guest upload is bound to, returned
+// when it is created and sent with every later request for it.
+const uploadSecretHeader = "Upload-Secret"
+
+// UploadHandler serves resumable uploads of files to records' file fields.
+// An upload is created with its size, receives the file in chunks and is
+// finalized to attach the file to the record. Only the caller who created
+// an upload may use it, which for guests means sending its secret.
+type UploadHandler struct {
+	uploadService *service.UploadService
+	fileService   *service.FileService
+	recordService *service.RecordService
+	roleService   *service.RoleService
+	registry      *db.SchemaRegistry
+}
+
+func NewUploadHandler(uploadService *service.UploadService, fileService *service.FileService, recordService *service.RecordService, roleService *service.RoleService, registry *db.SchemaRegistry) *UploadHandler {
+	return &UploadHandler{
+		uploadService: uploadService,
+		fileService:   fileService,
+		recordService: recordService,
+		roleService:   roleService,
+		registry:      registry,
+	}
+}
+
+// Create starts an upload. Upload-Length declares the size of the file and
+// Upload-Metadata names the collection, recordID, field and filename as
+// base64 encoded values. The field may be omitted when the collection has a
+// single file field.
+func (h *UploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_UPLOAD_LENGTH", "Upload-Length must be the size of the file in bytes"))
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_UPLOAD_METADATA", err.Error()))
+		return
+	}
+
+	collection := metadata["collection"]
+	recordID := metadata["recordID"]
+	if collection == "" || recordID == "" {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "MISSING_PARAMS", "collection and recordID are required"))
+		return
+	}
+	col, ok := h.registry.GetCollection(collection)
+	if !ok {
+		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
+		return
+	}
+	if !inScope(w, r, collection, models.ActionUpdate) {
+		return
+	}
+	field := metadata["field"]
+	if field == "" {
+		field = soleFileField(col)
+	}
+
+	existing, err := h.recordService.FindRecordByID(r.Context(), collection, recordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if !canUpdate(r, h.recordService, h.roleService, col, existing, map[string]any{}) {
+		errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to update this record"))
+		return
+	}
+
+	upload, err := h.uploadService.Create(r.Context(), col, existing, field, metadata["filename"], size, uploadOwner(r))
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	if upload.Secret != "" {
+		w.Header().Set(uploadSecretHeader, upload.Secret)
+	}
+	setUploadHeaders(w, upload)
+	SendJSON(w, http.StatusCreated, upload, nil)
+}
+
+// Head reports the bytes received so far, from which an interrupted upload
+// resumes.
+func (h *UploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	upload, err := h.upload(r)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch writes a chunk, sent as application/offset+octet-stream, at the
+// offset given in Upload-Offset.
+func (h *UploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/offset+octet-stream" {
+		errors.SendError(w, errors.NewError(http.StatusUnsupportedMediaType, "INVALID_CONTENT_TYPE", "Chunks must be sent as application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		errors.SendError(w, errors.NewError(http.StatusBadRequest, "INVALID_UPLOAD_OFFSET", "Upload-Offset must be the number of bytes already sent"))
+		return
+	}
+	upload, err := h.upload(r)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	upload, err = h.uploadService.WriteChunk(r.Context(), upload.ID, offset, r.Body)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Finalize attaches the complete file to the upload's record, as uploading
+// it in a single request would, and deletes the upload.
+func (h *UploadHandler) Finalize(w http.ResponseWriter, r *http.Request) {
+	upload, err := h.upload(r)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	col, ok := h.registry.GetCollection(upload.Collection)
+	if !ok {
+		errors.SendError(w, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", "Collection not found"))
+		return
+	}
+	if !inScope(w, r, col.Name, models.ActionUpdate) {
+		return
+	}
+	existing, err := h.recordService.FindRecordByID(r.Context(), col.Name, upload.RecordID)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	changes, err := h.uploadService.Prepare(r.Context(), upload, col, existing, data)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if !canUpdate(r, h.recordService, h.roleService, col, existing, data) {
+		errors.SendError(w, errors.NewError(http.StatusForbidden, "FORBIDDEN", "You do not have permission to update this record"))
+		return
+	}
+
+	if err := h.uploadService.Save(r.Context(), upload, changes); err != nil {
+		// The quarantine keeps its own copy of a flagged upload.
+		if vErr, ok := err.(*errors.VaultError); ok && vErr.Code == "FILE_QUARANTINED" {
+			if err := h.uploadService.Delete(r.Context(), upload); err != nil {
+				errors.Log(r.Context(), err, "delete quarantined upload", "upload_id", upload.ID)
+			}
+		}
+		errors.SendError(w, err)
+		return
+	}
+	if _, err := h.recordService.UpdateRecord(r.Context(), col.Name, upload.RecordID, data); err != nil {
+		h.fileService.Discard(r.Context(), col.Name, upload.RecordID, changes)
+		errors.SendError(w, err)
+		return
+	}
+	h.fileService.Commit(r.Context(), col.Name, upload.RecordID, changes)
+	if err := h.uploadService.Delete(r.Context(), upload); err != nil {
+		errors.Log(r.Context(), err, "delete finalized upload", "upload_id", upload.ID)
+	}
+
+	name := changes.Names()[0]
+	SendJSON(w, http.StatusCreated, map[string]any{
+		"name":  name,
+		"field": upload.Field,
+		"size":  upload.Size,
+		"mime":  storage.ContentType(name),
+		"url":   fmt.Sprintf("/api/files/%s/%s/%s", col.Name, upload.RecordID, name),
+	}, nil)
+}
+
+// Delete aborts an upload, removing the chunks received.
+func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	upload, err := h.upload(r)
+	if err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	if err := h.uploadService.Delete(r.Context(), upload); err != nil {
+		errors.SendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload returns the upload of the request's path, which the caller must
+// have created. Other callers' uploads are reported as not found.
+func (h *UploadHandler) upload(r *http.Request) (*models.Upload, error) {
+	upload, err := h.uploadService.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	if !h.uploadService.Allows(upload, uploadOwner(r), r.Header.Get(uploadSecretHeader)) {
+		return nil, errors.NewError(http.StatusNotFound, "UPLOAD_NOT_FOUND", "Upload not found")
+	}
+	return upload, nil
+}
+
+// uploadOwner identifies the caller as the owner of the uploads it creates
+// and the files it stores, which count towards its storage quota, or returns
+// "" for guests.
+func uploadOwner(r *http.Request) string {
+	claims, ok := core.GetAuth(r.Context()).(*auth.Claims)
+	if !ok || claims == nil {
+		return ""
+	}
+	return claims.Collection + "/" + claims.RecordID
+}
+
+func setUploadHeaders(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if expires, err := time.Parse(time.RFC3339, upload.Expires); err == nil {
+		w.Header().Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header, a comma-separated
+// list of keys each followed by a space and its base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for pair := range strings.SplitSeq(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata value of %s is not base64 encoded", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileTokenTTL is how long a signed file token stays valid.
+const FileTokenTTL = 5 * time.Minute
+
+// SignFileToken returns a token granting access to the stored file at path
+// until expires. Tokens are signed with an HMAC keyed with key, see
+// FileTokenKey, so they need no server-side state.
+func SignFileToken(key []byte, path string, expires time.Time) string {
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	return unix + "." + base64.RawURLEncoding.EncodeToString(fileTokenMAC(key, path, unix))
+}
+
+// FileTokenKey derives the key file tokens are signed with from the server
+// secret, so that a token never doubles as a signature for anything else.
+func FileTokenKey(secret string) []byte {
+	return DeriveKey(secret, "file-token")
+}
+
+// VerifyFileToken reports whether the token grants access to the file at
+// path at the given time.
+func VerifyFileToken(key []byte, path, token string, now time.Time) bool {
+	unix, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, fileTokenMAC(key, path, unix))
+}
+
+func fileTokenMAC(key []byte, path, expires string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("vault-file-token\n" + path + "\n" + expires))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := FileTokenKey("secret")
+	token := SignFileToken(key, "posts/rec1/a.png", now.Add(FileTokenTTL))
+
+	if !VerifyFileToken(key, "posts/rec1/a.png", token, now) {
+		t.Fatal("valid token rejected")
+	}
+	for name, ok := range map[string]bool{
+		"expired":     VerifyFileToken(key, "posts/rec1/a.png", token, now.Add(FileTokenTTL+time.Second)),
+		"other file":  VerifyFileToken(key, "posts/rec1/b.png", token, now),
+		"other key":   VerifyFileToken(FileTokenKey("other"), "posts/rec1/a.png", token, now),
+		"raw secret":  VerifyFileToken(key, "posts/rec1/a.png", SignFileToken([]byte("secret"), "posts/rec1/a.png", now.Add(FileTokenTTL)), now),
+		"tampered":    VerifyFileToken(key, "posts/rec1/a.png", "9999999999"+token[10:], now),
+		"malformed":   VerifyFileToken(key, "posts/rec1/a.png", "garbage", now),
+		"empty token": VerifyFileToken(key, "posts/rec1/a.png", "", now),
+	} {
+		if ok {
+			t.Errorf("%s token accepted", name)
+		}
+	}
+}
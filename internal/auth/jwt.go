@@ -2,7 +2,6 @@ package auth
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -12,19 +11,42 @@ import (
 	"github.com/zulfikawr/vault/internal/models"
 )
 
+const (
+	TokenTypeAuth  = "auth"
+	TokenTypeAdmin = "admin"
+)
+
 type Claims struct {
 	RecordID   string `json:"record_id"`
 	Collection string `json:"collection"`
+	Type       string `json:"type"`
 	RequestID  string `json:"request_id"`
+
+	// Set for API keys only, which are never encoded as tokens.
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
+
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(ctx context.Context, record *models.Record, secret string, expiryHours int) (string, error) {
+// IsAdmin reports whether the token was issued to a record of the admins
+// collection through the admin login endpoint.
+func (c *Claims) IsAdmin() bool {
+	return c.Type == TokenTypeAdmin && c.Collection == models.AdminsCollection
+}
+
+func GenerateToken(ctx context.Context, record *models.Record, keys *KeySet, expiryHours int) (string, error) {
 	requestID := core.GetRequestID(ctx)
 
+	tokenType := TokenTypeAuth
+	if record.Collection == models.AdminsCollection {
+		tokenType = TokenTypeAdmin
+	}
+
 	claims := Claims{
 		RecordID:   record.ID,
 		Collection: record.Collection,
+		Type:       tokenType,
 		RequestID:  requestID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiryHours) * time.Hour)),
@@ -34,8 +56,7 @@ func GenerateToken(ctx context.Context, record *models.Record, secret string, ex
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := keys.sign(claims)
 	if err != nil {
 		return "", errors.NewError(http.StatusInternalServerError, "TOKEN_GENERATION_FAILED", "Failed to sign token").WithDetails(map[string]any{"error": err.Error()})
 	}
@@ -43,13 +64,9 @@ func GenerateToken(ctx context.Context, record *models.Record, secret string, ex
 	return tokenString, nil
 }
 
-func ValidateToken(ctx context.Context, tokenStr string, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+func ValidateToken(ctx context.Context, tokenStr string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keys.verificationKey,
+		jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}))
 
 	if err != nil {
 		return nil, errors.NewError(http.StatusUnauthorized, "INVALID_TOKEN", "Token validation failed").WithDetails(map[string]any{"error": err.Error()})
@@ -0,0 +1,422 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms supported for access tokens.
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const rsaKeyBits = 2048
+
+// SigningKey is an asymmetric key of the keyset. Retired keys no longer sign
+// tokens but still verify the tokens they signed until those expire.
+type SigningKey struct {
+	ID         string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	PrivateKey string     `json:"private_key"`
+	Created    time.Time  `json:"created"`
+	Retired    *time.Time `json:"retired,omitempty"`
+
+	signer crypto.Signer
+}
+
+// KeySet holds the keys used to sign and verify access tokens. HS256 tokens
+// are signed with the shared secret; RS256 and EdDSA tokens are signed with
+// the active key of the keyset file and carry its ID in the kid header.
+type KeySet struct {
+	mu        sync.RWMutex
+	path      string
+	algorithm string
+	secret    []byte
+	overlap   time.Duration
+	keys      []*SigningKey
+	modTime   time.Time
+
+	// hmacRetired is when the keyset switched from HS256 to an asymmetric
+	// algorithm. HS256 tokens verify for the overlap period after it, like
+	// the tokens of a retired key.
+	hmacRetired *time.Time
+}
+
+// NewHMACKeySet returns a keyset that signs and verifies HS256 tokens only.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{algorithm: AlgorithmHS256, secret: []byte(secret)}
+}
+
+// LoadKeySet reads the keyset file at path. When algorithm is asymmetric and
+// the file has no active key for it, a key is generated and saved. Retired
+// keys are kept for overlap, which should be at least the token lifetime.
+func LoadKeySet(path, algorithm, secret string, overlap time.Duration) (*KeySet, error) {
+	if algorithm == "" {
+		algorithm = AlgorithmHS256
+	}
+	if !slices.Contains([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}, algorithm) {
+		return nil, fmt.Errorf("unsupported jwt algorithm: %s", algorithm)
+	}
+
+	ks := &KeySet{path: path, algorithm: algorithm, secret: []byte(secret), overlap: overlap}
+
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+
+	changed := ks.prune()
+	if algorithm == AlgorithmHS256 && ks.hmacRetired != nil {
+		ks.hmacRetired = nil
+		changed = true
+	}
+	if algorithm != AlgorithmHS256 && ks.hmacRetired == nil {
+		now := time.Now().UTC()
+		ks.hmacRetired = &now
+		changed = true
+	}
+	if algorithm != AlgorithmHS256 {
+		if active := ks.active(); active == nil || active.Algorithm != algorithm {
+			if _, err := ks.rotate(algorithm); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+	}
+	if changed {
+		if err := ks.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// Algorithm returns the algorithm new tokens are signed with.
+func (ks *KeySet) Algorithm() string {
+	return ks.algorithm
+}
+
+// Keys returns the asymmetric keys of the keyset, newest first.
+func (ks *KeySet) Keys() []*SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := slices.Clone(ks.keys)
+	slices.Reverse(keys)
+	return keys
+}
+
+// Rotate generates a new active key for the algorithm and retires the
+// previous one, which keeps verifying tokens for the overlap period.
+func (ks *KeySet) Rotate(algorithm string) (*SigningKey, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("only %s and %s keys can be rotated", AlgorithmRS256, AlgorithmEdDSA)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.prune()
+	key, err := ks.rotate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.save(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sign signs the token with the secret or the active key.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.algorithm == AlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+
+	ks.reloadIfChanged()
+
+	ks.mu.RLock()
+	key := ks.active()
+	ks.mu.RUnlock()
+	if key == nil {
+		return "", fmt.Errorf("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// verificationKey resolves the key that verifies the token. After switching
+// to an asymmetric algorithm, HS256 tokens are accepted for the overlap
+// period only, so that the switch does not sign everyone out.
+func (ks *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if token.Method.Alg() != AlgorithmHS256 || len(ks.secret) == 0 || !ks.acceptsHMAC() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ks.secret, nil
+	}
+
+	ks.reloadIfChanged()
+
+	kid, _ := token.Header["kid"].(string)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID == kid && key.Algorithm == token.Method.Alg() && !ks.expired(key) {
+			return key.signer.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key: %q", kid)
+}
+
+// JWKS returns the public keys that verify tokens, as a JSON Web Key Set.
+func (ks *KeySet) JWKS() map[string]any {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]map[string]any, 0, len(ks.keys))
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		key := ks.keys[i]
+		if ks.expired(key) {
+			continue
+		}
+		jwk := map[string]any{
+			"kid": key.ID,
+			"alg": key.Algorithm,
+			"use": "sig",
+		}
+		switch public := key.signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]any{"keys": keys}
+}
+
+// acceptsHMAC reports whether HS256 tokens still verify.
+func (ks *KeySet) acceptsHMAC() bool {
+	if ks.algorithm == AlgorithmHS256 {
+		return true
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.hmacRetired != nil && time.Since(*ks.hmacRetired) <= ks.overlap
+}
+
+func (ks *KeySet) active() *SigningKey {
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].Retired == nil {
+			return ks.keys[i]
+		}
+	}
+	return nil
+}
+
+func (ks *KeySet) rotate(algorithm string) (*SigningKey, error) {
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for _, existing := range ks.keys {
+		if existing.Retired == nil {
+			existing.Retired = &now
+		}
+	}
+	ks.keys = append(ks.keys, key)
+	return key, nil
+}
+
+// expired reports whether a retired key outlived the overlap period.
+func (ks *KeySet) expired(key *SigningKey) bool {
+	return key.Retired != nil && time.Since(*key.Retired) > ks.overlap
+}
+
+// prune drops expired keys and reports whether any were dropped.
+func (ks *KeySet) prune() bool {
+	before := len(ks.keys)
+	ks.keys = slices.DeleteFunc(ks.keys, ks.expired)
+	return len(ks.keys) != before
+}
+
+// load reads the keys from the keyset file, if it exists.
+func (ks *KeySet) load() error {
+	info, err := os.Stat(ks.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read keyset: %w", err)
+	}
+
+	content, err := os.ReadFile(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to read keyset: %w", err)
+	}
+
+	var file struct {
+		Keys        []*SigningKey `json:"keys"`
+		HMACRetired *time.Time    `json:"hs256_retired"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("failed to parse keyset: %w", err)
+	}
+	for _, key := range file.Keys {
+		if err := key.parse(); err != nil {
+			return fmt.Errorf("failed to parse key %s: %w", key.ID, err)
+		}
+	}
+
+	ks.keys = file.Keys
+	ks.hmacRetired = file.HMACRetired
+	ks.modTime = info.ModTime()
+	return nil
+}
+
+// reloadIfChanged picks up keys rotated by another process, such as
+// `vault keys rotate` while the server is running.
+func (ks *KeySet) reloadIfChanged() {
+	if ks.path == "" {
+		return
+	}
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if info.ModTime().Equal(ks.modTime) {
+		return
+	}
+	if err := ks.load(); err != nil {
+		slog.Error("Failed to reload keyset", "path", ks.path, "error", err)
+	}
+}
+
+func (ks *KeySet) save() error {
+	if ks.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return fmt.Errorf("failed to create keyset directory: %w", err)
+	}
+
+	file := map[string]any{"keys": ks.keys}
+	if ks.hmacRetired != nil {
+		file["hs256_retired"] = ks.hmacRetired
+	}
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := ks.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("failed to write keyset: %w", err)
+	}
+	if err := os.Rename(tmp, ks.path); err != nil {
+		return fmt.Errorf("failed to write keyset: %w", err)
+	}
+
+	if info, err := os.Stat(ks.path); err == nil {
+		ks.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func generateKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:         id[:16],
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		Created:    time.Now().UTC(),
+		signer:     signer,
+	}, nil
+}
+
+func (k *SigningKey) parse() error {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return fmt.Errorf("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.Algorithm != AlgorithmRS256 {
+			return fmt.Errorf("RSA key declared as %s", k.Algorithm)
+		}
+		k.signer = key
+	case ed25519.PrivateKey:
+		if k.Algorithm != AlgorithmEdDSA {
+			return fmt.Errorf("Ed25519 key declared as %s", k.Algorithm)
+		}
+		k.signer = key
+	default:
+		return fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return nil
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
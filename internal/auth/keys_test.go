@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestKeySetRotation(t *testing.T) {
+	ctx := context.Background()
+	record := &models.Record{ID: "usr_1", Collection: "users"}
+
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			keys, err := LoadKeySet(path, algorithm, "secret", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before, err := GenerateToken(ctx, record, keys, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := keys.Rotate(algorithm); err != nil {
+				t.Fatal(err)
+			}
+			after, err := GenerateToken(ctx, record, keys, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A second process loading the same file verifies both tokens.
+			reloaded, err := LoadKeySet(path, algorithm, "secret", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, token := range []string{before, after} {
+				claims, err := ValidateToken(ctx, token, reloaded)
+				if err != nil {
+					t.Fatalf("token rejected after rotation: %v", err)
+				}
+				if claims.RecordID != "usr_1" {
+					t.Errorf("unexpected record id %q", claims.RecordID)
+				}
+			}
+
+			if got := len(reloaded.JWKS()["keys"].([]map[string]any)); got != 2 {
+				t.Errorf("expected 2 published keys during overlap, got %d", got)
+			}
+
+			// Once the overlap has passed the retired key no longer verifies.
+			expired, err := LoadKeySet(path, algorithm, "secret", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ValidateToken(ctx, before, expired); err == nil {
+				t.Error("token of expired key accepted")
+			}
+			if _, err := ValidateToken(ctx, after, expired); err != nil {
+				t.Errorf("token of active key rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySetHMAC(t *testing.T) {
+	ctx := context.Background()
+	record := &models.Record{ID: "usr_1", Collection: "users"}
+
+	hmacToken, err := GenerateToken(ctx, record, NewHMACKeySet("secret"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Switching to an asymmetric algorithm keeps HS256 tokens valid for the
+	// overlap period.
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := LoadKeySet(path, AlgorithmEdDSA, "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(ctx, hmacToken, keys); err != nil {
+		t.Errorf("HS256 token rejected: %v", err)
+	}
+
+	// Once the overlap has passed, they no longer are, and a leaked secret
+	// cannot mint tokens.
+	expired, err := LoadKeySet(path, AlgorithmEdDSA, "secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(ctx, hmacToken, expired); err == nil {
+		t.Error("HS256 token accepted after the overlap")
+	}
+
+	if _, err := ValidateToken(ctx, hmacToken, NewHMACKeySet("other")); err == nil {
+		t.Error("HS256 token accepted with the wrong secret")
+	}
+	if _, err := LoadKeySet(filepath.Join(t.TempDir(), "keys.json"), "none", "", time.Hour); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+// DefaultOAuthScopes are requested when a provider does not list its own.
+var DefaultOAuthScopes = []string{"openid", "email", "profile"}
+
+// OAuthIdentity is the account a user signed in with at a provider.
+type OAuthIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// OAuthClient runs the authorization code flow with PKCE against one
+// provider. Endpoints missing from the provider config are read from the
+// issuer's OpenID discovery document on first use.
+type OAuthClient struct {
+	provider core.OAuthProvider
+	http     *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	issuer      string
+	authURL     string
+	tokenURL    string
+	userInfoURL string
+	jwksURL     string
+	keys        map[string]crypto.PublicKey
+}
+
+func NewOAuthClient(provider core.OAuthProvider, httpClient *http.Client) *OAuthClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OAuthClient{provider: provider, http: httpClient}
+}
+
+// Provider returns the configuration the client was created with.
+func (c *OAuthClient) Provider() core.OAuthProvider {
+	return c.provider
+}
+
+// NewPKCE returns a PKCE code verifier and its S256 challenge.
+func NewPKCE() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(buf)
+	return verifier, PKCEChallenge(verifier), nil
+}
+
+// PKCEChallenge derives the S256 code challenge of a verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OAuthNonce derives the OpenID nonce from the code verifier, which binds the
+// ID token to the same client without storing any state on the server.
+func OAuthNonce(verifier string) string {
+	sum := sha256.Sum256([]byte("nonce:" + verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider URL the user is sent to. When redirectURL
+// is empty the URL ends with "redirect_uri=" for the client to complete.
+func (c *OAuthClient) AuthCodeURL(ctx context.Context, state, verifier, redirectURL string) (string, error) {
+	if err := c.discover(ctx); err != nil {
+		return "", err
+	}
+
+	scopes := c.provider.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultOAuthScopes
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.provider.ClientID},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if slices.Contains(scopes, "openid") {
+		params.Set("nonce", OAuthNonce(verifier))
+	}
+
+	separator := "?"
+	if strings.Contains(c.authURL, "?") {
+		separator = "&"
+	}
+	return c.authURL + separator + params.Encode() + "&redirect_uri=" + url.QueryEscape(redirectURL), nil
+}
+
+// Exchange redeems an authorization code and returns the identity it was
+// issued for. A signed ID token is preferred; otherwise the userinfo
+// endpoint is queried with the access token.
+func (c *OAuthClient) Exchange(ctx context.Context, code, verifier, redirectURL string) (*OAuthIdentity, error) {
+	if err := c.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {c.provider.ClientID},
+		"client_secret": {c.provider.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := c.doJSON(req, &token); err != nil {
+		if token.Error != "" {
+			return nil, fmt.Errorf("token exchange failed: %s %s", token.Error, token.Description)
+		}
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+
+	if token.IDToken != "" && c.jwksURL != "" {
+		return c.verifyIDToken(ctx, token.IDToken, verifier)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token")
+	}
+	return c.userInfo(ctx, token.AccessToken)
+}
+
+func (c *OAuthClient) verifyIDToken(ctx context.Context, idToken, verifier string) (*OAuthIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "PS256", "EdDSA"}),
+		jwt.WithAudience(c.provider.ClientID),
+		jwt.WithIssuer(c.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if nonce, ok := claims["nonce"].(string); ok && nonce != OAuthNonce(verifier) {
+		return nil, fmt.Errorf("invalid id token: nonce mismatch")
+	}
+
+	return identityFromClaims(claims)
+}
+
+func (c *OAuthClient) userInfo(ctx context.Context, accessToken string) (*OAuthIdentity, error) {
+	if c.userInfoURL == "" {
+		return nil, fmt.Errorf("provider %s has no userinfo endpoint", c.provider.Name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	claims := map[string]any{}
+	if err := c.doJSON(req, &claims); err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+	return identityFromClaims(claims)
+}
+
+// discover fills in the endpoints from the provider config or, for those
+// left empty, the issuer's discovery document.
+func (c *OAuthClient) discover(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovered {
+		return nil
+	}
+
+	p := c.provider
+	c.issuer, c.authURL, c.tokenURL, c.userInfoURL, c.jwksURL = p.Issuer, p.AuthURL, p.TokenURL, p.UserInfoURL, p.JWKSURL
+
+	if p.Issuer != "" && (c.authURL == "" || c.tokenURL == "" || c.jwksURL == "") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return err
+		}
+
+		var doc struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+			TokenEndpoint         string `json:"token_endpoint"`
+			UserInfoEndpoint      string `json:"userinfo_endpoint"`
+			JWKSURI               string `json:"jwks_uri"`
+		}
+		if err := c.doJSON(req, &doc); err != nil {
+			return fmt.Errorf("openid discovery failed for %s: %w", p.Name, err)
+		}
+		if doc.Issuer != "" && doc.Issuer != p.Issuer {
+			return fmt.Errorf("openid discovery for %s returned issuer %q", p.Name, doc.Issuer)
+		}
+
+		c.authURL = firstNonEmpty(c.authURL, doc.AuthorizationEndpoint)
+		c.tokenURL = firstNonEmpty(c.tokenURL, doc.TokenEndpoint)
+		c.userInfoURL = firstNonEmpty(c.userInfoURL, doc.UserInfoEndpoint)
+		c.jwksURL = firstNonEmpty(c.jwksURL, doc.JWKSURI)
+	}
+
+	if c.authURL == "" || c.tokenURL == "" {
+		return fmt.Errorf("provider %s has no authorization or token endpoint", p.Name)
+	}
+
+	c.discovered = true
+	return nil
+}
+
+// publicKey returns the provider key with the ID, refetching the key set
+// once when the ID is unknown so that provider key rotation is picked up.
+func (c *OAuthClient) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := c.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+
+	c.keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		id, _ := jwk["kid"].(string)
+		c.keys[id] = key
+	}
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown provider key %q", kid)
+}
+
+func (c *OAuthClient) doJSON(req *http.Request, out any) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, out)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return decodeErr
+}
+
+func identityFromClaims(claims map[string]any) (*OAuthIdentity, error) {
+	identity := &OAuthIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		// Some OAuth2-only providers return a numeric id instead of sub.
+		if id, ok := claims["id"]; ok {
+			identity.Subject = fmt.Sprint(id)
+		}
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("identity has no subject")
+	}
+
+	identity.Email, _ = claims["email"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	identity.Name, _ = claims["name"].(string)
+	identity.Username, _ = claims["preferred_username"].(string)
+	if identity.Username == "" {
+		identity.Username, _ = claims["login"].(string)
+	}
+	return identity, nil
+}
+
+func parseJWK(jwk map[string]any) (crypto.PublicKey, error) {
+	field := func(name string) ([]byte, error) {
+		value, _ := jwk[name].(string)
+		return base64.RawURLEncoding.DecodeString(value)
+	}
+
+	switch jwk["kty"] {
+	case "RSA":
+		n, err := field("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := field("e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk["crv"] {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v", jwk["crv"])
+		}
+		x, err := field("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := field("y")
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := field("x")
+		if err != nil {
+			return nil, err
+		}
+		if jwk["crv"] != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %v", jwk["kty"])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -20,3 +20,9 @@ func ComparePasswords(hashed, plain string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain))
 	return err == nil
 }
+
+// IsHashed reports whether the value is already a bcrypt hash.
+func IsHashed(value string) bool {
+	_, err := bcrypt.Cost([]byte(value))
+	return err == nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// sealPrefix marks values sealed with SealSecret.
+const sealPrefix = "v1:"
+
+// DeriveKey derives a 256-bit key for one purpose, named by label, from the
+// server secret, so that each use of the secret gets a key of its own.
+func DeriveKey(secret, label string) []byte {
+	key, err := hkdf.Key(sha256.New, []byte(secret), nil, "vault "+label, 32)
+	if err != nil {
+		// Only possible for lengths hkdf cannot produce.
+		panic(err)
+	}
+	return key
+}
+
+// SealSecret encrypts a secret to be stored with AES-256-GCM under the key.
+func SealSecret(key []byte, secret string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), nil)
+	return sealPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSecret decrypts a secret sealed with SealSecret under the same key.
+func OpenSecret(key []byte, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealPrefix)
+	if !ok {
+		return "", fmt.Errorf("secret is not sealed")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed secret: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid sealed secret")
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to open sealed secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSealSecret(t *testing.T) {
+	key := DeriveKey("secret", "mfa-secret")
+	if bytes.Equal(key, DeriveKey("secret", "file-token")) || bytes.Equal(key, DeriveKey("other", "mfa-secret")) {
+		t.Fatal("expected keys to differ by label and secret")
+	}
+
+	sealed, err := SealSecret(key, "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("expected the secret to be encrypted, got %q", sealed)
+	}
+	if again, _ := SealSecret(key, "JBSWY3DPEHPK3PXP"); again == sealed {
+		t.Error("expected a fresh nonce for each seal")
+	}
+	if secret, err := OpenSecret(key, sealed); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected the secret back, got %q %v", secret, err)
+	}
+
+	if _, err := OpenSecret(DeriveKey("other", "mfa-secret"), sealed); err == nil {
+		t.Error("expected another key to fail")
+	}
+	for _, value := range []string{"JBSWY3DPEHPK3PXP", "v1:", "v1:!!", sealed[:len(sealed)-2]} {
+		if _, err := OpenSecret(key, value); err == nil {
+			t.Errorf("expected %q to fail", value)
+		}
+	}
+}
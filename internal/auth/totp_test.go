@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 SHA1 test vectors, truncated to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+	step, ok := ValidateTOTP(secret, previous, now, 0)
+	if !ok || step != TOTPStep(now)-1 {
+		t.Fatalf("code of the previous period rejected")
+	}
+	if _, ok := ValidateTOTP(secret, previous, now, step); ok {
+		t.Error("code accepted twice")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", now, 0); ok {
+		t.Error("wrong code accepted")
+	}
+
+	uri := TOTPProvisioningURI("Vault", "jane@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Vault:jane@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected provisioning uri %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(codes[0]) != 11 || codes[0] == codes[1] {
+		t.Fatalf("unexpected recovery codes %v", codes)
+	}
+	if got := NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))); got != codes[0] {
+		t.Errorf("NormalizeRecoveryCode = %s, want %s", got, codes[0])
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
 	"github.com/zulfikawr/vault/internal/service"
 )
 
@@ -18,6 +19,11 @@ type AdminCommand struct {
 	db                *sql.DB
 	recordService     *service.RecordService
 	collectionService *service.CollectionService
+	roleService       *service.RoleService
+	sessionService    *service.SessionService
+	mfaService        *service.MFAService
+	apiKeyService     *service.APIKeyService
+	lockoutService    *service.LockoutService
 }
 
 func NewAdminCommand(config *core.Config) *AdminCommand {
@@ -56,9 +62,13 @@ func (ac *AdminCommand) Run(args []string) error {
 
 	ac.collectionService = service.NewCollectionService(registry, migration)
 	ac.recordService = service.NewRecordService(repo, nil)
+	ac.roleService = service.NewRoleService(ac.recordService)
+	ac.sessionService = service.NewSessionService(ac.recordService)
+	ac.lockoutService = service.NewLockoutService(ac.recordService, ac.config)
+	ac.mfaService = service.NewMFAService(ac.recordService, ac.lockoutService, service.MFAIssuer, service.MFAKey(ac.config.JWTSecret))
+	ac.apiKeyService = service.NewAPIKeyService(ac.recordService)
 
-	// Initialize system and hooks
-	service.RegisterAuthHooks()
+	// Initialize system
 	// Note: We don't call InitSystem here automatically for all commands,
 	// but Create command might need it. Actually, Create command does bootstrap.
 	// Let's defer InitSystem to Create command or do it here if it's safe.
@@ -72,6 +82,9 @@ func (ac *AdminCommand) Run(args []string) error {
 		return fmt.Errorf("failed to load schema: %w", err)
 	}
 
+	// Register auth hooks once every auth collection is known
+	service.RegisterAuthHooks(registry.GetCollections())
+
 	switch subcommand {
 	case "create":
 		return ac.Create(ctx, args[1:])
@@ -81,6 +94,16 @@ func (ac *AdminCommand) Run(args []string) error {
 		return ac.Delete(ctx, args[1:])
 	case "reset-password":
 		return ac.ResetPassword(ctx, args[1:])
+	case "roles":
+		return ac.Roles(ctx, args[1:])
+	case "sessions":
+		return ac.Sessions(ctx, args[1:])
+	case "mfa":
+		return ac.MFA(ctx, args[1:])
+	case "api-keys":
+		return ac.APIKeys(ctx, args[1:])
+	case "lockouts":
+		return ac.Lockouts(ctx, args[1:])
 	default:
 		ac.printUsage()
 		return fmt.Errorf("unknown admin subcommand: %s", subcommand)
@@ -101,32 +124,32 @@ func (ac *AdminCommand) Create(ctx context.Context, args []string) error {
 		return fmt.Errorf("email, password, and username are required")
 	}
 
-	// Check if user exists (email)
-	records, _, err := ac.recordService.ListRecords(ctx, "users", db.QueryParams{Filter: fmt.Sprintf("email = '%s'", *email)})
+	// Check if admin exists (email)
+	records, _, err := ac.recordService.ListRecords(ctx, models.AdminsCollection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(*email)})
 	if err != nil {
-		return fmt.Errorf("failed to check existing user: %w", err)
+		return fmt.Errorf("failed to check existing admin: %w", err)
 	}
 	if len(records) > 0 {
-		return fmt.Errorf("user with email %s already exists", *email)
+		return fmt.Errorf("admin with email %s already exists", *email)
 	}
 
-	// Check if user exists (username)
-	records, _, err = ac.recordService.ListRecords(ctx, "users", db.QueryParams{Filter: fmt.Sprintf("username = '%s'", *username)})
+	// Check if admin exists (username)
+	records, _, err = ac.recordService.ListRecords(ctx, models.AdminsCollection, db.QueryParams{Filter: "username = " + db.QuoteFilterValue(*username)})
 	if err != nil {
-		return fmt.Errorf("failed to check existing user: %w", err)
+		return fmt.Errorf("failed to check existing admin: %w", err)
 	}
 	if len(records) > 0 {
-		return fmt.Errorf("user with username %s already exists", *username)
+		return fmt.Errorf("admin with username %s already exists", *username)
 	}
 
-	// Create user
+	// Create admin
 	data := map[string]any{
 		"email":    *email,
 		"username": *username,
 		"password": *password, // Will be hashed by hook
 	}
 
-	record, err := ac.recordService.CreateRecord(ctx, "users", data)
+	record, err := ac.recordService.CreateRecord(ctx, models.AdminsCollection, data)
 	if err != nil {
 		return fmt.Errorf("failed to create admin user: %w", err)
 	}
@@ -145,11 +168,11 @@ func (ac *AdminCommand) List(ctx context.Context, args []string) error {
 		return err
 	}
 
-	records, _, err := ac.recordService.ListRecords(ctx, "users", db.QueryParams{
+	records, _, err := ac.recordService.ListRecords(ctx, models.AdminsCollection, db.QueryParams{
 		Sort: "-created",
 	})
 	if err != nil {
-		return fmt.Errorf("failed to list users: %w", err)
+		return fmt.Errorf("failed to list admins: %w", err)
 	}
 
 	if len(records) == 0 {
@@ -192,13 +215,13 @@ func (ac *AdminCommand) Delete(ctx context.Context, args []string) error {
 		return fmt.Errorf("email is required")
 	}
 
-	// Find user
-	records, _, err := ac.recordService.ListRecords(ctx, "users", db.QueryParams{Filter: fmt.Sprintf("email = '%s'", *email)})
+	// Find admin
+	records, _, err := ac.recordService.ListRecords(ctx, models.AdminsCollection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(*email)})
 	if err != nil {
-		return fmt.Errorf("failed to find user: %w", err)
+		return fmt.Errorf("failed to find admin: %w", err)
 	}
 	if len(records) == 0 {
-		return fmt.Errorf("user with email %s not found", *email)
+		return fmt.Errorf("admin with email %s not found", *email)
 	}
 	user := records[0]
 
@@ -215,9 +238,9 @@ func (ac *AdminCommand) Delete(ctx context.Context, args []string) error {
 		}
 	}
 
-	// Delete user
-	if err := ac.recordService.DeleteRecord(ctx, "users", user.ID); err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+	// Delete admin
+	if err := ac.recordService.DeleteRecord(ctx, models.AdminsCollection, user.ID); err != nil {
+		return fmt.Errorf("failed to delete admin: %w", err)
 	}
 
 	fmt.Printf("✓ Admin user deleted successfully\n")
@@ -248,13 +271,13 @@ func (ac *AdminCommand) ResetPassword(ctx context.Context, args []string) error
 		return fmt.Errorf("password must be at least 8 characters long")
 	}
 
-	// Find user
-	records, _, err := ac.recordService.ListRecords(ctx, "users", db.QueryParams{Filter: fmt.Sprintf("email = '%s'", *email)})
+	// Find admin
+	records, _, err := ac.recordService.ListRecords(ctx, models.AdminsCollection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(*email)})
 	if err != nil {
-		return fmt.Errorf("failed to find user: %w", err)
+		return fmt.Errorf("failed to find admin: %w", err)
 	}
 	if len(records) == 0 {
-		return fmt.Errorf("user with email %s not found", *email)
+		return fmt.Errorf("admin with email %s not found", *email)
 	}
 	user := records[0]
 
@@ -264,7 +287,7 @@ func (ac *AdminCommand) ResetPassword(ctx context.Context, args []string) error
 		"password": *newPassword,
 	}
 
-	if _, err := ac.recordService.UpdateRecord(ctx, "users", user.ID, data); err != nil {
+	if _, err := ac.recordService.UpdateRecord(ctx, models.AdminsCollection, user.ID, data); err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
@@ -282,4 +305,9 @@ func (ac *AdminCommand) printUsage() {
 	fmt.Println("  list")
 	fmt.Println("  delete --email EMAIL [--force]")
 	fmt.Println("  reset-password --email EMAIL --password PASSWORD")
+	fmt.Println("  roles <list|create|delete|grant|revoke|assign|unassign> [options]")
+	fmt.Println("  sessions <list|revoke> --email EMAIL [--collection users]")
+	fmt.Println("  mfa <reset|require> [options]")
+	fmt.Println("  api-keys <create|list|revoke> [options]")
+	fmt.Println("  lockouts <list|clear> [options]")
 }
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/service"
+)
+
+func (ac *AdminCommand) APIKeys(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
+		ac.printAPIKeysUsage()
+		if len(args) < 1 {
+			return fmt.Errorf("no api-keys subcommand provided")
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "create":
+		return ac.CreateAPIKey(ctx, args[1:])
+	case "list":
+		return ac.ListAPIKeys(ctx, args[1:])
+	case "revoke":
+		return ac.RevokeAPIKey(ctx, args[1:])
+	default:
+		ac.printAPIKeysUsage()
+		return fmt.Errorf("unknown api-keys subcommand: %s", args[0])
+	}
+}
+
+// CreateAPIKey issues an API key acting as an auth record. The key is
+// printed once and cannot be shown again.
+func (ac *AdminCommand) CreateAPIKey(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin api-keys create", flag.ContinueOnError)
+	email := cmd.String("email", "", "Email of the auth record the key acts as")
+	collection := cmd.String("collection", "users", "Auth collection of the record")
+	name := cmd.String("name", "", "Name of the key")
+	scopes := cmd.String("scopes", "", "Comma separated collection:action scopes, e.g. posts:list,posts:view")
+	expires := cmd.Duration("expires", 0, "Lifetime of the key, e.g. 720h (default: never expires)")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	record, err := ac.findAuthRecord(ctx, *collection, *email)
+	if err != nil {
+		return err
+	}
+
+	input := service.APIKeyInput{Name: *name, Collection: *collection, RecordID: record.ID}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			input.Scopes = append(input.Scopes, scope)
+		}
+	}
+	if *expires > 0 {
+		input.Expires = time.Now().Add(*expires)
+	}
+
+	key, apiKey, err := ac.apiKeyService.Create(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	fmt.Printf("✓ API key created successfully\n")
+	fmt.Printf("  ID: %s\n", apiKey.ID)
+	fmt.Printf("  Scopes: %s\n", strings.Join(apiKey.Scopes, ", "))
+	if apiKey.Expires != "" {
+		fmt.Printf("  Expires: %s\n", apiKey.Expires)
+	}
+	fmt.Printf("  Key: %s\n", key)
+	fmt.Println("\nStore the key now, it will not be shown again.")
+
+	return nil
+}
+
+func (ac *AdminCommand) ListAPIKeys(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin api-keys list", flag.ContinueOnError)
+	email := cmd.String("email", "", "Only list keys of this auth record")
+	collection := cmd.String("collection", "users", "Auth collection of the record")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	recordID := ""
+	if *email != "" {
+		record, err := ac.findAuthRecord(ctx, *collection, *email)
+		if err != nil {
+			return err
+		}
+		recordID = record.ID
+	}
+
+	keys, err := ac.apiKeyService.List(ctx, *collection, recordID)
+	if err != nil {
+		return fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No API keys found")
+		return nil
+	}
+
+	fmt.Printf("Total API keys: %d\n\n", len(keys))
+	fmt.Printf("%-38s %-12s %-20s %-22s %-22s %s\n", "ID", "Prefix", "Name", "Expires", "Last Used", "Scopes")
+	fmt.Println(strings.Repeat("-", 140))
+	for _, key := range keys {
+		expires := key.Expires
+		if expires == "" {
+			expires = "never"
+		}
+		fmt.Printf("%-38s %-12s %-20s %-22s %-22s %s\n", key.ID, key.Prefix, key.Name, expires, key.LastUsed, strings.Join(key.Scopes, ","))
+	}
+
+	return nil
+}
+
+func (ac *AdminCommand) RevokeAPIKey(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin api-keys revoke", flag.ContinueOnError)
+	id := cmd.String("id", "", "ID of the API key")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	if *id == "" {
+		return fmt.Errorf("--id is required")
+	}
+
+	if err := ac.apiKeyService.Revoke(ctx, *id); err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	fmt.Printf("✓ API key %s revoked\n", *id)
+
+	return nil
+}
+
+func (ac *AdminCommand) printAPIKeysUsage() {
+	fmt.Println("Usage: vault admin api-keys <subcommand> [options]")
+	fmt.Println("Subcommands:")
+	fmt.Println("  create --email EMAIL --name NAME --scopes SCOPES [--collection users] [--expires 720h]")
+	fmt.Println("  list [--email EMAIL] [--collection users]")
+	fmt.Println("  revoke --id ID")
+}
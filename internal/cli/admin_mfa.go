@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func (ac *AdminCommand) MFA(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
+		ac.printMFAUsage()
+		if len(args) < 1 {
+			return fmt.Errorf("no mfa subcommand provided")
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "reset":
+		return ac.ResetMFA(ctx, args[1:])
+	case "require":
+		return ac.RequireMFA(ctx, args[1:])
+	default:
+		ac.printMFAUsage()
+		return fmt.Errorf("unknown mfa subcommand: %s", args[0])
+	}
+}
+
+// ResetMFA removes the authenticator of an auth record that lost it, along
+// with its recovery codes. The record signs in with its password alone
+// until it enrolls again, unless its collection requires MFA.
+func (ac *AdminCommand) ResetMFA(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin mfa reset", flag.ContinueOnError)
+	email := cmd.String("email", "", "Email of the auth record")
+	collection := cmd.String("collection", "users", "Auth collection of the record")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	record, err := ac.findAuthRecord(ctx, *collection, *email)
+	if err != nil {
+		return err
+	}
+
+	removed, err := ac.mfaService.Reset(ctx, *collection, record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reset mfa: %w", err)
+	}
+	if !removed {
+		fmt.Printf("%s has no authenticator enrolled\n", *email)
+		return nil
+	}
+
+	fmt.Printf("✓ MFA reset successfully\n")
+	fmt.Printf("  Email: %s\n", *email)
+
+	return nil
+}
+
+// RequireMFA makes every record of an auth collection complete a TOTP
+// challenge on login, enrolling on its next login if needed.
+func (ac *AdminCommand) RequireMFA(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin mfa require", flag.ContinueOnError)
+	collection := cmd.String("collection", "users", "Auth collection")
+	off := cmd.Bool("off", false, "Stop requiring MFA")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	col, ok := ac.collectionService.GetCollection(*collection)
+	if !ok || col.Type != models.CollectionTypeAuth {
+		return fmt.Errorf("auth collection %s not found", *collection)
+	}
+
+	col.Options.MFARequired = !*off
+	if err := ac.collectionService.CreateCollection(ctx, col); err != nil {
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+
+	if *off {
+		fmt.Printf("✓ MFA is now optional for %s\n", *collection)
+	} else {
+		fmt.Printf("✓ MFA is now required for %s\n", *collection)
+	}
+
+	return nil
+}
+
+func (ac *AdminCommand) printMFAUsage() {
+	fmt.Println("Usage: vault admin mfa <subcommand> [options]")
+	fmt.Println("Subcommands:")
+	fmt.Println("  reset --email EMAIL [--collection users]")
+	fmt.Println("  require [--collection users] [--off]")
+}
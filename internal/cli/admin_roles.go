@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func (ac *AdminCommand) Roles(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
+		ac.printRolesUsage()
+		if len(args) < 1 {
+			return fmt.Errorf("no roles subcommand provided")
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "list":
+		return ac.ListRoles(ctx, args[1:])
+	case "create":
+		return ac.CreateRole(ctx, args[1:])
+	case "delete":
+		return ac.DeleteRole(ctx, args[1:])
+	case "grant":
+		return ac.GrantRole(ctx, args[1:], true)
+	case "revoke":
+		return ac.GrantRole(ctx, args[1:], false)
+	case "assign":
+		return ac.AssignRole(ctx, args[1:], true)
+	case "unassign":
+		return ac.AssignRole(ctx, args[1:], false)
+	default:
+		ac.printRolesUsage()
+		return fmt.Errorf("unknown roles subcommand: %s", args[0])
+	}
+}
+
+func (ac *AdminCommand) ListRoles(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin roles list", flag.ContinueOnError)
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	roles, err := ac.roleService.ListRoles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	if len(roles) == 0 {
+		fmt.Println("No roles found")
+		return nil
+	}
+
+	fmt.Printf("Total roles: %d\n\n", len(roles))
+	for _, role := range roles {
+		fmt.Printf("%s", role.Name)
+		if role.Description != "" {
+			fmt.Printf(" - %s", role.Description)
+		}
+		fmt.Println()
+
+		collections := make([]string, 0, len(role.Collections))
+		for name := range role.Collections {
+			collections = append(collections, name)
+		}
+		slices.Sort(collections)
+		for _, name := range collections {
+			fmt.Printf("  %-20s %s\n", name, strings.Join(role.Collections[name], ", "))
+		}
+		if len(role.Permissions) > 0 {
+			fmt.Printf("  %-20s %s\n", "admin", strings.Join(role.Permissions, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (ac *AdminCommand) CreateRole(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin roles create", flag.ContinueOnError)
+	name := cmd.String("name", "", "Role name")
+	description := cmd.String("description", "", "Role description")
+	permissions := cmd.String("permissions", "", "Comma-separated admin permissions")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	role, err := ac.roleService.CreateRole(ctx, &models.Role{
+		Name:        *name,
+		Description: *description,
+		Permissions: splitList(*permissions),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	fmt.Printf("✓ Role created successfully\n")
+	fmt.Printf("  Name: %s\n", role.Name)
+
+	return nil
+}
+
+func (ac *AdminCommand) DeleteRole(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin roles delete", flag.ContinueOnError)
+	name := cmd.String("name", "", "Role name")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if err := ac.roleService.DeleteRole(ctx, *name); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	fmt.Printf("✓ Role deleted successfully\n")
+	fmt.Printf("  Name: %s\n", *name)
+
+	return nil
+}
+
+// GrantRole adds (or with grant false, removes) collection actions and admin
+// permissions on a role.
+func (ac *AdminCommand) GrantRole(ctx context.Context, args []string, grant bool) error {
+	verb := "grant"
+	if !grant {
+		verb = "revoke"
+	}
+
+	cmd := flag.NewFlagSet("admin roles "+verb, flag.ContinueOnError)
+	name := cmd.String("name", "", "Role name")
+	collection := cmd.String("collection", "", "Collection name, or * for all collections")
+	actions := cmd.String("actions", "", "Comma-separated actions: list,view,create,update,delete or *")
+	permissions := cmd.String("permissions", "", "Comma-separated admin permissions")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if *collection == "" && *permissions == "" {
+		return fmt.Errorf("either --collection or --permissions is required")
+	}
+
+	role, err := ac.roleService.GetRole(ctx, *name)
+	if err != nil {
+		return fmt.Errorf("failed to find role: %w", err)
+	}
+
+	if *collection != "" {
+		current := role.Collections[*collection]
+		requested := splitList(*actions)
+		if grant {
+			if len(requested) == 0 {
+				return fmt.Errorf("actions are required when granting a collection")
+			}
+			current = mergeList(current, requested)
+		} else if len(requested) == 0 {
+			current = nil
+		} else {
+			current = removeList(current, requested)
+		}
+
+		if len(current) == 0 {
+			delete(role.Collections, *collection)
+		} else {
+			role.Collections[*collection] = current
+		}
+	}
+
+	if *permissions != "" {
+		if grant {
+			role.Permissions = mergeList(role.Permissions, splitList(*permissions))
+		} else {
+			role.Permissions = removeList(role.Permissions, splitList(*permissions))
+		}
+	}
+
+	if _, err := ac.roleService.UpdateRole(ctx, *name, role); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	fmt.Printf("✓ Role updated successfully\n")
+	fmt.Printf("  Name: %s\n", *name)
+
+	return nil
+}
+
+// AssignRole adds (or with assign false, removes) a role on an auth record
+// identified by email.
+func (ac *AdminCommand) AssignRole(ctx context.Context, args []string, assign bool) error {
+	verb := "assign"
+	if !assign {
+		verb = "unassign"
+	}
+
+	cmd := flag.NewFlagSet("admin roles "+verb, flag.ContinueOnError)
+	name := cmd.String("name", "", "Role name")
+	email := cmd.String("email", "", "Email of the auth record")
+	collection := cmd.String("collection", "users", "Auth collection of the record")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" || *email == "" {
+		return fmt.Errorf("name and email are required")
+	}
+
+	record, err := ac.findAuthRecord(ctx, *collection, *email)
+	if err != nil {
+		return err
+	}
+
+	if assign {
+		err = ac.roleService.AssignRole(ctx, *collection, record.ID, *name)
+	} else {
+		err = ac.roleService.UnassignRole(ctx, *collection, record.ID, *name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s role: %w", verb, err)
+	}
+
+	if assign {
+		fmt.Printf("✓ Role assigned successfully\n")
+	} else {
+		fmt.Printf("✓ Role unassigned successfully\n")
+	}
+	fmt.Printf("  Role: %s\n", *name)
+	fmt.Printf("  Email: %s\n", *email)
+
+	return nil
+}
+
+func (ac *AdminCommand) printRolesUsage() {
+	fmt.Println("Usage: vault admin roles <subcommand> [options]")
+	fmt.Println("Subcommands:")
+	fmt.Println("  list")
+	fmt.Println("  create --name NAME [--description TEXT] [--permissions PERMS]")
+	fmt.Println("  delete --name NAME")
+	fmt.Println("  grant --name NAME [--collection NAME --actions ACTIONS] [--permissions PERMS]")
+	fmt.Println("  revoke --name NAME [--collection NAME [--actions ACTIONS]] [--permissions PERMS]")
+	fmt.Println("  assign --name NAME --email EMAIL [--collection users]")
+	fmt.Println("  unassign --name NAME --email EMAIL [--collection users]")
+	fmt.Println()
+	fmt.Println("Actions: " + strings.Join(models.RoleActions, ", "))
+	fmt.Println("Permissions: " + strings.Join(models.RolePermissions, ", "))
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func mergeList(current, add []string) []string {
+	for _, item := range add {
+		if !slices.Contains(current, item) {
+			current = append(current, item)
+		}
+	}
+	return current
+}
+
+func removeList(current, remove []string) []string {
+	return slices.DeleteFunc(slices.Clone(current), func(item string) bool {
+		return slices.Contains(remove, item)
+	})
+}
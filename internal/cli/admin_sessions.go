@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func (ac *AdminCommand) Sessions(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
+		ac.printSessionsUsage()
+		if len(args) < 1 {
+			return fmt.Errorf("no sessions subcommand provided")
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "list":
+		return ac.ListSessions(ctx, args[1:])
+	case "revoke":
+		return ac.RevokeSessions(ctx, args[1:])
+	default:
+		ac.printSessionsUsage()
+		return fmt.Errorf("unknown sessions subcommand: %s", args[0])
+	}
+}
+
+func (ac *AdminCommand) ListSessions(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin sessions list", flag.ContinueOnError)
+	email := cmd.String("email", "", "Email of the auth record")
+	collection := cmd.String("collection", "users", "Auth collection of the record")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	record, err := ac.findAuthRecord(ctx, *collection, *email)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := ac.sessionService.List(ctx, *collection, record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No active sessions")
+		return nil
+	}
+
+	fmt.Printf("Total sessions: %d\n\n", len(sessions))
+	fmt.Printf("%-38s %-16s %-22s %-22s %s\n", "ID", "IP", "Started", "Last Used", "User Agent")
+	fmt.Println(strings.Repeat("-", 120))
+	for _, session := range sessions {
+		fmt.Printf("%-38s %-16s %-22s %-22s %s\n", session.ID, session.IP, session.Created, session.LastUsed, session.UserAgent)
+	}
+
+	return nil
+}
+
+// RevokeSessions ends every session of an auth record. Access tokens
+// already issued stay valid until they expire.
+func (ac *AdminCommand) RevokeSessions(ctx context.Context, args []string) error {
+	cmd := flag.NewFlagSet("admin sessions revoke", flag.ContinueOnError)
+	email := cmd.String("email", "", "Email of the auth record")
+	collection := cmd.String("collection", "users", "Auth collection of the record")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	record, err := ac.findAuthRecord(ctx, *collection, *email)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := ac.sessionService.RevokeAll(ctx, *collection, record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	fmt.Printf("✓ Sessions revoked successfully\n")
+	fmt.Printf("  Email: %s\n", *email)
+	fmt.Printf("  Refresh tokens revoked: %d\n", revoked)
+
+	return nil
+}
+
+func (ac *AdminCommand) findAuthRecord(ctx context.Context, collection, email string) (*models.Record, error) {
+	if email == "" {
+		return nil, fmt.Errorf("email is required")
+	}
+
+	records, _, err := ac.recordService.ListRecords(ctx, collection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(email)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find record: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("record with email %s not found in %s", email, collection)
+	}
+	return records[0], nil
+}
+
+func (ac *AdminCommand) printSessionsUsage() {
+	fmt.Println("Usage: vault admin sessions <subcommand> [options]")
+	fmt.Println("Subcommands:")
+	fmt.Println("  list --email EMAIL [--collection users]")
+	fmt.Println("  revoke --email EMAIL [--collection users]")
+	fmt.Println()
+	fmt.Println("Use --collection _admins for admin sessions.")
+}
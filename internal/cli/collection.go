@@ -80,7 +80,7 @@ func (cc *CollectionCommand) Run(args []string) error {
 func (cc *CollectionCommand) printUsage() {
 	fmt.Println("Usage: vault collection <subcommand> [options]")
 	fmt.Println("Subcommands:")
-	fmt.Println("  create --name NAME --fields FIELDS --email EMAIL --password PASSWORD")
+	fmt.Println("  create --name NAME --fields FIELDS [--type base|auth] --email EMAIL --password PASSWORD")
 	fmt.Println("  list --email EMAIL --password PASSWORD")
 	fmt.Println("  get --name NAME --email EMAIL --password PASSWORD")
 	fmt.Println("  delete --name NAME --email EMAIL --password PASSWORD [--force]")
@@ -95,9 +95,9 @@ func (cc *CollectionCommand) authenticateAdmin(ctx context.Context, email, passw
 	}
 
 	params := db.QueryParams{
-		Filter: fmt.Sprintf("email = '%s'", email),
+		Filter: "email = " + db.QuoteFilterValue(email),
 	}
-	records, _, err := cc.recordService.ListRecords(ctx, "users", params)
+	records, _, err := cc.recordService.ListRecords(ctx, models.AdminsCollection, params)
 	if err != nil {
 		return fmt.Errorf("failed to authenticate: %w", err)
 	}
@@ -119,6 +119,7 @@ func (cc *CollectionCommand) Create(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("create", flag.ExitOnError)
 	name := fs.String("name", "", "Collection name")
 	fieldsStr := fs.String("fields", "", "Fields (comma-separated: name:type)")
+	colType := fs.String("type", string(models.CollectionTypeBase), "Collection type (base or auth)")
 	email := fs.String("email", "", "Admin email")
 	password := fs.String("password", "", "Admin password")
 
@@ -132,6 +133,10 @@ func (cc *CollectionCommand) Create(ctx context.Context, args []string) error {
 		return fmt.Errorf("missing required flags")
 	}
 
+	if *colType != string(models.CollectionTypeBase) && *colType != string(models.CollectionTypeAuth) {
+		return fmt.Errorf("invalid collection type: %s", *colType)
+	}
+
 	if err := cc.authenticateAdmin(ctx, *email, *password); err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
@@ -144,7 +149,7 @@ func (cc *CollectionCommand) Create(ctx context.Context, args []string) error {
 	col := &models.Collection{
 		ID:      "col_" + *name,
 		Name:    *name,
-		Type:    models.CollectionTypeBase,
+		Type:    models.CollectionType(*colType),
 		Fields:  fields,
 		Created: time.Now().Format(time.RFC3339),
 		Updated: time.Now().Format(time.RFC3339),
@@ -161,7 +166,7 @@ func (cc *CollectionCommand) Create(ctx context.Context, args []string) error {
 	})
 
 	slog.Info("collection_created", "collection", *name, "fields", len(fields), "email", *email)
-	fmt.Printf("✓ Collection '%s' created with %d fields\n", *name, len(fields))
+	fmt.Printf("✓ Collection '%s' created with %d fields\n", *name, len(col.Fields))
 	return nil
 }
 
@@ -15,6 +15,7 @@ import (
 
 	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
 	"golang.org/x/term"
 )
 
@@ -128,15 +129,20 @@ func createConfigFile(jwtSecret string) error {
   "log_format": "text",
   "jwt_secret": "%s",
   "jwt_expiry": 72,
+  "jwt_algorithm": "HS256",
   "tls_enabled": false,
   "tls_cert_path": "",
   "tls_key_path": "",
   "cors_origins": "*",
   "rate_limit_per_min": 300,
-  "max_file_upload_size": 10485760
+  "max_file_upload_size": 10485760,
+  "app_url": "http://localhost:8090",
+  "mail_driver": "outbox",
+  "mail_from": "Vault <no-reply@localhost>",
+  "mail_outbox_path": ""
 }`, jwtSecret)
 
-	return os.WriteFile("config.json", []byte(config), 0644)
+	return os.WriteFile("config.json", []byte(config), 0600)
 }
 
 func createEnvExample() error {
@@ -169,6 +175,17 @@ VAULT_RATE_LIMIT_PER_MIN=100
 
 # File Upload
 VAULT_MAX_UPLOAD_SIZE_MB=10
+
+# Mail (driver: outbox, smtp or none)
+VAULT_APP_URL=http://localhost:8090
+VAULT_MAIL_DRIVER=outbox
+VAULT_MAIL_FROM=Vault <no-reply@localhost>
+VAULT_MAIL_OUTBOX_PATH=
+VAULT_SMTP_HOST=
+VAULT_SMTP_PORT=587
+VAULT_SMTP_USERNAME=
+VAULT_SMTP_PASSWORD=
+VAULT_SMTP_TLS=false
 `
 	return os.WriteFile(".env.example", []byte(envExample), 0644)
 }
@@ -190,12 +207,60 @@ func createSystemCollections(ctx context.Context, database *sql.DB) error {
 		return err
 	}
 
+	if err := registry.BootstrapAdminsCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapRolesCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapAuthTokensCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapIdentitiesCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapMFACollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapAPIKeysCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapLoginAttemptsCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapUploadsCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapFileRefsCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapStoredFilesCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapStorageUsageCollection(); err != nil {
+		return err
+	}
+
+	if err := registry.BootstrapQuarantineCollection(); err != nil {
+		return err
+	}
+
 	if err := registry.BootstrapAuditLogsCollection(); err != nil {
 		return err
 	}
 
 	// Sync tables
-	systemCols := []string{"_collections", "_refresh_tokens", "_audit_logs", "users"}
+	systemCols := []string{"_collections", models.RefreshTokensCollection, "_audit_logs", "users", models.AdminsCollection, models.RolesCollection, models.AuthTokensCollection, models.IdentitiesCollection, models.MFACollection, models.APIKeysCollection, models.LoginAttemptsCollection, models.UploadsCollection, models.FileRefsCollection, models.StoredFilesCollection, models.StorageUsageCollection, models.QuarantineCollection}
 	for _, name := range systemCols {
 		col, ok := registry.GetCollection(name)
 		if !ok || col == nil {
@@ -266,11 +331,11 @@ func createAdminUser(ctx context.Context, database *sql.DB, email, username, pas
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Check if user already exists
+	// Check if admin already exists
 	var existingID string
-	err := database.QueryRowContext(ctx, "SELECT id FROM users WHERE email = ? OR username = ?", email, username).Scan(&existingID)
+	err := database.QueryRowContext(ctx, "SELECT id FROM "+models.AdminsCollection+" WHERE email = ? OR username = ?", email, username).Scan(&existingID)
 	if err == nil {
-		return fmt.Errorf("user with email or username already exists")
+		return fmt.Errorf("admin with email or username already exists")
 	}
 	if err != sql.ErrNoRows {
 		return fmt.Errorf("database error: %w", err)
@@ -281,16 +346,16 @@ func createAdminUser(ctx context.Context, database *sql.DB, email, username, pas
 		return err
 	}
 
-	userID := generateID()
-	query := `INSERT INTO users (id, username, email, password, created, updated) 
+	adminID := generateID()
+	query := `INSERT INTO ` + models.AdminsCollection + ` (id, username, email, password, created, updated) 
 	          VALUES (?, ?, ?, ?, ?, ?)`
 
-	_, err = database.ExecContext(ctx, query, userID, username, email, hashedPassword, time.Now(), time.Now())
+	_, err = database.ExecContext(ctx, query, adminID, username, email, hashedPassword, time.Now(), time.Now())
 	return err
 }
 
 func generateID() string {
-	return fmt.Sprintf("usr_%d", time.Now().UnixNano())
+	return fmt.Sprintf("adm_%d", time.Now().UnixNano())
 }
 
 func printInitUsage() {
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+type KeysCommand struct {
+	config *core.Config
+}
+
+func NewKeysCommand(config *core.Config) *KeysCommand {
+	return &KeysCommand{config: config}
+}
+
+func (kc *KeysCommand) Run(args []string) error {
+	if len(args) < 1 {
+		kc.printUsage()
+		return fmt.Errorf("no keys subcommand provided")
+	}
+
+	subcommand := args[0]
+
+	// Check for help flags before processing subcommands
+	if subcommand == "-h" || subcommand == "--help" {
+		kc.printUsage()
+		return nil
+	}
+
+	switch subcommand {
+	case "list":
+		return kc.List(args[1:])
+	case "rotate":
+		return kc.Rotate(args[1:])
+	default:
+		kc.printUsage()
+		return fmt.Errorf("unknown keys subcommand: %s", subcommand)
+	}
+}
+
+func (kc *KeysCommand) List(args []string) error {
+	cmd := flag.NewFlagSet("keys list", flag.ContinueOnError)
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := kc.loadKeySet()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Signing algorithm: %s\n", keys.Algorithm())
+	if len(keys.Keys()) == 0 {
+		fmt.Println("No signing keys")
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Printf("%-18s %-8s %-22s %s\n", "Key ID", "Alg", "Created", "Status")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, key := range keys.Keys() {
+		status := "active"
+		if key.Retired != nil {
+			status = "retired " + key.Retired.Format(time.RFC3339) + ", verifies until " + key.Retired.Add(kc.overlap()).Format(time.RFC3339)
+		}
+		fmt.Printf("%-18s %-8s %-22s %s\n", key.ID, key.Algorithm, key.Created.Format(time.RFC3339), status)
+	}
+
+	return nil
+}
+
+// Rotate adds a new active signing key. The previous key keeps verifying
+// tokens until they expire, so nobody is signed out.
+func (kc *KeysCommand) Rotate(args []string) error {
+	cmd := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	algorithm := cmd.String("alg", kc.config.JWTAlgorithm, "Key algorithm (RS256 or EdDSA)")
+
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+
+	if *algorithm != auth.AlgorithmRS256 && *algorithm != auth.AlgorithmEdDSA {
+		return fmt.Errorf("jwt_algorithm is %s; pass --alg RS256 or --alg EdDSA", kc.config.JWTAlgorithm)
+	}
+
+	keys, err := kc.loadKeySet()
+	if err != nil {
+		return err
+	}
+
+	key, err := keys.Rotate(*algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to rotate keys: %w", err)
+	}
+
+	fmt.Printf("✓ Signing key rotated successfully\n")
+	fmt.Printf("  Key ID: %s\n", key.ID)
+	fmt.Printf("  Algorithm: %s\n", key.Algorithm)
+	fmt.Printf("  Previous keys verify tokens for another %s\n", kc.overlap())
+	if *algorithm != kc.config.JWTAlgorithm {
+		fmt.Printf("  Note: set jwt_algorithm to %s to sign tokens with this key\n", *algorithm)
+	}
+
+	return nil
+}
+
+func (kc *KeysCommand) loadKeySet() (*auth.KeySet, error) {
+	keys, err := auth.LoadKeySet(kc.config.KeySetPath(), kc.config.JWTAlgorithm, kc.config.JWTSecret, kc.overlap())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (kc *KeysCommand) overlap() time.Duration {
+	return time.Duration(kc.config.JWTExpiry) * time.Hour
+}
+
+func (kc *KeysCommand) printUsage() {
+	fmt.Println("Usage: vault keys <subcommand> [options]")
+	fmt.Println("Subcommands:")
+	fmt.Println("  list")
+	fmt.Println("  rotate [--alg RS256|EdDSA]")
+}
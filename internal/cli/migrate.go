@@ -84,6 +84,54 @@ func (mc *MigrateCommand) Sync(args []string) error {
 		return fmt.Errorf("failed to bootstrap users collection: %w", err)
 	}
 
+	if err := registry.BootstrapAdminsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap admins collection: %w", err)
+	}
+
+	if err := registry.BootstrapRolesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap roles collection: %w", err)
+	}
+
+	if err := registry.BootstrapAuthTokensCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap auth tokens collection: %w", err)
+	}
+
+	if err := registry.BootstrapIdentitiesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap identities collection: %w", err)
+	}
+
+	if err := registry.BootstrapMFACollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap mfa collection: %w", err)
+	}
+
+	if err := registry.BootstrapAPIKeysCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap api keys collection: %w", err)
+	}
+
+	if err := registry.BootstrapLoginAttemptsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap login attempts collection: %w", err)
+	}
+
+	if err := registry.BootstrapUploadsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap uploads collection: %w", err)
+	}
+
+	if err := registry.BootstrapFileRefsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap file refs collection: %w", err)
+	}
+
+	if err := registry.BootstrapStoredFilesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap stored files collection: %w", err)
+	}
+
+	if err := registry.BootstrapStorageUsageCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap storage usage collection: %w", err)
+	}
+
+	if err := registry.BootstrapQuarantineCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap quarantine collection: %w", err)
+	}
+
 	if err := registry.BootstrapAuditLogsCollection(); err != nil {
 		return fmt.Errorf("failed to bootstrap audit logs collection: %w", err)
 	}
@@ -193,6 +241,54 @@ func (mc *MigrateCommand) Status(args []string) error {
 		return fmt.Errorf("failed to bootstrap users collection: %w", err)
 	}
 
+	if err := registry.BootstrapAdminsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap admins collection: %w", err)
+	}
+
+	if err := registry.BootstrapRolesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap roles collection: %w", err)
+	}
+
+	if err := registry.BootstrapAuthTokensCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap auth tokens collection: %w", err)
+	}
+
+	if err := registry.BootstrapIdentitiesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap identities collection: %w", err)
+	}
+
+	if err := registry.BootstrapMFACollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap mfa collection: %w", err)
+	}
+
+	if err := registry.BootstrapAPIKeysCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap api keys collection: %w", err)
+	}
+
+	if err := registry.BootstrapLoginAttemptsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap login attempts collection: %w", err)
+	}
+
+	if err := registry.BootstrapUploadsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap uploads collection: %w", err)
+	}
+
+	if err := registry.BootstrapFileRefsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap file refs collection: %w", err)
+	}
+
+	if err := registry.BootstrapStoredFilesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap stored files collection: %w", err)
+	}
+
+	if err := registry.BootstrapStorageUsageCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap storage usage collection: %w", err)
+	}
+
+	if err := registry.BootstrapQuarantineCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap quarantine collection: %w", err)
+	}
+
 	if err := registry.BootstrapAuditLogsCollection(); err != nil {
 		return fmt.Errorf("failed to bootstrap audit logs collection: %w", err)
 	}
@@ -5,19 +5,25 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/service"
+	"github.com/zulfikawr/vault/internal/storage"
 )
 
 type StorageCommand struct {
 	config *core.Config
 	db     *sql.DB
+	store  storage.Storage
+	quotas *service.QuotaService
 }
 
 type FileEntry struct {
@@ -58,6 +64,21 @@ func (sc *StorageCommand) Run(args []string) error {
 
 	sc.db = database
 
+	// The deduplicated storage and the storage usage are kept in system
+	// collections
+	registry := db.NewSchemaRegistry(database)
+	if err := service.NewCollectionService(registry, db.NewMigrationEngine(database)).InitSystem(ctx); err != nil {
+		return fmt.Errorf("failed to initialize system: %w", err)
+	}
+	recordService := service.NewRecordService(db.NewRepository(database, registry), nil)
+
+	store, err := service.NewStorage(sc.config, recordService)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	sc.store = store
+	sc.quotas = service.NewQuotaService(recordService, sc.config)
+
 	switch subcommand {
 	case "create":
 		return sc.Create(ctx, args[1:])
@@ -67,6 +88,8 @@ func (sc *StorageCommand) Run(args []string) error {
 		return sc.Get(ctx, args[1:])
 	case "delete":
 		return sc.Delete(ctx, args[1:])
+	case "usage":
+		return sc.Usage(ctx, args[1:])
 	default:
 		sc.printUsage()
 		return fmt.Errorf("unknown storage subcommand: %s", subcommand)
@@ -80,6 +103,7 @@ func (sc *StorageCommand) printUsage() {
 	fmt.Println("  list [--path PATH] [--recursive]")
 	fmt.Println("  get --path PATH --output FILE")
 	fmt.Println("  delete --path PATH [--recursive] [--force]")
+	fmt.Println("  usage [--collection NAME] [--user COLLECTION/ID] [--limit N]")
 }
 
 func (sc *StorageCommand) Create(ctx context.Context, args []string) error {
@@ -108,30 +132,27 @@ func (sc *StorageCommand) Create(ctx context.Context, args []string) error {
 		return fmt.Errorf("invalid path: contains '..'")
 	}
 
-	// Read the file to upload
-	fileData, err := os.ReadFile(*file)
+	// Open the file to upload
+	source, err := os.Open(*file)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("file not found: %s", *file)
 		}
 		return fmt.Errorf("failed to read file: %w", err)
 	}
+	defer source.Close()
 
-	// Create destination path
-	fullPath := filepath.Join(sc.config.StoragePath(), *path)
-	destDir := filepath.Dir(fullPath)
-
-	// Create directories if they don't exist
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	info, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
 	}
 
 	// Write file to storage
-	if err := os.WriteFile(fullPath, fileData, 0644); err != nil {
+	if err := sc.store.Save(ctx, *path, source); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
-	fileSize := sc.formatSize(int64(len(fileData)))
+	fileSize := sc.formatSize(info.Size())
 	fmt.Printf("✓ File uploaded successfully (%s) to %s\n", fileSize, *path)
 	return nil
 }
@@ -168,88 +189,42 @@ func (sc *StorageCommand) List(ctx context.Context, args []string) error {
 		return fmt.Errorf("invalid path: contains '..'")
 	}
 
-	fullPath := filepath.Join(sc.config.StoragePath(), listPath)
-
 	// Check if path exists
-	info, err := os.Stat(fullPath)
+	info, err := sc.store.Stat(ctx, listPath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if isNotFound(err) {
 			return fmt.Errorf("path not found: %s", listPath)
 		}
 		return fmt.Errorf("failed to access path: %w", err)
 	}
 
-	if !info.IsDir() {
+	if !info.IsDir {
 		return fmt.Errorf("path is not a directory: %s", listPath)
 	}
 
+	files, err := sc.store.List(ctx, listPath, *recursive)
+	if err != nil {
+		return fmt.Errorf("failed to list directory: %w", err)
+	}
+
 	var entries []FileEntry
 	var totalSize int64
 
-	if *recursive {
-		// Recursive listing
-		err = filepath.WalkDir(fullPath, func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-
-			info, err := d.Info()
-			if err != nil {
-				return err
-			}
-
-			relPath, _ := filepath.Rel(fullPath, path)
-			if relPath == "." {
-				return nil
-			}
-
-			entry := FileEntry{
-				Name:     d.Name(),
-				Path:     filepath.ToSlash(relPath),
-				Size:     info.Size(),
-				IsDir:    d.IsDir(),
-				Modified: info.ModTime(),
-			}
-
-			entries = append(entries, entry)
-			if !d.IsDir() {
-				totalSize += info.Size()
-			}
-
-			return nil
-		})
-	} else {
-		// Non-recursive listing
-		dirEntries, err := os.ReadDir(fullPath)
-		if err != nil {
-			return fmt.Errorf("failed to read directory: %w", err)
+	for _, file := range files {
+		entry := FileEntry{
+			Name:     file.Name,
+			Path:     file.Path,
+			Size:     file.Size,
+			IsDir:    file.IsDir,
+			Modified: file.ModTime,
 		}
 
-		for _, d := range dirEntries {
-			info, err := d.Info()
-			if err != nil {
-				continue
-			}
-
-			entry := FileEntry{
-				Name:     d.Name(),
-				Path:     filepath.ToSlash(filepath.Join(listPath, d.Name())),
-				Size:     info.Size(),
-				IsDir:    d.IsDir(),
-				Modified: info.ModTime(),
-			}
-
-			entries = append(entries, entry)
-			if !d.IsDir() {
-				totalSize += info.Size()
-			}
+		entries = append(entries, entry)
+		if !file.IsDir {
+			totalSize += file.Size
 		}
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to list directory: %w", err)
-	}
-
 	// Display results
 	if len(entries) == 0 {
 		fmt.Println("No files or folders found")
@@ -362,16 +337,15 @@ func (sc *StorageCommand) Get(ctx context.Context, args []string) error {
 	}
 
 	// Check if source file exists
-	fullPath := filepath.Join(sc.config.StoragePath(), *path)
-	fileInfo, err := os.Stat(fullPath)
+	fileInfo, err := sc.store.Stat(ctx, *path)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if isNotFound(err) {
 			return fmt.Errorf("file not found: %s", *path)
 		}
 		return fmt.Errorf("failed to access file: %w", err)
 	}
 
-	if fileInfo.IsDir() {
+	if fileInfo.IsDir {
 		return fmt.Errorf("path is a directory, not a file: %s", *path)
 	}
 
@@ -381,17 +355,26 @@ func (sc *StorageCommand) Get(ctx context.Context, args []string) error {
 	}
 
 	// Read source file
-	fileData, err := os.ReadFile(fullPath)
+	source, err := sc.store.Retrieve(ctx, *path)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
+	defer source.Close()
 
 	// Write to output file
-	if err := os.WriteFile(*output, fileData, 0644); err != nil {
+	out, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	written, err := io.Copy(out, source)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	fileSize := sc.formatSize(int64(len(fileData)))
+	fileSize := sc.formatSize(written)
 	fmt.Printf("✓ File downloaded successfully (%s) to %s\n", fileSize, *output)
 	return nil
 }
@@ -423,19 +406,17 @@ func (sc *StorageCommand) Delete(ctx context.Context, args []string) error {
 		return fmt.Errorf("invalid path: contains '..'")
 	}
 
-	fullPath := filepath.Join(sc.config.StoragePath(), *path)
-
 	// Check if path exists
-	fileInfo, err := os.Stat(fullPath)
+	fileInfo, err := sc.store.Stat(ctx, *path)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if isNotFound(err) {
 			return fmt.Errorf("path not found: %s", *path)
 		}
 		return fmt.Errorf("failed to access path: %w", err)
 	}
 
 	// Handle directory deletion
-	if fileInfo.IsDir() {
+	if fileInfo.IsDir {
 		if !*recursive {
 			return fmt.Errorf("path is a directory, use --recursive to delete")
 		}
@@ -443,15 +424,16 @@ func (sc *StorageCommand) Delete(ctx context.Context, args []string) error {
 		// Calculate size and count before deletion
 		var totalSize int64
 		var fileCount int
-		_ = filepath.WalkDir(fullPath, func(p string, d os.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
-				return nil
+		files, err := sc.store.List(ctx, *path, true)
+		if err != nil {
+			return fmt.Errorf("failed to list directory: %w", err)
+		}
+		for _, file := range files {
+			if !file.IsDir {
+				totalSize += file.Size
+				fileCount++
 			}
-			info, _ := d.Info()
-			totalSize += info.Size()
-			fileCount++
-			return nil
-		})
+		}
 
 		// Confirmation prompt
 		if !*force {
@@ -467,16 +449,19 @@ func (sc *StorageCommand) Delete(ctx context.Context, args []string) error {
 		}
 
 		// Delete directory
-		if err := os.RemoveAll(fullPath); err != nil {
+		if _, _, err := storage.RemoveAll(ctx, sc.store, *path); err != nil {
 			return fmt.Errorf("failed to delete directory: %w", err)
 		}
+		if err := sc.quotas.Release(ctx, *path); err != nil {
+			return fmt.Errorf("failed to update storage usage: %w", err)
+		}
 
 		fmt.Printf("✓ Directory deleted successfully (%d files, %s freed)\n", fileCount, sc.formatSize(totalSize))
 		return nil
 	}
 
 	// Handle file deletion
-	fileSize := fileInfo.Size()
+	fileSize := fileInfo.Size
 
 	// Confirmation prompt
 	if !*force {
@@ -492,23 +477,134 @@ func (sc *StorageCommand) Delete(ctx context.Context, args []string) error {
 	}
 
 	// Delete file
-	if err := os.Remove(fullPath); err != nil {
+	if err := sc.store.Delete(ctx, *path); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	if err := sc.quotas.Release(ctx, *path); err != nil {
+		return fmt.Errorf("failed to update storage usage: %w", err)
+	}
 
 	fmt.Printf("✓ File deleted successfully (%s freed)\n", sc.formatSize(fileSize))
 	return nil
 }
 
+func (sc *StorageCommand) Usage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("storage usage", flag.ExitOnError)
+	collection := fs.String("collection", "", "Show the usage of one collection")
+	user := fs.String("user", "", "Show the usage of one auth record (COLLECTION/ID)")
+	limit := fs.Int("limit", 20, "Number of auth records to list")
+	email := fs.String("email", "", "Admin email")
+	password := fs.String("password", "", "Admin password")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" || *password == "" {
+		fmt.Println("Error: --email and --password are required")
+		fs.Usage()
+		return fmt.Errorf("missing required flags")
+	}
+
+	if err := sc.authenticateAdmin(ctx, *email, *password); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+
+	if *collection != "" || *user != "" {
+		var usages []*models.StorageUsage
+		for _, key := range [][2]string{{models.UsageScopeCollection, *collection}, {models.UsageScopeUser, *user}} {
+			if key[1] == "" {
+				continue
+			}
+			usage, err := sc.quotas.Usage(ctx, key[0], key[1])
+			if err != nil {
+				return fmt.Errorf("failed to get storage usage: %w", err)
+			}
+			usages = append(usages, usage)
+		}
+		sc.printUsageTable("Storage usage", usages)
+		return nil
+	}
+
+	collections, err := sc.quotas.List(ctx, models.UsageScopeCollection, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list storage usage: %w", err)
+	}
+	users, err := sc.quotas.List(ctx, models.UsageScopeUser, *limit)
+	if err != nil {
+		return fmt.Errorf("failed to list storage usage: %w", err)
+	}
+	sc.printUsageTable("Collections", collections)
+	sc.printUsageTable("Users", users)
+	return nil
+}
+
+// printUsageTable prints the storage usage with its quotas, "-" standing
+// for unlimited.
+func (sc *StorageCommand) printUsageTable(title string, usages []*models.StorageUsage) {
+	fmt.Printf("\n%s\n", title)
+	if len(usages) == 0 {
+		fmt.Println("No files stored")
+		return
+	}
+
+	headers := []string{"Scope", "Name", "Files", "Size", "Files Quota", "Size Quota"}
+	rows := make([][]string, len(usages))
+	for i, usage := range usages {
+		filesQuota, sizeQuota := "-", "-"
+		if usage.QuotaFiles > 0 {
+			filesQuota = fmt.Sprintf("%d", usage.QuotaFiles)
+		}
+		if usage.QuotaBytes > 0 {
+			sizeQuota = sc.formatSize(usage.QuotaBytes)
+		}
+		rows[i] = []string{usage.Scope, sc.truncate(usage.Name, 40), fmt.Sprintf("%d", usage.Files), sc.formatSize(usage.Bytes), filesQuota, sizeQuota}
+	}
+
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = len(header)
+		for _, row := range rows {
+			widths[i] = max(widths[i], len(row[i]))
+		}
+	}
+	border := func(left, middle, right string) {
+		parts := make([]string, len(widths))
+		for i, width := range widths {
+			parts[i] = strings.Repeat("─", width+2)
+		}
+		fmt.Println(left + strings.Join(parts, middle) + right)
+	}
+	line := func(cells []string) {
+		for i, cell := range cells {
+			fmt.Printf("│ %-*s ", widths[i], cell)
+		}
+		fmt.Println("│")
+	}
+
+	border("┌", "┬", "┐")
+	line(headers)
+	border("├", "┼", "┤")
+	for _, row := range rows {
+		line(row)
+	}
+	border("└", "┴", "┘")
+}
+
 // Helper functions
 
+func isNotFound(err error) bool {
+	e, ok := err.(*errors.VaultError)
+	return ok && e.Code == "FILE_NOT_FOUND"
+}
+
 func (sc *StorageCommand) authenticateAdmin(ctx context.Context, email, password string) error {
 	if email == "" || password == "" {
 		return fmt.Errorf("email and password are required")
 	}
 
 	var storedPassword string
-	err := sc.db.QueryRowContext(ctx, "SELECT password FROM users WHERE email = ?", email).Scan(&storedPassword)
+	err := sc.db.QueryRowContext(ctx, "SELECT password FROM "+models.AdminsCollection+" WHERE email = ?", email).Scan(&storedPassword)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("admin user not found")
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -15,14 +16,109 @@ type Config struct {
 	LogFormat         string `json:"log_format"`
 	JWTSecret         string `json:"jwt_secret"`
 	JWTExpiry         int    `json:"jwt_expiry"`           // in hours
+	JWTAlgorithm      string `json:"jwt_algorithm"`        // HS256, RS256 or EdDSA
 	MaxFileUploadSize int64  `json:"max_file_upload_size"` // in bytes
 	CORSOrigins       string `json:"cors_origins"`         // comma-separated
 	RateLimitPerMin   int    `json:"rate_limit_per_min"`
 	TLSEnabled        bool   `json:"tls_enabled"`
 	TLSCertPath       string `json:"tls_cert_path"`
 	TLSKeyPath        string `json:"tls_key_path"`
+
+	// TrustedProxies lists the IPs and CIDR ranges of the reverse proxies in
+	// front of the server. X-Forwarded-For is only honoured on requests
+	// from them; without any, the connection's address is the client's.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// Brute-force protection. Failed logins are counted per identity and
+	// per client IP; reaching the maximum locks further attempts for
+	// LoginLockoutMinutes. A maximum of 0 disables that counter.
+	LoginMaxAttempts      int `json:"login_max_attempts"`
+	LoginMaxAttemptsPerIP int `json:"login_max_attempts_per_ip"`
+	LoginLockoutMinutes   int `json:"login_lockout_minutes"`
+
+	// Dashboard cookie sessions end after DashboardSessionIdleMinutes
+	// without requests and DashboardSessionMaxHours after login.
+	DashboardSessionIdleMinutes int `json:"dashboard_session_idle_minutes"`
+	DashboardSessionMaxHours    int `json:"dashboard_session_max_hours"`
+
+	// Resumable uploads not finalized within UploadExpiryHours of their
+	// creation are deleted along with their chunks.
+	UploadExpiryHours int `json:"upload_expiry_hours"`
+
+	// Storage quotas on the files of each collection and on the files each
+	// auth record uploads, in bytes and in files. Zero is unlimited.
+	// Collections can set their own in their options.
+	CollectionQuotaBytes int64 `json:"collection_quota_bytes"`
+	CollectionQuotaFiles int   `json:"collection_quota_files"`
+	UserQuotaBytes       int64 `json:"user_quota_bytes"`
+	UserQuotaFiles       int   `json:"user_quota_files"`
+
+	// Uploads are scanned before they are stored, and flagged files are
+	// quarantined. ScanBlockedExtensions replaces the extensions the built-in
+	// rules reject, and ScanClamAVAddress (host:port or unix:///path) also
+	// scans them with a clamd daemon.
+	ScanBlockedExtensions []string `json:"scan_blocked_extensions"`
+	ScanClamAVAddress     string   `json:"scan_clamav_address"`
+
+	// Storage backend. StorageDriver is "local" (default), keeping files
+	// under {data_dir}/storage, or "s3" for an S3-compatible bucket. Set
+	// S3PathStyle for servers such as MinIO that address the bucket in the
+	// path instead of the host name.
+	StorageDriver string `json:"storage_driver"`
+	S3Endpoint    string `json:"s3_endpoint"`
+	S3Bucket      string `json:"s3_bucket"`
+	S3Region      string `json:"s3_region"`
+	S3AccessKey   string `json:"s3_access_key"`
+	S3SecretKey   string `json:"s3_secret_key"`
+	S3PathStyle   bool   `json:"s3_path_style"`
+
+	// StorageDedupe stores the files of records once per distinct content,
+	// as blobs named by their SHA-256 hash and shared by reference.
+	StorageDedupe bool `json:"storage_dedupe"`
+
+	// AppURL is the public base URL used in links sent by email.
+	AppURL string `json:"app_url"`
+
+	// Mail delivery. MailDriver is "outbox" (default), "smtp" or "none".
+	// The outbox writes messages to MailOutboxPath, or stdout when empty.
+	MailDriver     string `json:"mail_driver"`
+	MailFrom       string `json:"mail_from"`
+	MailOutboxPath string `json:"mail_outbox_path"`
+	SMTPHost       string `json:"smtp_host"`
+	SMTPPort       int    `json:"smtp_port"`
+	SMTPUsername   string `json:"smtp_username"`
+	SMTPPassword   string `json:"smtp_password"`
+	SMTPTLS        bool   `json:"smtp_tls"` // implicit TLS instead of STARTTLS
+
+	// OAuthProviders are the OAuth2/OpenID Connect providers users of auth
+	// collections can sign in with.
+	OAuthProviders []OAuthProvider `json:"oauth_providers"`
+}
+
+// OAuthProvider configures an OAuth2 or OpenID Connect provider. With an
+// Issuer the endpoints are discovered from its OpenID configuration; the
+// explicit endpoint URLs override discovery or configure plain OAuth2.
+type OAuthProvider struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	AuthURL      string   `json:"auth_url"`
+	TokenURL     string   `json:"token_url"`
+	UserInfoURL  string   `json:"userinfo_url"`
+	JWKSURL      string   `json:"jwks_url"`
+
+	// Collections limits the provider to these auth collections; empty
+	// allows every auth collection.
+	Collections []string `json:"collections"`
 }
 
+// DefaultJWTSecret is the jwt_secret of a config that sets none. The server
+// refuses to start with it, since anyone can read it here.
+const DefaultJWTSecret = "change-me-please-use-a-strong-secret"
+
 func LoadConfig(path ...string) *Config {
 	// Defaults
 	cfg := &Config{
@@ -31,7 +127,8 @@ func LoadConfig(path ...string) *Config {
 		DataDir:           "./vault_data",
 		LogLevel:          "INFO",
 		LogFormat:         "text",
-		JWTSecret:         "change-me-please-use-a-strong-secret",
+		JWTSecret:         DefaultJWTSecret,
+		JWTAlgorithm:      "HS256",
 		JWTExpiry:         72,
 		MaxFileUploadSize: 10 * 1024 * 1024, // 10MB
 		CORSOrigins:       "*",
@@ -39,6 +136,22 @@ func LoadConfig(path ...string) *Config {
 		TLSEnabled:        false,
 		TLSCertPath:       "",
 		TLSKeyPath:        "",
+		AppURL:            "http://localhost:8090",
+		MailDriver:        "outbox",
+		MailFrom:          "Vault <no-reply@localhost>",
+		SMTPPort:          587,
+
+		LoginMaxAttempts:      10,
+		LoginMaxAttemptsPerIP: 50,
+		LoginLockoutMinutes:   15,
+
+		DashboardSessionIdleMinutes: 30,
+		DashboardSessionMaxHours:    12,
+
+		UploadExpiryHours: 24,
+
+		StorageDriver: "local",
+		S3Region:      "us-east-1",
 	}
 
 	configPath := "config.json"
@@ -82,6 +195,9 @@ func LoadConfig(path ...string) *Config {
 			cfg.JWTExpiry = expiry
 		}
 	}
+	if jwtAlgorithm := os.Getenv("VAULT_JWT_ALGORITHM"); jwtAlgorithm != "" {
+		cfg.JWTAlgorithm = jwtAlgorithm
+	}
 	if maxUpload := os.Getenv("VAULT_MAX_FILE_UPLOAD_SIZE"); maxUpload != "" {
 		if size, err := strconv.ParseInt(maxUpload, 10, 64); err == nil {
 			cfg.MaxFileUploadSize = size
@@ -95,6 +211,75 @@ func LoadConfig(path ...string) *Config {
 			cfg.RateLimitPerMin = limit
 		}
 	}
+	if proxies, ok := os.LookupEnv("VAULT_TRUSTED_PROXIES"); ok {
+		cfg.TrustedProxies = []string{}
+		for _, proxy := range strings.Split(proxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+			}
+		}
+	}
+	if maxAttempts := os.Getenv("VAULT_LOGIN_MAX_ATTEMPTS"); maxAttempts != "" {
+		if limit, err := strconv.Atoi(maxAttempts); err == nil {
+			cfg.LoginMaxAttempts = limit
+		}
+	}
+	if maxAttempts := os.Getenv("VAULT_LOGIN_MAX_ATTEMPTS_PER_IP"); maxAttempts != "" {
+		if limit, err := strconv.Atoi(maxAttempts); err == nil {
+			cfg.LoginMaxAttemptsPerIP = limit
+		}
+	}
+	if lockout := os.Getenv("VAULT_LOGIN_LOCKOUT_MINUTES"); lockout != "" {
+		if minutes, err := strconv.Atoi(lockout); err == nil {
+			cfg.LoginLockoutMinutes = minutes
+		}
+	}
+	if idle := os.Getenv("VAULT_DASHBOARD_SESSION_IDLE_MINUTES"); idle != "" {
+		if minutes, err := strconv.Atoi(idle); err == nil {
+			cfg.DashboardSessionIdleMinutes = minutes
+		}
+	}
+	if maxHours := os.Getenv("VAULT_DASHBOARD_SESSION_MAX_HOURS"); maxHours != "" {
+		if hours, err := strconv.Atoi(maxHours); err == nil {
+			cfg.DashboardSessionMaxHours = hours
+		}
+	}
+	if expiry := os.Getenv("VAULT_UPLOAD_EXPIRY_HOURS"); expiry != "" {
+		if hours, err := strconv.Atoi(expiry); err == nil {
+			cfg.UploadExpiryHours = hours
+		}
+	}
+	if quota := os.Getenv("VAULT_COLLECTION_QUOTA_BYTES"); quota != "" {
+		if bytes, err := strconv.ParseInt(quota, 10, 64); err == nil {
+			cfg.CollectionQuotaBytes = bytes
+		}
+	}
+	if quota := os.Getenv("VAULT_COLLECTION_QUOTA_FILES"); quota != "" {
+		if files, err := strconv.Atoi(quota); err == nil {
+			cfg.CollectionQuotaFiles = files
+		}
+	}
+	if quota := os.Getenv("VAULT_USER_QUOTA_BYTES"); quota != "" {
+		if bytes, err := strconv.ParseInt(quota, 10, 64); err == nil {
+			cfg.UserQuotaBytes = bytes
+		}
+	}
+	if quota := os.Getenv("VAULT_USER_QUOTA_FILES"); quota != "" {
+		if files, err := strconv.Atoi(quota); err == nil {
+			cfg.UserQuotaFiles = files
+		}
+	}
+	if extensions, ok := os.LookupEnv("VAULT_SCAN_BLOCKED_EXTENSIONS"); ok {
+		cfg.ScanBlockedExtensions = []string{}
+		for _, ext := range strings.Split(extensions, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				cfg.ScanBlockedExtensions = append(cfg.ScanBlockedExtensions, ext)
+			}
+		}
+	}
+	if clamav := os.Getenv("VAULT_SCAN_CLAMAV_ADDRESS"); clamav != "" {
+		cfg.ScanClamAVAddress = clamav
+	}
 	if tlsEnabled := os.Getenv("VAULT_TLS_ENABLED"); tlsEnabled != "" {
 		cfg.TLSEnabled = tlsEnabled == "true"
 	}
@@ -104,10 +289,78 @@ func LoadConfig(path ...string) *Config {
 	if tlsKey := os.Getenv("VAULT_TLS_KEY_PATH"); tlsKey != "" {
 		cfg.TLSKeyPath = tlsKey
 	}
+	if dedupe := os.Getenv("VAULT_STORAGE_DEDUPE"); dedupe != "" {
+		cfg.StorageDedupe = dedupe == "true"
+	}
+	if storageDriver := os.Getenv("VAULT_STORAGE_DRIVER"); storageDriver != "" {
+		cfg.StorageDriver = storageDriver
+	}
+	if s3Endpoint := os.Getenv("VAULT_S3_ENDPOINT"); s3Endpoint != "" {
+		cfg.S3Endpoint = s3Endpoint
+	}
+	if s3Bucket := os.Getenv("VAULT_S3_BUCKET"); s3Bucket != "" {
+		cfg.S3Bucket = s3Bucket
+	}
+	if s3Region := os.Getenv("VAULT_S3_REGION"); s3Region != "" {
+		cfg.S3Region = s3Region
+	}
+	if s3AccessKey := os.Getenv("VAULT_S3_ACCESS_KEY"); s3AccessKey != "" {
+		cfg.S3AccessKey = s3AccessKey
+	}
+	if s3SecretKey := os.Getenv("VAULT_S3_SECRET_KEY"); s3SecretKey != "" {
+		cfg.S3SecretKey = s3SecretKey
+	}
+	if s3PathStyle := os.Getenv("VAULT_S3_PATH_STYLE"); s3PathStyle != "" {
+		cfg.S3PathStyle = s3PathStyle == "true"
+	}
+	if appURL := os.Getenv("VAULT_APP_URL"); appURL != "" {
+		cfg.AppURL = appURL
+	}
+	if mailDriver := os.Getenv("VAULT_MAIL_DRIVER"); mailDriver != "" {
+		cfg.MailDriver = mailDriver
+	}
+	if mailFrom := os.Getenv("VAULT_MAIL_FROM"); mailFrom != "" {
+		cfg.MailFrom = mailFrom
+	}
+	if outboxPath := os.Getenv("VAULT_MAIL_OUTBOX_PATH"); outboxPath != "" {
+		cfg.MailOutboxPath = outboxPath
+	}
+	if smtpHost := os.Getenv("VAULT_SMTP_HOST"); smtpHost != "" {
+		cfg.SMTPHost = smtpHost
+	}
+	if smtpPort := os.Getenv("VAULT_SMTP_PORT"); smtpPort != "" {
+		if port, err := strconv.Atoi(smtpPort); err == nil {
+			cfg.SMTPPort = port
+		}
+	}
+	if smtpUsername := os.Getenv("VAULT_SMTP_USERNAME"); smtpUsername != "" {
+		cfg.SMTPUsername = smtpUsername
+	}
+	if smtpPassword := os.Getenv("VAULT_SMTP_PASSWORD"); smtpPassword != "" {
+		cfg.SMTPPassword = smtpPassword
+	}
+	if smtpTLS := os.Getenv("VAULT_SMTP_TLS"); smtpTLS != "" {
+		cfg.SMTPTLS = smtpTLS == "true"
+	}
 
 	return cfg
 }
 
+// OAuthProvider returns the configured provider with the name.
+func (c *Config) OAuthProvider(name string) (OAuthProvider, bool) {
+	for _, p := range c.OAuthProviders {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return OAuthProvider{}, false
+}
+
 func (c *Config) StoragePath() string {
 	return c.DataDir + "/storage"
 }
+
+// KeySetPath is the file holding the asymmetric JWT signing keys.
+func (c *Config) KeySetPath() string {
+	return c.DataDir + "/keys.json"
+}
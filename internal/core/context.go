@@ -8,6 +8,7 @@ type contextKey string
 
 const RequestIDKey contextKey = "request_id"
 const AuthRecordKey contextKey = "auth_record"
+const ClientIPKey contextKey = "client_ip"
 
 func WithRequestID(ctx context.Context, id string) context.Context {
 	return context.WithValue(ctx, RequestIDKey, id)
@@ -27,3 +28,14 @@ func WithAuth(ctx context.Context, record any) context.Context {
 func GetAuth(ctx context.Context) any {
 	return ctx.Value(AuthRecordKey)
 }
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ClientIPKey, ip)
+}
+
+func GetClientIP(ctx context.Context) string {
+	if ip, ok := ctx.Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	return ""
+}
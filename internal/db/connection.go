@@ -20,7 +20,9 @@ func Connect(ctx context.Context, path string) (*sql.DB, error) {
 		return nil, errors.NewError(http.StatusInternalServerError, "DB_DIR_CREATION_FAILED", "Failed to create data directory").WithDetails(map[string]any{"error": err.Error(), "path": dir})
 	}
 
-	db, err := sql.Open("sqlite", path)
+	// The busy timeout is set on every connection of the pool, so that
+	// concurrent writes wait for the lock instead of failing.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, errors.NewError(http.StatusInternalServerError, "DB_OPEN_FAILED", "Failed to open database").WithDetails(map[string]any{"error": err.Error(), "path": path})
 	}
@@ -28,7 +30,6 @@ func Connect(ctx context.Context, path string) (*sql.DB, error) {
 	// Performance and stability settings
 	pragmas := []string{
 		"PRAGMA journal_mode=WAL;",
-		"PRAGMA busy_timeout=5000;",
 		"PRAGMA synchronous=NORMAL;",
 		"PRAGMA foreign_keys=ON;",
 	}
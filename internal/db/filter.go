@@ -0,0 +1,512 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// Filter grammar accepted by the ?filter= query parameter:
+//
+//	expr       := and (("||" | OR) and)*
+//	and        := primary (("&&" | AND) primary)*
+//	primary    := "(" expr ")" | comparison
+//	comparison := field op value
+//	            | field [NOT] IN "(" value ("," value)* ")"
+//	            | field [NOT] LIKE value
+//	            | field IS [NOT] NULL
+//	op         := "=" | "!=" | ">" | "<" | ">=" | "<=" | "~" | "!~"
+//	value      := 'string' | "string" | number | true | false | null | @now | @today
+//
+// Keywords are case-insensitive. Every value is bound as a query parameter;
+// only validated field names are ever written into the SQL text.
+
+type filterTokenType int
+
+const (
+	filterEOF filterTokenType = iota
+	filterIdent
+	filterString
+	filterNumber
+	filterMacro
+	filterLParen
+	filterRParen
+	filterComma
+	filterOp
+	filterAnd
+	filterOr
+	filterNot
+	filterIn
+	filterIs
+	filterLike
+	filterNull
+	filterTrue
+	filterFalse
+)
+
+type filterToken struct {
+	Type  filterTokenType
+	Value string
+	Pos   int
+}
+
+var filterKeywords = map[string]filterTokenType{
+	"AND":   filterAnd,
+	"OR":    filterOr,
+	"NOT":   filterNot,
+	"IN":    filterIn,
+	"IS":    filterIs,
+	"LIKE":  filterLike,
+	"NULL":  filterNull,
+	"TRUE":  filterTrue,
+	"FALSE": filterFalse,
+}
+
+func filterError(filter string, pos int, format string, args ...any) *errors.VaultError {
+	msg := fmt.Sprintf(format, args...)
+	return errors.NewError(http.StatusBadRequest, "INVALID_FILTER", fmt.Sprintf("Invalid filter at position %d: %s", pos, msg)).WithDetails(map[string]any{
+		"filter":   filter,
+		"position": pos,
+		"error":    msg,
+	})
+}
+
+func tokenizeFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(input) {
+		ch := input[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			tokens = append(tokens, filterToken{Type: filterLParen, Value: "(", Pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, filterToken{Type: filterRParen, Value: ")", Pos: i})
+			i++
+		case ch == ',':
+			tokens = append(tokens, filterToken{Type: filterComma, Value: ",", Pos: i})
+			i++
+		case ch == '&' || ch == '|':
+			if i+1 >= len(input) || input[i+1] != ch {
+				return nil, filterError(input, i, "unexpected character %q", ch)
+			}
+			typ := filterAnd
+			if ch == '|' {
+				typ = filterOr
+			}
+			tokens = append(tokens, filterToken{Type: typ, Value: input[i : i+2], Pos: i})
+			i += 2
+		case ch == '=' || ch == '~':
+			tokens = append(tokens, filterToken{Type: filterOp, Value: string(ch), Pos: i})
+			i++
+		case ch == '!' || ch == '>' || ch == '<':
+			if i+1 < len(input) && (input[i+1] == '=' || (ch == '!' && input[i+1] == '~')) {
+				tokens = append(tokens, filterToken{Type: filterOp, Value: input[i : i+2], Pos: i})
+				i += 2
+				continue
+			}
+			if ch == '!' {
+				return nil, filterError(input, i, "unexpected character %q", ch)
+			}
+			tokens = append(tokens, filterToken{Type: filterOp, Value: string(ch), Pos: i})
+			i++
+		case ch == '\'' || ch == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(input) {
+				c := input[i]
+				if c == '\\' && i+1 < len(input) {
+					sb.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if c == ch {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return nil, filterError(input, start, "unterminated string")
+			}
+			tokens = append(tokens, filterToken{Type: filterString, Value: sb.String(), Pos: start})
+		case isFilterDigit(ch) || (ch == '-' && i+1 < len(input) && isFilterDigit(input[i+1])):
+			start := i
+			i++
+			for i < len(input) && (isFilterDigit(input[i]) || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{Type: filterNumber, Value: input[start:i], Pos: start})
+		case ch == '@' || isFilterLetter(ch):
+			start := i
+			i++
+			for i < len(input) && (isFilterLetter(input[i]) || isFilterDigit(input[i])) {
+				i++
+			}
+			word := input[start:i]
+			if ch == '@' {
+				tokens = append(tokens, filterToken{Type: filterMacro, Value: word, Pos: start})
+				continue
+			}
+			if typ, ok := filterKeywords[strings.ToUpper(word)]; ok {
+				tokens = append(tokens, filterToken{Type: typ, Value: word, Pos: start})
+				continue
+			}
+			tokens = append(tokens, filterToken{Type: filterIdent, Value: word, Pos: start})
+		default:
+			return nil, filterError(input, i, "unexpected character %q", ch)
+		}
+	}
+	tokens = append(tokens, filterToken{Type: filterEOF, Pos: len(input)})
+	return tokens, nil
+}
+
+func isFilterLetter(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func isFilterDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// filterCompiler turns a token stream into a parameterized SQL predicate,
+// validating every field reference against the collection schema.
+type filterCompiler struct {
+	input  string
+	tokens []filterToken
+	pos    int
+	fields map[string]models.FieldType
+	args   []any
+	now    time.Time
+}
+
+// CompileFilter parses a filter expression and compiles it into a SQL
+// predicate with positional parameters, suitable for QueryBuilder.Where.
+func CompileFilter(col *models.Collection, filter string) (string, []any, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fields := map[string]models.FieldType{
+		"id":      models.FieldTypeText,
+		"created": models.FieldTypeDate,
+		"updated": models.FieldTypeDate,
+	}
+	for _, f := range col.Fields {
+		fields[f.Name] = f.Type
+	}
+
+	c := &filterCompiler{
+		input:  filter,
+		tokens: tokens,
+		fields: fields,
+		now:    time.Now().UTC(),
+	}
+
+	clause, err := c.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if tok := c.peek(); tok.Type != filterEOF {
+		return "", nil, filterError(filter, tok.Pos, "unexpected %q", tok.Value)
+	}
+
+	return "(" + clause + ")", c.args, nil
+}
+
+// QuoteFilterValue renders s as a filter string literal so that callers can
+// safely embed untrusted input into a filter expression.
+func QuoteFilterValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+func (c *filterCompiler) peek() filterToken {
+	return c.tokens[c.pos]
+}
+
+func (c *filterCompiler) next() filterToken {
+	tok := c.tokens[c.pos]
+	if tok.Type != filterEOF {
+		c.pos++
+	}
+	return tok
+}
+
+func (c *filterCompiler) expect(typ filterTokenType, what string) (filterToken, error) {
+	tok := c.next()
+	if tok.Type != typ {
+		if tok.Type == filterEOF {
+			return tok, filterError(c.input, tok.Pos, "expected %s but reached end of filter", what)
+		}
+		return tok, filterError(c.input, tok.Pos, "expected %s, got %q", what, tok.Value)
+	}
+	return tok, nil
+}
+
+func (c *filterCompiler) parseOr() (string, error) {
+	left, err := c.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for c.peek().Type == filterOr {
+		c.next()
+		right, err := c.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (c *filterCompiler) parseAnd() (string, error) {
+	left, err := c.parsePrimary()
+	if err != nil {
+		return "", err
+	}
+	for c.peek().Type == filterAnd {
+		c.next()
+		right, err := c.parsePrimary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (c *filterCompiler) parsePrimary() (string, error) {
+	if c.peek().Type == filterLParen {
+		c.next()
+		inner, err := c.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if _, err := c.expect(filterRParen, "closing parenthesis"); err != nil {
+			return "", err
+		}
+		return inner, nil
+	}
+	return c.parseComparison()
+}
+
+func (c *filterCompiler) parseComparison() (string, error) {
+	fieldTok, err := c.expect(filterIdent, "field name")
+	if err != nil {
+		return "", err
+	}
+	fieldType, ok := c.fields[fieldTok.Value]
+	if !ok {
+		return "", filterError(c.input, fieldTok.Pos, "unknown field %q", fieldTok.Value)
+	}
+	field := fieldTok.Value
+
+	tok := c.next()
+	switch tok.Type {
+	case filterIs:
+		negate := false
+		if c.peek().Type == filterNot {
+			c.next()
+			negate = true
+		}
+		if _, err := c.expect(filterNull, "NULL"); err != nil {
+			return "", err
+		}
+		if negate {
+			return field + " IS NOT NULL", nil
+		}
+		return field + " IS NULL", nil
+
+	case filterNot:
+		next := c.next()
+		switch next.Type {
+		case filterIn:
+			return c.parseIn(field, fieldType, true)
+		case filterLike:
+			return c.parseLike(field, fieldType, next, true)
+		default:
+			return "", filterError(c.input, next.Pos, "expected IN or LIKE after NOT")
+		}
+
+	case filterIn:
+		return c.parseIn(field, fieldType, false)
+
+	case filterLike:
+		return c.parseLike(field, fieldType, tok, false)
+
+	case filterOp:
+		if tok.Value == "~" || tok.Value == "!~" {
+			return c.parseLike(field, fieldType, tok, tok.Value == "!~")
+		}
+		valTok := c.next()
+		if valTok.Type == filterNull {
+			switch tok.Value {
+			case "=":
+				return field + " IS NULL", nil
+			case "!=":
+				return field + " IS NOT NULL", nil
+			default:
+				return "", filterError(c.input, tok.Pos, "operator %s cannot be used with null", tok.Value)
+			}
+		}
+		val, err := c.bindValue(field, fieldType, valTok)
+		if err != nil {
+			return "", err
+		}
+		if (tok.Value != "=" && tok.Value != "!=") && fieldType == models.FieldTypeBool {
+			return "", filterError(c.input, tok.Pos, "operator %s is not supported for bool field %q", tok.Value, field)
+		}
+		c.args = append(c.args, val)
+		return fmt.Sprintf("%s %s ?", field, tok.Value), nil
+
+	case filterEOF:
+		return "", filterError(c.input, tok.Pos, "expected operator after %q but reached end of filter", field)
+	default:
+		return "", filterError(c.input, tok.Pos, "expected operator after %q, got %q", field, tok.Value)
+	}
+}
+
+func (c *filterCompiler) parseIn(field string, fieldType models.FieldType, negate bool) (string, error) {
+	if _, err := c.expect(filterLParen, "'(' to start IN list"); err != nil {
+		return "", err
+	}
+
+	placeholders := make([]string, 0)
+	for {
+		valTok := c.next()
+		val, err := c.bindValue(field, fieldType, valTok)
+		if err != nil {
+			return "", err
+		}
+		c.args = append(c.args, val)
+		placeholders = append(placeholders, "?")
+
+		sep := c.next()
+		if sep.Type == filterRParen {
+			break
+		}
+		if sep.Type != filterComma {
+			if sep.Type == filterEOF {
+				return "", filterError(c.input, sep.Pos, "unterminated IN list")
+			}
+			return "", filterError(c.input, sep.Pos, "expected ',' or ')' in IN list, got %q", sep.Value)
+		}
+	}
+
+	op := "IN"
+	if negate {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", field, op, strings.Join(placeholders, ", ")), nil
+}
+
+func (c *filterCompiler) parseLike(field string, fieldType models.FieldType, opTok filterToken, negate bool) (string, error) {
+	if fieldType == models.FieldTypeNumber || fieldType == models.FieldTypeBool {
+		return "", filterError(c.input, opTok.Pos, "pattern matching is not supported for %s field %q", fieldType, field)
+	}
+
+	valTok, err := c.expect(filterString, "string pattern")
+	if err != nil {
+		return "", err
+	}
+
+	// A pattern without explicit wildcards matches anywhere in the value.
+	pattern := valTok.Value
+	if !strings.ContainsAny(pattern, "%_") {
+		pattern = "%" + pattern + "%"
+	}
+	c.args = append(c.args, pattern)
+
+	if negate {
+		return field + " NOT LIKE ?", nil
+	}
+	return field + " LIKE ?", nil
+}
+
+// bindValue converts a literal token into a query argument, checking that it
+// is compatible with the type of the field it is compared against.
+func (c *filterCompiler) bindValue(field string, fieldType models.FieldType, tok filterToken) (any, error) {
+	switch tok.Type {
+	case filterString:
+		switch fieldType {
+		case models.FieldTypeNumber, models.FieldTypeBool:
+			return nil, filterError(c.input, tok.Pos, "field %q expects a %s value, got string", field, fieldType)
+		case models.FieldTypeDate:
+			t, ok := parseFilterDate(tok.Value)
+			if !ok {
+				return nil, filterError(c.input, tok.Pos, "invalid date %q for field %q", tok.Value, field)
+			}
+			return t.UTC().Format(time.RFC3339), nil
+		}
+		return tok.Value, nil
+
+	case filterNumber:
+		if fieldType != models.FieldTypeNumber {
+			return nil, filterError(c.input, tok.Pos, "field %q expects a %s value, got number", field, fieldType)
+		}
+		n, err := strconv.ParseFloat(tok.Value, 64)
+		if err != nil {
+			return nil, filterError(c.input, tok.Pos, "invalid number %q", tok.Value)
+		}
+		return n, nil
+
+	case filterTrue, filterFalse:
+		if fieldType != models.FieldTypeBool {
+			return nil, filterError(c.input, tok.Pos, "field %q expects a %s value, got bool", field, fieldType)
+		}
+		if tok.Type == filterTrue {
+			return 1, nil
+		}
+		return 0, nil
+
+	case filterMacro:
+		if fieldType != models.FieldTypeDate {
+			return nil, filterError(c.input, tok.Pos, "%s can only be compared with date fields", tok.Value)
+		}
+		switch tok.Value {
+		case "@now":
+			return c.now.Format(time.RFC3339), nil
+		case "@today":
+			y, m, d := c.now.Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Format(time.RFC3339), nil
+		}
+		return nil, filterError(c.input, tok.Pos, "unknown macro %s", tok.Value)
+
+	case filterNull:
+		return nil, filterError(c.input, tok.Pos, "null is only allowed with =, != or IS")
+
+	case filterEOF:
+		return nil, filterError(c.input, tok.Pos, "expected value but reached end of filter")
+	}
+	return nil, filterError(c.input, tok.Pos, "expected value, got %q", tok.Value)
+}
+
+var filterDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseFilterDate(s string) (time.Time, bool) {
+	for _, layout := range filterDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
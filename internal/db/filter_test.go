@@ -0,0 +1,103 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func testFilterCollection() *models.Collection {
+	return &models.Collection{
+		Name: "posts",
+		Fields: []models.Field{
+			{Name: "status", Type: models.FieldTypeText},
+			{Name: "views", Type: models.FieldTypeNumber},
+			{Name: "published", Type: models.FieldTypeBool},
+			{Name: "publishedAt", Type: models.FieldTypeDate},
+		},
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		clause string
+		args   []any
+	}{
+		{"status = 'active'", "(status = ?)", []any{"active"}},
+		{"status = 'active' && views > 10", "((status = ? AND views > ?))", []any{"active", 10.0}},
+		{"(status = 'a' || status = 'b') AND published = true", "(((status = ? OR status = ?) AND published = ?))", []any{"a", "b", 1}},
+		{"status ~ 'draft'", "(status LIKE ?)", []any{"%draft%"}},
+		{"status !~ 'dr%'", "(status NOT LIKE ?)", []any{"dr%"}},
+		{"status not like 'x'", "(status NOT LIKE ?)", []any{"%x%"}},
+		{"status IN ('a', 'b')", "(status IN (?, ?))", []any{"a", "b"}},
+		{"views NOT IN (1, 2.5)", "(views NOT IN (?, ?))", []any{1.0, 2.5}},
+		{"status = null", "(status IS NULL)", nil},
+		{"status IS NOT NULL", "(status IS NOT NULL)", nil},
+		{"publishedAt >= '2024-01-02'", "(publishedAt >= ?)", []any{"2024-01-02T00:00:00Z"}},
+		{`status = 'it\'s'`, "(status = ?)", []any{"it's"}},
+	}
+
+	for _, tt := range tests {
+		clause, args, err := CompileFilter(testFilterCollection(), tt.filter)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.filter, err)
+			continue
+		}
+		if clause != tt.clause {
+			t.Errorf("%q: expected clause %q, got %q", tt.filter, tt.clause, clause)
+		}
+		if len(args) != len(tt.args) || (len(args) > 0 && !reflect.DeepEqual(args, tt.args)) {
+			t.Errorf("%q: expected args %v, got %v", tt.filter, tt.args, args)
+		}
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		filter   string
+		position int
+	}{
+		{"unknown = 1", 0},
+		{"views = 'ten'", 8},
+		{"status = 'a' &&", 15},
+		{"(status = 'a'", 13},
+		{"status = 'a", 9},
+		{"views ~ 'x'", 6},
+		{"status IN ('a' 'b')", 15},
+		{"publishedAt > 'yesterday'", 14},
+	}
+
+	for _, tt := range tests {
+		_, _, err := CompileFilter(testFilterCollection(), tt.filter)
+		if err == nil {
+			t.Errorf("%q: expected error", tt.filter)
+			continue
+		}
+		ve, ok := err.(*errors.VaultError)
+		if !ok {
+			t.Errorf("%q: expected VaultError, got %T", tt.filter, err)
+			continue
+		}
+		if ve.Code != "INVALID_FILTER" {
+			t.Errorf("%q: expected code INVALID_FILTER, got %s", tt.filter, ve.Code)
+		}
+		if pos := ve.Details["position"]; pos != tt.position {
+			t.Errorf("%q: expected position %d, got %v", tt.filter, tt.position, pos)
+		}
+	}
+}
+
+func TestQuoteFilterValue(t *testing.T) {
+	col := testFilterCollection()
+	value := `a' || status != 'b\`
+	_, args, err := CompileFilter(col, "status = "+QuoteFilterValue(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 || args[0] != value {
+		t.Errorf("expected single arg %q, got %v", value, args)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -38,6 +39,25 @@ type QueryParams struct {
 	Sort    string
 	Filter  string
 	Expand  string
+
+	// RuleFilter is a pre-compiled SQL predicate (see rules.ToSQL) that is
+	// ANDed into the WHERE clause; RuleArgs holds its bound parameters.
+	RuleFilter string
+	RuleArgs   []any
+}
+
+// Collection returns the schema of a registered collection.
+func (r *Repository) Collection(name string) (*models.Collection, bool) {
+	return r.registry.GetCollection(name)
+}
+
+// Exists reports whether the given SELECT query returns at least one row.
+func (r *Repository) Exists(ctx context.Context, query string, args ...any) (bool, error) {
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS ("+query+")", args...).Scan(&exists); err != nil {
+		return false, errors.NewError(http.StatusInternalServerError, "DB_QUERY_FAILED", "Failed to run existence check").WithDetails(map[string]any{"error": err.Error()})
+	}
+	return exists, nil
 }
 
 func (r *Repository) CreateRecord(ctx context.Context, collectionName string, data map[string]any) (*models.Record, error) {
@@ -188,6 +208,61 @@ func (r *Repository) UpdateRecord(ctx context.Context, collectionName string, id
 	return record, nil
 }
 
+// ClaimRecord sets a bool field of the record to true in a single
+// conditional update, and reports whether it was not set before. Of
+// concurrent callers claiming the same record, exactly one succeeds.
+func (r *Repository) ClaimRecord(ctx context.Context, collectionName string, id string, field string) (bool, error) {
+	col, ok := r.registry.GetCollection(collectionName)
+	if !ok {
+		return false, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", fmt.Sprintf("Collection %s not found", collectionName))
+	}
+	if !slices.ContainsFunc(col.Fields, func(f models.Field) bool { return f.Name == field && f.Type == models.FieldTypeBool }) {
+		return false, errors.NewError(http.StatusInternalServerError, "INVALID_CLAIM_FIELD", fmt.Sprintf("Field %s is not a bool field of %s", field, collectionName))
+	}
+
+	qb := NewQueryBuilder(collectionName)
+	query, args := qb.Where("id = ?", id).Where(fmt.Sprintf("COALESCE(%s, 0) = 0", field)).BuildUpdate(map[string]any{
+		field:     true,
+		"updated": time.Now().UTC().Format(time.RFC3339),
+	})
+
+	stmt, err := r.stmtCache.Prepare(query)
+	if err != nil {
+		return false, errors.NewError(http.StatusInternalServerError, "DB_PREPARE_ERROR", "Failed to prepare statement").WithDetails(map[string]any{"error": err.Error()})
+	}
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return false, errors.NewError(http.StatusInternalServerError, "RECORD_UPDATE_FAILED", "Failed to update record").WithDetails(map[string]any{"error": err.Error()})
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1, nil
+}
+
+// IncrementRecord adds one to a number field of the record in a single
+// conditional update, unless the field already reached limit, and reports
+// whether it did. Of concurrent callers, at most limit succeed in total.
+func (r *Repository) IncrementRecord(ctx context.Context, collectionName string, id string, field string, limit int) (bool, error) {
+	col, ok := r.registry.GetCollection(collectionName)
+	if !ok {
+		return false, errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", fmt.Sprintf("Collection %s not found", collectionName))
+	}
+	if !slices.ContainsFunc(col.Fields, func(f models.Field) bool { return f.Name == field && f.Type == models.FieldTypeNumber }) {
+		return false, errors.NewError(http.StatusInternalServerError, "INVALID_INCREMENT_FIELD", fmt.Sprintf("Field %s is not a number field of %s", field, collectionName))
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s = COALESCE(%s, 0) + 1, updated = ? WHERE id = ? AND COALESCE(%s, 0) < ?", collectionName, field, field, field)
+	stmt, err := r.stmtCache.Prepare(query)
+	if err != nil {
+		return false, errors.NewError(http.StatusInternalServerError, "DB_PREPARE_ERROR", "Failed to prepare statement").WithDetails(map[string]any{"error": err.Error()})
+	}
+	result, err := stmt.ExecContext(ctx, time.Now().UTC().Format(time.RFC3339), id, limit)
+	if err != nil {
+		return false, errors.NewError(http.StatusInternalServerError, "RECORD_UPDATE_FAILED", "Failed to update record").WithDetails(map[string]any{"error": err.Error()})
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1, nil
+}
+
 func (r *Repository) DeleteRecord(ctx context.Context, collectionName string, id string) error {
 	_, ok := r.registry.GetCollection(collectionName)
 	if !ok {
@@ -231,13 +306,17 @@ func (r *Repository) ListRecords(ctx context.Context, collectionName string, par
 	qb := NewQueryBuilder(collectionName)
 
 	if params.Filter != "" {
-		clause, values, err := r.parseSafeFilter(col, params.Filter)
+		clause, values, err := CompileFilter(col, params.Filter)
 		if err != nil {
 			return nil, 0, err
 		}
 		qb.Where(clause, values...)
 	}
 
+	if params.RuleFilter != "" {
+		qb.Where("("+params.RuleFilter+")", params.RuleArgs...)
+	}
+
 	// Validate and apply sort
 	sortField, sortDir, err := r.validateSortField(col, params.Sort)
 	if err != nil {
@@ -343,49 +422,6 @@ func (r *Repository) validateSortField(col *models.Collection, sortParam string)
 	return fieldName, direction, nil
 }
 
-// parseSafeFilter implements basic parameterized filtering to prevent SQL injection
-func (r *Repository) parseSafeFilter(col *models.Collection, filter string) (string, []any, error) {
-	// Simple support for: field = 'value' or field != 'value'
-	operators := []string{" != ", " = ", " > ", " < ", " >= ", " <= "}
-
-	for _, op := range operators {
-		if strings.Contains(filter, op) {
-			parts := strings.Split(filter, op)
-			if len(parts) != 2 {
-				continue
-			}
-
-			fieldName := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-
-			// 1. Validate field name exists in collection
-			validField := false
-			if fieldName == "id" {
-				validField = true
-			} else {
-				for _, f := range col.Fields {
-					if f.Name == fieldName {
-						validField = true
-						break
-					}
-				}
-			}
-
-			if !validField {
-				return "", nil, errors.NewError(http.StatusBadRequest, "INVALID_FILTER", fmt.Sprintf("Unknown field in filter: %s", fieldName))
-			}
-
-			// 2. Clean value (remove single quotes if present)
-			value = strings.Trim(value, "'")
-
-			// 3. Return parameterized clause
-			return fmt.Sprintf("%s %s ?", fieldName, strings.TrimSpace(op)), []any{value}, nil
-		}
-	}
-
-	return "", nil, errors.NewError(http.StatusBadRequest, "UNSUPPORTED_FILTER", "Filter format not supported. Use 'field = value'")
-}
-
 func (r *Repository) expandRecords(ctx context.Context, collection *models.Collection, records []*models.Record, expand string) {
 	if expand == "" || len(records) == 0 {
 		return
@@ -434,16 +470,13 @@ func (r *Repository) expandRecords(ctx context.Context, collection *models.Colle
 		}
 
 		// 3. Batch fetch records (Fixing N+1)
-		placeholders := make([]string, len(relIDs))
-		args := make([]any, len(relIDs))
+		quoted := make([]string, len(relIDs))
 		for i, id := range relIDs {
-			placeholders[i] = "?"
-			args[i] = id
+			quoted[i] = QuoteFilterValue(id)
 		}
 
-		// Simplified batch fetch logic for this prototype
-		// We use ListRecords internally with a raw IN filter for efficiency
-		filter := fmt.Sprintf("id IN (%s)", strings.Join(placeholders, ","))
+		// We use ListRecords internally with an IN filter for efficiency
+		filter := fmt.Sprintf("id IN (%s)", strings.Join(quoted, ", "))
 		targetRecords, _, err := r.ListRecords(ctx, targetCol, QueryParams{
 			Filter:  filter,
 			PerPage: len(relIDs),
@@ -461,6 +494,9 @@ func (r *Repository) expandRecords(ctx context.Context, collection *models.Colle
 		for _, r := range records {
 			if id, ok := r.Data[fieldName].(string); ok {
 				if expanded, exists := resMap[id]; exists {
+					if r.Expand == nil {
+						r.Expand = make(map[string]any)
+					}
 					r.Expand[fieldName] = expanded
 				}
 			}
@@ -79,7 +79,12 @@ func (s *SchemaRegistry) LoadFromDB(ctx context.Context) error {
 		slog.Warn("Failed to migrate _collections IDs", "error", err)
 	}
 
-	rows, err := s.db.QueryContext(ctx, "SELECT id, name, type, fields, list_rule, view_rule, create_rule, update_rule, delete_rule, created, updated FROM _collections")
+	// Collections saved before options existed lack the column.
+	if err := s.ensureOptionsColumn(ctx); err != nil {
+		return err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, type, fields, list_rule, view_rule, create_rule, update_rule, delete_rule, options, created, updated FROM _collections")
 	if err != nil {
 		return err
 	}
@@ -87,8 +92,8 @@ func (s *SchemaRegistry) LoadFromDB(ctx context.Context) error {
 
 	for rows.Next() {
 		var id, name, ctype, fieldsJSON, created, updated string
-		var listRule, viewRule, createRule, updateRule, deleteRule sql.NullString
-		if err := rows.Scan(&id, &name, &ctype, &fieldsJSON, &listRule, &viewRule, &createRule, &updateRule, &deleteRule, &created, &updated); err != nil {
+		var listRule, viewRule, createRule, updateRule, deleteRule, optionsJSON sql.NullString
+		if err := rows.Scan(&id, &name, &ctype, &fieldsJSON, &listRule, &viewRule, &createRule, &updateRule, &deleteRule, &optionsJSON, &created, &updated); err != nil {
 			return err
 		}
 
@@ -97,11 +102,19 @@ func (s *SchemaRegistry) LoadFromDB(ctx context.Context) error {
 			return err
 		}
 
+		var options models.CollectionOptions
+		if optionsJSON.String != "" {
+			if err := json.Unmarshal([]byte(optionsJSON.String), &options); err != nil {
+				return err
+			}
+		}
+
 		col := &models.Collection{
 			ID:      id,
 			Name:    name,
 			Type:    models.CollectionType(ctype),
 			Fields:  fields,
+			Options: options,
 			Created: created,
 			Updated: updated,
 		}
@@ -127,16 +140,46 @@ func (s *SchemaRegistry) LoadFromDB(ctx context.Context) error {
 	return nil
 }
 
+// ensureOptionsColumn adds the options column to _collections if missing.
+func (s *SchemaRegistry) ensureOptionsColumn(ctx context.Context) error {
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('_collections') WHERE name = 'options'").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, "ALTER TABLE _collections ADD COLUMN options TEXT")
+	return err
+}
+
+// StoredOptions returns the options saved for the collection, so that
+// re-registering a built-in collection on startup keeps what admins set.
+func (s *SchemaRegistry) StoredOptions(ctx context.Context, name string) (models.CollectionOptions, error) {
+	var options models.CollectionOptions
+	var optionsJSON sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT options FROM _collections WHERE name = ?", name).Scan(&optionsJSON)
+	if err == sql.ErrNoRows || optionsJSON.String == "" {
+		return options, nil
+	}
+	if err != nil {
+		return options, err
+	}
+	err = json.Unmarshal([]byte(optionsJSON.String), &options)
+	return options, err
+}
+
 func (s *SchemaRegistry) SaveCollection(ctx context.Context, c *models.Collection) error {
 	fieldsJSON, _ := json.Marshal(c.Fields)
+	optionsJSON, _ := json.Marshal(c.Options)
 
 	// Generate ID if not present
 	if c.ID == "" {
 		c.ID = "col_" + c.Name
 	}
 
-	query := `INSERT INTO _collections (id, name, type, fields, list_rule, view_rule, create_rule, update_rule, delete_rule) 
-	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) 
+	query := `INSERT INTO _collections (id, name, type, fields, list_rule, view_rule, create_rule, update_rule, delete_rule, options) 
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) 
 	          ON CONFLICT(name) DO UPDATE SET 
 			  type=excluded.type, 
 			  fields=excluded.fields,
@@ -144,11 +187,12 @@ func (s *SchemaRegistry) SaveCollection(ctx context.Context, c *models.Collectio
 			  view_rule=excluded.view_rule,
 			  create_rule=excluded.create_rule,
 			  update_rule=excluded.update_rule,
-			  delete_rule=excluded.delete_rule`
+			  delete_rule=excluded.delete_rule,
+			  options=excluded.options`
 
 	_, err := s.db.ExecContext(ctx, query,
 		c.ID, c.Name, c.Type, string(fieldsJSON),
-		c.ListRule, c.ViewRule, c.CreateRule, c.UpdateRule, c.DeleteRule,
+		c.ListRule, c.ViewRule, c.CreateRule, c.UpdateRule, c.DeleteRule, string(optionsJSON),
 	)
 	if err != nil {
 		return errors.NewError(http.StatusInternalServerError, "DB_SAVE_COLLECTION_FAILED", "Failed to persist collection definition").WithDetails(map[string]any{"error": err.Error()})
@@ -158,9 +202,13 @@ func (s *SchemaRegistry) SaveCollection(ctx context.Context, c *models.Collectio
 	return nil
 }
 
+// adminOnlyRule never matches an ordinary auth record; admins bypass rules
+// entirely, so collections guarded by it are only reachable by admins.
+const adminOnlyRule = "@request.auth.collection = '" + models.AdminsCollection + "'"
+
 // BootstrapSystemCollections initializes the internal meta tables
 func (s *SchemaRegistry) BootstrapSystemCollections() error {
-	adminOnly := "@request.auth.id != ''"
+	adminOnly := adminOnlyRule
 	collectionsTable := &models.Collection{
 		ID:   "system_collections",
 		Name: "_collections",
@@ -174,6 +222,7 @@ func (s *SchemaRegistry) BootstrapSystemCollections() error {
 			{Name: "create_rule", Type: models.FieldTypeText},
 			{Name: "update_rule", Type: models.FieldTypeText},
 			{Name: "delete_rule", Type: models.FieldTypeText},
+			{Name: "options", Type: models.FieldTypeJSON},
 		},
 		ListRule:   &adminOnly,
 		ViewRule:   &adminOnly,
@@ -188,12 +237,14 @@ func (s *SchemaRegistry) BootstrapSystemCollections() error {
 	return nil
 }
 
-func (s *SchemaRegistry) BootstrapUsersCollection() error {
-	adminOnly := "@request.auth.id != ''"
-	usersTable := &models.Collection{
-		ID:   "system_users",
-		Name: "users",
-		Type: models.CollectionTypeAuth,
+// BootstrapAdminsCollection registers the collection holding dashboard
+// administrators, separate from ordinary users.
+func (s *SchemaRegistry) BootstrapAdminsCollection() error {
+	adminOnly := adminOnlyRule
+	adminsTable := &models.Collection{
+		ID:   "system_admins",
+		Name: models.AdminsCollection,
+		Type: models.CollectionTypeSystem,
 		Fields: []models.Field{
 			{Name: "username", Type: models.FieldTypeText, Required: true, Unique: true},
 			{Name: "email", Type: models.FieldTypeText, Required: true, Unique: true},
@@ -207,19 +258,275 @@ func (s *SchemaRegistry) BootstrapUsersCollection() error {
 		DeleteRule: &adminOnly,
 	}
 
+	s.AddCollection(adminsTable)
+	return nil
+}
+
+// BootstrapAuthTokensCollection registers the collection holding password
+// reset and email verification tokens. Only token hashes are stored.
+func (s *SchemaRegistry) BootstrapAuthTokensCollection() error {
+	adminOnly := adminOnlyRule
+	tokensTable := &models.Collection{
+		ID:   "system_auth_tokens",
+		Name: models.AuthTokensCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "token_hash", Type: models.FieldTypeText, Required: true, Unique: true},
+			{Name: "type", Type: models.FieldTypeText, Required: true},
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "record_id", Type: models.FieldTypeText, Required: true},
+			{Name: "email", Type: models.FieldTypeText},
+			{Name: "expires", Type: models.FieldTypeDate, Required: true},
+			{Name: "attempts", Type: models.FieldTypeNumber},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(tokensTable)
+	return nil
+}
+
+// BootstrapIdentitiesCollection registers the collection linking OAuth2
+// provider accounts to auth records.
+func (s *SchemaRegistry) BootstrapIdentitiesCollection() error {
+	adminOnly := adminOnlyRule
+	identitiesTable := &models.Collection{
+		ID:   "system_identities",
+		Name: models.IdentitiesCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "provider", Type: models.FieldTypeText, Required: true},
+			{Name: "provider_id", Type: models.FieldTypeText, Required: true},
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "record_id", Type: models.FieldTypeText, Required: true},
+			{Name: "email", Type: models.FieldTypeText},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(identitiesTable)
+	return nil
+}
+
+// BootstrapMFACollection registers the collection holding TOTP enrollments.
+// Recovery codes are stored as hashes.
+func (s *SchemaRegistry) BootstrapMFACollection() error {
+	adminOnly := adminOnlyRule
+	mfaTable := &models.Collection{
+		ID:   "system_mfa",
+		Name: models.MFACollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "record_id", Type: models.FieldTypeText, Required: true},
+			{Name: "secret", Type: models.FieldTypeText, Required: true},
+			{Name: "enabled", Type: models.FieldTypeBool},
+			{Name: "recovery_codes", Type: models.FieldTypeJSON},
+			{Name: "last_step", Type: models.FieldTypeNumber},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(mfaTable)
+	return nil
+}
+
+// BootstrapAPIKeysCollection registers the collection holding API keys.
+// Only key hashes are stored.
+func (s *SchemaRegistry) BootstrapAPIKeysCollection() error {
+	adminOnly := adminOnlyRule
+	keysTable := &models.Collection{
+		ID:   "system_api_keys",
+		Name: models.APIKeysCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "name", Type: models.FieldTypeText, Required: true},
+			{Name: "key_hash", Type: models.FieldTypeText, Required: true, Unique: true},
+			{Name: "prefix", Type: models.FieldTypeText, Required: true},
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "record_id", Type: models.FieldTypeText, Required: true},
+			{Name: "scopes", Type: models.FieldTypeJSON},
+			{Name: "expires", Type: models.FieldTypeDate},
+			{Name: "last_used", Type: models.FieldTypeDate},
+			{Name: "last_used_ip", Type: models.FieldTypeText},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(keysTable)
+	return nil
+}
+
+// BootstrapLoginAttemptsCollection registers the collection counting failed
+// logins per identity and per client IP for brute-force protection.
+func (s *SchemaRegistry) BootstrapLoginAttemptsCollection() error {
+	adminOnly := adminOnlyRule
+	attemptsTable := &models.Collection{
+		ID:   "system_login_attempts",
+		Name: models.LoginAttemptsCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "key", Type: models.FieldTypeText, Required: true, Unique: true},
+			{Name: "kind", Type: models.FieldTypeText, Required: true},
+			{Name: "collection", Type: models.FieldTypeText},
+			{Name: "subject", Type: models.FieldTypeText, Required: true},
+			{Name: "failures", Type: models.FieldTypeNumber},
+			{Name: "last_failure", Type: models.FieldTypeDate},
+			{Name: "locked_until", Type: models.FieldTypeDate},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(attemptsTable)
+	return nil
+}
+
+// BootstrapUploadsCollection registers the collection tracking resumable
+// uploads. Their chunks are kept in storage under _uploads/{id}, and guest
+// uploads keep the hash of the secret they are bound to.
+func (s *SchemaRegistry) BootstrapUploadsCollection() error {
+	adminOnly := adminOnlyRule
+	uploadsTable := &models.Collection{
+		ID:   "system_uploads",
+		Name: models.UploadsCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "record_id", Type: models.FieldTypeText, Required: true},
+			{Name: "field", Type: models.FieldTypeText, Required: true},
+			{Name: "filename", Type: models.FieldTypeText},
+			{Name: "size", Type: models.FieldTypeNumber},
+			{Name: "offset", Type: models.FieldTypeNumber},
+			{Name: "owner", Type: models.FieldTypeText},
+			{Name: "expires", Type: models.FieldTypeDate},
+			{Name: "secret", Type: models.FieldTypeText},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(uploadsTable)
+	return nil
+}
+
+// BootstrapFileRefsCollection registers the collection referencing the
+// deduplicated blobs that hold the files of records, by the SHA-256 hash of
+// their content.
+func (s *SchemaRegistry) BootstrapFileRefsCollection() error {
+	adminOnly := adminOnlyRule
+	refsTable := &models.Collection{
+		ID:   "system_file_refs",
+		Name: models.FileRefsCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "path", Type: models.FieldTypeText, Required: true, Unique: true},
+			{Name: "collection", Type: models.FieldTypeText},
+			{Name: "record_id", Type: models.FieldTypeText},
+			{Name: "field", Type: models.FieldTypeText},
+			{Name: "filename", Type: models.FieldTypeText},
+			{Name: "hash", Type: models.FieldTypeText, Required: true},
+			{Name: "size", Type: models.FieldTypeNumber},
+			{Name: "modified", Type: models.FieldTypeDate},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(refsTable)
+	return nil
+}
+
+// BootstrapRolesCollection registers the collection holding role definitions
+// and their collection grants and admin permissions.
+func (s *SchemaRegistry) BootstrapRolesCollection() error {
+	adminOnly := adminOnlyRule
+	rolesTable := &models.Collection{
+		ID:   "system_roles",
+		Name: models.RolesCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "name", Type: models.FieldTypeText, Required: true, Unique: true},
+			{Name: "description", Type: models.FieldTypeText},
+			{Name: "collections", Type: models.FieldTypeJSON},
+			{Name: "permissions", Type: models.FieldTypeJSON},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(rolesTable)
+	return nil
+}
+
+func (s *SchemaRegistry) BootstrapUsersCollection() error {
+	adminOnly := adminOnlyRule
+	ownerOnly := "id = @request.auth.id"
+	public := ""
+	usersTable := &models.Collection{
+		ID:         "system_users",
+		Name:       "users",
+		Type:       models.CollectionTypeAuth,
+		Fields:     models.AuthFields(),
+		ListRule:   &ownerOnly,
+		ViewRule:   &ownerOnly,
+		CreateRule: &public,
+		UpdateRule: &ownerOnly,
+		DeleteRule: &adminOnly,
+	}
+
 	s.AddCollection(usersTable)
 	return nil
 }
 
+// BootstrapRefreshTokensCollection registers the collection holding refresh
+// tokens. The token field stores a SHA-256 hash, never the token itself.
+// Rotated tokens are kept as used so that replaying one can be detected.
 func (s *SchemaRegistry) BootstrapRefreshTokensCollection() error {
-	adminOnly := "@request.auth.id != ''"
+	adminOnly := adminOnlyRule
 	tokensTable := &models.Collection{
 		ID:   "system_refresh_tokens",
-		Name: "_refresh_tokens",
+		Name: models.RefreshTokensCollection,
 		Type: models.CollectionTypeSystem,
 		Fields: []models.Field{
 			{Name: "token", Type: models.FieldTypeText, Required: true, Unique: true},
 			{Name: "user_id", Type: models.FieldTypeText, Required: true},
+			{Name: "collection", Type: models.FieldTypeText},
+			{Name: "family", Type: models.FieldTypeText},
+			{Name: "kind", Type: models.FieldTypeText},
+			{Name: "used", Type: models.FieldTypeBool},
+			{Name: "started", Type: models.FieldTypeDate},
+			{Name: "last_used", Type: models.FieldTypeDate},
+			{Name: "user_agent", Type: models.FieldTypeText},
+			{Name: "ip", Type: models.FieldTypeText},
 			{Name: "expires", Type: models.FieldTypeDate, Required: true},
 		},
 		ListRule:   &adminOnly,
@@ -234,7 +541,7 @@ func (s *SchemaRegistry) BootstrapRefreshTokensCollection() error {
 }
 
 func (s *SchemaRegistry) BootstrapAuditLogsCollection() error {
-	adminOnly := "@request.auth.id != ''"
+	adminOnly := adminOnlyRule
 	auditTable := &models.Collection{
 		ID:   "system_audit_logs",
 		Name: "_audit_logs",
@@ -258,3 +565,82 @@ func (s *SchemaRegistry) BootstrapAuditLogsCollection() error {
 	s.AddCollection(auditTable)
 	return nil
 }
+
+// BootstrapStoredFilesCollection registers the collection listing the files
+// of records with their size and uploader.
+func (s *SchemaRegistry) BootstrapStoredFilesCollection() error {
+	adminOnly := adminOnlyRule
+	filesTable := &models.Collection{
+		ID:   "system_stored_files",
+		Name: models.StoredFilesCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "path", Type: models.FieldTypeText, Required: true, Unique: true},
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "owner", Type: models.FieldTypeText},
+			{Name: "size", Type: models.FieldTypeNumber},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(filesTable)
+	return nil
+}
+
+// BootstrapStorageUsageCollection registers the collection holding the
+// storage used per collection and per uploading auth record.
+func (s *SchemaRegistry) BootstrapStorageUsageCollection() error {
+	adminOnly := adminOnlyRule
+	usageTable := &models.Collection{
+		ID:   "system_storage_usage",
+		Name: models.StorageUsageCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "scope", Type: models.FieldTypeText, Required: true},
+			{Name: "name", Type: models.FieldTypeText, Required: true},
+			{Name: "bytes", Type: models.FieldTypeNumber},
+			{Name: "files", Type: models.FieldTypeNumber},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(usageTable)
+	return nil
+}
+
+// BootstrapQuarantineCollection registers the collection listing quarantined
+// uploads. Their content is kept in storage under _quarantine/{id}.
+func (s *SchemaRegistry) BootstrapQuarantineCollection() error {
+	adminOnly := adminOnlyRule
+	quarantineTable := &models.Collection{
+		ID:   "system_quarantine",
+		Name: models.QuarantineCollection,
+		Type: models.CollectionTypeSystem,
+		Fields: []models.Field{
+			{Name: "collection", Type: models.FieldTypeText, Required: true},
+			{Name: "record_id", Type: models.FieldTypeText, Required: true},
+			{Name: "field", Type: models.FieldTypeText, Required: true},
+			{Name: "filename", Type: models.FieldTypeText},
+			{Name: "size", Type: models.FieldTypeNumber},
+			{Name: "owner", Type: models.FieldTypeText},
+			{Name: "scanner", Type: models.FieldTypeText},
+			{Name: "threat", Type: models.FieldTypeText},
+		},
+		ListRule:   &adminOnly,
+		ViewRule:   &adminOnly,
+		CreateRule: &adminOnly,
+		UpdateRule: &adminOnly,
+		DeleteRule: &adminOnly,
+	}
+
+	s.AddCollection(quarantineTable)
+	return nil
+}
@@ -0,0 +1,269 @@
+// Package imaging generates thumbnails and converts images between the JPEG,
+// PNG and GIF formats using only the standard library.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Supported formats.
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	GIF  = "gif"
+)
+
+// MaxPixels bounds the size of the images decoded, so that a small file
+// declaring huge dimensions cannot exhaust memory.
+const MaxPixels = 50_000_000
+
+// MaxSide bounds each side of a thumbnail.
+const MaxSide = 4096
+
+var ErrTooLarge = errors.New("image is too large to process")
+
+// Thumb is a thumbnail size. A zero width or height follows the image's
+// aspect ratio. Otherwise the image is cropped around its center to fill the
+// size, or scaled to fit inside it when Fit is set.
+type Thumb struct {
+	Width  int
+	Height int
+	Fit    bool
+}
+
+// ParseThumb parses a size written as WxH, or WxHf to fit the image inside
+// the size instead of cropping it.
+func ParseThumb(s string) (Thumb, error) {
+	spec, fit := strings.CutSuffix(strings.ToLower(strings.TrimSpace(s)), "f")
+	w, h, ok := strings.Cut(spec, "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width < 0 || height < 0 || width+height == 0 || width > MaxSide || height > MaxSide {
+		return Thumb{}, fmt.Errorf("invalid thumb size %q, expected WxH or WxHf", s)
+	}
+	return Thumb{Width: width, Height: height, Fit: fit}, nil
+}
+
+// String formats the size as ParseThumb reads it.
+func (t Thumb) String() string {
+	s := fmt.Sprintf("%dx%d", t.Width, t.Height)
+	if t.Fit {
+		s += "f"
+	}
+	return s
+}
+
+// ParseFormat returns the format a name such as jpg or PNG stands for.
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "jpeg", "jpg":
+		return JPEG, nil
+	case "png":
+		return PNG, nil
+	case "gif":
+		return GIF, nil
+	}
+	return "", fmt.Errorf("unsupported image format %q, expected jpeg, png or gif", name)
+}
+
+// Format detects the format of an image from its first bytes, returning ""
+// for anything but JPEG, PNG and GIF.
+func Format(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return JPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return GIF
+	}
+	return ""
+}
+
+// Extension returns the file extension of a format.
+func Extension(format string) string {
+	if format == JPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// Transform decodes an image, resizes it to the thumb unless the thumb is
+// zero, and encodes it in the format. Only the first frame of an animated
+// GIF is kept.
+func Transform(r io.Reader, thumb Thumb, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(io.MultiReader(&buf, r))
+	if err != nil {
+		return nil, err
+	}
+
+	if thumb != (Thumb{}) {
+		img = Thumbnail(img, thumb)
+	}
+
+	var out bytes.Buffer
+	switch format {
+	case JPEG:
+		err = jpeg.Encode(&out, flatten(img), &jpeg.Options{Quality: 85})
+	case PNG:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&out, img)
+	case GIF:
+		err = gif.Encode(&out, img, nil)
+	default:
+		err = fmt.Errorf("unsupported image format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Thumbnail resizes the image to the thumb.
+func Thumbnail(img image.Image, thumb Thumb) image.Image {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	w, h := thumb.Width, thumb.Height
+
+	switch {
+	case w == 0:
+		w = max(1, int(math.Round(float64(sw)*float64(h)/float64(sh))))
+	case h == 0:
+		h = max(1, int(math.Round(float64(sh)*float64(w)/float64(sw))))
+	case thumb.Fit:
+		ratio := math.Min(float64(w)/float64(sw), float64(h)/float64(sh))
+		w = max(1, int(math.Round(float64(sw)*ratio)))
+		h = max(1, int(math.Round(float64(sh)*ratio)))
+	default:
+		// Crop the source around its center to the thumb's aspect ratio.
+		crop := bounds
+		if sw*h > sh*w {
+			cw := max(1, int(math.Round(float64(sh)*float64(w)/float64(h))))
+			crop.Min.X += (sw - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else {
+			ch := max(1, int(math.Round(float64(sw)*float64(h)/float64(w))))
+			crop.Min.Y += (sh - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+		return Resize(img, crop, w, h)
+	}
+	return Resize(img, bounds, w, h)
+}
+
+// Resize scales the rectangle of the image to w by h pixels. It filters
+// each axis in turn with a triangle filter, widened when shrinking so that
+// every source pixel contributes.
+func Resize(img image.Image, rect image.Rectangle, w, h int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(src, src.Bounds(), img, rect.Min, draw.Src)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Horizontal pass into a w by sh buffer.
+	columns := weights(sw, w)
+	tmp := make([]float64, w*sh*4)
+	for y := range sh {
+		row := src.Pix[y*src.Stride:]
+		for x, c := range columns {
+			var r, g, b, a float64
+			for i, weight := range c.weights {
+				p := row[(c.start+i)*4:]
+				r += float64(p[0]) * weight
+				g += float64(p[1]) * weight
+				b += float64(p[2]) * weight
+				a += float64(p[3]) * weight
+			}
+			t := tmp[(y*w+x)*4:]
+			t[0], t[1], t[2], t[3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass into the result.
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	rows := weights(sh, h)
+	for y, c := range rows {
+		out := dst.Pix[y*dst.Stride:]
+		for x := range w {
+			var r, g, b, a float64
+			for i, weight := range c.weights {
+				t := tmp[((c.start+i)*w+x)*4:]
+				r += t[0] * weight
+				g += t[1] * weight
+				b += t[2] * weight
+				a += t[3] * weight
+			}
+			p := out[x*4:]
+			p[0], p[1], p[2], p[3] = clamp(r), clamp(g), clamp(b), clamp(a)
+		}
+	}
+	return dst
+}
+
+// contribution lists the weights of the consecutive source pixels, from
+// start, that make up one destination pixel.
+type contribution struct {
+	start   int
+	weights []float64
+}
+
+func weights(srcSize, dstSize int) []contribution {
+	scale := float64(srcSize) / float64(dstSize)
+	support := math.Max(scale, 1)
+
+	contributions := make([]contribution, dstSize)
+	for i := range contributions {
+		center := (float64(i) + 0.5) * scale
+		start := max(0, int(math.Floor(center-support)))
+		end := min(srcSize, int(math.Ceil(center+support)))
+
+		var total float64
+		ws := make([]float64, 0, end-start)
+		for j := start; j < end; j++ {
+			weight := 1 - math.Abs((float64(j)+0.5-center)/support)
+			if weight < 0 {
+				weight = 0
+			}
+			ws = append(ws, weight)
+			total += weight
+		}
+		for j := range ws {
+			ws[j] /= total
+		}
+		contributions[i] = contribution{start: start, weights: ws}
+	}
+	return contributions
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Min(255, math.Max(0, math.Round(v))))
+}
+
+// flatten draws the image over white, since JPEG has no transparency.
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
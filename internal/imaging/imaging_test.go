@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func TestParseThumb(t *testing.T) {
+	for spec, want := range map[string]Thumb{
+		"100x50":  {Width: 100, Height: 50},
+		"100x50f": {Width: 100, Height: 50, Fit: true},
+		"0x80":    {Height: 80},
+		"80x0":    {Width: 80},
+	} {
+		got, err := ParseThumb(spec)
+		if err != nil || got != want || got.String() != spec {
+			t.Errorf("%s: got %+v %v", spec, got, err)
+		}
+	}
+	for _, spec := range []string{"", "100", "0x0", "-1x5", "axb", "100x50c", "5000x10"} {
+		if _, err := ParseThumb(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	// A 200x100 image, red on the left half and blue on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := range 100 {
+		for x := range 200 {
+			if x < 100 {
+				src.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				src.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		thumb         Thumb
+		width, height int
+	}{
+		{Thumb{Width: 50, Height: 50}, 50, 50},
+		{Thumb{Width: 50, Height: 50, Fit: true}, 50, 25},
+		{Thumb{Width: 40}, 40, 20},
+		{Thumb{Height: 40}, 80, 40},
+		{Thumb{Width: 400, Height: 100}, 400, 100},
+	} {
+		img := Thumbnail(src, tc.thumb)
+		if b := img.Bounds(); b.Dx() != tc.width || b.Dy() != tc.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", tc.thumb, tc.width, tc.height, b.Dx(), b.Dy())
+		}
+	}
+
+	// Cropping keeps the center, so both halves stay visible and the edges
+	// keep their colors.
+	img := Thumbnail(src, Thumb{Width: 20, Height: 20})
+	if r, _, b, _ := img.At(0, 10).RGBA(); r>>8 != 255 || b != 0 {
+		t.Errorf("expected red on the left, got %v", img.At(0, 10))
+	}
+	if r, _, b, _ := img.At(19, 10).RGBA(); r != 0 || b>>8 != 255 {
+		t.Errorf("expected blue on the right, got %v", img.At(19, 10))
+	}
+}
+
+func TestTransform(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for i := range src.Pix {
+		src.Pix[i] = 128
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	if Format(buf.Bytes()) != PNG {
+		t.Fatal("expected the image to be detected as PNG")
+	}
+
+	for _, format := range []string{JPEG, PNG, GIF} {
+		data, err := Transform(bytes.NewReader(buf.Bytes()), Thumb{Width: 16, Height: 16}, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if Format(data) != format {
+			t.Errorf("expected %s output", format)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || config.Width != 16 || config.Height != 16 {
+			t.Errorf("%s: expected a 16x16 image, got %+v %v", format, config, err)
+		}
+	}
+
+	// Converting without a thumb keeps the size.
+	data, err := Transform(bytes.NewReader(buf.Bytes()), Thumb{}, GIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err := gif.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != 64 {
+		t.Errorf("expected the original size, got %v", err)
+	}
+
+	if _, err := Transform(bytes.NewReader([]byte("not an image")), Thumb{}, PNG); err == nil {
+		t.Error("expected an invalid image to fail")
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+// APIKeysCollection is the system collection that holds API key hashes.
+const APIKeysCollection = "_api_keys"
+
+// APIKey is a long-lived key that authenticates as an auth record, limited
+// to its scopes. The key itself is only shown when it is created.
+type APIKey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Collection string   `json:"collection"`
+	RecordID   string   `json:"record_id"`
+	Scopes     []string `json:"scopes"`
+	Expires    string   `json:"expires,omitempty"`
+	LastUsed   string   `json:"last_used,omitempty"`
+	LastUsedIP string   `json:"last_used_ip,omitempty"`
+	Created    string   `json:"created"`
+}
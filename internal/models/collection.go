@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 type CollectionType string
 
 const (
@@ -8,6 +10,32 @@ const (
 	CollectionTypeSystem CollectionType = "system"
 )
 
+// AdminsCollection is the system collection that holds dashboard
+// administrators. Its records are kept apart from ordinary auth records.
+const AdminsCollection = "_admins"
+
+// AuditLogsCollection is the system collection that records admin actions
+// such as lifted lockouts and released quarantined files.
+const AuditLogsCollection = "_audit_logs"
+
+// AuthTokensCollection is the system collection that holds the hashed,
+// single-use tokens behind password reset and email verification.
+const AuthTokensCollection = "_auth_tokens"
+
+// IdentitiesCollection is the system collection that links accounts at
+// OAuth2 providers to records of auth collections.
+const IdentitiesCollection = "_identities"
+
+// MFACollection is the system collection that holds the TOTP secrets and
+// hashed recovery codes of auth records.
+const MFACollection = "_mfa"
+
+// IsSystemCollection reports whether the name is that of a system
+// collection, which all start with an underscore.
+func IsSystemCollection(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
 type Collection struct {
 	ID      string         `json:"id"`
 	Name    string         `json:"name"`
@@ -22,6 +50,58 @@ type Collection struct {
 	UpdateRule *string `json:"update_rule"`
 	DeleteRule *string `json:"delete_rule"`
 
+	Options CollectionOptions `json:"options"`
+
 	Created string `json:"created"`
 	Updated string `json:"updated"`
 }
+
+// CollectionOptions holds collection settings that are not fields or rules.
+type CollectionOptions struct {
+	// MFARequired makes records of an auth collection complete a TOTP
+	// challenge, enrolling first if needed, on every password login.
+	MFARequired bool `json:"mfa_required,omitempty"`
+
+	// QuotaBytes and QuotaFiles limit the files of the collection's records,
+	// in place of the server's collection quotas when set.
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+	QuotaFiles int   `json:"quota_files,omitempty"`
+
+	// UserQuotaBytes and UserQuotaFiles limit the files each record of an
+	// auth collection uploads, in place of the server's user quotas when
+	// set.
+	UserQuotaBytes int64 `json:"user_quota_bytes,omitempty"`
+	UserQuotaFiles int   `json:"user_quota_files,omitempty"`
+}
+
+// AuthFields returns the fields every auth collection carries.
+func AuthFields() []Field {
+	return []Field{
+		{Name: "username", Type: FieldTypeText, Required: true, Unique: true},
+		{Name: "email", Type: FieldTypeText, Required: true, Unique: true},
+		{Name: "password", Type: FieldTypeText, Required: true},
+		{Name: "lastLogin", Type: FieldTypeDate},
+		{Name: "roles", Type: FieldTypeJSON},
+		{Name: "verified", Type: FieldTypeBool},
+	}
+}
+
+// EnsureAuthFields adds the auth fields missing from an auth collection and
+// resets the definition of any that were redeclared.
+func (c *Collection) EnsureAuthFields() {
+	for _, required := range AuthFields() {
+		found := false
+		for i := range c.Fields {
+			if c.Fields[i].Name == required.Name {
+				options := c.Fields[i].Options
+				c.Fields[i] = required
+				c.Fields[i].Options = options
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Fields = append(c.Fields, required)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 type FieldType string
 
 const (
@@ -19,3 +24,85 @@ type Field struct {
 	Unique   bool      `json:"unique"`
 	Options  any       `json:"options,omitempty"`
 }
+
+// FileOptions are the options of a file field.
+type FileOptions struct {
+	// Protected files are only served to callers who may view the record,
+	// or with a signed file token.
+	Protected bool `json:"protected,omitempty"`
+
+	// MaxSize is the largest accepted file in bytes. Zero falls back to the
+	// server's max_file_upload_size.
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	// MimeTypes lists the accepted content types, such as image/png or
+	// image/*. Any type the server does not block is accepted when empty.
+	MimeTypes []string `json:"mime_types,omitempty"`
+
+	// MaxSelect is how many files the field holds. Fields holding more than
+	// one store a JSON list of names rather than a single name.
+	MaxSelect int `json:"max_select,omitempty"`
+
+	// Thumbs lists the thumbnail sizes, such as 100x100 or 800x0, that
+	// images of the field may be served at.
+	Thumbs []string `json:"thumbs,omitempty"`
+}
+
+// Multiple reports whether the field holds a list of files.
+func (o FileOptions) Multiple() bool {
+	return o.MaxSelect > 1
+}
+
+// Accepts reports whether the field accepts files of the content type.
+func (o FileOptions) Accepts(contentType string) bool {
+	if len(o.MimeTypes) == 0 {
+		return true
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, allowed := range o.MimeTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == contentType || allowed == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FileOptions decodes the options of a file field.
+func (f *Field) FileOptions() FileOptions {
+	var options FileOptions
+	if data, err := json.Marshal(f.Options); err == nil {
+		_ = json.Unmarshal(data, &options)
+	}
+	return options
+}
+
+// FileNames returns the file names held by a file field's value, either a
+// single name or a JSON list of names.
+func FileNames(value any) []string {
+	switch v := value.(type) {
+	case string:
+		var names []string
+		if strings.HasPrefix(strings.TrimSpace(v), "[") && json.Unmarshal([]byte(v), &names) == nil {
+			return names
+		}
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []any:
+		var names []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
@@ -6,3 +6,34 @@ type FileMetadata struct {
 	Mime string `json:"mime"`
 	URL  string `json:"url"`
 }
+
+// FileRefsCollection is the system collection mapping the files of records
+// to the blobs holding their content when storage deduplication is enabled.
+const FileRefsCollection = "_file_refs"
+
+// StoredFilesCollection is the system collection listing the files of
+// records with their size and the auth record that uploaded them, which
+// storage usage is accounted from.
+const StoredFilesCollection = "_stored_files"
+
+// StorageUsageCollection is the system collection holding the storage used
+// by the files of each collection and by the uploads of each auth record.
+const StorageUsageCollection = "_storage_usage"
+
+// Storage usage scopes.
+const (
+	UsageScopeCollection = "collection"
+	UsageScopeUser       = "user"
+)
+
+// StorageUsage is the storage used within a scope, by the collection or the
+// auth record ({collection}/{id}) Name, and the quota it is held to. A zero
+// quota is unlimited.
+type StorageUsage struct {
+	Scope      string `json:"scope"`
+	Name       string `json:"name"`
+	Bytes      int64  `json:"bytes"`
+	Files      int    `json:"files"`
+	QuotaBytes int64  `json:"quota_bytes"`
+	QuotaFiles int    `json:"quota_files"`
+}
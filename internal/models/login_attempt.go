@@ -0,0 +1,24 @@
+package models
+
+// LoginAttemptsCollection is the system collection that counts failed
+// logins per identity and per client IP.
+const LoginAttemptsCollection = "_login_attempts"
+
+// Kinds of failed-login counters.
+const (
+	LoginAttemptIdentity = "identity"
+	LoginAttemptIP       = "ip"
+)
+
+// LoginAttempt is a failed-login counter. Subject is the identity (email or
+// username) or the client IP, depending on Kind.
+type LoginAttempt struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Collection  string `json:"collection,omitempty"`
+	Subject     string `json:"subject"`
+	Failures    int    `json:"failures"`
+	LastFailure string `json:"last_failure"`
+	LockedUntil string `json:"locked_until,omitempty"`
+	Locked      bool   `json:"locked"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// QuarantineCollection is the system collection listing the uploads a
+// scanner flagged, held out of the record they were uploaded to until an
+// admin releases or deletes them.
+const QuarantineCollection = "_quarantine"
+
+// QuarantinedFile is an upload to a file field of a record that a scanner
+// flagged. Its content is kept in storage under _quarantine/{id}. Owner
+// identifies the auth record that uploaded it as {collection}/{id}, or is
+// empty for guests.
+type QuarantinedFile struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	RecordID   string `json:"record_id"`
+	Field      string `json:"field"`
+	Filename   string `json:"filename"`
+	Size       int64  `json:"size"`
+	Owner      string `json:"owner,omitempty"`
+	Scanner    string `json:"scanner"`
+	Threat     string `json:"threat"`
+	Created    string `json:"created"`
+}
@@ -21,6 +21,19 @@ func NewRecord(collection string) *Record {
 	}
 }
 
+// Values returns the record's field data together with its system fields,
+// as seen by rule expressions.
+func (r *Record) Values() map[string]any {
+	values := make(map[string]any, len(r.Data)+3)
+	for k, v := range r.Data {
+		values[k] = v
+	}
+	values["id"] = r.ID
+	values["created"] = r.Created
+	values["updated"] = r.Updated
+	return values
+}
+
 func (r *Record) GetString(key string) string {
 	if val, ok := r.Data[key].(string); ok {
 		return val
@@ -35,5 +48,8 @@ func (r *Record) GetInt(key string) int {
 	if val, ok := r.Data[key].(int); ok {
 		return val
 	}
+	if val, ok := r.Data[key].(int64); ok {
+		return int(val)
+	}
 	return 0
 }
@@ -0,0 +1,94 @@
+package models
+
+// RolesCollection is the system collection that holds role definitions.
+const RolesCollection = "_roles"
+
+// Actions that a role can be granted on a collection.
+const (
+	ActionList   = "list"
+	ActionView   = "view"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Permissions that a role can be granted on the admin API.
+const (
+	PermissionCollectionsRead  = "collections.read"
+	PermissionCollectionsWrite = "collections.write"
+	PermissionSettingsRead     = "settings.read"
+	PermissionSettingsWrite    = "settings.write"
+	PermissionBackupsCreate    = "backups.create"
+	PermissionLogsRead         = "logs.read"
+	PermissionLogsDelete       = "logs.delete"
+	PermissionStorageRead      = "storage.read"
+	PermissionStorageWrite     = "storage.write"
+	PermissionQueryExecute     = "query.execute"
+	PermissionRolesManage      = "roles.manage"
+	PermissionSessionsManage   = "sessions.manage"
+	PermissionAPIKeysManage    = "api_keys.manage"
+	PermissionLockoutsManage   = "lockouts.manage"
+	PermissionQuarantineManage = "quarantine.manage"
+	PermissionAuditLogsRead    = "audit_logs.read"
+)
+
+// RoleWildcard grants every collection other than the system ones, every
+// action or every permission.
+const RoleWildcard = "*"
+
+var RoleActions = []string{ActionList, ActionView, ActionCreate, ActionUpdate, ActionDelete}
+
+var RolePermissions = []string{
+	PermissionCollectionsRead,
+	PermissionCollectionsWrite,
+	PermissionSettingsRead,
+	PermissionSettingsWrite,
+	PermissionBackupsCreate,
+	PermissionLogsRead,
+	PermissionLogsDelete,
+	PermissionStorageRead,
+	PermissionStorageWrite,
+	PermissionQueryExecute,
+	PermissionRolesManage,
+	PermissionSessionsManage,
+	PermissionAPIKeysManage,
+	PermissionLockoutsManage,
+	PermissionQuarantineManage,
+	PermissionAuditLogsRead,
+}
+
+// Role is a named set of grants. Auth records hold the names of their roles
+// in their "roles" field.
+type Role struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Collections map[string][]string `json:"collections"`
+	Permissions []string            `json:"permissions"`
+}
+
+// Allows reports whether the role grants the action on the collection.
+// Roles never grant system collections, not even through the wildcard.
+func (r *Role) Allows(collection, action string) bool {
+	if IsSystemCollection(collection) {
+		return false
+	}
+	for _, name := range []string{collection, RoleWildcard} {
+		for _, a := range r.Collections[name] {
+			if a == action || a == RoleWildcard {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the role grants the admin API permission.
+func (r *Role) HasPermission(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission || p == RoleWildcard {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package models
+
+// RefreshTokensCollection is the system collection that holds refresh token
+// hashes. Tokens issued by one login share a family, which is a session.
+const RefreshTokensCollection = "_refresh_tokens"
+
+// Session is a login of an auth record, identified by its refresh token
+// family. Token sessions are kept alive by rotating refresh tokens; cookie
+// sessions by requests carrying the dashboard's session cookie.
+type Session struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	RecordID   string `json:"record_id"`
+	Kind       string `json:"kind"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	Created    string `json:"created"`
+	LastUsed   string `json:"last_used"`
+	Expires    string `json:"expires"`
+}
@@ -0,0 +1,28 @@
+package models
+
+// UploadsCollection is the system collection tracking resumable uploads
+// until they are attached to a record or expire.
+const UploadsCollection = "_uploads"
+
+// Upload is a resumable upload of a file to a file field of a record. Offset
+// counts the bytes received so far out of Size. Owner identifies the auth
+// record that created it as {collection}/{id}, or is empty for guests, whose
+// uploads are bound to the Secret returned when they are created instead.
+type Upload struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	RecordID   string `json:"record_id"`
+	Field      string `json:"field"`
+	Filename   string `json:"filename"`
+	Size       int64  `json:"size"`
+	Offset     int64  `json:"offset"`
+	Owner      string `json:"owner,omitempty"`
+	Expires    string `json:"expires"`
+	Secret     string `json:"secret,omitempty"`
+	SecretHash string `json:"-"`
+}
+
+// Complete reports whether every byte of the file was received.
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Size
+}
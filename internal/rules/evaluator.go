@@ -1,15 +1,54 @@
 package rules
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/models"
 )
 
+// Lookup gives rules access to other records and collections so that they
+// can follow relation fields and run @collection existence checks.
+type Lookup interface {
+	Collection(name string) (*models.Collection, bool)
+	FindRecordByID(ctx context.Context, collectionName string, id string) (*models.Record, error)
+	Exists(ctx context.Context, query string, args ...any) (bool, error)
+}
+
 type EvaluationContext struct {
 	Auth    map[string]any
 	Data    map[string]any
 	Record  map[string]any
 	IsAdmin bool
+
+	// Collection is the collection the rule belongs to. It is used to
+	// resolve dotted paths into relation and JSON fields of the record.
+	Collection string
+	Method     string
+	Headers    map[string]any
+	Now        time.Time
+
+	Lookup  Lookup
+	Context context.Context
+}
+
+func (ctx EvaluationContext) context() context.Context {
+	if ctx.Context != nil {
+		return ctx.Context
+	}
+	return context.Background()
+}
+
+func (ctx EvaluationContext) now() time.Time {
+	if ctx.Now.IsZero() {
+		return time.Now().UTC()
+	}
+	return ctx.Now.UTC()
 }
 
 func Evaluate(rule string, ctx EvaluationContext) (bool, error) {
@@ -53,11 +92,41 @@ func evalNode(node Node, ctx EvaluationContext) (any, error) {
 		return n.Value, nil
 	case *IntegerLiteral:
 		return n.Value, nil
+	case *FloatLiteral:
+		return n.Value, nil
 	case *StringLiteral:
 		return n.Value, nil
+	case *NullLiteral:
+		return nil, nil
+	case *ListLiteral:
+		values := make([]any, 0, len(n.Elements))
+		for _, e := range n.Elements {
+			v, err := evalNode(e, ctx)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
 	case *Identifier:
+		if isCollectionRef(n.Value) {
+			return nil, fmt.Errorf("%s can only be used in a comparison", n.Value)
+		}
 		return resolveValue(n.Value, ctx), nil
+	case *PrefixExpression:
+		right, err := evalNode(n.Right, ctx)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("type mismatch for !")
+		}
+		return !b, nil
 	case *InfixExpression:
+		if refersToCollection(n) {
+			return evalCollectionComparison(n, ctx)
+		}
 		left, err := evalNode(n.Left, ctx)
 		if err != nil {
 			return nil, err
@@ -73,46 +142,169 @@ func evalNode(node Node, ctx EvaluationContext) (any, error) {
 }
 
 func resolveValue(key string, ctx EvaluationContext) any {
+	switch key {
+	case "@now":
+		return ctx.now().Format(time.RFC3339)
+	case "@request.method":
+		return ctx.Method
+	}
+
+	if strings.HasPrefix(key, "@request.headers.") {
+		name := normalizeHeaderName(strings.TrimPrefix(key, "@request.headers."))
+		if ctx.Headers == nil {
+			return nil
+		}
+		return ctx.Headers[name]
+	}
+
 	// Handle @request context
 	if strings.HasPrefix(key, "@request.auth.") {
-		field := strings.TrimPrefix(key, "@request.auth.")
+		path := strings.Split(strings.TrimPrefix(key, "@request.auth."), ".")
 		if ctx.Auth == nil {
 			return nil
 		}
-		return ctx.Auth[field]
+		authCollection, _ := ctx.Auth["collection"].(string)
+		return resolvePath(ctx, authCollection, ctx.Auth, path)
 	}
 	if strings.HasPrefix(key, "@request.data.") {
-		field := strings.TrimPrefix(key, "@request.data.")
+		path := strings.Split(strings.TrimPrefix(key, "@request.data."), ".")
 		if ctx.Data == nil {
 			return nil
 		}
-		return ctx.Data[field]
+		return resolvePath(ctx, ctx.Collection, ctx.Data, path)
+	}
+
+	// Handle record context (fields without a prefix also refer to the record)
+	path := strings.Split(strings.TrimPrefix(key, "record."), ".")
+	if ctx.Record == nil {
+		return nil
+	}
+	return resolvePath(ctx, ctx.Collection, ctx.Record, path)
+}
+
+// resolvePath walks a dotted path through a record's data, following relation
+// fields into the related record and descending into JSON values.
+func resolvePath(ctx EvaluationContext, collection string, data map[string]any, path []string) any {
+	val, ok := data[path[0]]
+	if !ok || len(path) == 1 {
+		return val
+	}
+
+	if ctx.Lookup != nil && collection != "" {
+		if col, ok := ctx.Lookup.Collection(collection); ok {
+			if field := findField(col, path[0]); field != nil && field.Type == models.FieldTypeRelation {
+				id := formatValue(val)
+				target := relationTarget(field)
+				if id == "" || target == "" {
+					return nil
+				}
+				related, err := ctx.Lookup.FindRecordByID(ctx.context(), target, id)
+				if err != nil {
+					return nil
+				}
+				return resolvePath(ctx, target, related.Values(), path[1:])
+			}
+		}
 	}
 
-	// Handle record context
-	if strings.HasPrefix(key, "record.") {
-		field := strings.TrimPrefix(key, "record.")
-		if ctx.Record == nil {
+	return jsonPath(val, path[1:])
+}
+
+// jsonPath descends into a JSON object (or its serialized form) by key.
+func jsonPath(val any, path []string) any {
+	if s, ok := val.(string); ok {
+		var decoded any
+		if err := json.Unmarshal([]byte(s), &decoded); err != nil {
 			return nil
 		}
-		return ctx.Record[field]
+		val = decoded
 	}
+	for _, key := range path {
+		m, ok := val.(map[string]any)
+		if !ok {
+			return nil
+		}
+		val = m[key]
+	}
+	return val
+}
 
-	// Default to record field if no prefix
-	if ctx.Record != nil {
-		if val, ok := ctx.Record[key]; ok {
-			return val
+func findField(col *models.Collection, name string) *models.Field {
+	for i := range col.Fields {
+		if col.Fields[i].Name == name {
+			return &col.Fields[i]
 		}
 	}
 	return nil
 }
 
+func relationTarget(f *models.Field) string {
+	if options, ok := f.Options.(map[string]any); ok {
+		if target, ok := options["collection"].(string); ok {
+			return target
+		}
+	}
+	return ""
+}
+
+// normalizeHeaderName maps an identifier such as x_api_key to the key used
+// for the X-Api-Key header in EvaluationContext.Headers.
+func normalizeHeaderName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+}
+
+// HeadersFromRequest converts request headers into the form expected by
+// EvaluationContext.Headers.
+func HeadersFromRequest(h map[string][]string) map[string]any {
+	headers := make(map[string]any, len(h))
+	for k, v := range h {
+		if len(v) > 0 {
+			headers[normalizeHeaderName(k)] = v[0]
+		}
+	}
+	return headers
+}
+
+func isCollectionRef(key string) bool {
+	return strings.HasPrefix(key, "@collection.")
+}
+
+func refersToCollection(n *InfixExpression) bool {
+	if n.Operator == "&&" || n.Operator == "||" {
+		return false
+	}
+	for _, side := range []Node{n.Left, n.Right} {
+		if id, ok := side.(*Identifier); ok && isCollectionRef(id.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalCollectionComparison answers an @collection comparison by asking the
+// database whether any row of the referenced collection satisfies it.
+func evalCollectionComparison(n *InfixExpression, ctx EvaluationContext) (any, error) {
+	if ctx.Lookup == nil {
+		return nil, fmt.Errorf("@collection lookups are not available in this context")
+	}
+
+	t := &translator{ctx: ctx}
+	op, err := t.translate(n)
+	if err != nil {
+		return nil, err
+	}
+	if op.isConst {
+		return op.value, nil
+	}
+	return ctx.Lookup.Exists(ctx.context(), "SELECT 1 WHERE "+op.sql, op.args...)
+}
+
 func applyOp(op string, left, right any) (any, error) {
 	switch op {
 	case "=", "==":
-		return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right), nil
+		return valuesEqual(left, right), nil
 	case "!=":
-		return fmt.Sprintf("%v", left) != fmt.Sprintf("%v", right), nil
+		return !valuesEqual(left, right), nil
 	case "&&":
 		l, ok1 := left.(bool)
 		r, ok2 := right.(bool)
@@ -128,18 +320,61 @@ func applyOp(op string, left, right any) (any, error) {
 		}
 		return l || r, nil
 	case ">":
-		return compareNumbers(left, right, func(l, r float64) bool { return l > r })
+		return compareValues(left, right, func(c int) bool { return c > 0 })
 	case "<":
-		return compareNumbers(left, right, func(l, r float64) bool { return l < r })
+		return compareValues(left, right, func(c int) bool { return c < 0 })
 	case ">=":
-		return compareNumbers(left, right, func(l, r float64) bool { return l >= r })
+		return compareValues(left, right, func(c int) bool { return c >= 0 })
 	case "<=":
-		return compareNumbers(left, right, func(l, r float64) bool { return l <= r })
+		return compareValues(left, right, func(c int) bool { return c <= 0 })
+	case "~":
+		return likeMatch(formatValue(left), formatValue(right)), nil
+	case "!~":
+		return !likeMatch(formatValue(left), formatValue(right)), nil
+	case "in":
+		for _, v := range toList(right) {
+			if valuesEqual(left, v) {
+				return true, nil
+			}
+		}
+		return false, nil
 	}
 	return nil, fmt.Errorf("unknown operator: %s", op)
 }
 
-func compareNumbers(left, right any, cmp func(float64, float64) bool) (bool, error) {
+// formatValue renders a value for equality checks; a missing value (e.g. an
+// unauthenticated @request.auth.id) compares equal to the empty string.
+func formatValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// valuesEqual compares numerically when both sides are numbers (booleans
+// count as 1/0, matching how SQLite stores them) and as strings otherwise.
+func valuesEqual(left, right any) bool {
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		return ls == rs
+	}
+
+	l, lerr := toFloat(left)
+	r, rerr := toFloat(right)
+	if lerr == nil && rerr == nil {
+		return l == r
+	}
+	return formatValue(left) == formatValue(right)
+}
+
+func compareValues(left, right any, cmp func(int) bool) (bool, error) {
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		return cmp(strings.Compare(ls, rs)), nil
+	}
+
 	l, err := toFloat(left)
 	if err != nil {
 		return false, err
@@ -148,7 +383,13 @@ func compareNumbers(left, right any, cmp func(float64, float64) bool) (bool, err
 	if err != nil {
 		return false, err
 	}
-	return cmp(l, r), nil
+	switch {
+	case l < r:
+		return cmp(-1), nil
+	case l > r:
+		return cmp(1), nil
+	}
+	return cmp(0), nil
 }
 
 func toFloat(v any) (float64, error) {
@@ -161,7 +402,69 @@ func toFloat(v any) (float64, error) {
 		return val, nil
 	case float32:
 		return float64(val), nil
-	default:
-		return 0, fmt.Errorf("cannot convert %v to number", v)
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %v to number", v)
+}
+
+// toList interprets the right-hand side of `in` as a list: a literal list, a
+// decoded JSON array, a serialized JSON array, or a single value.
+func toList(v any) []any {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return val
+	case []string:
+		list := make([]any, len(val))
+		for i, s := range val {
+			list[i] = s
+		}
+		return list
+	case string:
+		var decoded []any
+		if strings.HasPrefix(strings.TrimSpace(val), "[") && json.Unmarshal([]byte(val), &decoded) == nil {
+			return decoded
+		}
+	}
+	return []any{v}
+}
+
+// likePattern returns the LIKE pattern for a ~ operand; patterns without
+// wildcards match anywhere in the value.
+func likePattern(pattern string) string {
+	if !strings.ContainsAny(pattern, "%_") {
+		return "%" + pattern + "%"
+	}
+	return pattern
+}
+
+// likeMatch mirrors SQLite's case-insensitive LIKE semantics.
+func likeMatch(value, pattern string) bool {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	for _, r := range likePattern(pattern) {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return false
 	}
+	return re.MatchString(value)
 }
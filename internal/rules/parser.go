@@ -3,6 +3,7 @@ package rules
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // TokenType represents the type of a token
@@ -24,6 +25,13 @@ const (
 	TOKEN_LT
 	TOKEN_GTE
 	TOKEN_LTE
+	TOKEN_NOT
+	TOKEN_IN
+	TOKEN_LIKE
+	TOKEN_NLIKE
+	TOKEN_NULL
+	TOKEN_COMMA
+	TOKEN_ILLEGAL
 )
 
 type Token struct {
@@ -64,14 +72,25 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: TOKEN_LPAREN, Value: string(l.ch)}
 	case ')':
 		tok = Token{Type: TOKEN_RPAREN, Value: string(l.ch)}
+	case ',':
+		tok = Token{Type: TOKEN_COMMA, Value: ","}
 	case '=':
+		if l.peekChar() == '=' {
+			l.readChar()
+		}
 		tok = Token{Type: TOKEN_EQ, Value: "="}
+	case '~':
+		tok = Token{Type: TOKEN_LIKE, Value: "~"}
 	case '!':
-		if l.peekChar() == '=' {
+		switch l.peekChar() {
+		case '=':
 			l.readChar()
 			tok = Token{Type: TOKEN_NEQ, Value: "!="}
-		} else {
-			tok = Token{Type: TOKEN_EOF, Value: "ILLEGAL"}
+		case '~':
+			l.readChar()
+			tok = Token{Type: TOKEN_NLIKE, Value: "!~"}
+		default:
+			tok = Token{Type: TOKEN_NOT, Value: "!"}
 		}
 	case '>':
 		if l.peekChar() == '=' {
@@ -91,20 +110,29 @@ func (l *Lexer) NextToken() Token {
 		if l.peekChar() == '&' {
 			l.readChar()
 			tok = Token{Type: TOKEN_AND, Value: "&&"}
+		} else {
+			tok = Token{Type: TOKEN_ILLEGAL, Value: "&"}
 		}
 	case '|':
 		if l.peekChar() == '|' {
 			l.readChar()
 			tok = Token{Type: TOKEN_OR, Value: "||"}
+		} else {
+			tok = Token{Type: TOKEN_ILLEGAL, Value: "|"}
 		}
 	case 0:
 		tok = Token{Type: TOKEN_EOF, Value: ""}
 	default:
 		if isLetter(l.ch) || l.ch == '@' {
 			tok.Value = l.readIdentifier()
-			if tok.Value == "true" || tok.Value == "false" {
+			switch tok.Value {
+			case "true", "false":
 				tok.Type = TOKEN_BOOL
-			} else {
+			case "null":
+				tok.Type = TOKEN_NULL
+			case "in":
+				tok.Type = TOKEN_IN
+			default:
 				tok.Type = TOKEN_IDENTIFIER
 			}
 			return tok
@@ -117,7 +145,7 @@ func (l *Lexer) NextToken() Token {
 			tok.Value = l.readString(l.ch)
 			return tok
 		} else {
-			tok = Token{Type: TOKEN_EOF, Value: "ILLEGAL"}
+			tok = Token{Type: TOKEN_ILLEGAL, Value: string(l.ch)}
 		}
 	}
 
@@ -144,6 +172,12 @@ func (l *Lexer) readNumber() string {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[position:l.position]
 }
 
@@ -207,6 +241,42 @@ func (il *IntegerLiteral) String() string {
 	return fmt.Sprintf("%d", il.Value)
 }
 
+type FloatLiteral struct {
+	Value float64
+}
+
+func (fl *FloatLiteral) String() string {
+	return strconv.FormatFloat(fl.Value, 'f', -1, 64)
+}
+
+type NullLiteral struct{}
+
+func (nl *NullLiteral) String() string {
+	return "null"
+}
+
+// ListLiteral is the parenthesized right-hand side of an `in` expression.
+type ListLiteral struct {
+	Elements []Node
+}
+
+func (ll *ListLiteral) String() string {
+	parts := make([]string, len(ll.Elements))
+	for i, e := range ll.Elements {
+		parts[i] = e.String()
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+type PrefixExpression struct {
+	Operator string
+	Right    Node
+}
+
+func (pe *PrefixExpression) String() string {
+	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right.String())
+}
+
 type BooleanLiteral struct {
 	Value bool
 }
@@ -244,26 +314,37 @@ func (p *Parser) nextToken() {
 }
 
 func (p *Parser) Parse() (Node, error) {
-	return p.parseExpression(LOWEST)
+	node, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	if p.peekToken.Type != TOKEN_EOF {
+		return nil, fmt.Errorf("unexpected token %q", p.peekToken.Value)
+	}
+	return node, nil
 }
 
 const (
 	LOWEST      int = iota
 	OR              // ||
 	AND             // &&
-	EQUALS          // ==, !=
+	EQUALS          // ==, !=, ~, !~, in
 	LESSGREATER     // >, <, >=, <=
+	PREFIX          // !
 )
 
 var precedences = map[TokenType]int{
-	TOKEN_EQ:  EQUALS,
-	TOKEN_NEQ: EQUALS,
-	TOKEN_LT:  LESSGREATER,
-	TOKEN_GT:  LESSGREATER,
-	TOKEN_LTE: LESSGREATER,
-	TOKEN_GTE: LESSGREATER,
-	TOKEN_AND: AND,
-	TOKEN_OR:  OR,
+	TOKEN_EQ:    EQUALS,
+	TOKEN_NEQ:   EQUALS,
+	TOKEN_LIKE:  EQUALS,
+	TOKEN_NLIKE: EQUALS,
+	TOKEN_IN:    EQUALS,
+	TOKEN_LT:    LESSGREATER,
+	TOKEN_GT:    LESSGREATER,
+	TOKEN_LTE:   LESSGREATER,
+	TOKEN_GTE:   LESSGREATER,
+	TOKEN_AND:   AND,
+	TOKEN_OR:    OR,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -304,6 +385,13 @@ func (p *Parser) parsePrefix() (Node, error) {
 	case TOKEN_STRING:
 		return &StringLiteral{Value: p.curToken.Value}, nil
 	case TOKEN_NUMBER:
+		if strings.Contains(p.curToken.Value, ".") {
+			val, err := strconv.ParseFloat(p.curToken.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse %q as float", p.curToken.Value)
+			}
+			return &FloatLiteral{Value: val}, nil
+		}
 		val, err := strconv.ParseInt(p.curToken.Value, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("could not parse %q as integer", p.curToken.Value)
@@ -311,6 +399,15 @@ func (p *Parser) parsePrefix() (Node, error) {
 		return &IntegerLiteral{Value: val}, nil
 	case TOKEN_BOOL:
 		return &BooleanLiteral{Value: p.curToken.Value == "true"}, nil
+	case TOKEN_NULL:
+		return &NullLiteral{}, nil
+	case TOKEN_NOT:
+		p.nextToken()
+		right, err := p.parseExpression(PREFIX)
+		if err != nil {
+			return nil, err
+		}
+		return &PrefixExpression{Operator: "!", Right: right}, nil
 	case TOKEN_LPAREN:
 		p.nextToken()
 		exp, err := p.parseExpression(LOWEST)
@@ -334,6 +431,16 @@ func (p *Parser) parseInfix(left Node) (Node, error) {
 	}
 
 	precedence := p.curPrecedence()
+	if p.curToken.Type == TOKEN_IN && p.peekToken.Type == TOKEN_LPAREN {
+		p.nextToken()
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		expression.Right = list
+		return expression, nil
+	}
+
 	p.nextToken()
 	right, err := p.parseExpression(precedence)
 	if err != nil {
@@ -342,3 +449,32 @@ func (p *Parser) parseInfix(left Node) (Node, error) {
 	expression.Right = right
 	return expression, nil
 }
+
+// parseList parses `(a, b, ...)` with the current token on the opening
+// parenthesis, leaving it on the closing one.
+func (p *Parser) parseList() (Node, error) {
+	list := &ListLiteral{}
+	if p.peekToken.Type == TOKEN_RPAREN {
+		p.nextToken()
+		return list, nil
+	}
+
+	for {
+		p.nextToken()
+		elem, err := p.parseExpression(EQUALS)
+		if err != nil {
+			return nil, err
+		}
+		list.Elements = append(list.Elements, elem)
+
+		switch p.peekToken.Type {
+		case TOKEN_COMMA:
+			p.nextToken()
+		case TOKEN_RPAREN:
+			p.nextToken()
+			return list, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or ')' in list, got %q", p.peekToken.Value)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// sqlOperand is the result of translating a node: either a constant known at
+// translation time (request context, literals) or a SQL fragment that depends
+// on the row being filtered.
+type sqlOperand struct {
+	sql     string
+	args    []any
+	isConst bool
+	value   any
+
+	// list holds the elements of a literal list that is not fully constant.
+	list []sqlOperand
+	// from is set for @collection references and names the aliased table
+	// the enclosing comparison must be checked against with EXISTS.
+	from string
+}
+
+// translator converts a rule AST into SQL. When col is nil, record fields are
+// resolved from ctx.Record as constants; this is used to answer @collection
+// comparisons during in-memory evaluation.
+type translator struct {
+	ctx     EvaluationContext
+	col     *models.Collection
+	aliases int
+}
+
+// ToSQL translates a rule into a SQL predicate that can be ANDed into a WHERE
+// clause on col's table so that only the rows the rule permits are returned.
+// Values from the request context are bound as parameters. An empty predicate
+// means the rule places no restriction on rows.
+func ToSQL(rule string, ctx EvaluationContext, col *models.Collection) (string, []any, error) {
+	if ctx.IsAdmin {
+		return "", nil, nil // Admin bypass
+	}
+
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return "", nil, nil // Empty rule means public access
+	}
+
+	l := NewLexer(rule)
+	p := NewParser(l)
+	node, err := p.Parse()
+	if err != nil {
+		return "", nil, fmt.Errorf("parse error: %w", err)
+	}
+
+	if ctx.Collection == "" {
+		ctx.Collection = col.Name
+	}
+	t := &translator{ctx: ctx, col: col}
+	op, err := t.translate(node)
+	if err != nil {
+		return "", nil, fmt.Errorf("translate error: %w", err)
+	}
+
+	if op.isConst {
+		b, ok := op.value.(bool)
+		if !ok {
+			return "", nil, fmt.Errorf("rule did not evaluate to a boolean")
+		}
+		if b {
+			return "", nil, nil
+		}
+		return "1 = 0", nil, nil
+	}
+
+	return op.sql, op.args, nil
+}
+
+func (t *translator) alias(prefix string) string {
+	t.aliases++
+	return fmt.Sprintf("%s%d", prefix, t.aliases)
+}
+
+func (t *translator) translate(node Node) (sqlOperand, error) {
+	switch n := node.(type) {
+	case *BooleanLiteral:
+		return sqlOperand{isConst: true, value: n.Value}, nil
+	case *IntegerLiteral:
+		return sqlOperand{isConst: true, value: n.Value}, nil
+	case *FloatLiteral:
+		return sqlOperand{isConst: true, value: n.Value}, nil
+	case *StringLiteral:
+		return sqlOperand{isConst: true, value: n.Value}, nil
+	case *NullLiteral:
+		return sqlOperand{isConst: true, value: nil}, nil
+	case *ListLiteral:
+		return t.translateList(n)
+	case *Identifier:
+		return t.translateIdentifier(n.Value)
+	case *PrefixExpression:
+		right, err := t.translate(n.Right)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		if right.isConst {
+			b, ok := right.value.(bool)
+			if !ok {
+				return sqlOperand{}, fmt.Errorf("type mismatch for !")
+			}
+			return sqlOperand{isConst: true, value: !b}, nil
+		}
+		return sqlOperand{sql: "NOT (" + right.sql + ")", args: right.args}, nil
+	case *InfixExpression:
+		left, err := t.translate(n.Left)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		right, err := t.translate(n.Right)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		if n.Operator == "&&" || n.Operator == "||" {
+			return translateLogical(n.Operator, left, right)
+		}
+		return translateComparison(n.Operator, left, right)
+	default:
+		return sqlOperand{}, fmt.Errorf("unknown node type: %T", node)
+	}
+}
+
+func (t *translator) translateList(n *ListLiteral) (sqlOperand, error) {
+	elems := make([]sqlOperand, 0, len(n.Elements))
+	values := make([]any, 0, len(n.Elements))
+	allConst := true
+	for _, e := range n.Elements {
+		op, err := t.translate(e)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		if op.from != "" {
+			return sqlOperand{}, fmt.Errorf("@collection cannot be used inside a list")
+		}
+		allConst = allConst && op.isConst
+		elems = append(elems, op)
+		values = append(values, op.value)
+	}
+	if allConst {
+		return sqlOperand{isConst: true, value: values}, nil
+	}
+	return sqlOperand{list: elems}, nil
+}
+
+func (t *translator) translateIdentifier(key string) (sqlOperand, error) {
+	if isCollectionRef(key) {
+		parts := strings.Split(strings.TrimPrefix(key, "@collection."), ".")
+		if len(parts) < 2 {
+			return sqlOperand{}, fmt.Errorf("%s must reference a field", key)
+		}
+		if t.ctx.Lookup == nil {
+			return sqlOperand{}, fmt.Errorf("@collection lookups are not available in this context")
+		}
+		col, ok := t.ctx.Lookup.Collection(parts[0])
+		if !ok {
+			return sqlOperand{}, fmt.Errorf("unknown collection: %s", parts[0])
+		}
+		alias := t.alias("_c")
+		expr, err := t.fieldSQL(alias, col, parts[1:])
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		return sqlOperand{sql: expr, from: fmt.Sprintf("%s AS %s", col.Name, alias)}, nil
+	}
+
+	if strings.HasPrefix(key, "@") || t.col == nil {
+		return sqlOperand{isConst: true, value: resolveValue(key, t.ctx)}, nil
+	}
+
+	path := strings.Split(strings.TrimPrefix(key, "record."), ".")
+	expr, err := t.fieldSQL(t.col.Name, t.col, path)
+	if err != nil {
+		return sqlOperand{}, err
+	}
+	return sqlOperand{sql: expr}, nil
+}
+
+// fieldSQL builds the SQL expression for a dotted field path on table,
+// joining into related collections and extracting from JSON as needed.
+func (t *translator) fieldSQL(table string, col *models.Collection, path []string) (string, error) {
+	name := path[0]
+	field := findField(col, name)
+	if field == nil && name != "id" && name != "created" && name != "updated" {
+		return "", fmt.Errorf("unknown field: %s", name)
+	}
+
+	expr := table + "." + name
+	if len(path) == 1 {
+		return expr, nil
+	}
+	if field == nil {
+		return "", fmt.Errorf("field %s does not support nested access", name)
+	}
+
+	switch field.Type {
+	case models.FieldTypeRelation:
+		target := relationTarget(field)
+		if t.ctx.Lookup == nil || target == "" {
+			return "", fmt.Errorf("cannot resolve relation field: %s", name)
+		}
+		targetCol, ok := t.ctx.Lookup.Collection(target)
+		if !ok {
+			return "", fmt.Errorf("unknown collection: %s", target)
+		}
+		alias := t.alias("_r")
+		inner, err := t.fieldSQL(alias, targetCol, path[1:])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(SELECT %s FROM %s AS %s WHERE %s.id = %s)", inner, targetCol.Name, alias, alias, expr), nil
+	case models.FieldTypeJSON:
+		// Path segments are identifiers (the lexer admits only [A-Za-z0-9_]).
+		return fmt.Sprintf("json_extract(%s, '$.%s')", expr, strings.Join(path[1:], ".")), nil
+	default:
+		return "", fmt.Errorf("field %s does not support nested access", name)
+	}
+}
+
+func translateLogical(op string, left, right sqlOperand) (sqlOperand, error) {
+	if left.isConst && right.isConst {
+		v, err := applyOp(op, left.value, right.value)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		return sqlOperand{isConst: true, value: v}, nil
+	}
+
+	// Fold a constant side away where it decides or does not affect the result.
+	for _, pair := range [][2]sqlOperand{{left, right}, {right, left}} {
+		c, other := pair[0], pair[1]
+		if !c.isConst {
+			continue
+		}
+		b, ok := c.value.(bool)
+		if !ok {
+			return sqlOperand{}, fmt.Errorf("type mismatch for %s", op)
+		}
+		if (op == "&&" && !b) || (op == "||" && b) {
+			return sqlOperand{isConst: true, value: b}, nil
+		}
+		return other, nil
+	}
+
+	sqlOp := "AND"
+	if op == "||" {
+		sqlOp = "OR"
+	}
+	return sqlOperand{
+		sql:  fmt.Sprintf("(%s %s %s)", left.sql, sqlOp, right.sql),
+		args: append(append([]any{}, left.args...), right.args...),
+	}, nil
+}
+
+func translateComparison(op string, left, right sqlOperand) (sqlOperand, error) {
+	if left.isConst && right.isConst {
+		v, err := applyOp(op, left.value, right.value)
+		if err != nil {
+			return sqlOperand{}, err
+		}
+		return sqlOperand{isConst: true, value: v}, nil
+	}
+
+	cmp, err := comparisonSQL(op, left, right)
+	if err != nil {
+		return sqlOperand{}, err
+	}
+	if cmp.isConst {
+		return cmp, nil
+	}
+
+	// @collection references turn the comparison into an existence check.
+	var from []string
+	for _, o := range []sqlOperand{left, right} {
+		if o.from != "" {
+			from = append(from, o.from)
+		}
+	}
+	if len(from) > 0 {
+		cmp.sql = fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", strings.Join(from, ", "), cmp.sql)
+	}
+	return cmp, nil
+}
+
+func comparisonSQL(op string, left, right sqlOperand) (sqlOperand, error) {
+	if op == "==" {
+		op = "="
+	}
+
+	switch op {
+	case "=", "!=":
+		// Comparisons against a missing value are emptiness checks, matching
+		// the evaluator, which treats null and '' as equal.
+		for _, pair := range [][2]sqlOperand{{left, right}, {right, left}} {
+			c, other := pair[0], pair[1]
+			if !c.isConst || c.value != nil {
+				continue
+			}
+			expr, args := operandSQL(other)
+			if op == "=" {
+				return sqlOperand{sql: fmt.Sprintf("(%s IS NULL OR %s = '')", expr, expr), args: append(args, args...)}, nil
+			}
+			return sqlOperand{sql: fmt.Sprintf("(%s IS NOT NULL AND %s != '')", expr, expr), args: append(args, args...)}, nil
+		}
+	case ">", "<", ">=", "<=":
+	case "~", "!~":
+		l, largs := operandSQL(left)
+		like := "LIKE"
+		if op == "!~" {
+			like = "NOT LIKE"
+		}
+		if right.isConst {
+			return sqlOperand{sql: fmt.Sprintf("%s %s ?", l, like), args: append(largs, likePattern(formatValue(right.value)))}, nil
+		}
+		r, rargs := operandSQL(right)
+		return sqlOperand{sql: fmt.Sprintf("%s %s ('%%' || %s || '%%')", l, like, r), args: append(largs, rargs...)}, nil
+	case "in":
+		return inSQL(left, right)
+	default:
+		return sqlOperand{}, fmt.Errorf("unknown operator: %s", op)
+	}
+
+	l, largs := operandSQL(left)
+	r, rargs := operandSQL(right)
+	return sqlOperand{
+		sql:  fmt.Sprintf("%s %s %s", l, op, r),
+		args: append(largs, rargs...),
+	}, nil
+}
+
+func inSQL(left, right sqlOperand) (sqlOperand, error) {
+	l, largs := operandSQL(left)
+
+	var elems []sqlOperand
+	switch {
+	case right.list != nil:
+		elems = right.list
+	case right.isConst:
+		for _, v := range toList(right.value) {
+			elems = append(elems, sqlOperand{isConst: true, value: v})
+		}
+		if len(elems) == 0 {
+			return sqlOperand{isConst: true, value: false}, nil
+		}
+	default:
+		// A column holding a JSON array (e.g. a multi-value field); plain
+		// values fall back to equality.
+		r, rargs := operandSQL(right)
+		args := append(append(append(append([]any{}, rargs...), rargs...), largs...), rargs...)
+		args = append(args, largs...)
+		return sqlOperand{
+			sql:  fmt.Sprintf("(CASE WHEN json_valid(%s) THEN EXISTS (SELECT 1 FROM json_each(%s) WHERE json_each.value = %s) ELSE %s = %s END)", r, r, l, r, l),
+			args: args,
+		}, nil
+	}
+
+	placeholders := make([]string, 0, len(elems))
+	args := append([]any{}, largs...)
+	for _, e := range elems {
+		expr, eargs := operandSQL(e)
+		placeholders = append(placeholders, expr)
+		args = append(args, eargs...)
+	}
+	return sqlOperand{sql: fmt.Sprintf("%s IN (%s)", l, strings.Join(placeholders, ", ")), args: args}, nil
+}
+
+func operandSQL(o sqlOperand) (string, []any) {
+	if o.isConst {
+		return "?", []any{o.value}
+	}
+	return o.sql, append([]any{}, o.args...)
+}
@@ -0,0 +1,172 @@
+package rules
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+type fakeLookup struct {
+	collections map[string]*models.Collection
+	records     map[string]*models.Record
+	exists      bool
+	queries     []string
+}
+
+func (f *fakeLookup) Collection(name string) (*models.Collection, bool) {
+	c, ok := f.collections[name]
+	return c, ok
+}
+
+func (f *fakeLookup) FindRecordByID(ctx context.Context, collectionName string, id string) (*models.Record, error) {
+	if r, ok := f.records[collectionName+"/"+id]; ok {
+		return r, nil
+	}
+	return nil, context.Canceled
+}
+
+func (f *fakeLookup) Exists(ctx context.Context, query string, args ...any) (bool, error) {
+	f.queries = append(f.queries, query)
+	return f.exists, nil
+}
+
+func testLookup() *fakeLookup {
+	return &fakeLookup{
+		collections: map[string]*models.Collection{
+			"posts": {Name: "posts", Fields: []models.Field{
+				{Name: "owner", Type: models.FieldTypeText},
+				{Name: "status", Type: models.FieldTypeText},
+				{Name: "views", Type: models.FieldTypeNumber},
+				{Name: "meta", Type: models.FieldTypeJSON},
+				{Name: "author", Type: models.FieldTypeRelation, Options: map[string]any{"collection": "users"}},
+			}},
+			"users": {Name: "users", Fields: []models.Field{
+				{Name: "name", Type: models.FieldTypeText},
+			}},
+			"members": {Name: "members", Fields: []models.Field{
+				{Name: "user", Type: models.FieldTypeText},
+				{Name: "post", Type: models.FieldTypeText},
+			}},
+		},
+		records: map[string]*models.Record{
+			"users/u1": {ID: "u1", Collection: "users", Data: map[string]any{"name": "Ann"}},
+		},
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	lookup := testLookup()
+	posts := lookup.collections["posts"]
+	authed := EvaluationContext{Auth: map[string]any{"id": "u1", "roles": []any{"editor"}}, Lookup: lookup}
+	anon := EvaluationContext{Auth: map[string]any{}, Lookup: lookup}
+
+	tests := []struct {
+		name   string
+		rule   string
+		ctx    EvaluationContext
+		clause string
+		args   []any
+	}{
+		{"owner match", "owner = @request.auth.id", authed, "posts.owner = ?", []any{"u1"}},
+		{"record prefix", "record.owner = @request.auth.id", authed, "posts.owner = ?", []any{"u1"}},
+		{"mixed", "status = 'public' || owner = @request.auth.id", authed, "(posts.status = ? OR posts.owner = ?)", []any{"public", "u1"}},
+		{"constant true folds away", "@request.auth.id != '' && views > 10", authed, "posts.views > ?", []any{int64(10)}},
+		{"constant false denies", "@request.auth.id != '' && views > 10", anon, "1 = 0", nil},
+		{"constant true short circuits", "@request.auth.id != '' || status = 'public'", authed, "", nil},
+		{"admin bypass", "owner = @request.auth.id", EvaluationContext{IsAdmin: true}, "", nil},
+		{"negation", "!(status = 'draft')", authed, "NOT (posts.status = ?)", []any{"draft"}},
+		{"null", "owner != null", authed, "(posts.owner IS NOT NULL AND posts.owner != '')", nil},
+		{"like", "status ~ 'pub'", authed, "posts.status LIKE ?", []any{"%pub%"}},
+		{"in list", "status in ('a', 'b')", authed, "posts.status IN (?, ?)", []any{"a", "b"}},
+		{"const in const", "'editor' in @request.auth.roles", authed, "", nil},
+		{"float", "views >= 1.5", authed, "posts.views >= ?", []any{1.5}},
+		{"json path", "meta.visibility = 'public'", authed, "json_extract(posts.meta, '$.visibility') = ?", []any{"public"}},
+		{"relation path", "author.name = 'Ann'", authed, "(SELECT _r1.name FROM users AS _r1 WHERE _r1.id = posts.author) = ?", []any{"Ann"}},
+		{"collection exists", "@collection.members.post = id && @collection.members.user = @request.auth.id", authed,
+			"(EXISTS (SELECT 1 FROM members AS _c1 WHERE _c1.post = posts.id) AND EXISTS (SELECT 1 FROM members AS _c2 WHERE _c2.user = ?))", []any{"u1"}},
+	}
+
+	for _, tt := range tests {
+		clause, args, err := ToSQL(tt.rule, tt.ctx, posts)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if clause != tt.clause {
+			t.Errorf("%s: expected clause %q, got %q", tt.name, tt.clause, clause)
+		}
+		if len(args) != len(tt.args) || (len(args) > 0 && !reflect.DeepEqual(args, tt.args)) {
+			t.Errorf("%s: expected args %v, got %v", tt.name, tt.args, args)
+		}
+	}
+}
+
+func TestToSQLUnknownField(t *testing.T) {
+	col := &models.Collection{Name: "posts"}
+	if _, _, err := ToSQL("secret = 'x'", EvaluationContext{}, col); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	lookup := testLookup()
+	ctx := EvaluationContext{
+		Auth:       map[string]any{"id": "u1", "collection": "users", "roles": `["editor","viewer"]`},
+		Record:     map[string]any{"id": "p1", "owner": "u1", "views": int64(12), "meta": `{"tags":{"main":"go"}}`, "author": "u1", "published": int64(1)},
+		Collection: "posts",
+		Method:     "PATCH",
+		Headers:    HeadersFromRequest(map[string][]string{"X-Api-Key": {"secret"}}),
+		Lookup:     lookup,
+	}
+
+	tests := []struct {
+		rule     string
+		expected bool
+	}{
+		{"owner = @request.auth.id", true},
+		{"!(owner = @request.auth.id)", false},
+		{"views > 10.5", true},
+		{"published = true", true},
+		{"'viewer' in @request.auth.roles", true},
+		{"owner in ('u2', 'u3')", false},
+		{"meta.tags.main = 'go'", true},
+		{"author.name ~ 'an'", true},
+		{"author.name !~ 'bob'", true},
+		{"@request.method = 'PATCH'", true},
+		{"@request.headers.x_api_key = 'secret'", true},
+		{"@request.auth.missing = null", true},
+	}
+
+	for _, tt := range tests {
+		got, err := Evaluate(tt.rule, ctx)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.rule, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %t, got %t", tt.rule, tt.expected, got)
+		}
+	}
+}
+
+func TestEvaluateCollectionLookup(t *testing.T) {
+	lookup := testLookup()
+	lookup.exists = true
+	ctx := EvaluationContext{
+		Auth:       map[string]any{"id": "u1"},
+		Record:     map[string]any{"id": "p1"},
+		Collection: "posts",
+		Lookup:     lookup,
+	}
+
+	ok, err := Evaluate("@collection.members.user = @request.auth.id", ctx)
+	if err != nil || !ok {
+		t.Fatalf("expected lookup to pass, got %t, %v", ok, err)
+	}
+	if len(lookup.queries) != 1 || !strings.Contains(lookup.queries[0], "FROM members AS _c1") {
+		t.Errorf("unexpected lookup queries: %v", lookup.queries)
+	}
+}
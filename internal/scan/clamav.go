@@ -0,0 +1,116 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClamAV scans files with a clamd daemon, streaming them with the INSTREAM
+// command.
+type ClamAV struct {
+	network string
+	address string
+
+	// Timeout bounds a whole scan, including connecting.
+	Timeout time.Duration
+}
+
+// clamavChunkSize is the size of the chunks a file is streamed in.
+const clamavChunkSize = 64 << 10
+
+// NewClamAV returns a client of the clamd daemon listening at address,
+// tcp://host:port, host:port or unix:///path/to/clamd.sock.
+func NewClamAV(address string) (*ClamAV, error) {
+	network, addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return &ClamAV{network: network, address: addr, Timeout: 2 * time.Minute}, nil
+}
+
+func (c *ClamAV) Scan(ctx context.Context, name string, file *io.SectionReader) (*Finding, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// clamd closes the connection once a stream exceeds its StreamMaxLength,
+	// after which only its reply is left to read.
+	writeErr := c.stream(conn, file)
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		if writeErr != nil {
+			err = writeErr
+		}
+		return nil, fmt.Errorf("read clamd reply: %w", err)
+	}
+	return parseClamAVReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// stream sends the file with the INSTREAM command: chunks prefixed with their
+// length, ended by an empty chunk.
+func (c *ClamAV) stream(conn net.Conn, file io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buffer := make([]byte, 4+clamavChunkSize)
+	for {
+		n, err := io.ReadFull(file, buffer[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buffer, uint32(n))
+			if _, err := conn.Write(buffer[:4+n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamAVReply reads "stream: OK", "stream: {signature} FOUND" or
+// "{message} ERROR".
+func parseClamAVReply(reply string) (*Finding, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return nil, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &Finding{Scanner: "clamav", Threat: strings.TrimSuffix(result, " FOUND")}, nil
+	case strings.HasSuffix(result, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+	}
+	return nil, fmt.Errorf("unexpected clamd reply %q", reply)
+}
+
+// parseAddress splits a tcp://host:port, unix:///path or host:port address
+// into the network and address to dial.
+func parseAddress(address string) (string, string, error) {
+	if path, ok := strings.CutPrefix(address, "unix://"); ok && path != "" {
+		return "unix", path, nil
+	}
+	host := strings.TrimPrefix(address, "tcp://")
+	if _, port, err := net.SplitHostPort(host); err != nil || strings.Contains(host, "/") || port == "" {
+		return "", "", fmt.Errorf("invalid clamd address %q, expected host:port or unix:///path", address)
+	}
+	return "tcp", host, nil
+}
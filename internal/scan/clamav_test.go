@@ -0,0 +1,137 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// eicar is the EICAR anti-virus test file.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func TestClamAV(t *testing.T) {
+	address := newFakeClamd(t)
+	clamav, err := NewClamAV("tcp://" + address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func(content string) (*Finding, error) {
+		return clamav.Scan(context.Background(), "file.txt", io.NewSectionReader(strings.NewReader(content), 0, int64(len(content))))
+	}
+
+	if finding, err := scan("hello"); err != nil || finding != nil {
+		t.Errorf("expected a clean file, got %v, %v", finding, err)
+	}
+	// Larger than a chunk, and than the fake's buffer.
+	if finding, err := scan(strings.Repeat("a", 3*clamavChunkSize+1)); err != nil || finding != nil {
+		t.Errorf("expected a clean large file, got %v, %v", finding, err)
+	}
+	finding, err := scan("prefix " + eicar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finding == nil || finding.Scanner != "clamav" || finding.Threat != "Eicar-Test-Signature" {
+		t.Errorf("expected the EICAR signature, got %v", finding)
+	}
+	if _, err := scan("error"); err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("expected the clamd error, got %v", err)
+	}
+
+	clamav, _ = NewClamAV(newClosedAddress(t))
+	if _, err := scan("hello"); err == nil {
+		t.Error("expected an unreachable daemon to fail the scan")
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address, network, addr string
+	}{
+		{"localhost:3310", "tcp", "localhost:3310"},
+		{"tcp://127.0.0.1:3310", "tcp", "127.0.0.1:3310"},
+		{"unix:///run/clamd.sock", "unix", "/run/clamd.sock"},
+	}
+	for _, tt := range tests {
+		network, addr, err := parseAddress(tt.address)
+		if err != nil || network != tt.network || addr != tt.addr {
+			t.Errorf("parseAddress(%q) = %q, %q, %v", tt.address, network, addr, err)
+		}
+	}
+	for _, address := range []string{"localhost", "unix://", "http://localhost"} {
+		if _, _, err := parseAddress(address); err == nil {
+			t.Errorf("expected %q to be invalid", address)
+		}
+	}
+}
+
+// newFakeClamd serves the INSTREAM command like clamd, finding the EICAR
+// test file and failing streams containing "error".
+func newFakeClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveClamd(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		_, _ = io.WriteString(conn, "UNKNOWN COMMAND\x00")
+		return
+	}
+
+	var content bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&content, reader, int64(size)); err != nil {
+			return
+		}
+	}
+
+	reply := "stream: OK"
+	switch {
+	case bytes.Contains(content.Bytes(), []byte(eicar)):
+		reply = "stream: Eicar-Test-Signature FOUND"
+	case bytes.Contains(content.Bytes(), []byte("error")):
+		reply = "INSTREAM size limit exceeded. ERROR"
+	}
+	_, _ = io.WriteString(conn, reply+"\x00")
+}
+
+// newClosedAddress returns an address nothing listens on.
+func newClosedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+	return address
+}
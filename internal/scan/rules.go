@@ -0,0 +1,270 @@
+package scan
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultExtensions are the file extensions Rules reject unless configured
+// otherwise: executables, scripts, and documents browsers run scripts in.
+var DefaultExtensions = []string{
+	".exe", ".dll", ".com", ".scr", ".msi", ".cpl", ".lnk",
+	".bat", ".cmd", ".ps1", ".vbs", ".vbe", ".wsf", ".hta",
+	".js", ".mjs", ".jse", ".jar", ".sh", ".php", ".phtml",
+	".html", ".htm", ".xhtml", ".svg", ".svgz", ".xml",
+}
+
+// signatures are the magic bytes of executables and scripts.
+var signatures = []struct {
+	magic  string
+	threat string
+}{
+	{"MZ", "Windows executable"},
+	{"\x7fELF", "ELF executable"},
+	{"\xfe\xed\xfa\xce", "Mach-O executable"},
+	{"\xfe\xed\xfa\xcf", "Mach-O executable"},
+	{"\xce\xfa\xed\xfe", "Mach-O executable"},
+	{"\xcf\xfa\xed\xfe", "Mach-O executable"},
+	{"\xca\xfe\xba\xbe", "Mach-O universal binary or Java class"},
+	{"#!", "script"},
+}
+
+const (
+	// sniffLen is the length of the head of a file checked for signatures.
+	sniffLen = 512
+
+	// Archives nested deeper than maxArchiveDepth, or larger than
+	// maxNestedSize, are only checked like other files.
+	maxArchiveDepth = 3
+	maxNestedSize   = 16 << 20
+
+	// Archives with more entries, or compressed archives expanding to more,
+	// are rejected rather than scanned.
+	maxArchiveEntries = 10000
+	maxExpandedSize   = 1 << 30
+)
+
+var errExpanded = errors.New("archive expands beyond the scanned size")
+
+// Rules rejects files by extension and by the magic bytes of executables and
+// scripts, and HTML, SVG and XML documents. The entries of zip, tar and gzip archives are
+// checked by extension and magic bytes too.
+type Rules struct {
+	extensions []string
+}
+
+// NewRules returns rules rejecting the extensions, or DefaultExtensions when
+// nil.
+func NewRules(extensions []string) *Rules {
+	if extensions == nil {
+		extensions = DefaultExtensions
+	}
+	rules := &Rules{extensions: make([]string, len(extensions))}
+	for i, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		rules.extensions[i] = ext
+	}
+	return rules
+}
+
+func (r *Rules) Scan(ctx context.Context, name string, file *io.SectionReader) (*Finding, error) {
+	head := make([]byte, sniffLen)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	threat, err := r.check(name, head), nil
+	if threat == "" {
+		threat = markup(head)
+	}
+	if threat == "" {
+		threat, err = r.archive(file, head, 0)
+	}
+	if err != nil || threat == "" {
+		return nil, err
+	}
+	return &Finding{Scanner: "rules", Threat: threat}, nil
+}
+
+// check matches the name and the head of a file against the extensions and
+// signatures.
+func (r *Rules) check(name string, head []byte) string {
+	if ext := strings.ToLower(path.Ext(strings.ReplaceAll(name, "\\", "/"))); ext != "" && slices.Contains(r.extensions, ext) {
+		return "blocked file extension " + ext
+	}
+	for _, signature := range signatures {
+		if bytes.HasPrefix(head, []byte(signature.magic)) {
+			return signature.threat
+		}
+	}
+	return ""
+}
+
+// markup names the documents browsers run scripts in, HTML, SVG and other
+// XML, by their head, or returns "".
+func markup(head []byte) string {
+	if strings.HasPrefix(http.DetectContentType(head), "text/html") {
+		return "HTML document"
+	}
+	head = bytes.ToLower(bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n"))
+	switch {
+	case bytes.HasPrefix(head, []byte("<svg")), bytes.HasPrefix(head, []byte("<!doctype svg")):
+		return "SVG document"
+	case bytes.HasPrefix(head, []byte("<?xml")):
+		return "XML document"
+	}
+	return ""
+}
+
+// archive checks the entries of the file when it is an archive, with head
+// holding its first bytes.
+func (r *Rules) archive(file *io.SectionReader, head []byte, depth int) (string, error) {
+	if depth >= maxArchiveDepth {
+		return "", nil
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return r.zip(file, depth)
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			// Not an archive that can be read; it was checked as a file.
+			return "", nil
+		}
+		expanded := bufio.NewReaderSize(&limitedReader{r: gz, n: maxExpandedSize}, sniffLen)
+		if inner, _ := expanded.Peek(sniffLen); isTar(inner) {
+			return r.tar(expanded, depth)
+		}
+		name := strings.TrimSuffix(gz.Name, ".gz")
+		if name == "" {
+			name = "gzip content"
+		}
+		return r.entry(name, expanded, depth)
+	case isTar(head):
+		return r.tar(file, depth)
+	}
+	return "", nil
+}
+
+func (r *Rules) zip(file *io.SectionReader, depth int) (string, error) {
+	archive, err := zip.NewReader(file, file.Size())
+	if err != nil {
+		return "", nil
+	}
+	if len(archive.File) > maxArchiveEntries {
+		return "archive has too many entries", nil
+	}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		if threat, err := r.zipEntry(entry, depth); err != nil || threat != "" {
+			return threat, err
+		}
+	}
+	return "", nil
+}
+
+func (r *Rules) zipEntry(entry *zip.File, depth int) (string, error) {
+	content, err := entry.Open()
+	if err != nil {
+		// Entries that cannot be read, such as encrypted ones, are checked
+		// by name alone.
+		return r.entry(entry.Name, bytes.NewReader(nil), depth)
+	}
+	defer func() { _ = content.Close() }()
+	return r.entry(entry.Name, content, depth)
+}
+
+func (r *Rules) tar(file io.Reader, depth int) (string, error) {
+	archive := tar.NewReader(file)
+	for entries := 0; ; entries++ {
+		header, err := archive.Next()
+		if errors.Is(err, errExpanded) {
+			return errExpanded.Error(), nil
+		}
+		if err != nil {
+			// The end of the archive, or the rest cannot be read.
+			return "", nil
+		}
+		if entries >= maxArchiveEntries {
+			return "archive has too many entries", nil
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if threat, err := r.entry(header.Name, archive, depth); err != nil || threat != "" {
+			return threat, err
+		}
+	}
+}
+
+// entry checks a file inside an archive, and its own entries when it is a
+// small enough archive.
+func (r *Rules) entry(name string, content io.Reader, depth int) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, head)
+	if errors.Is(err, errExpanded) {
+		return errExpanded.Error(), nil
+	}
+	head = head[:n]
+
+	threat := r.check(name, head)
+	if threat == "" && isArchive(head) {
+		rest, err := io.ReadAll(io.LimitReader(content, maxNestedSize))
+		if errors.Is(err, errExpanded) {
+			return errExpanded.Error(), nil
+		}
+		if err == nil && len(rest) < maxNestedSize {
+			data := append(head, rest...)
+			if threat, err = r.archive(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), head, depth+1); err != nil {
+				return "", err
+			}
+		}
+	}
+	if threat == "" {
+		return "", nil
+	}
+	return "archive entry " + name + ": " + threat, nil
+}
+
+func isArchive(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("PK\x03\x04")) || bytes.HasPrefix(head, []byte("\x1f\x8b")) || isTar(head)
+}
+
+func isTar(head []byte) bool {
+	return len(head) >= 262 && string(head[257:262]) == "ustar"
+}
+
+// limitedReader fails with errExpanded once more than n bytes were read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errExpanded
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
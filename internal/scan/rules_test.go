@@ -0,0 +1,137 @@
+package scan
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	rules := NewRules(nil)
+	scan := func(name string, content []byte) string {
+		t.Helper()
+		finding, err := rules.Scan(context.Background(), name, io.NewSectionReader(bytes.NewReader(content), 0, int64(len(content))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if finding == nil {
+			return ""
+		}
+		return finding.Threat
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		threat  string
+	}{
+		{"clean text", "notes.txt", []byte("hello"), ""},
+		{"empty", "empty.bin", nil, ""},
+		{"blocked extension", "setup.EXE", []byte("hello"), "blocked file extension .exe"},
+		{"windows executable", "photo.png", []byte("MZ\x90\x00"), "Windows executable"},
+		{"elf executable", "data", []byte("\x7fELF\x02\x01"), "ELF executable"},
+		{"script", "run", []byte("#!/bin/sh\nrm -rf /"), "script"},
+		{"html", "page.txt", []byte("<!DOCTYPE html><script>alert(1)</script>"), "HTML document"},
+		{"svg extension", "logo.SVG", []byte("hello"), "blocked file extension .svg"},
+		{"svg", "logo.png", []byte("\xef\xbb\xbf\n<svg xmlns=\"http://www.w3.org/2000/svg\"><script>alert(1)</script></svg>"), "SVG document"},
+		{"xml", "feed.txt", []byte("<?xml version=\"1.0\"?><svg/>"), "XML document"},
+		{"clean zip", "a.zip", zipFile(t, map[string][]byte{"a.txt": []byte("a"), "b.png": []byte("\x89PNG")}), ""},
+		{"zip entry extension", "a.zip", zipFile(t, map[string][]byte{"docs/run.bat": []byte("echo")}), "archive entry docs/run.bat: blocked file extension .bat"},
+		{"zip entry signature", "a.zip", zipFile(t, map[string][]byte{"tool": []byte("MZ")}), "archive entry tool: Windows executable"},
+		{"nested zip", "a.zip", zipFile(t, map[string][]byte{"inner.zip": zipFile(t, map[string][]byte{"x.so": []byte("\x7fELF")})}),
+			"archive entry inner.zip: archive entry x.so: ELF executable"},
+		{"tar", "a.tar", tarFile(t, map[string][]byte{"bin/app": []byte("\x7fELF")}), "archive entry bin/app: ELF executable"},
+		{"tar.gz", "a.tgz", gzipFile(t, tarFile(t, map[string][]byte{"x.php": []byte("<?php")})), "archive entry x.php: blocked file extension .php"},
+		{"clean tar.gz", "a.tgz", gzipFile(t, tarFile(t, map[string][]byte{"x.txt": []byte("x")})), ""},
+		{"gzip", "a.gz", gzipFile(t, []byte("MZ")), "archive entry gzip content: Windows executable"},
+	}
+	for _, tt := range tests {
+		if threat := scan(tt.file, tt.content); threat != tt.threat {
+			t.Errorf("%s: expected threat %q, got %q", tt.name, tt.threat, threat)
+		}
+	}
+
+	rules = NewRules([]string{"TXT", ".md"})
+	if threat := scan("notes.txt", []byte("hello")); threat != "blocked file extension .txt" {
+		t.Errorf("expected the configured extensions, got %q", threat)
+	}
+	if threat := scan("setup.exe", []byte("hello")); threat != "" {
+		t.Errorf("expected the configured extensions to replace the defaults, got %q", threat)
+	}
+}
+
+func TestRulesExpandedSize(t *testing.T) {
+	// A tar.gz whose first entry expands beyond the scanned size, hiding the
+	// next.
+	var compressed bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&compressed, gzip.BestSpeed)
+	archive := tar.NewWriter(gz)
+	if err := archive.WriteHeader(&tar.Header{Name: "zeros", Mode: 0o644, Size: maxExpandedSize, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	zeros := make([]byte, 1<<20)
+	for range maxExpandedSize / len(zeros) {
+		_, _ = archive.Write(zeros)
+	}
+	_ = archive.WriteHeader(&tar.Header{Name: "x.exe", Mode: 0o644, Typeflag: tar.TypeReg})
+	_ = archive.Close()
+	_ = gz.Close()
+	content := compressed.Bytes()
+
+	finding, err := NewRules(nil).Scan(context.Background(), "bomb.tgz", io.NewSectionReader(bytes.NewReader(content), 0, int64(len(content))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finding == nil || finding.Threat != errExpanded.Error() {
+		t.Errorf("expected the expanded size to be rejected, got %v", finding)
+	}
+}
+
+func zipFile(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarFile(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = writer.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipFile(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, _ = writer.Write(content)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,50 @@
+// Package scan inspects uploaded files for malware and for content that must
+// not be served, before they are stored.
+package scan
+
+import (
+	"context"
+	"io"
+
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+// Finding is a threat a scanner found in a file.
+type Finding struct {
+	Scanner string `json:"scanner"`
+	Threat  string `json:"threat"`
+}
+
+// Scanner inspects a file. Scan returns the threat found in the file, or nil
+// when it is clean, and an error when it could not tell.
+type Scanner interface {
+	Scan(ctx context.Context, name string, file *io.SectionReader) (*Finding, error)
+}
+
+// New returns the scanners enabled by the configuration: the rules, with
+// scan_blocked_extensions replacing their extensions when set, followed by
+// clamd at scan_clamav_address.
+func New(cfg *core.Config) (Scanner, error) {
+	scanners := Chain{NewRules(cfg.ScanBlockedExtensions)}
+	if cfg.ScanClamAVAddress != "" {
+		clamav, err := NewClamAV(cfg.ScanClamAVAddress)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, clamav)
+	}
+	return scanners, nil
+}
+
+// Chain runs scanners in order until one finds a threat.
+type Chain []Scanner
+
+func (c Chain) Scan(ctx context.Context, name string, file *io.SectionReader) (*Finding, error) {
+	for _, scanner := range c {
+		finding, err := scanner.Scan(ctx, name, io.NewSectionReader(file, 0, file.Size()))
+		if err != nil || finding != nil {
+			return finding, err
+		}
+	}
+	return nil, nil
+}
@@ -14,9 +14,12 @@ import (
 
 	"github.com/zulfikawr/vault/internal/api"
 	"github.com/zulfikawr/vault/internal/api/middleware"
+	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
 	"github.com/zulfikawr/vault/internal/realtime"
+	"github.com/zulfikawr/vault/internal/scan"
 	"github.com/zulfikawr/vault/internal/service"
 	"github.com/zulfikawr/vault/internal/storage"
 )
@@ -31,6 +34,7 @@ type App struct {
 	CollectionService *service.CollectionService
 	Storage           storage.Storage
 	Hub               *realtime.Hub
+	UploadService     *service.UploadService
 }
 
 func NewApp(cfg *core.Config) *App {
@@ -54,13 +58,6 @@ func NewApp(cfg *core.Config) *App {
 		os.Exit(1)
 	}
 
-	// Initialize Storage
-	store, err := storage.NewLocal(cfg.DataDir + "/storage")
-	if err != nil {
-		slog.Error("Failed to initialize storage", "error", err)
-		os.Exit(1)
-	}
-
 	// Initialize Realtime Hub
 	hub := realtime.NewHub()
 	// Hub is started in Run()
@@ -70,11 +67,51 @@ func NewApp(cfg *core.Config) *App {
 	repo := db.NewRepository(database, registry)
 
 	recordService := service.NewRecordService(repo, hub)
+
+	// Initialize Storage
+	store, err := service.NewStorage(cfg, recordService)
+	if err != nil {
+		slog.Error("Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+
 	collectionService := service.NewCollectionService(registry, migration)
+	roleService := service.NewRoleService(recordService)
 	sqlService := service.NewSqlService(database)
 
-	// Register Auth Hooks
-	service.RegisterAuthHooks()
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		slog.Error("Invalid trusted_proxies", "error", err)
+		os.Exit(1)
+	}
+
+	keys, err := auth.LoadKeySet(cfg.KeySetPath(), cfg.JWTAlgorithm, cfg.JWTSecret, time.Duration(cfg.JWTExpiry)*time.Hour)
+	if err != nil {
+		slog.Error("Failed to load signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	mailer, err := service.NewMailer(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize mailer", "error", err)
+		os.Exit(1)
+	}
+	sessionService := service.NewSessionService(recordService)
+	sessionService.SetCookieTimeouts(time.Duration(cfg.DashboardSessionIdleMinutes)*time.Minute, time.Duration(cfg.DashboardSessionMaxHours)*time.Hour)
+	oauthService := service.NewOAuthService(recordService, cfg, nil)
+	lockoutService := service.NewLockoutService(recordService, cfg)
+	mfaService := service.NewMFAService(recordService, lockoutService, service.MFAIssuer, service.MFAKey(cfg.JWTSecret))
+	apiKeyService := service.NewAPIKeyService(recordService)
+	quotaService := service.NewQuotaService(recordService, cfg)
+	scanner, err := scan.New(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize upload scanning", "error", err)
+		os.Exit(1)
+	}
+	fileService := service.NewFileService(recordService, store, cfg, quotaService, scanner)
+	uploadService := service.NewUploadService(recordService, fileService, store, cfg)
+	quarantineService := service.NewQuarantineService(recordService, fileService, store)
+	accountService := service.NewAccountService(recordService, sessionService, mailer, service.NewMailTemplates(cfg.DataDir+"/templates"), cfg.AppURL)
 
 	// Bootstrap system
 	if err := collectionService.InitSystem(ctx); err != nil {
@@ -88,12 +125,17 @@ func NewApp(cfg *core.Config) *App {
 		os.Exit(1)
 	}
 
-	router := api.NewRouter(recordService, collectionService, sqlService, registry, store, hub, cfg)
+	// Register Auth Hooks on every auth collection
+	service.RegisterAuthHooks(registry.GetCollections())
+
+	router := api.NewRouter(recordService, collectionService, roleService, accountService, sessionService, oauthService, mfaService, lockoutService, apiKeyService, fileService, uploadService, quotaService, quarantineService, keys, sqlService, registry, store, hub, cfg)
 	handler := middleware.Chain(router,
 		middleware.RecoveryMiddleware,
+		middleware.ClientIPMiddleware(trustedProxies),
 		middleware.LoggerMiddleware,
 		middleware.SecurityMiddleware,
-		middleware.AuthMiddleware(cfg.JWTSecret),
+		middleware.AuthMiddleware(keys, apiKeyService, sessionService),
+		middleware.CSRFMiddleware,
 		middleware.RequestIDMiddleware,
 		middleware.CORSMiddleware,
 	)
@@ -110,6 +152,7 @@ func NewApp(cfg *core.Config) *App {
 		CollectionService: collectionService,
 		Storage:           store,
 		Hub:               hub,
+		UploadService:     uploadService,
 	}
 }
 
@@ -121,11 +164,14 @@ func (a *App) Run() {
 	// Start Realtime Hub
 	go a.Hub.Run(ctx)
 
-	// Check if any users exist
+	// Delete abandoned resumable uploads
+	go a.UploadService.Run(ctx)
+
+	// Check if any admins exist
 	var count int
-	err := a.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	err := a.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+models.AdminsCollection).Scan(&count)
 	if err == nil && count == 0 {
-		fmt.Println("⚠️  No users found! Create an admin user with:")
+		fmt.Println("⚠️  No admins found! Create an admin user with:")
 		fmt.Println("./vault admin create --email <email> --password <password> --username <username>")
 		os.Exit(1)
 	}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+const (
+	TokenTypePasswordReset = "password_reset"
+	TokenTypeVerification  = "verification"
+
+	PasswordResetTokenTTL = time.Hour
+	VerificationTokenTTL  = 72 * time.Hour
+
+	MinPasswordLength = 8
+)
+
+// AccountService issues and redeems the single-use tokens behind password
+// resets and email verification, and mails them to the record owner.
+type AccountService struct {
+	records   *RecordService
+	sessions  *SessionService
+	mailer    Mailer
+	templates *MailTemplates
+	appURL    string
+}
+
+func NewAccountService(records *RecordService, sessions *SessionService, mailer Mailer, templates *MailTemplates, appURL string) *AccountService {
+	return &AccountService{
+		records:   records,
+		sessions:  sessions,
+		mailer:    mailer,
+		templates: templates,
+		appURL:    appURL,
+	}
+}
+
+// RequestPasswordReset mails a reset link to the record with the email. It
+// succeeds silently when no such record exists so that callers cannot probe
+// for accounts.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, collection, email string) error {
+	record, err := s.findByEmail(ctx, collection, email)
+	if err != nil || record == nil {
+		return err
+	}
+	return s.send(ctx, record, TokenTypePasswordReset, MailTemplatePasswordReset, PasswordResetTokenTTL)
+}
+
+// ConfirmPasswordReset redeems a reset token, sets the new password and
+// ends every session of the record.
+func (s *AccountService) ConfirmPasswordReset(ctx context.Context, collection, token, password string) error {
+	if len(password) < MinPasswordLength {
+		return errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(map[string]any{
+			"password": "must be at least 8 characters",
+		})
+	}
+
+	tokenRecord, err := s.redeem(ctx, collection, token, TokenTypePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	recordID := tokenRecord.GetString("record_id")
+	if _, err := s.records.UpdateRecord(ctx, collection, recordID, map[string]any{"password": password}); err != nil {
+		return err
+	}
+
+	_, err = s.sessions.RevokeAll(ctx, collection, recordID)
+	return err
+}
+
+// RequestVerification mails a verification link to the record with the
+// email unless it is already verified. Unknown emails succeed silently.
+func (s *AccountService) RequestVerification(ctx context.Context, collection, email string) error {
+	record, err := s.findByEmail(ctx, collection, email)
+	if err != nil || record == nil {
+		return err
+	}
+	if isTruthy(record.Data["verified"]) {
+		return nil
+	}
+	return s.send(ctx, record, TokenTypeVerification, MailTemplateVerification, VerificationTokenTTL)
+}
+
+// ConfirmVerification redeems a verification token and marks the record
+// verified. The token is rejected if the email changed since it was issued.
+func (s *AccountService) ConfirmVerification(ctx context.Context, collection, token string) (*models.Record, error) {
+	tokenRecord, err := s.redeem(ctx, collection, token, TokenTypeVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.records.FindRecordByID(ctx, collection, tokenRecord.GetString("record_id"))
+	if err != nil {
+		return nil, invalidTokenError()
+	}
+	if record.GetString("email") != tokenRecord.GetString("email") {
+		return nil, invalidTokenError()
+	}
+
+	return s.records.UpdateRecord(ctx, collection, record.ID, map[string]any{"verified": true})
+}
+
+func (s *AccountService) send(ctx context.Context, record *models.Record, tokenType, templateName string, ttl time.Duration) error {
+	token, err := s.issue(ctx, record, tokenType, ttl)
+	if err != nil {
+		return err
+	}
+
+	email := record.GetString("email")
+	subject, body, err := s.templates.Render(templateName, MailTemplateData{
+		AppURL:     s.appURL,
+		Collection: record.Collection,
+		Email:      email,
+		Token:      token,
+		Expires:    ttl.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(ctx, email, subject, body); err != nil {
+		slog.Error("Failed to send mail", "template", templateName, "collection", record.Collection, "error", err)
+		return errors.NewError(http.StatusInternalServerError, "MAIL_FAILED", "Failed to send email")
+	}
+	return nil
+}
+
+// issue stores the hash of a new token, replacing any earlier token of the
+// same type for the record, and returns the plain token.
+func (s *AccountService) issue(ctx context.Context, record *models.Record, tokenType string, ttl time.Duration) (string, error) {
+	if err := s.deleteTokens(ctx, record.Collection, record.ID, tokenType); err != nil {
+		return "", err
+	}
+
+	token, err := auth.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.records.CreateRecord(ctx, models.AuthTokensCollection, map[string]any{
+		"token_hash": auth.HashToken(token),
+		"type":       tokenType,
+		"collection": record.Collection,
+		"record_id":  record.ID,
+		"email":      record.GetString("email"),
+		"expires":    time.Now().Add(ttl).UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeem looks up and deletes a token, so that each token works once.
+func (s *AccountService) redeem(ctx context.Context, collection, token, tokenType string) (*models.Record, error) {
+	if token == "" {
+		return nil, invalidTokenError()
+	}
+
+	records, _, err := s.records.ListRecords(ctx, models.AuthTokensCollection, db.QueryParams{Filter: "token_hash = " + db.QuoteFilterValue(auth.HashToken(token)), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, invalidTokenError()
+	}
+
+	tokenRecord := records[0]
+	if tokenRecord.GetString("type") != tokenType || tokenRecord.GetString("collection") != collection {
+		return nil, invalidTokenError()
+	}
+
+	if err := s.records.DeleteRecord(ctx, models.AuthTokensCollection, tokenRecord.ID); err != nil {
+		return nil, err
+	}
+
+	expires, err := time.Parse(time.RFC3339, tokenRecord.GetString("expires"))
+	if err != nil || time.Now().After(expires) {
+		return nil, invalidTokenError()
+	}
+
+	return tokenRecord, nil
+}
+
+func (s *AccountService) deleteTokens(ctx context.Context, collection, recordID, tokenType string) error {
+	records, _, err := s.records.ListRecords(ctx, models.AuthTokensCollection, db.QueryParams{Filter: "record_id = " + db.QuoteFilterValue(recordID), PerPage: 500})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.GetString("collection") != collection || record.GetString("type") != tokenType {
+			continue
+		}
+		if err := s.records.DeleteRecord(ctx, models.AuthTokensCollection, record.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AccountService) findByEmail(ctx context.Context, collection, email string) (*models.Record, error) {
+	if email == "" {
+		return nil, nil
+	}
+	records, _, err := s.records.ListRecords(ctx, collection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(email), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func invalidTokenError() error {
+	return errors.NewError(http.StatusBadRequest, "INVALID_TOKEN", "Invalid or expired token")
+}
+
+func isTruthy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v == "1" || v == "true"
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// apiKeyTouchInterval limits how often last-used tracking writes to the
+// database for a busy key.
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyInput describes a key to create. Expires is optional.
+type APIKeyInput struct {
+	Name       string    `json:"name"`
+	Collection string    `json:"collection"`
+	RecordID   string    `json:"record_id"`
+	Scopes     []string  `json:"scopes"`
+	Expires    time.Time `json:"expires"`
+}
+
+// APIKeyService manages API keys for machine-to-machine access. A key
+// authenticates as an auth record, so rules see that record, but only for
+// the collection actions its scopes grant.
+type APIKeyService struct {
+	records *RecordService
+}
+
+func NewAPIKeyService(records *RecordService) *APIKeyService {
+	return &APIKeyService{records: records}
+}
+
+// Create stores a new key and returns it in plain text together with its
+// metadata. The plain key cannot be retrieved later.
+func (s *APIKeyService) Create(ctx context.Context, input APIKeyInput) (string, *models.APIKey, error) {
+	details := map[string]any{}
+	if input.Name == "" {
+		details["name"] = "required"
+	}
+	if len(input.Scopes) == 0 {
+		details["scopes"] = "at least one scope is required"
+	}
+	for _, scope := range input.Scopes {
+		if err := auth.ValidateScope(scope); err != nil {
+			details["scopes"] = err.Error()
+		}
+	}
+	if !input.Expires.IsZero() && input.Expires.Before(time.Now()) {
+		details["expires"] = "must be in the future"
+	}
+	if len(details) > 0 {
+		return "", nil, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(details)
+	}
+
+	if input.Collection == "" {
+		input.Collection = "users"
+	}
+	col, ok := s.records.Lookup().Collection(input.Collection)
+	if !ok || col.Type != models.CollectionTypeAuth {
+		return "", nil, errors.NewError(http.StatusBadRequest, "AUTH_COLLECTION_NOT_FOUND", "API keys can only be issued to records of auth collections")
+	}
+	if _, err := s.records.FindRecordByID(ctx, input.Collection, input.RecordID); err != nil {
+		return "", nil, err
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	scopes, _ := json.Marshal(input.Scopes)
+	data := map[string]any{
+		"name":       input.Name,
+		"key_hash":   auth.HashToken(key),
+		"prefix":     prefix,
+		"collection": input.Collection,
+		"record_id":  input.RecordID,
+		"scopes":     string(scopes),
+	}
+	if !input.Expires.IsZero() {
+		data["expires"] = input.Expires.UTC().Format(time.RFC3339)
+	}
+
+	record, err := s.records.CreateRecord(ctx, models.APIKeysCollection, data)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, apiKeyFromRecord(record), nil
+}
+
+// List returns the keys issued to the record, or every key when recordID
+// is empty.
+func (s *APIKeyService) List(ctx context.Context, collection, recordID string) ([]*models.APIKey, error) {
+	params := db.QueryParams{PerPage: 500, Sort: "-created"}
+	if recordID != "" {
+		params.Filter = "record_id = " + db.QuoteFilterValue(recordID) + " && collection = " + db.QuoteFilterValue(collection)
+	}
+	records, _, err := s.records.ListRecords(ctx, models.APIKeysCollection, params)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*models.APIKey, 0, len(records))
+	for _, record := range records {
+		keys = append(keys, apiKeyFromRecord(record))
+	}
+	return keys, nil
+}
+
+// Revoke deletes a key; requests using it fail from then on.
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	if _, err := s.records.FindRecordByID(ctx, models.APIKeysCollection, id); err != nil {
+		return errors.NewError(http.StatusNotFound, "API_KEY_NOT_FOUND", "API key not found")
+	}
+	return s.records.DeleteRecord(ctx, models.APIKeysCollection, id)
+}
+
+// Resolve returns the claims of a key presented by a client at ip, and
+// records when and from where the key was last used.
+func (s *APIKeyService) Resolve(ctx context.Context, key, ip string) (*auth.Claims, error) {
+	records, _, err := s.records.ListRecords(ctx, models.APIKeysCollection, db.QueryParams{Filter: "key_hash = " + db.QuoteFilterValue(auth.HashToken(key)), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, invalidAPIKeyError()
+	}
+
+	apiKey := apiKeyFromRecord(records[0])
+	if apiKey.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, apiKey.Expires)
+		if err != nil || time.Now().After(expires) {
+			return nil, invalidAPIKeyError()
+		}
+	}
+
+	// Keys of deleted records stop working with them.
+	if _, err := s.records.FindRecordByID(ctx, apiKey.Collection, apiKey.RecordID); err != nil {
+		return nil, invalidAPIKeyError()
+	}
+
+	lastUsed, _ := time.Parse(time.RFC3339, apiKey.LastUsed)
+	if time.Since(lastUsed) > apiKeyTouchInterval || apiKey.LastUsedIP != ip {
+		_, err := s.records.UpdateRecord(ctx, models.APIKeysCollection, apiKey.ID, map[string]any{
+			"last_used":    time.Now().UTC().Format(time.RFC3339),
+			"last_used_ip": ip,
+		})
+		if err != nil {
+			slog.Warn("Failed to record API key use", "key", apiKey.Prefix, "error", err)
+		}
+	}
+
+	return &auth.Claims{
+		RecordID:   apiKey.RecordID,
+		Collection: apiKey.Collection,
+		Type:       auth.TokenTypeAPIKey,
+		APIKeyID:   apiKey.ID,
+		Scopes:     apiKey.Scopes,
+	}, nil
+}
+
+func apiKeyFromRecord(record *models.Record) *models.APIKey {
+	return &models.APIKey{
+		ID:         record.ID,
+		Name:       record.GetString("name"),
+		Prefix:     record.GetString("prefix"),
+		Collection: record.GetString("collection"),
+		RecordID:   record.GetString("record_id"),
+		Scopes:     stringList(record.Data["scopes"]),
+		Expires:    record.GetString("expires"),
+		LastUsed:   record.GetString("last_used"),
+		LastUsedIP: record.GetString("last_used_ip"),
+		Created:    record.Created,
+	}
+}
+
+func invalidAPIKeyError() error {
+	return errors.NewError(http.StatusUnauthorized, "INVALID_API_KEY", "Invalid or expired API key")
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	keys := NewAPIKeyService(records)
+
+	record, err := records.CreateRecord(ctx, "users", map[string]any{"username": "bot", "email": "bot@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := keys.Create(ctx, APIKeyInput{Name: "sync", RecordID: record.ID, Scopes: []string{"posts:publish"}}); errorCode(err) != "VALIDATION_FAILED" {
+		t.Fatalf("expected an unknown action to be rejected, got %v", err)
+	}
+
+	key, apiKey, err := keys.Create(ctx, APIKeyInput{Name: "sync", RecordID: record.ID, Scopes: []string{"posts:list", "posts:view"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := keys.Resolve(ctx, key, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.RecordID != record.ID || claims.APIKeyID != apiKey.ID || !claims.Allows("posts", "view") || claims.Allows("posts", "delete") {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	listed, err := keys.List(ctx, "users", record.ID)
+	if err != nil || len(listed) != 1 || listed[0].LastUsedIP != "10.0.0.1" || listed[0].LastUsed == "" {
+		t.Fatalf("expected the key to record its use, got %+v %v", listed, err)
+	}
+
+	if _, err := keys.Resolve(ctx, key+"x", ""); errorCode(err) != "INVALID_API_KEY" {
+		t.Errorf("expected an unknown key to be rejected, got %v", err)
+	}
+
+	if err := keys.Revoke(ctx, apiKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Resolve(ctx, key, ""); errorCode(err) != "INVALID_API_KEY" {
+		t.Errorf("expected a revoked key to be rejected, got %v", err)
+	}
+
+	// Expired keys stop working.
+	key, apiKey, err = keys.Create(ctx, APIKeyInput{Name: "short", RecordID: record.ID, Scopes: []string{"*:*"}, Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := records.UpdateRecord(ctx, "_api_keys", apiKey.ID, map[string]any{"expires": time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Resolve(ctx, key, ""); errorCode(err) != "INVALID_API_KEY" {
+		t.Errorf("expected an expired key to be rejected, got %v", err)
+	}
+}
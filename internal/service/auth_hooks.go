@@ -2,22 +2,51 @@ package service
 
 import (
 	"context"
+	"sync"
 
 	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/models"
 )
 
-func RegisterAuthHooks() {
-	hooks := GetHooks("users")
+var (
+	authHooksMu sync.Mutex
+	authHooked  = make(map[string]bool)
+)
 
-	// Avoid adding duplicate hooks if called multiple times
-	// This is a simple check, ideally we'd have named hooks or better management
-	if len(hooks.BeforeCreate) == 0 {
-		hooks.BeforeCreate = append(hooks.BeforeCreate, hashPasswordHook)
+// RegisterAuthHooks installs the password hashing hooks on the admins
+// collection and on every auth collection given.
+func RegisterAuthHooks(collections []*models.Collection) {
+	RegisterAuthCollectionHooks(models.AdminsCollection)
+	for _, col := range collections {
+		if col.Type == models.CollectionTypeAuth {
+			RegisterAuthCollectionHooks(col.Name)
+		}
 	}
-	if len(hooks.BeforeUpdate) == 0 {
-		hooks.BeforeUpdate = append(hooks.BeforeUpdate, hashPasswordHook)
+}
+
+// RegisterAuthCollectionHooks installs the password hashing hooks on a single
+// collection. Calling it again for the same collection is a no-op.
+func RegisterAuthCollectionHooks(name string) {
+	authHooksMu.Lock()
+	defer authHooksMu.Unlock()
+
+	if authHooked[name] {
+		return
 	}
+	authHooked[name] = true
+
+	hooks := GetHooks(name)
+	hooks.BeforeCreate = append(hooks.BeforeCreate, hashPasswordHook)
+	hooks.BeforeUpdate = append(hooks.BeforeUpdate, hashPasswordHook)
+}
+
+type hashedPasswordKey struct{}
+
+// withHashedPassword marks the context of a trusted write within this
+// package whose password is already a bcrypt hash to be stored as is.
+// Passwords from API and CLI input are always hashed.
+func withHashedPassword(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hashedPasswordKey{}, true)
 }
 
 func hashPasswordHook(ctx context.Context, record *models.Record) error {
@@ -25,6 +54,16 @@ func hashPasswordHook(ctx context.Context, record *models.Record) error {
 	if password == "" {
 		return nil
 	}
+	// Only the hash already stored, merged into an update, or one a trusted
+	// caller supplies is kept; a hash sent by a client is hashed again so it
+	// cannot be used to choose the stored credential.
+	if auth.IsHashed(password) {
+		stored, _ := StoredData(ctx)["password"].(string)
+		trusted, _ := ctx.Value(hashedPasswordKey{}).(bool)
+		if password == stored || trusted {
+			return nil
+		}
+	}
 
 	hashed, err := auth.HashPassword(ctx, password)
 	if err != nil {
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestHashPasswordHook(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	RegisterAuthCollectionHooks(models.AdminsCollection)
+
+	admin, err := records.CreateRecord(ctx, models.AdminsCollection, map[string]any{
+		"email": "a@x.io", "username": "a", "password": "password123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := admin.GetString("password")
+	if !auth.ComparePasswords(stored, "password123") {
+		t.Fatal("expected the password to be hashed")
+	}
+
+	// The stored hash merged into an unrelated update is kept.
+	admin, err = records.UpdateRecord(ctx, models.AdminsCollection, admin.ID, map[string]any{"username": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.GetString("password") != stored {
+		t.Error("expected the stored hash to be kept")
+	}
+
+	// A hash chosen by a client is hashed again, so it is no credential.
+	chosen, _ := auth.HashPassword(ctx, "x")
+	admin, err = records.UpdateRecord(ctx, models.AdminsCollection, admin.ID, map[string]any{"password": chosen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.GetString("password") == chosen || auth.ComparePasswords(admin.GetString("password"), "x") {
+		t.Error("expected a client supplied hash to be hashed again")
+	}
+
+	// Trusted internal callers may store a hash as is.
+	admin, err = records.UpdateRecord(withHashedPassword(ctx), models.AdminsCollection, admin.ID, map[string]any{"password": chosen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.GetString("password") != chosen {
+		t.Error("expected the trusted hash to be stored as is")
+	}
+}
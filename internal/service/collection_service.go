@@ -3,8 +3,10 @@ package service
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
 	"github.com/zulfikawr/vault/internal/models"
 )
 
@@ -30,11 +32,47 @@ func (s *CollectionService) InitSystem(ctx context.Context) error {
 	if err := s.registry.BootstrapUsersCollection(); err != nil {
 		return fmt.Errorf("failed to bootstrap users collection: %w", err)
 	}
+	if err := s.registry.BootstrapAdminsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap admins collection: %w", err)
+	}
+	if err := s.registry.BootstrapRolesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap roles collection: %w", err)
+	}
+	if err := s.registry.BootstrapAuthTokensCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap auth tokens collection: %w", err)
+	}
+	if err := s.registry.BootstrapIdentitiesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap identities collection: %w", err)
+	}
+	if err := s.registry.BootstrapMFACollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap mfa collection: %w", err)
+	}
+	if err := s.registry.BootstrapAPIKeysCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap api keys collection: %w", err)
+	}
+	if err := s.registry.BootstrapLoginAttemptsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap login attempts collection: %w", err)
+	}
+	if err := s.registry.BootstrapUploadsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap uploads collection: %w", err)
+	}
+	if err := s.registry.BootstrapFileRefsCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap file refs collection: %w", err)
+	}
+	if err := s.registry.BootstrapStoredFilesCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap stored files collection: %w", err)
+	}
+	if err := s.registry.BootstrapStorageUsageCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap storage usage collection: %w", err)
+	}
+	if err := s.registry.BootstrapQuarantineCollection(); err != nil {
+		return fmt.Errorf("failed to bootstrap quarantine collection: %w", err)
+	}
 	if err := s.registry.BootstrapAuditLogsCollection(); err != nil {
 		return fmt.Errorf("failed to bootstrap audit logs collection: %w", err)
 	}
 
-	systemCols := []string{"_collections", "_refresh_tokens", "_audit_logs", "users"}
+	systemCols := []string{"_collections", models.RefreshTokensCollection, "_audit_logs", "users", models.AdminsCollection, models.RolesCollection, models.AuthTokensCollection, models.IdentitiesCollection, models.MFACollection, models.APIKeysCollection, models.LoginAttemptsCollection, models.UploadsCollection, models.FileRefsCollection, models.StoredFilesCollection, models.StorageUsageCollection, models.QuarantineCollection}
 	for _, name := range systemCols {
 		col, ok := s.registry.GetCollection(name)
 		if !ok || col == nil {
@@ -44,6 +82,11 @@ func (s *CollectionService) InitSystem(ctx context.Context) error {
 			return fmt.Errorf("failed to sync collection %s: %w", name, err)
 		}
 		if name != "_collections" {
+			options, err := s.registry.StoredOptions(ctx, name)
+			if err != nil {
+				return fmt.Errorf("failed to load options of collection %s: %w", name, err)
+			}
+			col.Options = options
 			if err := s.registry.SaveCollection(ctx, col); err != nil {
 				return fmt.Errorf("failed to save collection %s: %w", name, err)
 			}
@@ -61,6 +104,15 @@ func (s *CollectionService) GetCollection(name string) (*models.Collection, bool
 }
 
 func (s *CollectionService) CreateCollection(ctx context.Context, col *models.Collection) error {
+	// Auth collections always carry the login fields and hash passwords.
+	if col.Type == models.CollectionTypeAuth {
+		col.EnsureAuthFields()
+		RegisterAuthCollectionHooks(col.Name)
+	}
+	if err := validateOptions(col); err != nil {
+		return err
+	}
+
 	// 1. Sync DB
 	if err := s.migration.SyncCollection(ctx, col); err != nil {
 		return err
@@ -74,6 +126,35 @@ func (s *CollectionService) CreateCollection(ctx context.Context, col *models.Co
 	return nil
 }
 
+// validateOptions checks the collection options against the collection's
+// type.
+func validateOptions(col *models.Collection) error {
+	options := col.Options
+	details := make(map[string]any)
+	if col.Type != models.CollectionTypeAuth {
+		if options.MFARequired {
+			details["options.mfa_required"] = "only auth collections can require MFA"
+		}
+		if options.UserQuotaBytes != 0 || options.UserQuotaFiles != 0 {
+			details["options.user_quota"] = "only auth collections have user quotas"
+		}
+	}
+	for name, quota := range map[string]int64{
+		"options.quota_bytes":      options.QuotaBytes,
+		"options.quota_files":      int64(options.QuotaFiles),
+		"options.user_quota_bytes": options.UserQuotaBytes,
+		"options.user_quota_files": int64(options.UserQuotaFiles),
+	} {
+		if quota < 0 {
+			details[name] = "must not be negative"
+		}
+	}
+	if len(details) > 0 {
+		return errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(details)
+	}
+	return nil
+}
+
 func (s *CollectionService) DeleteCollection(ctx context.Context, name string) error {
 	// Remove from registry
 	s.registry.RemoveCollection(name)
@@ -2,32 +2,53 @@ package service
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/zulfikawr/vault/internal/auth"
 	"github.com/zulfikawr/vault/internal/core"
 	"github.com/zulfikawr/vault/internal/rules"
 )
 
-func GetEvaluationContext(r *http.Request, recordData map[string]any) rules.EvaluationContext {
+// GetEvaluationContext builds the rule context for a request against a record
+// of the given collection. The authenticated record is loaded in full so that
+// rules can reference any of its fields via @request.auth.*.
+func GetEvaluationContext(r *http.Request, lookup rules.Lookup, collection string, recordData map[string]any) rules.EvaluationContext {
 	authClaims := core.GetAuth(r.Context())
 
 	evalCtx := rules.EvaluationContext{
-		Auth:    make(map[string]any),
-		Data:    make(map[string]any),
-		Record:  recordData,
-		IsAdmin: false,
+		Auth:       make(map[string]any),
+		Data:       make(map[string]any),
+		Record:     recordData,
+		IsAdmin:    false,
+		Collection: collection,
+		Method:     r.Method,
+		Headers:    rules.HeadersFromRequest(r.Header),
+		Now:        time.Now().UTC(),
+		Lookup:     lookup,
+		Context:    r.Context(),
 	}
 
 	// If we have JWT claims, populate @request.auth
 	if claims, ok := authClaims.(*auth.Claims); ok {
+		if lookup != nil {
+			if record, err := lookup.FindRecordByID(r.Context(), claims.Collection, claims.RecordID); err == nil {
+				for k, v := range record.Data {
+					evalCtx.Auth[k] = v
+				}
+				delete(evalCtx.Auth, "password")
+				evalCtx.Auth["created"] = record.Created
+				evalCtx.Auth["updated"] = record.Updated
+			}
+		}
 		evalCtx.Auth["id"] = claims.RecordID
 		evalCtx.Auth["collection"] = claims.Collection
+		evalCtx.IsAdmin = claims.IsAdmin()
 
-		// For now, any user in the 'users' collection is an admin if they have a certain flag
-		// but let's just say any verified user in 'users' is admin for this prototype
-		// or better: check a specific 'is_admin' field.
-		if claims.Collection == "users" {
-			evalCtx.IsAdmin = true // Placeholder: Real logic would check user record
+		// Requests made with an API key expose the key and its scopes, so
+		// rules can tell them apart from logins.
+		evalCtx.Auth["api_key"] = claims.APIKeyID
+		if claims.IsAPIKey() {
+			evalCtx.Auth["scopes"] = claims.Scopes
 		}
 	}
 
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+// NewStorage returns the storage backend of the configuration, storing the
+// files of records deduplicated when storage_dedupe is set.
+func NewStorage(config *core.Config, records *RecordService) (storage.Storage, error) {
+	store, err := storage.New(config)
+	if err != nil || !config.StorageDedupe {
+		return store, err
+	}
+	return storage.NewDedupe(store, NewFileRefService(records)), nil
+}
+
+// FileRefService keeps the references of deduplicated files in the
+// _file_refs system collection, one record per file path.
+type FileRefService struct {
+	records *RecordService
+}
+
+func NewFileRefService(records *RecordService) *FileRefService {
+	return &FileRefService{records: records}
+}
+
+func (s *FileRefService) Get(ctx context.Context, path string) (*storage.Ref, error) {
+	record, err := s.find(ctx, path)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return refFromRecord(record), nil
+}
+
+func (s *FileRefService) Put(ctx context.Context, ref *storage.Ref) error {
+	data := map[string]any{
+		"path":     ref.Path,
+		"field":    ref.Field,
+		"hash":     ref.Hash,
+		"size":     ref.Size,
+		"modified": ref.ModTime.UTC().Format(time.RFC3339Nano),
+	}
+	if parts := strings.Split(ref.Path, "/"); len(parts) == 3 {
+		data["collection"], data["record_id"], data["filename"] = parts[0], parts[1], parts[2]
+	}
+
+	record, err := s.find(ctx, ref.Path)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		_, err = s.records.CreateRecord(ctx, models.FileRefsCollection, data)
+	} else {
+		_, err = s.records.UpdateRecord(ctx, models.FileRefsCollection, record.ID, data)
+	}
+	return err
+}
+
+func (s *FileRefService) Delete(ctx context.Context, path string) error {
+	record, err := s.find(ctx, path)
+	if err != nil || record == nil {
+		return err
+	}
+	return s.records.DeleteRecord(ctx, models.FileRefsCollection, record.ID)
+}
+
+func (s *FileRefService) List(ctx context.Context, prefix string) ([]*storage.Ref, error) {
+	records, err := recordsBelow(ctx, s.records, models.FileRefsCollection, prefix)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*storage.Ref, len(records))
+	for i, record := range records {
+		refs[i] = refFromRecord(record)
+	}
+	return refs, nil
+}
+
+func (s *FileRefService) Count(ctx context.Context, hash string) (int, error) {
+	_, total, err := s.records.ListRecords(ctx, models.FileRefsCollection, db.QueryParams{Filter: "hash = " + db.QuoteFilterValue(hash), PerPage: 1})
+	return total, err
+}
+
+func (s *FileRefService) find(ctx context.Context, path string) (*models.Record, error) {
+	return recordAt(ctx, s.records, models.FileRefsCollection, path)
+}
+
+// recordAt returns the record of the collection whose path field holds the
+// path, or nil.
+func recordAt(ctx context.Context, records *RecordService, collection, path string) (*models.Record, error) {
+	found, _, err := records.ListRecords(ctx, collection, db.QueryParams{Filter: "path = " + db.QuoteFilterValue(path), PerPage: 1})
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return found[0], nil
+}
+
+// recordsBelow returns the records of the collection whose path field holds
+// a path below the prefix, or every record for an empty prefix.
+func recordsBelow(ctx context.Context, records *RecordService, collection, prefix string) ([]*models.Record, error) {
+	params := db.QueryParams{Page: 1, PerPage: 500, Sort: "path"}
+	if prefix != "" {
+		prefix += "/"
+		params.Filter = "path LIKE " + db.QuoteFilterValue(prefix+"%")
+	}
+
+	var below []*models.Record
+	for {
+		page, total, err := records.ListRecords(ctx, collection, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range page {
+			// LIKE also matches _ and % in the prefix as wildcards.
+			if strings.HasPrefix(record.GetString("path"), prefix) {
+				below = append(below, record)
+			}
+		}
+		if len(page) == 0 || params.Page*params.PerPage >= total {
+			return below, nil
+		}
+		params.Page++
+	}
+}
+
+func refFromRecord(record *models.Record) *storage.Ref {
+	modified, _ := time.Parse(time.RFC3339Nano, record.GetString("modified"))
+	return &storage.Ref{
+		Path:    record.GetString("path"),
+		Field:   record.GetString("field"),
+		Hash:    record.GetString("hash"),
+		Size:    int64(record.GetInt("size")),
+		ModTime: modified,
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+func TestFileRefs(t *testing.T) {
+	ctx := context.Background()
+	_, records, _ := newTestFileService(t, &models.Collection{Name: "docs", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "file", Type: models.FieldTypeFile},
+	}})
+	refs := NewFileRefService(records)
+
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	for _, ref := range []*storage.Ref{
+		{Path: "my_docs/rec1/a.txt", Field: "file", Hash: "aaaa", Size: 4, ModTime: modified},
+		{Path: "my_docs/rec1/b.txt", Field: "file", Hash: "aaaa", Size: 4, ModTime: modified},
+		{Path: "myxdocs/rec1/c.txt", Field: "file", Hash: "bbbb", Size: 2, ModTime: modified},
+	} {
+		if err := refs.Put(ctx, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ref, err := refs.Get(ctx, "my_docs/rec1/a.txt")
+	if err != nil || ref == nil || ref.Hash != "aaaa" || ref.Size != 4 || ref.Field != "file" || !ref.ModTime.Equal(modified) {
+		t.Fatalf("unexpected reference %+v %v", ref, err)
+	}
+	record, err := refs.find(ctx, "my_docs/rec1/a.txt")
+	if err != nil || record.GetString("collection") != "my_docs" || record.GetString("record_id") != "rec1" || record.GetString("filename") != "a.txt" {
+		t.Errorf("expected the path to be split into the record's file, got %v %v", record, err)
+	}
+
+	// The underscore of the prefix must not match any character.
+	if list, err := refs.List(ctx, "my_docs"); err != nil || len(list) != 2 {
+		t.Errorf("expected 2 references, got %d %v", len(list), err)
+	}
+	if list, err := refs.List(ctx, ""); err != nil || len(list) != 3 {
+		t.Errorf("expected every reference, got %d %v", len(list), err)
+	}
+
+	// Putting a path again replaces its reference.
+	if err := refs.Put(ctx, &storage.Ref{Path: "my_docs/rec1/b.txt", Hash: "bbbb", Size: 2, ModTime: modified}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := refs.Count(ctx, "aaaa"); err != nil || count != 1 {
+		t.Errorf("expected 1 reference to aaaa, got %d %v", count, err)
+	}
+	if err := refs.Delete(ctx, "my_docs/rec1/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := refs.Count(ctx, "aaaa"); count != 0 {
+		t.Errorf("expected no reference to aaaa, got %d", count)
+	}
+	if ref, err := refs.Get(ctx, "my_docs/rec1/a.txt"); err != nil || ref != nil {
+		t.Errorf("expected the reference to be deleted, got %+v %v", ref, err)
+	}
+}
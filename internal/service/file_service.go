@@ -0,0 +1,635 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/imaging"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/scan"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+// FileService keeps the files of records' file fields in storage, at
+// {collection}/{record id}/{name}, in step with the records holding them.
+// Uploads are scanned before they are stored, and the ones a scanner flags
+// are quarantined instead.
+type FileService struct {
+	records *RecordService
+	store   storage.Storage
+	config  *core.Config
+	quotas  *QuotaService
+	scanner scan.Scanner
+
+	// thumbLocks serialize generating a thumbnail, striped by its path.
+	thumbLocks [32]sync.Mutex
+}
+
+func NewFileService(records *RecordService, store storage.Storage, config *core.Config, quotas *QuotaService, scanner scan.Scanner) *FileService {
+	return &FileService{records: records, store: store, config: config, quotas: quotas, scanner: scanner}
+}
+
+// FileField returns the file field of the collection whose value on the
+// record holds the file, or nil when none does.
+func FileField(col *models.Collection, record *models.Record, filename string) *models.Field {
+	for i := range col.Fields {
+		field := &col.Fields[i]
+		if field.Type == models.FieldTypeFile && slices.Contains(models.FileNames(record.Data[field.Name]), filename) {
+			return field
+		}
+	}
+	return nil
+}
+
+// FileChanges are the file writes and deletions of one record write.
+// Prepare computes them, Save stores the uploads before the record is
+// written, and Commit or Discard settles them once it was or was not.
+type FileChanges struct {
+	uploads []pendingUpload
+	removed []string
+}
+
+type pendingUpload struct {
+	name  string
+	field string
+	file  fileSource
+}
+
+// fileSource is an uploaded file, sent in a multipart form, assembled from
+// the chunks of a resumable upload or released from quarantine. Trusted
+// files are not scanned.
+type fileSource struct {
+	filename string
+	size     int64
+	open     func() (io.ReadCloser, error)
+	trusted  bool
+}
+
+func multipartSource(header *multipart.FileHeader) fileSource {
+	return fileSource{
+		filename: header.Filename,
+		size:     header.Size,
+		open:     func() (io.ReadCloser, error) { return header.Open() },
+	}
+}
+
+// Names returns the names the uploads are stored under.
+func (c *FileChanges) Names() []string {
+	names := make([]string, len(c.uploads))
+	for i, upload := range c.uploads {
+		names[i] = upload.name
+	}
+	return names
+}
+
+// FilePath returns the storage path of a record's file.
+func FilePath(collection, recordID, name string) string {
+	return collection + "/" + recordID + "/" + name
+}
+
+// ThumbsDir returns the directory caching the thumbnails of the file at
+// path, next to the file.
+func ThumbsDir(path string) string {
+	dir, name := pathpkg.Split(path)
+	return dir + "thumbs_" + name
+}
+
+// MaxSize returns the largest file the field accepts.
+func (s *FileService) MaxSize(field *models.Field) int64 {
+	if size := field.FileOptions().MaxSize; size > 0 {
+		return size
+	}
+	return s.config.MaxFileUploadSize
+}
+
+// Prepare validates the uploads sent for the collection's file fields and
+// sets the fields' new values in data. A file field's value in data may only
+// keep files the existing record, nil for a new one, already holds. Uploads
+// are added to fields holding several files and replace the file of single
+// file fields.
+func (s *FileService) Prepare(col *models.Collection, existing *models.Record, data map[string]any, uploads map[string][]*multipart.FileHeader) (*FileChanges, error) {
+	sources := make(map[string][]fileSource, len(uploads))
+	for name, headers := range uploads {
+		for _, header := range headers {
+			sources[name] = append(sources[name], multipartSource(header))
+		}
+	}
+	return s.prepare(col, existing, data, sources)
+}
+
+func (s *FileService) prepare(col *models.Collection, existing *models.Record, data map[string]any, uploads map[string][]fileSource) (*FileChanges, error) {
+	changes := &FileChanges{}
+	details := make(map[string]any)
+
+	for name := range uploads {
+		if field := fileField(col, name); field == nil {
+			details[name] = "not a file field"
+		}
+	}
+
+	for i := range col.Fields {
+		field := &col.Fields[i]
+		if field.Type != models.FieldTypeFile {
+			continue
+		}
+		value, set := data[field.Name]
+		files := uploads[field.Name]
+		if !set && len(files) == 0 {
+			continue
+		}
+
+		var current []string
+		if existing != nil {
+			current = models.FileNames(existing.Data[field.Name])
+		}
+		names := current
+		if set {
+			names = models.FileNames(value)
+			if unknown := slices.IndexFunc(names, func(name string) bool { return !slices.Contains(current, name) }); unknown >= 0 {
+				details[field.Name] = fmt.Sprintf("unknown file %s", names[unknown])
+				continue
+			}
+		}
+
+		if problem := s.checkUploads(field, files); problem != "" {
+			details[field.Name] = problem
+			continue
+		}
+
+		options := field.FileOptions()
+		var added []string
+		for _, file := range files {
+			name := uuid.New().String() + fileExt(file.filename)
+			added = append(added, name)
+			changes.uploads = append(changes.uploads, pendingUpload{name: name, field: field.Name, file: file})
+		}
+		if !options.Multiple() {
+			if len(files) > 1 {
+				details[field.Name] = "only one file is allowed"
+				continue
+			}
+			if len(added) > 0 {
+				names = added
+			}
+		} else {
+			names = append(slices.Clone(names), added...)
+			if len(names) > options.MaxSelect {
+				details[field.Name] = fmt.Sprintf("at most %d files are allowed", options.MaxSelect)
+				continue
+			}
+		}
+
+		for _, name := range current {
+			if !slices.Contains(names, name) {
+				changes.removed = append(changes.removed, name)
+			}
+		}
+		data[field.Name] = fileFieldValue(names, options.Multiple())
+	}
+
+	if len(details) > 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(details)
+	}
+	return changes, nil
+}
+
+// checkUploads describes why the field does not accept the files, or
+// returns "" when it does.
+func (s *FileService) checkUploads(field *models.Field, files []fileSource) string {
+	options := field.FileOptions()
+	maxSize := s.MaxSize(field)
+	for _, file := range files {
+		if file.size > maxSize {
+			return fmt.Sprintf("%s exceeds the maximum size of %d bytes", file.filename, maxSize)
+		}
+		contentType, err := detectContentType(file)
+		if err != nil {
+			return fmt.Sprintf("%s could not be read", file.filename)
+		}
+		if !options.Accepts(contentType) {
+			return fmt.Sprintf("%s has a file type (%s) that is not allowed", file.filename, contentType)
+		}
+	}
+	return ""
+}
+
+// Save stores the uploads of the changes for the record, counted against
+// the storage quotas of the collection and of owner, the auth record
+// ({collection}/{id}) uploading them or "". Files already stored are removed
+// again when one fails. When a scanner flags an upload, every flagged one is
+// quarantined and FILE_QUARANTINED returned without storing any.
+func (s *FileService) Save(ctx context.Context, collection, recordID, owner string, changes *FileChanges) error {
+	if len(changes.uploads) == 0 {
+		return nil
+	}
+	if err := s.scanUploads(ctx, collection, recordID, owner, changes.uploads); err != nil {
+		return err
+	}
+	sizes := make([]int64, len(changes.uploads))
+	for i, upload := range changes.uploads {
+		sizes[i] = upload.file.size
+	}
+	if err := s.quotas.Check(ctx, collection, owner, sizes...); err != nil {
+		return err
+	}
+
+	for i, upload := range changes.uploads {
+		path := FilePath(collection, recordID, upload.name)
+		err := s.quotas.Add(ctx, path, owner, upload.file.size)
+		if err == nil {
+			if err = s.save(storage.WithField(ctx, upload.field), path, upload.file); err != nil {
+				if releaseErr := s.quotas.Release(ctx, path); releaseErr != nil {
+					errors.Log(ctx, releaseErr, "release failed upload", "path", path)
+				}
+			}
+		}
+		if err != nil {
+			s.discard(ctx, collection, recordID, changes.uploads[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// scanUploads scans the uploads that are not trusted, quarantining the ones
+// a scanner flags.
+func (s *FileService) scanUploads(ctx context.Context, collection, recordID, owner string, uploads []pendingUpload) error {
+	var quarantined []*models.QuarantinedFile
+	for _, upload := range uploads {
+		if upload.file.trusted {
+			continue
+		}
+		finding, err := s.scan(ctx, upload.file)
+		if err != nil {
+			errors.Log(ctx, err, "scan upload", "filename", upload.file.filename)
+			return errors.NewError(http.StatusServiceUnavailable, "SCAN_FAILED", "Uploaded file could not be scanned").WithDetails(map[string]any{"filename": upload.file.filename})
+		}
+		if finding == nil {
+			continue
+		}
+		file, err := s.quarantine(ctx, &models.QuarantinedFile{
+			Collection: collection,
+			RecordID:   recordID,
+			Field:      upload.field,
+			Filename:   upload.file.filename,
+			Size:       upload.file.size,
+			Owner:      owner,
+			Scanner:    finding.Scanner,
+			Threat:     finding.Threat,
+		}, upload.file)
+		if err != nil {
+			return err
+		}
+		quarantined = append(quarantined, file)
+	}
+	if len(quarantined) > 0 {
+		return errors.NewError(http.StatusUnprocessableEntity, "FILE_QUARANTINED", "Uploaded file was flagged by a scanner and quarantined").WithDetails(map[string]any{"files": quarantined})
+	}
+	return nil
+}
+
+// scan runs the scanner over an upload, spooling it to a temporary file when
+// it cannot be read at any offset.
+func (s *FileService) scan(ctx context.Context, source fileSource) (*scan.Finding, error) {
+	file, err := source.open()
+	if err != nil {
+		return nil, err
+	}
+	defer errors.Defer(ctx, file.Close, "close uploaded file", "filename", source.filename)
+
+	content, ok := file.(io.ReaderAt)
+	size := source.size
+	if !ok {
+		spool, err := os.CreateTemp("", "vault-scan-*")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		if size, err = io.Copy(spool, file); err != nil {
+			return nil, err
+		}
+		content = spool
+	}
+	return s.scanner.Scan(ctx, source.filename, io.NewSectionReader(content, 0, size))
+}
+
+// quarantine stores a flagged upload under QuarantineDir and lists it in
+// _quarantine.
+func (s *FileService) quarantine(ctx context.Context, file *models.QuarantinedFile, source fileSource) (*models.QuarantinedFile, error) {
+	record, err := s.records.CreateRecord(ctx, models.QuarantineCollection, map[string]any{
+		"collection": file.Collection,
+		"record_id":  file.RecordID,
+		"field":      file.Field,
+		"filename":   file.Filename,
+		"size":       file.Size,
+		"owner":      file.Owner,
+		"scanner":    file.Scanner,
+		"threat":     file.Threat,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(ctx, QuarantinePath(record.ID), source); err != nil {
+		if deleteErr := s.records.DeleteRecord(ctx, models.QuarantineCollection, record.ID); deleteErr != nil {
+			errors.Log(ctx, deleteErr, "delete quarantine entry", "id", record.ID)
+		}
+		return nil, err
+	}
+	slog.Warn("Quarantined flagged upload", "id", record.ID, "collection", file.Collection, "record_id", file.RecordID, "filename", file.Filename, "scanner", file.Scanner, "threat", file.Threat)
+	return quarantinedFile(record), nil
+}
+
+func (s *FileService) save(ctx context.Context, path string, source fileSource) error {
+	file, err := source.open()
+	if err != nil {
+		return errors.NewError(http.StatusBadRequest, "FILE_READ_ERROR", "Failed to read uploaded file").WithDetails(map[string]any{"filename": source.filename})
+	}
+	defer errors.Defer(ctx, file.Close, "close uploaded file", "filename", source.filename)
+	return s.store.Save(ctx, path, file)
+}
+
+// Commit removes the files the record no longer holds once it was written.
+func (s *FileService) Commit(ctx context.Context, collection, recordID string, changes *FileChanges) {
+	for _, name := range changes.removed {
+		path := FilePath(collection, recordID, name)
+		if err := s.DeleteFile(ctx, path); err != nil {
+			errors.Log(ctx, err, "delete replaced file", "path", path)
+		}
+	}
+}
+
+// DeleteFile removes a file along with its cached thumbnails.
+func (s *FileService) DeleteFile(ctx context.Context, path string) error {
+	if err := s.store.Delete(ctx, path); err != nil {
+		return err
+	}
+	if err := s.quotas.Release(ctx, path); err != nil {
+		return err
+	}
+	_, _, err := storage.RemoveAll(ctx, s.store, ThumbsDir(path))
+	return err
+}
+
+// Discard removes the stored uploads when the record could not be written.
+func (s *FileService) Discard(ctx context.Context, collection, recordID string, changes *FileChanges) {
+	s.discard(ctx, collection, recordID, changes.uploads)
+}
+
+func (s *FileService) discard(ctx context.Context, collection, recordID string, uploads []pendingUpload) {
+	for _, upload := range uploads {
+		path := FilePath(collection, recordID, upload.name)
+		if err := s.store.Delete(ctx, path); err != nil {
+			errors.Log(ctx, err, "delete discarded upload", "path", path)
+		} else if err := s.quotas.Release(ctx, path); err != nil {
+			errors.Log(ctx, err, "release discarded upload", "path", path)
+		}
+	}
+}
+
+// DeleteRecordFiles removes the files of a deleted record.
+func (s *FileService) DeleteRecordFiles(ctx context.Context, col *models.Collection, recordID string) {
+	if !hasFileFields(col) || recordID == "" {
+		return
+	}
+	if _, _, err := storage.RemoveAll(ctx, s.store, col.Name+"/"+recordID); err != nil {
+		errors.Log(ctx, err, "delete record files", "collection", col.Name, "record_id", recordID)
+	} else if err := s.quotas.Release(ctx, col.Name+"/"+recordID); err != nil {
+		errors.Log(ctx, err, "release record files", "collection", col.Name, "record_id", recordID)
+	}
+}
+
+// DeleteCollectionFiles removes the files of every record of a deleted
+// collection.
+func (s *FileService) DeleteCollectionFiles(ctx context.Context, collection string) {
+	if collection == "" {
+		return
+	}
+	if _, _, err := storage.RemoveAll(ctx, s.store, collection); err != nil {
+		errors.Log(ctx, err, "delete collection files", "collection", collection)
+	} else if err := s.quotas.Release(ctx, collection); err != nil {
+		errors.Log(ctx, err, "release collection files", "collection", collection)
+	}
+}
+
+// RemovedFieldFiles returns the paths of the files held by file fields of
+// the collection that the updated definition drops or turns into another
+// type. They must be collected before the update drops the columns and
+// deleted with DeleteFiles once it succeeded.
+func (s *FileService) RemovedFieldFiles(ctx context.Context, col, updated *models.Collection) ([]string, error) {
+	var removed []string
+	for _, field := range col.Fields {
+		if field.Type != models.FieldTypeFile {
+			continue
+		}
+		if kept := fileField(updated, field.Name); kept == nil {
+			removed = append(removed, field.Name)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	var paths []string
+	params := db.QueryParams{Page: 1, PerPage: 500, Sort: "id"}
+	for {
+		records, total, err := s.records.ListRecords(ctx, col.Name, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			for _, field := range removed {
+				for _, name := range models.FileNames(record.Data[field]) {
+					paths = append(paths, FilePath(col.Name, record.ID, name))
+				}
+			}
+		}
+		if len(records) == 0 || params.Page*params.PerPage >= total {
+			return paths, nil
+		}
+		params.Page++
+	}
+}
+
+// DeleteFiles removes the files at the paths.
+func (s *FileService) DeleteFiles(ctx context.Context, paths []string) {
+	for _, path := range paths {
+		if err := s.DeleteFile(ctx, path); err != nil {
+			errors.Log(ctx, err, "delete orphaned file", "path", path)
+		}
+	}
+}
+
+// Thumb returns the path of the field's image file at path resized to thumb
+// and converted to format, either of which may be empty. Thumbs must be
+// listed in the field's thumbs option; files held by no field, with a nil
+// field, can only be converted. The result is generated on first use
+// and cached in ThumbsDir until the original changes. Files other than JPEG,
+// PNG and GIF images are returned unchanged.
+func (s *FileService) Thumb(ctx context.Context, field *models.Field, path, thumb, format string) (string, error) {
+	var size imaging.Thumb
+	if thumb != "" {
+		parsed, err := imaging.ParseThumb(thumb)
+		if err != nil {
+			return "", errors.NewError(http.StatusBadRequest, "INVALID_THUMB", err.Error())
+		}
+		var allowed []string
+		if field != nil {
+			allowed = field.FileOptions().Thumbs
+		}
+		if !slices.ContainsFunc(allowed, func(a string) bool {
+			t, err := imaging.ParseThumb(a)
+			return err == nil && t == parsed
+		}) {
+			return "", errors.NewError(http.StatusBadRequest, "THUMB_NOT_ALLOWED", "Thumbnail size is not allowed for this field").WithDetails(map[string]any{
+				"thumb":   parsed.String(),
+				"allowed": allowed,
+			})
+		}
+		size = parsed
+	}
+	if format != "" {
+		parsed, err := imaging.ParseFormat(format)
+		if err != nil {
+			return "", errors.NewError(http.StatusBadRequest, "INVALID_FORMAT", err.Error())
+		}
+		format = parsed
+	}
+
+	info, err := s.store.Stat(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	source, err := s.imageFormat(ctx, path)
+	if err != nil || source == "" {
+		return path, err
+	}
+	if format == "" {
+		format = source
+	}
+	if size == (imaging.Thumb{}) && format == source {
+		return path, nil
+	}
+
+	name := "full"
+	if size != (imaging.Thumb{}) {
+		name = size.String()
+	}
+	cached := ThumbsDir(path) + "/" + name + imaging.Extension(format)
+
+	lock := &s.thumbLocks[crc32.ChecksumIEEE([]byte(cached))%uint32(len(s.thumbLocks))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	if thumbInfo, err := s.store.Stat(ctx, cached); err == nil && !thumbInfo.ModTime.Before(info.ModTime) {
+		return cached, nil
+	}
+
+	file, err := s.store.Retrieve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer errors.Defer(ctx, file.Close, "close image", "path", path)
+
+	data, err := imaging.Transform(file, size, format)
+	if err == imaging.ErrTooLarge {
+		return "", errors.NewError(http.StatusBadRequest, "IMAGE_TOO_LARGE", "Image is too large to transform")
+	}
+	if err != nil {
+		return "", errors.NewError(http.StatusBadRequest, "INVALID_IMAGE", "Failed to transform image").WithDetails(map[string]any{"error": err.Error()})
+	}
+	if err := s.store.Save(ctx, cached, bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+// imageFormat detects the image format of the file at path, or "" when it
+// is not a supported image.
+func (s *FileService) imageFormat(ctx context.Context, path string) (string, error) {
+	file, err := s.store.RetrieveRange(ctx, path, 0, 16)
+	if err != nil {
+		return "", err
+	}
+	defer errors.Defer(ctx, file.Close, "close image", "path", path)
+	header, err := io.ReadAll(file)
+	if err != nil {
+		return "", errors.NewError(http.StatusInternalServerError, "STORAGE_READ_FAILED", "Failed to read file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	return imaging.Format(header), nil
+}
+
+func fileField(col *models.Collection, name string) *models.Field {
+	for i := range col.Fields {
+		if col.Fields[i].Name == name && col.Fields[i].Type == models.FieldTypeFile {
+			return &col.Fields[i]
+		}
+	}
+	return nil
+}
+
+func hasFileFields(col *models.Collection) bool {
+	return slices.ContainsFunc(col.Fields, func(f models.Field) bool { return f.Type == models.FieldTypeFile })
+}
+
+// fileFieldValue is the stored value of a file field holding the names.
+func fileFieldValue(names []string, multiple bool) string {
+	if len(names) == 0 {
+		return ""
+	}
+	if !multiple {
+		return names[0]
+	}
+	data, _ := json.Marshal(names)
+	return string(data)
+}
+
+// fileExt returns the lower-case extension of an uploaded file's name, or ""
+// when it holds anything but letters and digits.
+func fileExt(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filepath.Base(filename)))
+	if len(ext) < 2 || len(ext) > 16 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// detectContentType sniffs the content type of an uploaded file.
+func detectContentType(source fileSource) (string, error) {
+	file, err := source.open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buffer[:n]), nil
+}
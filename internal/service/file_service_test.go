@@ -0,0 +1,252 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/scan"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+func TestRecordFiles(t *testing.T) {
+	ctx := context.Background()
+	posts := &models.Collection{Name: "posts", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "title", Type: models.FieldTypeText},
+		{Name: "cover", Type: models.FieldTypeFile, Options: map[string]any{"mime_types": []string{"image/*"}, "max_size": 64}},
+		{Name: "attachments", Type: models.FieldTypeFile, Options: map[string]any{"max_select": 2}},
+	}}
+	files, records, store := newTestFileService(t, posts)
+	stored := func(id, name string) bool {
+		t.Helper()
+		found, err := store.Exists(ctx, FilePath("posts", id, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+	uploads := formFiles(t, map[string][]string{"cover": {png}, "attachments": {"one", "two"}})
+	data := map[string]any{"title": "hello"}
+	changes, err := files.Prepare(posts, nil, data, uploads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Save(ctx, "posts", "rec1", "", changes); err != nil {
+		t.Fatal(err)
+	}
+	record, err := records.CreateRecordWithID(ctx, "posts", "rec1", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover := record.GetString("cover")
+	attachments := models.FileNames(record.Data["attachments"])
+	if !strings.HasSuffix(cover, ".bin") || len(attachments) != 2 || !stored("rec1", cover) || !stored("rec1", attachments[1]) {
+		t.Fatalf("expected the files to be stored and named in the record, got %v", record.Data)
+	}
+
+	for name, tc := range map[string]struct {
+		data    map[string]any
+		uploads map[string][]*multipart.FileHeader
+	}{
+		"disallowed type": {uploads: formFiles(t, map[string][]string{"cover": {"plain text"}})},
+		"too large":       {uploads: formFiles(t, map[string][]string{"cover": {png + strings.Repeat("\x00", 64)}})},
+		"too many":        {uploads: formFiles(t, map[string][]string{"attachments": {"three"}})},
+		"unknown file":    {data: map[string]any{"attachments": []any{"other.txt"}}},
+		"not a file":      {uploads: formFiles(t, map[string][]string{"title": {"x"}})},
+	} {
+		if tc.data == nil {
+			tc.data = map[string]any{}
+		}
+		if _, err := files.Prepare(posts, record, tc.data, tc.uploads); errorCode(err) != "VALIDATION_FAILED" {
+			t.Errorf("%s: expected VALIDATION_FAILED, got %v", name, err)
+		}
+	}
+
+	// Replacing the cover and dropping an attachment removes their files
+	// once the record is written.
+	data = map[string]any{"attachments": []string{attachments[1]}}
+	changes, err = files.Prepare(posts, record, data, formFiles(t, map[string][]string{"cover": {png}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Save(ctx, "posts", "rec1", "", changes); err != nil {
+		t.Fatal(err)
+	}
+	if record, err = records.UpdateRecord(ctx, "posts", "rec1", data); err != nil {
+		t.Fatal(err)
+	}
+	files.Commit(ctx, "posts", "rec1", changes)
+	if stored("rec1", cover) || stored("rec1", attachments[0]) || !stored("rec1", attachments[1]) || !stored("rec1", record.GetString("cover")) {
+		t.Error("expected only the files the record holds to remain")
+	}
+
+	// Discarded uploads are removed.
+	changes, err = files.Prepare(posts, record, map[string]any{}, formFiles(t, map[string][]string{"attachments": {"three"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Save(ctx, "posts", "rec1", "", changes); err != nil {
+		t.Fatal(err)
+	}
+	files.Discard(ctx, "posts", "rec1", changes)
+	if stored("rec1", changes.Names()[0]) {
+		t.Error("expected a discarded upload to be removed")
+	}
+
+	// Dropping a file field orphans its files.
+	updated := *posts
+	updated.Fields = posts.Fields[:2]
+	paths, err := files.RemovedFieldFiles(ctx, posts, &updated)
+	if err != nil || len(paths) != 1 || paths[0] != FilePath("posts", "rec1", attachments[1]) {
+		t.Fatalf("expected the attachment to be orphaned, got %v %v", paths, err)
+	}
+	files.DeleteFiles(ctx, paths)
+	if stored("rec1", attachments[1]) {
+		t.Error("expected the orphaned file to be removed")
+	}
+
+	files.DeleteRecordFiles(ctx, posts, "rec1")
+	if found, _ := store.Exists(ctx, "posts/rec1"); found {
+		t.Error("expected the record's files to be removed")
+	}
+}
+
+func TestThumbs(t *testing.T) {
+	ctx := context.Background()
+	photos := &models.Collection{Name: "photos", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "image", Type: models.FieldTypeFile, Options: map[string]any{"thumbs": []string{"10x10", "20x0f"}}},
+	}}
+	files, _, store := newTestFileService(t, photos)
+	field := &photos.Fields[0]
+
+	var original bytes.Buffer
+	if err := png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "photos/rec1/a.png", bytes.NewReader(original.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "photos/rec1/notes.txt", strings.NewReader("text")); err != nil {
+		t.Fatal(err)
+	}
+	decode := func(path string) image.Config {
+		t.Helper()
+		file, err := store.Retrieve(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = file.Close() }()
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	path, err := files.Thumb(ctx, field, "photos/rec1/a.png", "10x10", "")
+	if err != nil || path != "photos/rec1/thumbs_a.png/10x10.png" {
+		t.Fatalf("unexpected thumb %q %v", path, err)
+	}
+	if config := decode(path); config.Width != 10 || config.Height != 10 {
+		t.Errorf("expected a 10x10 thumb, got %+v", config)
+	}
+	path, err = files.Thumb(ctx, field, "photos/rec1/a.png", "20x0f", "jpg")
+	if err != nil || path != "photos/rec1/thumbs_a.png/20x0f.jpg" {
+		t.Fatalf("unexpected thumb %q %v", path, err)
+	}
+	if config := decode(path); config.Width != 20 || config.Height != 10 {
+		t.Errorf("expected a 20x10 thumb, got %+v", config)
+	}
+
+	if _, err := files.Thumb(ctx, field, "photos/rec1/a.png", "30x30", ""); errorCode(err) != "THUMB_NOT_ALLOWED" {
+		t.Errorf("expected THUMB_NOT_ALLOWED, got %v", err)
+	}
+	if _, err := files.Thumb(ctx, field, "photos/rec1/a.png", "", "webp"); errorCode(err) != "INVALID_FORMAT" {
+		t.Errorf("expected INVALID_FORMAT, got %v", err)
+	}
+	if path, err := files.Thumb(ctx, field, "photos/rec1/notes.txt", "10x10", ""); err != nil || path != "photos/rec1/notes.txt" {
+		t.Errorf("expected other files to be served unchanged, got %q %v", path, err)
+	}
+
+	// Replacing the original regenerates the thumb. The pause lets the
+	// file system's clock move past the thumb's modification time.
+	time.Sleep(20 * time.Millisecond)
+	original.Reset()
+	if err := png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 40, 40))); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "photos/rec1/a.png", bytes.NewReader(original.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := files.Thumb(ctx, field, "photos/rec1/a.png", "20x0f", "jpg"); decode(path).Height != 20 {
+		t.Error("expected the thumb of the replaced image")
+	}
+
+	if err := files.DeleteFile(ctx, "photos/rec1/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.Exists(ctx, "photos/rec1/thumbs_a.png"); found {
+		t.Error("expected the thumbs to be deleted with the file")
+	}
+}
+
+func newTestFileService(t *testing.T, col *models.Collection) (*FileService, *RecordService, storage.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	database, err := db.Connect(ctx, filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	registry := db.NewSchemaRegistry(database)
+	collections := NewCollectionService(registry, db.NewMigrationEngine(database))
+	if err := collections.InitSystem(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := collections.CreateCollection(ctx, col); err != nil {
+		t.Fatal(err)
+	}
+
+	records := NewRecordService(db.NewRepository(database, registry), nil)
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &core.Config{MaxFileUploadSize: 1024}
+	return NewFileService(records, store, config, NewQuotaService(records, config), scan.NewRules(nil)), records, store
+}
+
+// formFiles encodes the contents as a multipart form and returns its files.
+func formFiles(t *testing.T, contents map[string][]string) map[string][]*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, files := range contents {
+		for _, content := range files {
+			part, err := writer.CreateFormFile(field, field+".bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = part.Write([]byte(content))
+		}
+	}
+	_ = writer.Close()
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = form.RemoveAll() })
+	return form.File
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"sync"
 
 	"github.com/zulfikawr/vault/internal/models"
 )
@@ -17,9 +18,24 @@ type Hooks struct {
 	AfterDelete  []HookFunc
 }
 
-var globalHooks = make(map[string]*Hooks)
+var (
+	globalHooksMu sync.Mutex
+	globalHooks   = make(map[string]*Hooks)
+)
+
+type storedKey struct{}
+
+// StoredData returns, within BeforeUpdate hooks, the record data as stored
+// before the update was merged into it.
+func StoredData(ctx context.Context) map[string]any {
+	data, _ := ctx.Value(storedKey{}).(map[string]any)
+	return data
+}
 
 func GetHooks(collection string) *Hooks {
+	globalHooksMu.Lock()
+	defer globalHooksMu.Unlock()
+
 	if h, ok := globalHooks[collection]; ok {
 		return h
 	}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// LockoutService protects password logins against brute force. Failed logins
+// are counted per identity and per client IP. Once half of the allowed
+// attempts have failed, every further failure locks the counter for a delay
+// that doubles each time; reaching the maximum locks it for the configured
+// lockout period and writes an audit log entry. Counters reset once no login
+// failed for a lockout period.
+type LockoutService struct {
+	records *RecordService
+	config  *core.Config
+	mu      sync.Mutex
+}
+
+func NewLockoutService(records *RecordService, config *core.Config) *LockoutService {
+	return &LockoutService{records: records, config: config}
+}
+
+// loginCounter identifies one failed-login counter.
+type loginCounter struct {
+	kind       string
+	collection string
+	subject    string
+	max        int
+}
+
+func (c loginCounter) key() string {
+	if c.kind == models.LoginAttemptIP {
+		return c.kind + ":" + c.subject
+	}
+	return c.kind + ":" + c.collection + ":" + c.subject
+}
+
+func (s *LockoutService) counters(collection, identity, ip string) []loginCounter {
+	var counters []loginCounter
+	if identity = strings.ToLower(strings.TrimSpace(identity)); identity != "" && s.config.LoginMaxAttempts > 0 {
+		counters = append(counters, loginCounter{models.LoginAttemptIdentity, collection, identity, s.config.LoginMaxAttempts})
+	}
+	if ip != "" && s.config.LoginMaxAttemptsPerIP > 0 {
+		counters = append(counters, loginCounter{models.LoginAttemptIP, "", ip, s.config.LoginMaxAttemptsPerIP})
+	}
+	return counters
+}
+
+func (s *LockoutService) lockoutPeriod() time.Duration {
+	if s.config.LoginLockoutMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(s.config.LoginLockoutMinutes) * time.Minute
+}
+
+// Reserve counts a login to the identity of the collection from the ip as
+// failed before the password is checked, unless logins are locked, in which
+// case it returns how long they remain locked. Checking and counting under
+// one lock keeps parallel guesses from all passing the check; a login that
+// succeeds takes its attempt back with Refund.
+func (s *LockoutService) Reserve(ctx context.Context, collection, identity, ip string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait, err := s.check(ctx, collection, identity, ip)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	return 0, s.fail(ctx, collection, identity, ip)
+}
+
+// Refund takes back the attempt Reserve counted for a successful login. The
+// failed logins of the identity are cleared; the counter of the IP only
+// drops by one, so that logging into an account one controls does not reset
+// it.
+func (s *LockoutService) Refund(ctx context.Context, collection, identity, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, counter := range s.counters(collection, identity, ip) {
+		record, err := s.find(ctx, counter.key())
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			continue
+		}
+		failures := record.GetInt("failures") - 1
+		if counter.kind == models.LoginAttemptIdentity || failures <= 0 {
+			err = s.records.DeleteRecord(ctx, models.LoginAttemptsCollection, record.ID)
+		} else {
+			// The attempt was reserved while the counter was not locked, so
+			// without it the counter is not locked either.
+			_, err = s.records.UpdateRecord(ctx, models.LoginAttemptsCollection, record.ID, map[string]any{
+				"failures":     failures,
+				"locked_until": "",
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns how long logins to the identity of the collection, or from
+// the ip, remain locked. Zero means the login may be attempted.
+func (s *LockoutService) check(ctx context.Context, collection, identity, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, counter := range s.counters(collection, identity, ip) {
+		record, err := s.find(ctx, counter.key())
+		if err != nil {
+			return 0, err
+		}
+		if record == nil {
+			continue
+		}
+		if lockedUntil, err := time.Parse(time.RFC3339, record.GetString("locked_until")); err == nil {
+			wait = max(wait, time.Until(lockedUntil))
+		}
+	}
+	return wait, nil
+}
+
+// Fail counts a failed login to the identity of the collection from the ip,
+// for failures that come after an attempt was allowed, like wrong MFA codes.
+func (s *LockoutService) Fail(ctx context.Context, collection, identity, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fail(ctx, collection, identity, ip)
+}
+
+func (s *LockoutService) fail(ctx context.Context, collection, identity, ip string) error {
+	now := time.Now().UTC()
+	period := s.lockoutPeriod()
+	for _, counter := range s.counters(collection, identity, ip) {
+		record, err := s.find(ctx, counter.key())
+		if err != nil {
+			return err
+		}
+
+		failures := 0
+		if record != nil {
+			lastFailure, _ := time.Parse(time.RFC3339, record.GetString("last_failure"))
+			lockedUntil, _ := time.Parse(time.RFC3339, record.GetString("locked_until"))
+			if now.Sub(lastFailure) < period || now.Before(lockedUntil) {
+				failures = record.GetInt("failures")
+			}
+		}
+		failures++
+
+		data := map[string]any{
+			"failures":     failures,
+			"last_failure": now.Format(time.RFC3339),
+			"locked_until": "",
+		}
+		if free := counter.max / 2; failures >= counter.max {
+			lockedUntil := now.Add(period).Format(time.RFC3339)
+			data["locked_until"] = lockedUntil
+			s.audit(ctx, counter, failures, lockedUntil)
+		} else if failures > free {
+			delay := time.Duration(math.Pow(2, float64(failures-free-1))) * time.Second
+			data["locked_until"] = now.Add(min(delay, period)).Format(time.RFC3339)
+		}
+
+		if record == nil {
+			data["key"] = counter.key()
+			data["kind"] = counter.kind
+			data["collection"] = counter.collection
+			data["subject"] = counter.subject
+			_, err = s.records.CreateRecord(ctx, models.LoginAttemptsCollection, data)
+		} else {
+			_, err = s.records.UpdateRecord(ctx, models.LoginAttemptsCollection, record.ID, data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the failed-login counters, or only the locked ones.
+func (s *LockoutService) List(ctx context.Context, lockedOnly bool) ([]*models.LoginAttempt, error) {
+	records, _, err := s.records.ListRecords(ctx, models.LoginAttemptsCollection, db.QueryParams{PerPage: 500, Sort: "-last_failure"})
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]*models.LoginAttempt, 0, len(records))
+	for _, record := range records {
+		attempt := loginAttemptFromRecord(record)
+		if lockedOnly && !attempt.Locked {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// Clear deletes a failed-login counter, lifting its lockout.
+func (s *LockoutService) Clear(ctx context.Context, id string) error {
+	if _, err := s.records.FindRecordByID(ctx, models.LoginAttemptsCollection, id); err != nil {
+		return errors.NewError(http.StatusNotFound, "LOCKOUT_NOT_FOUND", "Lockout not found")
+	}
+	return s.records.DeleteRecord(ctx, models.LoginAttemptsCollection, id)
+}
+
+func (s *LockoutService) find(ctx context.Context, key string) (*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.LoginAttemptsCollection, db.QueryParams{Filter: "key = " + db.QuoteFilterValue(key), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func (s *LockoutService) audit(ctx context.Context, counter loginCounter, failures int, lockedUntil string) {
+	details, _ := json.Marshal(map[string]any{
+		"kind":         counter.kind,
+		"collection":   counter.collection,
+		"subject":      counter.subject,
+		"failures":     failures,
+		"locked_until": lockedUntil,
+	})
+	_, err := s.records.CreateRecord(ctx, "_audit_logs", map[string]any{
+		"action":    "login_locked",
+		"resource":  counter.key(),
+		"admin_id":  "system",
+		"details":   string(details),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		errors.Log(ctx, err, "audit login lockout")
+	}
+}
+
+func loginAttemptFromRecord(record *models.Record) *models.LoginAttempt {
+	attempt := &models.LoginAttempt{
+		ID:          record.ID,
+		Kind:        record.GetString("kind"),
+		Collection:  record.GetString("collection"),
+		Subject:     record.GetString("subject"),
+		Failures:    record.GetInt("failures"),
+		LastFailure: record.GetString("last_failure"),
+		LockedUntil: record.GetString("locked_until"),
+	}
+	if lockedUntil, err := time.Parse(time.RFC3339, attempt.LockedUntil); err == nil {
+		attempt.Locked = time.Now().Before(lockedUntil)
+	}
+	return attempt
+}
+
+// LoginLockedError is returned for logins attempted while locked.
+func LoginLockedError(wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	return errors.NewError(http.StatusTooManyRequests, "LOGIN_LOCKED", fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds)).WithDetails(map[string]any{
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+)
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	lockouts := NewLockoutService(records, &core.Config{LoginMaxAttempts: 4, LoginMaxAttemptsPerIP: 100, LoginLockoutMinutes: 15})
+
+	fail := func() {
+		t.Helper()
+		if err := lockouts.Fail(ctx, "users", "Jane@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Half of the allowed attempts fail without delay.
+	fail()
+	fail()
+	if wait, err := lockouts.check(ctx, "users", "jane@example.com", "10.0.0.2"); err != nil || wait != 0 {
+		t.Fatalf("expected no delay yet, got %v %v", wait, err)
+	}
+
+	// Then each failure delays the next attempt, and the maximum locks the
+	// identity from any IP.
+	fail()
+	if wait, _ := lockouts.check(ctx, "users", "jane@example.com", "10.0.0.2"); wait <= 0 || wait > 2*time.Second {
+		t.Fatalf("expected a short backoff, got %v", wait)
+	}
+	fail()
+	wait, _ := lockouts.check(ctx, "users", "jane@example.com", "10.0.0.2")
+	if wait < 14*time.Minute {
+		t.Fatalf("expected a lockout, got %v", wait)
+	}
+	if wait, _ := lockouts.check(ctx, "admins", "jane@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("expected other collections not to be locked, got %v", wait)
+	}
+
+	_, total, err := records.ListRecords(ctx, "_audit_logs", db.QueryParams{Filter: "action = 'login_locked'"})
+	if err != nil || total != 1 {
+		t.Fatalf("expected the lockout to be audited, got %d %v", total, err)
+	}
+
+	locked, err := lockouts.List(ctx, true)
+	if err != nil || len(locked) != 1 || locked[0].Subject != "jane@example.com" || locked[0].Failures != 4 {
+		t.Fatalf("expected the identity to be listed as locked, got %+v %v", locked, err)
+	}
+	if err := lockouts.Clear(ctx, locked[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := lockouts.check(ctx, "users", "jane@example.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("expected a cleared lockout to allow logins, got %v", wait)
+	}
+
+	// A successful login takes its attempt back and resets the identity but
+	// not the IP.
+	fail()
+	if wait, err := lockouts.Reserve(ctx, "users", "jane@example.com", "10.0.0.1"); err != nil || wait != 0 {
+		t.Fatalf("expected the attempt to be reserved, got %v %v", wait, err)
+	}
+	if err := lockouts.Refund(ctx, "users", "jane@example.com", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := lockouts.List(ctx, false)
+	if len(all) != 1 || all[0].Kind != "ip" || all[0].Failures != 5 {
+		t.Errorf("expected only the IP counter to remain, got %+v", all)
+	}
+}
+
+func TestLoginLockoutReserve(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	lockouts := NewLockoutService(records, &core.Config{LoginMaxAttempts: 4, LoginMaxAttemptsPerIP: 100, LoginLockoutMinutes: 15})
+
+	// Parallel guesses each take an attempt, so no more than the maximum
+	// get past the lockout.
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := lockouts.Reserve(ctx, "users", "jane@example.com", "10.0.0.1")
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			} else if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n == 0 || n > 4 {
+		t.Errorf("expected at most 4 attempts to be allowed, got %d", n)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.txt
+var defaultMailTemplates embed.FS
+
+const (
+	MailTemplatePasswordReset = "password_reset"
+	MailTemplateVerification  = "verification"
+)
+
+// MailTemplateData is passed to every mail template.
+type MailTemplateData struct {
+	AppURL     string
+	Collection string
+	Email      string
+	Token      string
+	Expires    string
+}
+
+// MailTemplates renders mail templates. A template named in the override
+// directory replaces the embedded default with the same name.
+type MailTemplates struct {
+	dir string
+}
+
+func NewMailTemplates(dir string) *MailTemplates {
+	return &MailTemplates{dir: dir}
+}
+
+// Render executes the named template and splits it into subject and body.
+// Templates start with a "Subject:" line followed by a blank line.
+func (t *MailTemplates) Render(name string, data MailTemplateData) (string, string, error) {
+	source, err := t.load(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	tmpl, err := template.New(name).Parse(source)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse mail template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("failed to render mail template %s: %w", name, err)
+	}
+
+	head, body, _ := strings.Cut(buf.String(), "\n\n")
+	subject, ok := strings.CutPrefix(strings.TrimSpace(head), "Subject:")
+	if !ok {
+		return "", "", fmt.Errorf("mail template %s must start with a Subject line", name)
+	}
+
+	return strings.TrimSpace(subject), body, nil
+}
+
+func (t *MailTemplates) load(name string) (string, error) {
+	if t.dir != "" {
+		content, err := os.ReadFile(filepath.Join(t.dir, name+".txt"))
+		if err == nil {
+			return string(content), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read mail template %s: %w", name, err)
+		}
+	}
+
+	content, err := defaultMailTemplates.ReadFile("templates/" + name + ".txt")
+	if err != nil {
+		return "", fmt.Errorf("unknown mail template %s", name)
+	}
+	return string(content), nil
+}
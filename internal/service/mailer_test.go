@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	mailer, err := NewOutboxMailer(path, "Vault <no-reply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mailer.Send(context.Background(), "user@example.com", "Hello", "line one\nline two"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: user@example.com", "Subject: Hello", "line one\r\nline two"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("outbox missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go serveFakeSMTP(ln, received)
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	mailer := NewSMTPMailer(&core.Config{
+		SMTPHost: "127.0.0.1",
+		SMTPPort: portNum,
+		MailFrom: "Vault <no-reply@example.com>",
+	})
+
+	if err := mailer.Send(context.Background(), "user@example.com", "Reset", "token: abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := <-received
+	transcript := strings.Join(lines, "\n")
+	for _, want := range []string{"MAIL FROM:<no-reply@example.com>", "RCPT TO:<user@example.com>", "Subject: Reset", "token: abc"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript missing %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestMailTemplates(t *testing.T) {
+	data := MailTemplateData{AppURL: "https://app.example.com", Collection: "users", Email: "u@example.com", Token: "tok"}
+
+	subject, body, err := NewMailTemplates("").Render(MailTemplatePasswordReset, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Reset your password" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if !strings.Contains(body, "https://app.example.com/reset-password?collection=users&token=tok") {
+		t.Errorf("body missing reset link:\n%s", body)
+	}
+
+	dir := t.TempDir()
+	override := "Subject: Confirm {{.Email}}\n\nCode {{.Token}}\n"
+	if err := os.WriteFile(filepath.Join(dir, MailTemplateVerification+".txt"), []byte(override), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	subject, body, err = NewMailTemplates(dir).Render(MailTemplateVerification, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Confirm u@example.com" || body != "Code tok\n" {
+		t.Errorf("override not used: %q %q", subject, body)
+	}
+}
+
+// serveFakeSMTP accepts one session, answers every command and sends the
+// client lines it received once the session ends.
+func serveFakeSMTP(ln net.Listener, received chan<- []string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var lines []string
+	r := bufio.NewReader(conn)
+	write := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+
+	write("220 localhost ESMTP")
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		if inData {
+			if line == "." {
+				inData = false
+				write("250 OK")
+			}
+			continue
+		}
+
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "EHLO", "HELO":
+			write("250 localhost")
+		case "DATA":
+			inData = true
+			write("354 Go ahead")
+		case "QUIT":
+			write("221 Bye")
+			received <- lines
+			return
+		default:
+			write("250 OK")
+		}
+	}
+	received <- lines
+}
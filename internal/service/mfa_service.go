@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+const (
+	TokenTypeMFAChallenge = "mfa_challenge"
+
+	// MFAChallengeTTL is how long the second login step may take.
+	MFAChallengeTTL = 5 * time.Minute
+	// MFAChallengeAttempts is how many wrong codes end a challenge.
+	MFAChallengeAttempts = 5
+
+	RecoveryCodeCount = 10
+
+	// MFAIssuer names Vault in authenticator apps.
+	MFAIssuer = "Vault"
+)
+
+// MFAEnrollment is a new TOTP secret waiting to be confirmed with a code.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFAStatus describes the MFA setup of a record.
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAChallenge is returned by the first login step instead of a token.
+type MFAChallenge struct {
+	Token    string `json:"mfa_token"`
+	Enrolled bool   `json:"mfa_enrolled"`
+	Expires  string `json:"expires"`
+}
+
+// MFAService manages TOTP enrollments and the challenge of two-step logins.
+// A record enrolls by requesting a secret and confirming it with a code,
+// which enables MFA and returns single-use recovery codes. Secrets are
+// stored encrypted with key, see MFAKey. Wrong codes also count as failed
+// logins of the record's identity in lockouts, when it is not nil.
+type MFAService struct {
+	records  *RecordService
+	lockouts *LockoutService
+	issuer   string
+	key      []byte
+}
+
+func NewMFAService(records *RecordService, lockouts *LockoutService, issuer string, key []byte) *MFAService {
+	return &MFAService{records: records, lockouts: lockouts, issuer: issuer, key: key}
+}
+
+// MFAKey derives the key TOTP secrets are encrypted with from the server
+// secret. Changing jwt_secret leaves existing enrollments unreadable; they
+// have to be reset.
+func MFAKey(secret string) []byte {
+	return auth.DeriveKey(secret, "mfa-secret")
+}
+
+// Status returns the MFA setup of the record.
+func (s *MFAService) Status(ctx context.Context, record *models.Record) (*MFAStatus, error) {
+	enrollment, err := s.enrollment(ctx, record.Collection, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Required: s.collectionRequires(record.Collection)}
+	if enrollment != nil && isTruthy(enrollment.Data["enabled"]) {
+		status.Enabled = true
+		status.RecoveryCodesRemaining = len(stringList(enrollment.Data["recovery_codes"]))
+	}
+	return status, nil
+}
+
+// Challenge starts the second login step when the record has MFA enabled or
+// its collection requires MFA. It returns nil when no second step is needed.
+func (s *MFAService) Challenge(ctx context.Context, record *models.Record) (*MFAChallenge, error) {
+	status, err := s.Status(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Enabled && !status.Required {
+		return nil, nil
+	}
+
+	if err := s.deleteChallenges(ctx, record); err != nil {
+		return nil, err
+	}
+
+	token, err := auth.GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(MFAChallengeTTL).UTC().Format(time.RFC3339)
+	_, err = s.records.CreateRecord(ctx, models.AuthTokensCollection, map[string]any{
+		"token_hash": auth.HashToken(token),
+		"type":       TokenTypeMFAChallenge,
+		"collection": record.Collection,
+		"record_id":  record.ID,
+		"email":      record.GetString("email"),
+		"expires":    expires,
+		"attempts":   0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{Token: token, Enrolled: status.Enabled, Expires: expires}, nil
+}
+
+// ChallengeRecord returns the record an unexpired challenge was issued to.
+// Records that must enroll use it to authorize the enrollment.
+func (s *MFAService) ChallengeRecord(ctx context.Context, collection, token string) (*models.Record, error) {
+	challenge, err := s.findChallenge(ctx, collection, token)
+	if err != nil {
+		return nil, err
+	}
+	record, err := s.records.FindRecordByID(ctx, collection, challenge.GetString("record_id"))
+	if err != nil {
+		return nil, invalidMFATokenError()
+	}
+	return record, nil
+}
+
+// CompleteChallenge checks the code or recovery code for a challenge and
+// returns the record to sign in. A record that enrolled during the
+// challenge is activated by its first code, and its recovery codes are
+// returned. Each attempt counts towards MFAChallengeAttempts, and each
+// wrong code also counts as a failed login of the record.
+func (s *MFAService) CompleteChallenge(ctx context.Context, collection, token, code, recoveryCode string) (*models.Record, []string, error) {
+	challenge, err := s.findChallenge(ctx, collection, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The attempt is claimed before the code is checked, so that concurrent
+	// guesses cannot exceed the limit.
+	claimed, err := s.records.IncrementRecord(ctx, models.AuthTokensCollection, challenge.ID, "attempts", MFAChallengeAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !claimed {
+		_ = s.records.DeleteRecord(ctx, models.AuthTokensCollection, challenge.ID)
+		return nil, nil, invalidMFATokenError()
+	}
+	record, err := s.records.FindRecordByID(ctx, collection, challenge.GetString("record_id"))
+	if err != nil {
+		return nil, nil, invalidMFATokenError()
+	}
+
+	enrollment, err := s.enrollment(ctx, collection, record.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recoveryCodes []string
+	switch {
+	case enrollment != nil && isTruthy(enrollment.Data["enabled"]):
+		err = s.verify(ctx, enrollment, code, recoveryCode)
+	case enrollment != nil && code != "":
+		recoveryCodes, err = s.activate(ctx, enrollment, code)
+	default:
+		return nil, nil, errors.NewError(http.StatusBadRequest, "MFA_NOT_ENROLLED", "Enroll an authenticator before completing the login")
+	}
+
+	if err != nil {
+		if challenge.GetInt("attempts")+1 >= MFAChallengeAttempts {
+			_ = s.records.DeleteRecord(ctx, models.AuthTokensCollection, challenge.ID)
+		}
+		if s.lockouts != nil {
+			if lockErr := s.lockouts.Fail(ctx, collection, mfaIdentity(record), ""); lockErr != nil {
+				errors.Log(ctx, lockErr, "count failed mfa code")
+			}
+		}
+		return nil, nil, err
+	}
+
+	if err := s.records.DeleteRecord(ctx, models.AuthTokensCollection, challenge.ID); err != nil {
+		return nil, nil, err
+	}
+	return record, recoveryCodes, nil
+}
+
+// Enroll creates a new TOTP secret for the record, replacing an enrollment
+// that was never confirmed.
+func (s *MFAService) Enroll(ctx context.Context, record *models.Record) (*MFAEnrollment, error) {
+	enrollment, err := s.enrollment(ctx, record.Collection, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment != nil && isTruthy(enrollment.Data["enabled"]) {
+		return nil, errors.NewError(http.StatusConflict, "MFA_ALREADY_ENABLED", "MFA is already enabled; disable it before enrolling again")
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := auth.SealSecret(s.key, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{
+		"collection":     record.Collection,
+		"record_id":      record.ID,
+		"secret":         sealed,
+		"enabled":        false,
+		"recovery_codes": "[]",
+		"last_step":      0,
+	}
+	if enrollment != nil {
+		_, err = s.records.UpdateRecord(ctx, models.MFACollection, enrollment.ID, data)
+	} else {
+		_, err = s.records.CreateRecord(ctx, models.MFACollection, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account := record.GetString("email")
+	if account == "" {
+		account = record.GetString("username")
+	}
+	return &MFAEnrollment{Secret: secret, URI: auth.TOTPProvisioningURI(s.issuer, account, secret)}, nil
+}
+
+// Activate confirms the pending enrollment with a code, enables MFA and
+// returns the recovery codes, which are only shown this once.
+func (s *MFAService) Activate(ctx context.Context, record *models.Record, code string) ([]string, error) {
+	enrollment, err := s.enrollment(ctx, record.Collection, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		return nil, errors.NewError(http.StatusBadRequest, "MFA_NOT_ENROLLED", "Enroll an authenticator first")
+	}
+	if isTruthy(enrollment.Data["enabled"]) {
+		return nil, errors.NewError(http.StatusConflict, "MFA_ALREADY_ENABLED", "MFA is already enabled")
+	}
+	return s.activate(ctx, enrollment, code)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, record *models.Record, code string) ([]string, error) {
+	enrollment, err := s.enabledEnrollment(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verify(ctx, enrollment, code, ""); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, enrollment, nil)
+}
+
+// Disable turns MFA off after checking a code or recovery code. Records of
+// collections that require MFA cannot disable it.
+func (s *MFAService) Disable(ctx context.Context, record *models.Record, code, recoveryCode string) error {
+	if s.collectionRequires(record.Collection) {
+		return errors.NewError(http.StatusForbidden, "MFA_REQUIRED", "This collection requires MFA")
+	}
+	enrollment, err := s.enabledEnrollment(ctx, record)
+	if err != nil {
+		return err
+	}
+	if err := s.verify(ctx, enrollment, code, recoveryCode); err != nil {
+		return err
+	}
+	return s.records.DeleteRecord(ctx, models.MFACollection, enrollment.ID)
+}
+
+// Reset removes the record's enrollment without a code, for records that
+// lost their authenticator and recovery codes. It reports whether there was
+// anything to remove.
+func (s *MFAService) Reset(ctx context.Context, collection, recordID string) (bool, error) {
+	enrollment, err := s.enrollment(ctx, collection, recordID)
+	if err != nil || enrollment == nil {
+		return false, err
+	}
+	return true, s.records.DeleteRecord(ctx, models.MFACollection, enrollment.ID)
+}
+
+func (s *MFAService) activate(ctx context.Context, enrollment *models.Record, code string) ([]string, error) {
+	step, ok := s.validateCode(enrollment, code)
+	if !ok {
+		return nil, invalidMFACodeError()
+	}
+	return s.newRecoveryCodes(ctx, enrollment, map[string]any{"enabled": true, "last_step": step})
+}
+
+// verify accepts a TOTP code, or else consumes a recovery code.
+func (s *MFAService) verify(ctx context.Context, enrollment *models.Record, code, recoveryCode string) error {
+	if code != "" {
+		step, ok := s.validateCode(enrollment, code)
+		if !ok {
+			return invalidMFACodeError()
+		}
+		_, err := s.records.UpdateRecord(ctx, models.MFACollection, enrollment.ID, map[string]any{"last_step": step})
+		return err
+	}
+
+	if recoveryCode == "" {
+		return invalidMFACodeError()
+	}
+	hashes := stringList(enrollment.Data["recovery_codes"])
+	hash := auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode))
+	index := slices.Index(hashes, hash)
+	if index < 0 {
+		return invalidMFACodeError()
+	}
+	encoded, _ := json.Marshal(slices.Delete(hashes, index, index+1))
+	_, err := s.records.UpdateRecord(ctx, models.MFACollection, enrollment.ID, map[string]any{"recovery_codes": string(encoded)})
+	return err
+}
+
+// validateCode checks a TOTP code against the enrollment's secret and
+// returns its time step. Secrets that cannot be decrypted match no code.
+func (s *MFAService) validateCode(enrollment *models.Record, code string) (int64, bool) {
+	secret, err := auth.OpenSecret(s.key, enrollment.GetString("secret"))
+	if err != nil {
+		slog.Warn("Failed to decrypt MFA secret", "collection", enrollment.GetString("collection"), "record_id", enrollment.GetString("record_id"), "error", err)
+		return 0, false
+	}
+	return auth.ValidateTOTP(secret, code, time.Now(), int64(enrollment.GetInt("last_step")))
+}
+
+func (s *MFAService) newRecoveryCodes(ctx context.Context, enrollment *models.Record, data map[string]any) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+	encoded, _ := json.Marshal(hashes)
+
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["recovery_codes"] = string(encoded)
+	if _, err := s.records.UpdateRecord(ctx, models.MFACollection, enrollment.ID, data); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *MFAService) enrollment(ctx context.Context, collection, recordID string) (*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.MFACollection, db.QueryParams{
+		Filter:  "record_id = " + db.QuoteFilterValue(recordID) + " && collection = " + db.QuoteFilterValue(collection),
+		PerPage: 1,
+	})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+func (s *MFAService) enabledEnrollment(ctx context.Context, record *models.Record) (*models.Record, error) {
+	enrollment, err := s.enrollment(ctx, record.Collection, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil || !isTruthy(enrollment.Data["enabled"]) {
+		return nil, errors.NewError(http.StatusBadRequest, "MFA_NOT_ENABLED", "MFA is not enabled")
+	}
+	return enrollment, nil
+}
+
+func (s *MFAService) collectionRequires(collection string) bool {
+	col, ok := s.records.Lookup().Collection(collection)
+	return ok && col.Options.MFARequired
+}
+
+func (s *MFAService) findChallenge(ctx context.Context, collection, token string) (*models.Record, error) {
+	if token == "" {
+		return nil, invalidMFATokenError()
+	}
+	records, _, err := s.records.ListRecords(ctx, models.AuthTokensCollection, db.QueryParams{Filter: "token_hash = " + db.QuoteFilterValue(auth.HashToken(token)), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, invalidMFATokenError()
+	}
+
+	challenge := records[0]
+	if challenge.GetString("type") != TokenTypeMFAChallenge || challenge.GetString("collection") != collection {
+		return nil, invalidMFATokenError()
+	}
+	expires, err := time.Parse(time.RFC3339, challenge.GetString("expires"))
+	if err != nil || time.Now().After(expires) {
+		_ = s.records.DeleteRecord(ctx, models.AuthTokensCollection, challenge.ID)
+		return nil, invalidMFATokenError()
+	}
+	return challenge, nil
+}
+
+func (s *MFAService) deleteChallenges(ctx context.Context, record *models.Record) error {
+	records, _, err := s.records.ListRecords(ctx, models.AuthTokensCollection, db.QueryParams{
+		Filter:  "record_id = " + db.QuoteFilterValue(record.ID) + " && type = " + db.QuoteFilterValue(TokenTypeMFAChallenge),
+		PerPage: 100,
+	})
+	if err != nil {
+		return err
+	}
+	for _, challenge := range records {
+		if challenge.GetString("collection") != record.Collection {
+			continue
+		}
+		if err := s.records.DeleteRecord(ctx, models.AuthTokensCollection, challenge.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mfaIdentity is the identity failed codes are counted against, matching
+// the one password logins of the record count against.
+func mfaIdentity(record *models.Record) string {
+	if email := record.GetString("email"); email != "" {
+		return email
+	}
+	return record.GetString("username")
+}
+
+func invalidMFACodeError() error {
+	return errors.NewError(http.StatusUnauthorized, "INVALID_MFA_CODE", "Invalid authentication code")
+}
+
+func invalidMFATokenError() error {
+	return errors.NewError(http.StatusUnauthorized, "INVALID_MFA_TOKEN", "Invalid or expired MFA token")
+}
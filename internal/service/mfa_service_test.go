@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+func TestMFAChallenge(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	mfa := NewMFAService(records, nil, MFAIssuer, MFAKey("secret"))
+
+	record, err := records.CreateRecord(ctx, "users", map[string]any{"username": "jane", "email": "jane@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if challenge, err := mfa.Challenge(ctx, record); err != nil || challenge != nil {
+		t.Fatalf("expected no challenge before enrollment, got %v %v", challenge, err)
+	}
+
+	enrollment, err := mfa.Enroll(ctx, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := mfa.enrollment(ctx, "users", record.ID); stored == nil || strings.Contains(stored.GetString("secret"), enrollment.Secret) {
+		t.Errorf("expected the secret to be stored encrypted, got %v", stored)
+	}
+	code := func(offset int64) string {
+		c, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now())+offset)
+		return c
+	}
+
+	if _, err := mfa.Activate(ctx, record, "000000"); errorCode(err) != "INVALID_MFA_CODE" {
+		t.Fatalf("expected a wrong code to be rejected, got %v", err)
+	}
+	recoveryCodes, err := mfa.Activate(ctx, record, code(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveryCodes) != RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", RecoveryCodeCount, len(recoveryCodes))
+	}
+
+	challenge, err := mfa.Challenge(ctx, record)
+	if err != nil || challenge == nil || !challenge.Enrolled {
+		t.Fatalf("expected a challenge once enrolled, got %v %v", challenge, err)
+	}
+
+	// The code that activated the enrollment cannot be replayed.
+	if _, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, code(-1), ""); errorCode(err) != "INVALID_MFA_CODE" {
+		t.Errorf("expected a used code to be rejected, got %v", err)
+	}
+	signedIn, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, code(0), "")
+	if err != nil || signedIn.ID != record.ID {
+		t.Fatalf("expected the challenge to complete, got %v", err)
+	}
+	if _, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, code(1), ""); errorCode(err) != "INVALID_MFA_TOKEN" {
+		t.Errorf("expected a completed challenge to be spent, got %v", err)
+	}
+
+	// Recovery codes work once.
+	challenge, _ = mfa.Challenge(ctx, record)
+	if _, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, "", recoveryCodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ = mfa.Challenge(ctx, record)
+	if _, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, "", recoveryCodes[0]); errorCode(err) != "INVALID_MFA_CODE" {
+		t.Errorf("expected a used recovery code to be rejected, got %v", err)
+	}
+
+	// Wrong codes end the challenge after MFAChallengeAttempts.
+	for i := 1; i < MFAChallengeAttempts; i++ {
+		_, _, _ = mfa.CompleteChallenge(ctx, "users", challenge.Token, "000000", "")
+	}
+	if _, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, code(1), ""); errorCode(err) != "INVALID_MFA_TOKEN" {
+		t.Errorf("expected the challenge to end after too many attempts, got %v", err)
+	}
+
+	if removed, err := mfa.Reset(ctx, "users", record.ID); err != nil || !removed {
+		t.Fatalf("expected reset to remove the enrollment, got %v %v", removed, err)
+	}
+}
+
+func TestMFAChallengeAttempts(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	lockouts := NewLockoutService(records, &core.Config{LoginMaxAttempts: 100, LoginLockoutMinutes: 15})
+	mfa := NewMFAService(records, lockouts, MFAIssuer, MFAKey("secret"))
+
+	record, err := records.CreateRecord(ctx, "users", map[string]any{"username": "jane", "email": "jane@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := mfa.Enroll(ctx, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	if _, err := mfa.Activate(ctx, record, code); err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := mfa.Challenge(ctx, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent guesses cannot check more codes than the challenge allows.
+	var wg sync.WaitGroup
+	var checked atomic.Int32
+	for range 3 * MFAChallengeAttempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, "000000", "")
+			switch errorCode(err) {
+			case "INVALID_MFA_CODE":
+				checked.Add(1)
+			case "INVALID_MFA_TOKEN":
+			default:
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := checked.Load(); n == 0 || n > MFAChallengeAttempts {
+		t.Errorf("expected at most %d codes to be checked, got %d", MFAChallengeAttempts, n)
+	}
+
+	// Each wrong code counted as a failed login of the identity.
+	counters, err := lockouts.List(ctx, false)
+	if err != nil || len(counters) != 1 || counters[0].Subject != "jane@example.com" || int32(counters[0].Failures) != checked.Load() {
+		t.Errorf("expected %d failed logins, got %+v %v", checked.Load(), counters, err)
+	}
+}
+
+func TestMFARequiredEnrollment(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	mfa := NewMFAService(records, nil, MFAIssuer, MFAKey("secret"))
+
+	users, _ := records.Lookup().Collection("users")
+	users.Options.MFARequired = true
+
+	record, err := records.CreateRecord(ctx, "users", map[string]any{"username": "jane", "email": "jane@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := mfa.Challenge(ctx, record)
+	if err != nil || challenge == nil || challenge.Enrolled {
+		t.Fatalf("expected an enrollment challenge, got %v %v", challenge, err)
+	}
+
+	// The challenge token authorizes enrolling, and the first code
+	// activates the enrollment and completes the login.
+	owner, err := mfa.ChallengeRecord(ctx, "users", challenge.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := mfa.Enroll(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	signedIn, recoveryCodes, err := mfa.CompleteChallenge(ctx, "users", challenge.Token, code, "")
+	if err != nil || signedIn.ID != record.ID || len(recoveryCodes) != RecoveryCodeCount {
+		t.Fatalf("expected the enrollment to complete the login, got %v", err)
+	}
+
+	if err := mfa.Disable(ctx, record, code, ""); errorCode(err) != "MFA_REQUIRED" {
+		t.Errorf("expected required MFA not to be disabled, got %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// OAuthProviderInfo is what a client needs to send a user to a provider.
+// The client keeps State and CodeVerifier until the provider redirects back.
+type OAuthProviderInfo struct {
+	Name                string `json:"name"`
+	DisplayName         string `json:"display_name"`
+	State               string `json:"state"`
+	CodeVerifier        string `json:"code_verifier"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	AuthURL             string `json:"auth_url"`
+}
+
+// OAuthResult is the record a provider sign-in resolved to.
+type OAuthResult struct {
+	Record   *models.Record
+	Identity *auth.OAuthIdentity
+	IsNew    bool
+}
+
+// OAuthService signs users of auth collections in through OAuth2 and OpenID
+// Connect providers. Provider accounts are linked to records in the
+// identities collection; an unknown account is linked to the record with the
+// same verified email, or a new record is created for it.
+type OAuthService struct {
+	records    *RecordService
+	config     *core.Config
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	clients map[string]*auth.OAuthClient
+}
+
+func NewOAuthService(records *RecordService, config *core.Config, httpClient *http.Client) *OAuthService {
+	return &OAuthService{
+		records:    records,
+		config:     config,
+		httpClient: httpClient,
+		clients:    make(map[string]*auth.OAuthClient),
+	}
+}
+
+// AuthMethods returns the providers enabled for the collection, each with a
+// fresh state and PKCE pair. Providers that cannot be reached are skipped.
+func (s *OAuthService) AuthMethods(ctx context.Context, collection, redirectURL string) ([]OAuthProviderInfo, error) {
+	methods := make([]OAuthProviderInfo, 0)
+	for _, provider := range s.config.OAuthProviders {
+		if !providerEnabled(provider, collection) {
+			continue
+		}
+
+		state, err := auth.GenerateSecureToken()
+		if err != nil {
+			return nil, err
+		}
+		verifier, challenge, err := auth.NewPKCE()
+		if err != nil {
+			return nil, err
+		}
+
+		authURL, err := s.client(provider).AuthCodeURL(ctx, state, verifier, redirectURL)
+		if err != nil {
+			slog.Warn("OAuth2 provider unavailable", "provider", provider.Name, "error", err)
+			continue
+		}
+
+		displayName := provider.DisplayName
+		if displayName == "" {
+			displayName = provider.Name
+		}
+		methods = append(methods, OAuthProviderInfo{
+			Name:                provider.Name,
+			DisplayName:         displayName,
+			State:               state,
+			CodeVerifier:        verifier,
+			CodeChallenge:       challenge,
+			CodeChallengeMethod: "S256",
+			AuthURL:             authURL,
+		})
+	}
+	return methods, nil
+}
+
+// Authenticate redeems the authorization code the provider redirected back
+// with and returns the record of the collection it signs in. canCreate is
+// asked before a new record is created for an unknown account.
+func (s *OAuthService) Authenticate(ctx context.Context, collection, providerName, code, verifier, redirectURL string, canCreate func(data map[string]any) bool) (*OAuthResult, error) {
+	provider, identity, err := s.exchange(ctx, collection, providerName, code, verifier, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OAuthResult{Identity: identity}
+
+	link, err := s.findLink(ctx, collection, provider.Name, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil {
+		record, err := s.records.FindRecordByID(ctx, collection, link.GetString("record_id"))
+		if err == nil {
+			result.Record = record
+			return result, nil
+		}
+		// The record was deleted; the stale link is replaced below.
+		if err := s.records.DeleteRecord(ctx, models.IdentitiesCollection, link.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if identity.Email != "" {
+		records, _, err := s.records.ListRecords(ctx, collection, db.QueryParams{Filter: "email = " + db.QuoteFilterValue(identity.Email), PerPage: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			// Linking on an unverified email would let anyone who registers
+			// the address at the provider take over the record.
+			if !identity.EmailVerified {
+				return nil, errors.NewError(http.StatusConflict, "OAUTH_EMAIL_IN_USE", "A record with this email exists; sign in and link the provider instead")
+			}
+			result.Record = records[0]
+		}
+	}
+
+	if result.Record == nil {
+		record, err := s.createRecord(ctx, collection, identity, canCreate)
+		if err != nil {
+			return nil, err
+		}
+		result.Record = record
+		result.IsNew = true
+	}
+
+	if err := s.link(ctx, collection, provider.Name, identity, result.Record.ID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Link redeems the authorization code like Authenticate, and links the
+// provider account to the record instead of signing in. It returns the
+// identity, which may already have been linked to the record. Accounts
+// linked to another record are refused.
+func (s *OAuthService) Link(ctx context.Context, collection, recordID, providerName, code, verifier, redirectURL string) (*models.Record, error) {
+	provider, identity, err := s.exchange(ctx, collection, providerName, code, verifier, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := s.findLink(ctx, collection, provider.Name, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil {
+		if link.GetString("record_id") == recordID {
+			return link, nil
+		}
+		if _, err := s.records.FindRecordByID(ctx, collection, link.GetString("record_id")); err == nil {
+			return nil, errors.NewError(http.StatusConflict, "OAUTH_IDENTITY_IN_USE", "This provider account is linked to another record")
+		}
+		if err := s.records.DeleteRecord(ctx, models.IdentitiesCollection, link.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.link(ctx, collection, provider.Name, identity, recordID); err != nil {
+		return nil, err
+	}
+	return s.findLink(ctx, collection, provider.Name, identity.Subject)
+}
+
+// ListIdentities returns the provider accounts linked to the record.
+func (s *OAuthService) ListIdentities(ctx context.Context, collection, recordID string) ([]*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.IdentitiesCollection, db.QueryParams{
+		Filter:  "record_id = " + db.QuoteFilterValue(recordID) + " && collection = " + db.QuoteFilterValue(collection),
+		PerPage: 100,
+	})
+	return records, err
+}
+
+// Unlink removes a provider account from the record.
+func (s *OAuthService) Unlink(ctx context.Context, collection, recordID, identityID string) error {
+	identities, err := s.ListIdentities(ctx, collection, recordID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(identities, func(r *models.Record) bool { return r.ID == identityID }) {
+		return errors.NewError(http.StatusNotFound, "IDENTITY_NOT_FOUND", "Identity not found")
+	}
+	return s.records.DeleteRecord(ctx, models.IdentitiesCollection, identityID)
+}
+
+func (s *OAuthService) client(provider core.OAuthProvider) *auth.OAuthClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Settings updates replace the provider config; a changed provider
+	// gets a fresh client and discovery.
+	if client, ok := s.clients[provider.Name]; ok && sameProvider(client.Provider(), provider) {
+		return client
+	}
+	client := auth.NewOAuthClient(provider, s.httpClient)
+	s.clients[provider.Name] = client
+	return client
+}
+
+// exchange redeems the authorization code with a provider enabled for the
+// collection and returns the account it identifies.
+func (s *OAuthService) exchange(ctx context.Context, collection, providerName, code, verifier, redirectURL string) (core.OAuthProvider, *auth.OAuthIdentity, error) {
+	provider, ok := s.config.OAuthProvider(providerName)
+	if !ok || !providerEnabled(provider, collection) {
+		return provider, nil, errors.NewError(http.StatusBadRequest, "OAUTH_PROVIDER_NOT_FOUND", "OAuth2 provider is not enabled for this collection")
+	}
+	if code == "" || verifier == "" {
+		return provider, nil, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(map[string]any{
+			"code":          "required",
+			"code_verifier": "required",
+		})
+	}
+
+	identity, err := s.client(provider).Exchange(ctx, code, verifier, redirectURL)
+	if err != nil {
+		slog.Warn("OAuth2 sign-in failed", "provider", provider.Name, "collection", collection, "error", err)
+		return provider, nil, errors.NewError(http.StatusUnauthorized, "OAUTH_FAILED", "Failed to authenticate with the OAuth2 provider")
+	}
+	return provider, identity, nil
+}
+
+func (s *OAuthService) findLink(ctx context.Context, collection, provider, subject string) (*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.IdentitiesCollection, db.QueryParams{
+		Filter:  "provider = " + db.QuoteFilterValue(provider) + " && provider_id = " + db.QuoteFilterValue(subject) + " && collection = " + db.QuoteFilterValue(collection),
+		PerPage: 1,
+	})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+func (s *OAuthService) link(ctx context.Context, collection, provider string, identity *auth.OAuthIdentity, recordID string) error {
+	_, err := s.records.CreateRecord(ctx, models.IdentitiesCollection, map[string]any{
+		"provider":    provider,
+		"provider_id": identity.Subject,
+		"collection":  collection,
+		"record_id":   recordID,
+		"email":       identity.Email,
+	})
+	return err
+}
+
+func (s *OAuthService) createRecord(ctx context.Context, collection string, identity *auth.OAuthIdentity, canCreate func(data map[string]any) bool) (*models.Record, error) {
+	if identity.Email == "" {
+		return nil, errors.NewError(http.StatusBadRequest, "OAUTH_EMAIL_REQUIRED", "The OAuth2 provider did not share an email address")
+	}
+
+	username, err := s.uniqueUsername(ctx, collection, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The record gets an unguessable password; it can sign in with a
+	// password after a password reset.
+	password, err := auth.GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{
+		"username":  username,
+		"email":     identity.Email,
+		"password":  password,
+		"verified":  identity.EmailVerified,
+		"lastLogin": time.Now().Format(time.RFC3339),
+	}
+	if canCreate != nil && !canCreate(data) {
+		return nil, errors.NewError(http.StatusForbidden, "FORBIDDEN", "Registration is not allowed for this collection")
+	}
+
+	return s.records.CreateRecord(ctx, collection, data)
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// uniqueUsername derives a username from the provider account, adding a
+// numeric suffix when it is taken.
+func (s *OAuthService) uniqueUsername(ctx context.Context, collection string, identity *auth.OAuthIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameUnsafe.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", base, i+1)
+		}
+		records, _, err := s.records.ListRecords(ctx, collection, db.QueryParams{Filter: "username = " + db.QuoteFilterValue(candidate), PerPage: 1})
+		if err != nil {
+			return "", err
+		}
+		if len(records) == 0 {
+			return candidate, nil
+		}
+	}
+
+	suffix, err := auth.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	return base + suffix[:8], nil
+}
+
+func providerEnabled(provider core.OAuthProvider, collection string) bool {
+	return len(provider.Collections) == 0 || slices.Contains(provider.Collections, collection)
+}
+
+func sameProvider(a, b core.OAuthProvider) bool {
+	return a.Issuer == b.Issuer && a.ClientID == b.ClientID && a.ClientSecret == b.ClientSecret &&
+		a.AuthURL == b.AuthURL && a.TokenURL == b.TokenURL && a.UserInfoURL == b.UserInfoURL &&
+		a.JWKSURL == b.JWKSURL && slices.Equal(a.Scopes, b.Scopes)
+}
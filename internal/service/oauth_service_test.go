@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+// fakeOIDC is a stand-in OpenID Connect provider. Authorize plays the part
+// of the user approving the sign-in and returns the code the provider would
+// redirect back with.
+type fakeOIDC struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakeOIDC{key: key, codes: make(map[string]fakeGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeOIDC) Authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != "vault" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code, _ := auth.GenerateSecureToken()
+	p.mu.Lock()
+	p.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri"), claims: claims}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *fakeOIDC) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || r.PostForm.Get("client_secret") != "secret" || r.PostForm.Get("redirect_uri") != grant.redirectURI ||
+		auth.PKCEChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   "vault",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, _ := token.SignedString(p.key)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+func TestOAuthAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeOIDC(t)
+	records := newTestRecordService(t)
+	oauth := NewOAuthService(records, &core.Config{OAuthProviders: []core.OAuthProvider{{
+		Name:         "fake",
+		Issuer:       provider.URL,
+		ClientID:     "vault",
+		ClientSecret: "secret",
+	}}}, nil)
+
+	const redirect = "http://localhost/callback"
+	signIn := func(claims jwt.MapClaims, tamper bool) (*OAuthResult, error) {
+		methods, err := oauth.AuthMethods(ctx, "users", redirect)
+		if err != nil || len(methods) != 1 {
+			t.Fatalf("expected the fake provider, got %v %v", methods, err)
+		}
+		code := provider.Authorize(t, methods[0].AuthURL, claims)
+		verifier := methods[0].CodeVerifier
+		if tamper {
+			verifier += "x"
+		}
+		return oauth.Authenticate(ctx, "users", "fake", code, verifier, redirect, nil)
+	}
+
+	alice := jwt.MapClaims{"sub": "alice-1", "email": "alice@example.com", "email_verified": true, "preferred_username": "alice"}
+	first, err := signIn(alice, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.IsNew || first.Record.GetString("username") != "alice" || !isTruthy(first.Record.Data["verified"]) {
+		t.Fatalf("expected a new verified record, got %+v", first.Record.Data)
+	}
+
+	again, err := signIn(alice, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.IsNew || again.Record.ID != first.Record.ID {
+		t.Errorf("expected the linked record on the second sign-in")
+	}
+
+	if _, err := signIn(alice, true); errorCode(err) != "OAUTH_FAILED" {
+		t.Errorf("expected a wrong code verifier to fail, got %v", err)
+	}
+
+	// A verified email links to the existing record instead of creating one.
+	existing, err := records.CreateRecord(ctx, "users", map[string]any{"username": "bob", "email": "bob@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := signIn(jwt.MapClaims{"sub": "bob-1", "email": "bob@example.com", "email_verified": true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.IsNew || linked.Record.ID != existing.ID {
+		t.Errorf("expected the record with the verified email to be linked")
+	}
+
+	if _, err := signIn(jwt.MapClaims{"sub": "mallory-1", "email": "bob@example.com"}, false); errorCode(err) != "OAUTH_EMAIL_IN_USE" {
+		t.Errorf("expected an unverified email not to be linked, got %v", err)
+	}
+
+	identities, err := oauth.ListIdentities(ctx, "users", existing.ID)
+	if err != nil || len(identities) != 1 {
+		t.Fatalf("expected one identity, got %d %v", len(identities), err)
+	}
+	if err := oauth.Unlink(ctx, "users", first.Record.ID, identities[0].ID); errorCode(err) != "IDENTITY_NOT_FOUND" {
+		t.Errorf("expected another record's identity not to be unlinked, got %v", err)
+	}
+	if err := oauth.Unlink(ctx, "users", existing.ID, identities[0].ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuthLink(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeOIDC(t)
+	records := newTestRecordService(t)
+	oauth := NewOAuthService(records, &core.Config{OAuthProviders: []core.OAuthProvider{{
+		Name:         "fake",
+		Issuer:       provider.URL,
+		ClientID:     "vault",
+		ClientSecret: "secret",
+	}}}, nil)
+
+	const redirect = "http://localhost/callback"
+	authorize := func(claims jwt.MapClaims) (string, string) {
+		methods, err := oauth.AuthMethods(ctx, "users", redirect)
+		if err != nil || len(methods) != 1 {
+			t.Fatalf("expected the fake provider, got %v %v", methods, err)
+		}
+		return provider.Authorize(t, methods[0].AuthURL, claims), methods[0].CodeVerifier
+	}
+
+	bob, err := records.CreateRecord(ctx, "users", map[string]any{"username": "bob", "email": "bob@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := records.CreateRecord(ctx, "users", map[string]any{"username": "carol", "email": "carol@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider does not verify the email, so signing in is refused...
+	account := jwt.MapClaims{"sub": "bob-1", "email": "bob@example.com"}
+	code, verifier := authorize(account)
+	if _, err := oauth.Authenticate(ctx, "users", "fake", code, verifier, redirect, nil); errorCode(err) != "OAUTH_EMAIL_IN_USE" {
+		t.Fatalf("expected an unverified email not to be linked, got %v", err)
+	}
+
+	// ...but the signed-in record can link the account itself.
+	code, verifier = authorize(account)
+	identity, err := oauth.Link(ctx, "users", bob.ID, "fake", code, verifier, redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.GetString("record_id") != bob.ID || identity.GetString("provider_id") != "bob-1" {
+		t.Fatalf("expected the account to be linked to bob, got %+v", identity.Data)
+	}
+	code, verifier = authorize(account)
+	result, err := oauth.Authenticate(ctx, "users", "fake", code, verifier, redirect, nil)
+	if err != nil || result.Record.ID != bob.ID {
+		t.Fatalf("expected the linked account to sign bob in, got %v", err)
+	}
+
+	code, verifier = authorize(account)
+	if again, err := oauth.Link(ctx, "users", bob.ID, "fake", code, verifier, redirect); err != nil || again.ID != identity.ID {
+		t.Errorf("expected linking twice to return the identity, got %v", err)
+	}
+	code, verifier = authorize(account)
+	if _, err := oauth.Link(ctx, "users", carol.ID, "fake", code, verifier, redirect); errorCode(err) != "OAUTH_IDENTITY_IN_USE" {
+		t.Errorf("expected another record's account not to be linked, got %v", err)
+	}
+	if _, err := oauth.Link(ctx, "users", carol.ID, "fake", "wrong", verifier, redirect); errorCode(err) != "OAUTH_FAILED" {
+		t.Errorf("expected a wrong code to fail, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+// QuarantineDir is the storage directory holding quarantined uploads.
+const QuarantineDir = "_quarantine"
+
+// QuarantinePath returns the storage path of a quarantined upload.
+func QuarantinePath(id string) string {
+	return QuarantineDir + "/" + id
+}
+
+// QuarantineService lets admins review the uploads FileService quarantined,
+// and either release them to the record they were uploaded to or delete
+// them.
+type QuarantineService struct {
+	records *RecordService
+	files   *FileService
+	store   storage.Storage
+}
+
+func NewQuarantineService(records *RecordService, files *FileService, store storage.Storage) *QuarantineService {
+	return &QuarantineService{records: records, files: files, store: store}
+}
+
+// List returns the quarantined uploads, the latest first, of the collection
+// or of every collection when it is empty.
+func (s *QuarantineService) List(ctx context.Context, collection string) ([]*models.QuarantinedFile, error) {
+	params := db.QueryParams{Sort: "-created", Page: 1, PerPage: 500}
+	if collection != "" {
+		params.Filter = "collection = " + db.QuoteFilterValue(collection)
+	}
+	files := []*models.QuarantinedFile{}
+	for {
+		records, total, err := s.records.ListRecords(ctx, models.QuarantineCollection, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			files = append(files, quarantinedFile(record))
+		}
+		if len(records) == 0 || params.Page*params.PerPage >= total {
+			return files, nil
+		}
+		params.Page++
+	}
+}
+
+// Get returns a quarantined upload.
+func (s *QuarantineService) Get(ctx context.Context, id string) (*models.QuarantinedFile, error) {
+	record, err := s.records.FindRecordByID(ctx, models.QuarantineCollection, id)
+	if err != nil {
+		return nil, errors.NewError(http.StatusNotFound, "QUARANTINE_NOT_FOUND", "Quarantined file not found")
+	}
+	return quarantinedFile(record), nil
+}
+
+// Open returns the content of a quarantined upload.
+func (s *QuarantineService) Open(ctx context.Context, file *models.QuarantinedFile) (io.ReadCloser, error) {
+	return s.store.Retrieve(ctx, QuarantinePath(file.ID))
+}
+
+// Release attaches a quarantined upload to its field on the record it was
+// uploaded to, or on the record of the same collection recordID names,
+// without scanning it again, and returns the updated record. Uploads sent
+// with a new record, which was not created, can only be released to another
+// one. The field must still accept the file, as for a new upload. admin
+// identifies who released it in the audit log.
+func (s *QuarantineService) Release(ctx context.Context, file *models.QuarantinedFile, recordID, admin string) (*models.Record, error) {
+	if recordID != "" {
+		released := *file
+		released.RecordID = recordID
+		file = &released
+	}
+	col, ok := s.records.repo.Collection(file.Collection)
+	if !ok {
+		return nil, quarantineRecordMissing(file)
+	}
+	existing, err := s.records.FindRecordByID(ctx, col.Name, file.RecordID)
+	if err != nil {
+		return nil, quarantineRecordMissing(file)
+	}
+
+	source := fileSource{
+		filename: file.Filename,
+		size:     file.Size,
+		open:     func() (io.ReadCloser, error) { return s.Open(ctx, file) },
+		trusted:  true,
+	}
+	data := make(map[string]any)
+	changes, err := s.files.prepare(col, existing, data, map[string][]fileSource{file.Field: {source}})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.files.Save(ctx, col.Name, file.RecordID, file.Owner, changes); err != nil {
+		return nil, err
+	}
+	record, err := s.records.UpdateRecord(ctx, col.Name, file.RecordID, data)
+	if err != nil {
+		s.files.Discard(ctx, col.Name, file.RecordID, changes)
+		return nil, err
+	}
+	s.files.Commit(ctx, col.Name, file.RecordID, changes)
+
+	if err := s.remove(ctx, file); err != nil {
+		errors.Log(ctx, err, "delete released quarantine entry", "id", file.ID)
+	}
+	s.audit(ctx, "quarantine_released", file, admin)
+	return record, nil
+}
+
+// Delete removes a quarantined upload for good. admin identifies who deleted
+// it in the audit log.
+func (s *QuarantineService) Delete(ctx context.Context, file *models.QuarantinedFile, admin string) error {
+	if err := s.remove(ctx, file); err != nil {
+		return err
+	}
+	s.audit(ctx, "quarantine_deleted", file, admin)
+	return nil
+}
+
+func (s *QuarantineService) remove(ctx context.Context, file *models.QuarantinedFile) error {
+	if err := s.store.Delete(ctx, QuarantinePath(file.ID)); err != nil {
+		return err
+	}
+	return s.records.DeleteRecord(ctx, models.QuarantineCollection, file.ID)
+}
+
+func (s *QuarantineService) audit(ctx context.Context, action string, file *models.QuarantinedFile, admin string) {
+	details, _ := json.Marshal(file)
+	_, err := s.records.CreateRecord(ctx, "_audit_logs", map[string]any{
+		"action":    action,
+		"resource":  QuarantinePath(file.ID),
+		"admin_id":  admin,
+		"details":   string(details),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		errors.Log(ctx, err, "audit quarantine", "action", action, "id", file.ID)
+	}
+}
+
+func quarantineRecordMissing(file *models.QuarantinedFile) error {
+	return errors.NewError(http.StatusConflict, "QUARANTINE_RECORD_MISSING", "The record to release the file to does not exist").WithDetails(map[string]any{
+		"collection": file.Collection,
+		"record_id":  file.RecordID,
+	})
+}
+
+func quarantinedFile(record *models.Record) *models.QuarantinedFile {
+	return &models.QuarantinedFile{
+		ID:         record.ID,
+		Collection: record.GetString("collection"),
+		RecordID:   record.GetString("record_id"),
+		Field:      record.GetString("field"),
+		Filename:   record.GetString("filename"),
+		Size:       int64(record.GetInt("size")),
+		Owner:      record.GetString("owner"),
+		Scanner:    record.GetString("scanner"),
+		Threat:     record.GetString("threat"),
+		Created:    record.Created,
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/db"
+	vaulterrors "github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/scan"
+)
+
+func TestQuarantine(t *testing.T) {
+	ctx := context.Background()
+	docs := &models.Collection{Name: "docs", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "files", Type: models.FieldTypeFile, Options: map[string]any{"max_select": 10}},
+	}}
+	files, records, store := newTestFileService(t, docs)
+	quarantine := NewQuarantineService(records, files, store)
+	record, err := records.CreateRecordWithID(ctx, "docs", "rec1", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(sources ...fileSource) error {
+		t.Helper()
+		changes, err := files.prepare(docs, record, map[string]any{}, map[string][]fileSource{"files": sources})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files.Save(ctx, "docs", "rec1", "users/u1", changes)
+	}
+	// Sources read from a stream are spooled to be scanned.
+	source := func(filename, content string) fileSource {
+		return fileSource{filename: filename, size: int64(len(content)), open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		}}
+	}
+
+	// A flagged upload is quarantined and none of the others are stored.
+	err = save(source("notes.txt", "hello"), source("page.txt", "<html><script>alert(1)</script></html>"), source("tool", "MZ\x90\x00"))
+	if errorCode(err) != "FILE_QUARANTINED" {
+		t.Fatalf("expected FILE_QUARANTINED, got %v", err)
+	}
+	if flagged := err.(*vaulterrors.VaultError).Details["files"].([]*models.QuarantinedFile); len(flagged) != 2 || flagged[0].Threat != "HTML document" {
+		t.Errorf("expected both flagged files in the details, got %v", flagged)
+	}
+	if entries, _ := store.List(ctx, "docs/rec1", false); len(entries) != 0 {
+		t.Errorf("expected no file to be stored, got %d", len(entries))
+	}
+	if usage, _ := files.quotas.Usage(ctx, models.UsageScopeCollection, "docs"); usage.Files != 0 {
+		t.Errorf("expected quarantined files not to count against quotas, got %+v", usage)
+	}
+
+	list, err := quarantine.List(ctx, "docs")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("expected two quarantined files, got %v %v", list, err)
+	}
+	var page, tool *models.QuarantinedFile
+	for _, file := range list {
+		if file.Filename == "page.txt" {
+			page = file
+		} else {
+			tool = file
+		}
+	}
+	if page == nil || tool == nil || page.RecordID != "rec1" || page.Field != "files" || page.Owner != "users/u1" || page.Scanner != "rules" || tool.Threat != "Windows executable" {
+		t.Fatalf("unexpected quarantined files %+v %+v", page, tool)
+	}
+	content, err := quarantine.Open(ctx, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(content)
+	_ = content.Close()
+	if !strings.HasPrefix(string(data), "<html>") {
+		t.Errorf("expected the quarantined content, got %q", data)
+	}
+
+	// Releasing attaches the file without scanning it again.
+	released, err := quarantine.Release(ctx, page, "", "_admins/a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := models.FileNames(released.Data["files"])
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".txt") {
+		t.Fatalf("expected the released file on the record, got %v", released.Data["files"])
+	}
+	if found, _ := store.Exists(ctx, FilePath("docs", "rec1", names[0])); !found {
+		t.Error("expected the released file to be stored")
+	}
+	if found, _ := store.Exists(ctx, QuarantinePath(page.ID)); found {
+		t.Error("expected the released file to leave the quarantine")
+	}
+	if _, err := quarantine.Get(ctx, page.ID); errorCode(err) != "QUARANTINE_NOT_FOUND" {
+		t.Errorf("expected QUARANTINE_NOT_FOUND, got %v", err)
+	}
+	logs, _, err := records.ListRecords(ctx, "_audit_logs", db.QueryParams{Filter: "action = 'quarantine_released'"})
+	if err != nil || len(logs) != 1 || logs[0].GetString("admin_id") != "_admins/a1" {
+		t.Errorf("expected the release to be audited, got %v %v", logs, err)
+	}
+
+	if err := quarantine.Delete(ctx, tool, "_admins/a1"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.Exists(ctx, QuarantinePath(tool.ID)); found {
+		t.Error("expected the deleted file to be removed")
+	}
+
+	// Files of deleted records cannot be released to them.
+	if err := save(source("run.sh", "echo")); errorCode(err) != "FILE_QUARANTINED" {
+		t.Fatalf("expected FILE_QUARANTINED, got %v", err)
+	}
+	if err := records.DeleteRecord(ctx, "docs", "rec1"); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = quarantine.List(ctx, "")
+	if len(list) != 1 || list[0].Threat != "blocked file extension .sh" {
+		t.Fatalf("expected the script to be quarantined, got %v", list)
+	}
+	if _, err := quarantine.Release(ctx, list[0], "", "_admins/a1"); errorCode(err) != "QUARANTINE_RECORD_MISSING" {
+		t.Errorf("expected QUARANTINE_RECORD_MISSING, got %v", err)
+	}
+	// They can be released to another record instead.
+	if _, err := records.CreateRecordWithID(ctx, "docs", "rec2", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if released, err = quarantine.Release(ctx, list[0], "rec2", "_admins/a1"); err != nil || released.ID != "rec2" || len(models.FileNames(released.Data["files"])) != 1 {
+		t.Fatalf("expected the script to be released to rec2, got %v %v", released, err)
+	}
+
+	// Uploads are rejected while they cannot be scanned.
+	files.scanner = failingScanner{}
+	if err := save(source("notes.txt", "hello")); errorCode(err) != "SCAN_FAILED" {
+		t.Errorf("expected SCAN_FAILED, got %v", err)
+	}
+}
+
+type failingScanner struct{}
+
+func (failingScanner) Scan(context.Context, string, *io.SectionReader) (*scan.Finding, error) {
+	return nil, errors.New("scanner unavailable")
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// QuotaService accounts for the storage used by the files of records, per
+// collection and per auth record that uploaded them, and enforces the quotas
+// on it. Every file is listed in _stored_files with its size and uploader,
+// so that deleting it releases what it was counted in, and the totals are
+// kept in _storage_usage.
+type QuotaService struct {
+	records *RecordService
+	config  *core.Config
+
+	// mu serializes usage changes, so that concurrent uploads cannot all
+	// pass a quota only some of them fit in.
+	mu sync.Mutex
+}
+
+func NewQuotaService(records *RecordService, config *core.Config) *QuotaService {
+	return &QuotaService{records: records, config: config}
+}
+
+// Check returns QUOTA_EXCEEDED when files of the sizes, uploaded to the
+// collection by owner ({collection}/{id}, or "" for none), would exceed a
+// quota.
+func (s *QuotaService) Check(ctx context.Context, collection, owner string, sizes ...int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.check(ctx, collection, owner, sizes)
+}
+
+// Reserve runs create, which opens a resumable upload of size bytes to the
+// collection by owner, if the file fits in the quotas along with the uploads
+// already open, and returns QUOTA_EXCEEDED otherwise.
+func (s *QuotaService) Reserve(ctx context.Context, collection, owner string, size int64, create func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx, collection, owner, []int64{size}); err != nil {
+		return err
+	}
+	return create()
+}
+
+// check counts the open resumable uploads with their declared size, as
+// their chunks take up storage before they are finalized, except the one
+// whose file ctx stores.
+func (s *QuotaService) check(ctx context.Context, collection, owner string, sizes []int64) error {
+	var bytes int64
+	for _, size := range sizes {
+		bytes += size
+	}
+	for _, key := range usageKeys(collection, owner) {
+		usage, err := s.Usage(ctx, key.scope, key.name)
+		if err != nil {
+			return err
+		}
+		if usage.QuotaBytes <= 0 && usage.QuotaFiles <= 0 {
+			continue
+		}
+		pendingBytes, pendingFiles, err := s.pending(ctx, key)
+		if err != nil {
+			return err
+		}
+		if usage.QuotaBytes > 0 && usage.Bytes+pendingBytes+bytes > usage.QuotaBytes || usage.QuotaFiles > 0 && usage.Files+pendingFiles+len(sizes) > usage.QuotaFiles {
+			return errors.NewError(http.StatusForbidden, "QUOTA_EXCEEDED", "Storage quota exceeded").WithDetails(map[string]any{
+				"scope":         usage.Scope,
+				"name":          usage.Name,
+				"bytes":         usage.Bytes,
+				"files":         usage.Files,
+				"pending_bytes": pendingBytes,
+				"pending_files": pendingFiles,
+				"quota_bytes":   usage.QuotaBytes,
+				"quota_files":   usage.QuotaFiles,
+			})
+		}
+	}
+	return nil
+}
+
+// pending returns the declared bytes and the number of the unexpired
+// resumable uploads counted in the usage of key.
+func (s *QuotaService) pending(ctx context.Context, key usageKey) (int64, int, error) {
+	filter := "collection = "
+	if key.scope == models.UsageScopeUser {
+		filter = "owner = "
+	}
+	params := db.QueryParams{Filter: filter + db.QuoteFilterValue(key.name) + " && expires >= @now", Page: 1, PerPage: 500}
+	storing, _ := ctx.Value(uploadKey{}).(string)
+	var bytes int64
+	files := 0
+	for {
+		records, total, err := s.records.ListRecords(ctx, models.UploadsCollection, params)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, record := range records {
+			if record.ID != storing {
+				bytes += int64(record.GetInt("size"))
+				files++
+			}
+		}
+		if len(records) == 0 || params.Page*params.PerPage >= total {
+			return bytes, files, nil
+		}
+		params.Page++
+	}
+}
+
+type uploadKey struct{}
+
+// withUpload marks ctx as storing the file of the resumable upload, which
+// is then counted as a stored file rather than an open upload.
+func withUpload(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, uploadKey{}, id)
+}
+
+// Add counts the file about to be stored at path, {collection}/{record
+// id}/{name}, against the quotas of its collection and owner, returning
+// QUOTA_EXCEEDED when it does not fit.
+func (s *QuotaService) Add(ctx context.Context, path, owner string, size int64) error {
+	collection, _, _ := strings.Cut(path, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx, collection, owner, []int64{size}); err != nil {
+		return err
+	}
+	if _, err := s.records.CreateRecord(ctx, models.StoredFilesCollection, map[string]any{
+		"path":       path,
+		"collection": collection,
+		"owner":      owner,
+		"size":       size,
+	}); err != nil {
+		return err
+	}
+	for _, key := range usageKeys(collection, owner) {
+		if err := s.change(ctx, key.scope, key.name, size, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release stops counting the file at path, or the files below it when it is
+// a directory.
+func (s *QuotaService) Release(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files(ctx, path)
+	if err != nil {
+		return err
+	}
+	released := make(map[usageKey]*models.StorageUsage)
+	for _, file := range files {
+		if err := s.records.DeleteRecord(ctx, models.StoredFilesCollection, file.ID); err != nil {
+			return err
+		}
+		for _, key := range usageKeys(file.GetString("collection"), file.GetString("owner")) {
+			if released[key] == nil {
+				released[key] = &models.StorageUsage{}
+			}
+			released[key].Bytes += int64(file.GetInt("size"))
+			released[key].Files++
+		}
+	}
+	for key, usage := range released {
+		if err := s.change(ctx, key.scope, key.name, -usage.Bytes, -usage.Files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move follows the files at or below oldPath to newPath, moving them to the
+// usage of another collection when the first path segment changes.
+func (s *QuotaService) Move(ctx context.Context, oldPath, newPath string) error {
+	oldPath, newPath = strings.Trim(oldPath, "/"), strings.Trim(newPath, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files(ctx, oldPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		path := newPath + strings.TrimPrefix(file.GetString("path"), oldPath)
+		from := file.GetString("collection")
+		to, _, _ := strings.Cut(path, "/")
+		if _, err := s.records.UpdateRecord(ctx, models.StoredFilesCollection, file.ID, map[string]any{"path": path, "collection": to}); err != nil {
+			return err
+		}
+		if from == to {
+			continue
+		}
+		size := int64(file.GetInt("size"))
+		if err := s.change(ctx, models.UsageScopeCollection, from, -size, -1); err != nil {
+			return err
+		}
+		if err := s.change(ctx, models.UsageScopeCollection, to, size, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// files returns the stored files at or below the path.
+func (s *QuotaService) files(ctx context.Context, path string) ([]*models.Record, error) {
+	path = strings.Trim(path, "/")
+	files, err := recordsBelow(ctx, s.records, models.StoredFilesCollection, path)
+	if err != nil || path == "" {
+		return files, err
+	}
+	file, err := recordAt(ctx, s.records, models.StoredFilesCollection, path)
+	if err != nil || file == nil {
+		return files, err
+	}
+	return append(files, file), nil
+}
+
+// change adds to the usage of the scope's name, deleting it once no file is
+// left.
+func (s *QuotaService) change(ctx context.Context, scope, name string, bytes int64, files int) error {
+	record, err := s.find(ctx, scope, name)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		if files <= 0 {
+			return nil
+		}
+		_, err = s.records.CreateRecord(ctx, models.StorageUsageCollection, map[string]any{
+			"scope": scope,
+			"name":  name,
+			"bytes": bytes,
+			"files": files,
+		})
+		return err
+	}
+
+	bytes += int64(record.GetInt("bytes"))
+	files += record.GetInt("files")
+	if files <= 0 {
+		return s.records.DeleteRecord(ctx, models.StorageUsageCollection, record.ID)
+	}
+	_, err = s.records.UpdateRecord(ctx, models.StorageUsageCollection, record.ID, map[string]any{
+		"bytes": max(bytes, 0),
+		"files": files,
+	})
+	return err
+}
+
+func (s *QuotaService) find(ctx context.Context, scope, name string) (*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.StorageUsageCollection, db.QueryParams{
+		Filter:  "scope = " + db.QuoteFilterValue(scope) + " && name = " + db.QuoteFilterValue(name),
+		PerPage: 1,
+	})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// Usage returns the storage used by the scope's name and its quota.
+func (s *QuotaService) Usage(ctx context.Context, scope, name string) (*models.StorageUsage, error) {
+	record, err := s.find(ctx, scope, name)
+	if err != nil {
+		return nil, err
+	}
+	usage := &models.StorageUsage{Scope: scope, Name: name}
+	if record != nil {
+		usage.Bytes = int64(record.GetInt("bytes"))
+		usage.Files = record.GetInt("files")
+	}
+	usage.QuotaBytes, usage.QuotaFiles = s.Quota(scope, name)
+	return usage, nil
+}
+
+// List returns the usage of the scope, the largest first, limited to limit
+// entries unless it is zero.
+func (s *QuotaService) List(ctx context.Context, scope string, limit int) ([]*models.StorageUsage, error) {
+	params := db.QueryParams{Filter: "scope = " + db.QuoteFilterValue(scope), Sort: "-bytes", Page: 1, PerPage: 500}
+	var list []*models.StorageUsage
+	for {
+		records, total, err := s.records.ListRecords(ctx, models.StorageUsageCollection, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			usage := &models.StorageUsage{
+				Scope: scope,
+				Name:  record.GetString("name"),
+				Bytes: int64(record.GetInt("bytes")),
+				Files: record.GetInt("files"),
+			}
+			usage.QuotaBytes, usage.QuotaFiles = s.Quota(scope, usage.Name)
+			list = append(list, usage)
+		}
+		if limit > 0 && len(list) >= limit {
+			return list[:limit], nil
+		}
+		if len(records) == 0 || params.Page*params.PerPage >= total {
+			return list, nil
+		}
+		params.Page++
+	}
+}
+
+// Quota returns the quota of the scope's name, from its collection's options
+// or else the configuration. Only records of auth collections have user
+// quotas.
+func (s *QuotaService) Quota(scope, name string) (int64, int) {
+	switch scope {
+	case models.UsageScopeCollection:
+		bytes, files := s.config.CollectionQuotaBytes, s.config.CollectionQuotaFiles
+		if col, ok := s.records.repo.Collection(name); ok {
+			bytes, files = quotaOption(col.Options.QuotaBytes, bytes), quotaOption(col.Options.QuotaFiles, files)
+		}
+		return bytes, files
+	case models.UsageScopeUser:
+		collection, _, _ := strings.Cut(name, "/")
+		col, ok := s.records.repo.Collection(collection)
+		if !ok || col.Type != models.CollectionTypeAuth {
+			return 0, 0
+		}
+		return quotaOption(col.Options.UserQuotaBytes, s.config.UserQuotaBytes), quotaOption(col.Options.UserQuotaFiles, s.config.UserQuotaFiles)
+	}
+	return 0, 0
+}
+
+func quotaOption[T int | int64](option, fallback T) T {
+	if option > 0 {
+		return option
+	}
+	return fallback
+}
+
+type usageKey struct {
+	scope, name string
+}
+
+// usageKeys returns the usage a file of the collection uploaded by owner is
+// counted in.
+func usageKeys(collection, owner string) []usageKey {
+	keys := []usageKey{{models.UsageScopeCollection, collection}}
+	if owner != "" {
+		keys = append(keys, usageKey{models.UsageScopeUser, owner})
+	}
+	return keys
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestStorageQuotas(t *testing.T) {
+	ctx := context.Background()
+	docs := &models.Collection{Name: "docs", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "files", Type: models.FieldTypeFile, Options: map[string]any{"max_select": 10}},
+	}, Options: models.CollectionOptions{QuotaBytes: 16}}
+	files, records, store := newTestFileService(t, docs)
+	quotas := files.quotas
+	files.config.UserQuotaFiles = 2
+
+	record, err := records.CreateRecordWithID(ctx, "docs", "rec1", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(owner string, contents ...string) (*FileChanges, error) {
+		t.Helper()
+		data := map[string]any{}
+		changes, err := files.Prepare(docs, record, data, formFiles(t, map[string][]string{"files": contents}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := files.Save(ctx, "docs", "rec1", owner, changes); err != nil {
+			return nil, err
+		}
+		if record, err = records.UpdateRecord(ctx, "docs", "rec1", data); err != nil {
+			t.Fatal(err)
+		}
+		return changes, nil
+	}
+	usage := func(scope, name string) *models.StorageUsage {
+		t.Helper()
+		usage, err := quotas.Usage(ctx, scope, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return usage
+	}
+
+	if _, err := upload("users/u1", "hello", "world"); err != nil {
+		t.Fatal(err)
+	}
+	if got := usage(models.UsageScopeCollection, "docs"); got.Bytes != 10 || got.Files != 2 || got.QuotaBytes != 16 {
+		t.Errorf("unexpected collection usage %+v", got)
+	}
+	if got := usage(models.UsageScopeUser, "users/u1"); got.Bytes != 10 || got.Files != 2 || got.QuotaFiles != 2 {
+		t.Errorf("unexpected user usage %+v", got)
+	}
+
+	// Uploads over a quota are rejected before anything is stored.
+	if _, err := upload("users/u1", "!"); errorCode(err) != "QUOTA_EXCEEDED" {
+		t.Errorf("expected the user's file quota to be exceeded, got %v", err)
+	}
+	if _, err := upload("users/u2", "1234", "5678"); errorCode(err) != "QUOTA_EXCEEDED" {
+		t.Errorf("expected the collection's byte quota to be exceeded, got %v", err)
+	}
+	if entries, _ := store.List(ctx, "docs/rec1", false); len(entries) != 2 {
+		t.Errorf("expected no rejected file to be stored, got %d files", len(entries))
+	}
+	// Only auth records have user quotas.
+	if _, err := upload("_admins/a1", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := usage(models.UsageScopeUser, "_admins/a1"); got.Files != 1 || got.QuotaFiles != 0 {
+		t.Errorf("unexpected admin usage %+v", got)
+	}
+
+	// Deleting files releases their usage.
+	names := models.FileNames(record.Data["files"])
+	if err := files.DeleteFile(ctx, FilePath("docs", "rec1", names[0])); err != nil {
+		t.Fatal(err)
+	}
+	if got := usage(models.UsageScopeUser, "users/u1"); got.Bytes != 5 || got.Files != 1 {
+		t.Errorf("expected the deleted file to be released, got %+v", got)
+	}
+	if err := quotas.Move(ctx, "docs", "archive"); err != nil {
+		t.Fatal(err)
+	}
+	if got := usage(models.UsageScopeCollection, "archive"); got.Bytes != 8 || got.Files != 2 {
+		t.Errorf("expected the files to move to the other collection, got %+v", got)
+	}
+	if err := quotas.Move(ctx, "archive", "docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	files.DeleteRecordFiles(ctx, docs, "rec1")
+	list, err := quotas.List(ctx, models.UsageScopeUser, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usage(models.UsageScopeCollection, "docs"); got.Bytes != 0 || got.Files != 0 || len(list) != 0 {
+		t.Errorf("expected every file to be released, got %+v and %d users", got, len(list))
+	}
+}
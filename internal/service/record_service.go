@@ -2,12 +2,14 @@ package service
 
 import (
 	"context"
+	"maps"
 
 	"github.com/google/uuid"
 	"github.com/zulfikawr/vault/internal/db"
 	"github.com/zulfikawr/vault/internal/errors"
 	"github.com/zulfikawr/vault/internal/models"
 	"github.com/zulfikawr/vault/internal/realtime"
+	"github.com/zulfikawr/vault/internal/rules"
 )
 
 type RecordService struct {
@@ -23,18 +25,39 @@ func (s *RecordService) Close() {
 	s.repo.Close()
 }
 
+// Lookup exposes the repository to rule evaluation for relation traversal
+// and @collection checks.
+func (s *RecordService) Lookup() rules.Lookup {
+	return s.repo
+}
+
+// broadcast sends the change to the realtime clients, which need no
+// authentication. System collections, which hold secrets and internal
+// state, are never broadcast, nor are password hashes.
 func (s *RecordService) broadcast(action string, collection string, record *models.Record) {
-	if s.hub != nil {
-		s.hub.Broadcast(&realtime.Message{
-			Action:     action,
-			Collection: collection,
-			Record:     record,
-		})
+	if s.hub == nil || models.IsSystemCollection(collection) {
+		return
+	}
+	if _, ok := record.Data["password"]; ok {
+		hidden := *record
+		hidden.Data = maps.Clone(record.Data)
+		hidden.HideField("password")
+		record = &hidden
 	}
+	s.hub.Broadcast(&realtime.Message{
+		Action:     action,
+		Collection: collection,
+		Record:     record,
+	})
 }
 
 func (s *RecordService) CreateRecord(ctx context.Context, collectionName string, data map[string]any) (*models.Record, error) {
-	id := uuid.New().String()
+	return s.CreateRecordWithID(ctx, collectionName, uuid.New().String(), data)
+}
+
+// CreateRecordWithID creates a record with an ID chosen beforehand, such as
+// one whose files were stored first.
+func (s *RecordService) CreateRecordWithID(ctx context.Context, collectionName string, id string, data map[string]any) (*models.Record, error) {
 	data["id"] = id
 
 	record := &models.Record{
@@ -76,6 +99,9 @@ func (s *RecordService) UpdateRecord(ctx context.Context, collectionName string,
 		return nil, err
 	}
 
+	// BeforeUpdate hooks can tell the stored values from the incoming ones.
+	ctx = context.WithValue(ctx, storedKey{}, maps.Clone(record.Data))
+
 	// Merge incoming data into existing record data
 	for k, v := range data {
 		if k != "id" && k != "created" && k != "updated" {
@@ -103,6 +129,20 @@ func (s *RecordService) UpdateRecord(ctx context.Context, collectionName string,
 	return updatedRecord, nil
 }
 
+// ClaimRecord sets a bool field of the record to true unless it already
+// is, and reports whether this call set it. Hooks are not run, so that the
+// check and the update stay a single statement.
+func (s *RecordService) ClaimRecord(ctx context.Context, collectionName string, id string, field string) (bool, error) {
+	return s.repo.ClaimRecord(ctx, collectionName, id, field)
+}
+
+// IncrementRecord adds one to a number field of the record unless it
+// already reached limit, and reports whether this call did. Like
+// ClaimRecord, it runs no hooks.
+func (s *RecordService) IncrementRecord(ctx context.Context, collectionName string, id string, field string, limit int) (bool, error) {
+	return s.repo.IncrementRecord(ctx, collectionName, id, field, limit)
+}
+
 func (s *RecordService) DeleteRecord(ctx context.Context, collectionName string, id string) error {
 	record, err := s.repo.FindRecordByID(ctx, collectionName, id)
 	if err != nil {
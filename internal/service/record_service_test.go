@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/realtime"
+)
+
+func TestBroadcast(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := realtime.NewHub()
+	go hub.Run(ctx)
+	client := make(realtime.Client, 10)
+	hub.Register(client)
+
+	records := newTestRecordService(t)
+	records.hub = hub
+	if _, err := records.CreateRecord(ctx, models.MFACollection, map[string]any{"collection": "users", "record_id": "usr_1", "secret": "s"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := records.CreateRecord(ctx, "users", map[string]any{"username": "jane", "email": "jane@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the user is broadcast, without its password.
+	select {
+	case msg := <-client:
+		if msg.Collection != "users" || msg.Record.ID != user.ID {
+			t.Fatalf("expected the user to be broadcast first, got %s %v", msg.Collection, msg.Record)
+		}
+		if _, ok := msg.Record.Data["password"]; ok {
+			t.Error("expected the password to be hidden")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a broadcast")
+	}
+	if user.Data["password"] == nil {
+		t.Error("expected the returned record to keep its password")
+	}
+	select {
+	case msg := <-client:
+		t.Errorf("unexpected broadcast %s %v", msg.Collection, msg.Record)
+	default:
+	}
+}
@@ -12,6 +12,10 @@ type Repository interface {
 	ListRecords(ctx context.Context, collectionName string, params db.QueryParams) ([]*models.Record, int, error)
 	FindRecordByID(ctx context.Context, collectionName string, id string) (*models.Record, error)
 	UpdateRecord(ctx context.Context, collectionName string, id string, data map[string]any) (*models.Record, error)
+	ClaimRecord(ctx context.Context, collectionName string, id string, field string) (bool, error)
+	IncrementRecord(ctx context.Context, collectionName string, id string, field string, limit int) (bool, error)
 	DeleteRecord(ctx context.Context, collectionName string, id string) error
+	Collection(name string) (*models.Collection, bool)
+	Exists(ctx context.Context, query string, args ...any) (bool, error)
 	Close()
 }
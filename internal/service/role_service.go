@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// RoleService manages roles stored in the _roles system collection and
+// resolves the grants held by an authenticated record.
+type RoleService struct {
+	records *RecordService
+}
+
+func NewRoleService(records *RecordService) *RoleService {
+	return &RoleService{records: records}
+}
+
+func (s *RoleService) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	records, _, err := s.records.ListRecords(ctx, models.RolesCollection, db.QueryParams{Sort: "name", PerPage: 500})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]*models.Role, 0, len(records))
+	for _, record := range records {
+		roles = append(roles, roleFromRecord(record))
+	}
+	return roles, nil
+}
+
+func (s *RoleService) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	record, err := s.findRoleRecord(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return roleFromRecord(record), nil
+}
+
+func (s *RoleService) CreateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	if _, err := s.findRoleRecord(ctx, role.Name); err == nil {
+		return nil, errors.NewError(http.StatusConflict, "ROLE_EXISTS", fmt.Sprintf("Role %s already exists", role.Name))
+	}
+
+	record, err := s.records.CreateRecord(ctx, models.RolesCollection, roleData(role))
+	if err != nil {
+		return nil, err
+	}
+	return roleFromRecord(record), nil
+}
+
+// UpdateRole replaces the description, grants and permissions of a role.
+func (s *RoleService) UpdateRole(ctx context.Context, name string, role *models.Role) (*models.Role, error) {
+	existing, err := s.findRoleRecord(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Name = name
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	record, err := s.records.UpdateRecord(ctx, models.RolesCollection, existing.ID, roleData(role))
+	if err != nil {
+		return nil, err
+	}
+	return roleFromRecord(record), nil
+}
+
+func (s *RoleService) DeleteRole(ctx context.Context, name string) error {
+	existing, err := s.findRoleRecord(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.records.DeleteRecord(ctx, models.RolesCollection, existing.ID)
+}
+
+// AssignRole adds the role to the roles field of an auth record.
+func (s *RoleService) AssignRole(ctx context.Context, collection, recordID, name string) error {
+	return s.updateAssignment(ctx, collection, recordID, name, true)
+}
+
+// UnassignRole removes the role from the roles field of an auth record.
+func (s *RoleService) UnassignRole(ctx context.Context, collection, recordID, name string) error {
+	return s.updateAssignment(ctx, collection, recordID, name, false)
+}
+
+// RolesFor resolves the roles assigned to the authenticated record. Role
+// names that no longer exist are ignored.
+func (s *RoleService) RolesFor(ctx context.Context, claims *auth.Claims) []*models.Role {
+	if claims == nil {
+		return nil
+	}
+
+	record, err := s.records.FindRecordByID(ctx, claims.Collection, claims.RecordID)
+	if err != nil {
+		return nil
+	}
+
+	names := RoleNames(record.Data["roles"])
+	if len(names) == 0 {
+		return nil
+	}
+
+	all, err := s.ListRoles(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var roles []*models.Role
+	for _, role := range all {
+		if slices.Contains(names, role.Name) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// CanAccess reports whether the caller may perform the action on the
+// collection regardless of its API rules. Admins can access everything.
+func (s *RoleService) CanAccess(ctx context.Context, claims *auth.Claims, collection, action string) bool {
+	if claims == nil {
+		return false
+	}
+	if claims.IsAdmin() {
+		return true
+	}
+	for _, role := range s.RolesFor(ctx, claims) {
+		if role.Allows(collection, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the caller holds the admin API permission.
+// Admins hold every permission.
+func (s *RoleService) HasPermission(ctx context.Context, claims *auth.Claims, permission string) bool {
+	if claims == nil {
+		return false
+	}
+	if claims.IsAdmin() {
+		return true
+	}
+	for _, role := range s.RolesFor(ctx, claims) {
+		if role.HasPermission(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *RoleService) findRoleRecord(ctx context.Context, name string) (*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.RolesCollection, db.QueryParams{Filter: "name = " + db.QuoteFilterValue(name), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.NewError(http.StatusNotFound, "ROLE_NOT_FOUND", fmt.Sprintf("Role %s not found", name))
+	}
+	return records[0], nil
+}
+
+func (s *RoleService) updateAssignment(ctx context.Context, collection, recordID, name string, assign bool) error {
+	col, ok := s.records.repo.Collection(collection)
+	if !ok {
+		return errors.NewError(http.StatusNotFound, "COLLECTION_NOT_FOUND", fmt.Sprintf("Collection %s not found", collection))
+	}
+	if !hasRolesField(col) {
+		return errors.NewError(http.StatusBadRequest, "ROLES_NOT_SUPPORTED", fmt.Sprintf("Collection %s does not support roles", collection))
+	}
+	if _, err := s.findRoleRecord(ctx, name); err != nil {
+		return err
+	}
+
+	record, err := s.records.FindRecordByID(ctx, collection, recordID)
+	if err != nil {
+		return err
+	}
+
+	names := RoleNames(record.Data["roles"])
+	if assign {
+		if slices.Contains(names, name) {
+			return nil
+		}
+		names = append(names, name)
+	} else {
+		names = slices.DeleteFunc(names, func(n string) bool { return n == name })
+	}
+
+	encoded, _ := json.Marshal(names)
+	_, err = s.records.UpdateRecord(ctx, collection, recordID, map[string]any{"roles": string(encoded)})
+	return err
+}
+
+// RoleNames decodes the roles field of an auth record, which is stored as a
+// JSON array of role names.
+func RoleNames(value any) []string {
+	return stringList(value)
+}
+
+// stringList decodes a JSON field holding an array of strings.
+func stringList(value any) []string {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		_ = json.Unmarshal([]byte(v), &names)
+	case []byte:
+		_ = json.Unmarshal(v, &names)
+	case []string:
+		names = append(names, v...)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+	return names
+}
+
+func hasRolesField(col *models.Collection) bool {
+	for _, f := range col.Fields {
+		if f.Name == "roles" {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRole(role *models.Role) error {
+	details := make(map[string]any)
+
+	if role.Name == "" {
+		details["name"] = "this field is required"
+	}
+	for collection, actions := range role.Collections {
+		if models.IsSystemCollection(collection) {
+			details["collections."+collection] = "system collections cannot be granted"
+			continue
+		}
+		for _, action := range actions {
+			if action != models.RoleWildcard && !slices.Contains(models.RoleActions, action) {
+				details["collections."+collection] = fmt.Sprintf("unknown action %q", action)
+			}
+		}
+	}
+	for _, permission := range role.Permissions {
+		if permission != models.RoleWildcard && !slices.Contains(models.RolePermissions, permission) {
+			details["permissions"] = fmt.Sprintf("unknown permission %q", permission)
+		}
+	}
+
+	if len(details) > 0 {
+		return errors.NewError(http.StatusBadRequest, "INVALID_ROLE", "Role validation failed").WithDetails(details)
+	}
+	return nil
+}
+
+func roleData(role *models.Role) map[string]any {
+	collections := role.Collections
+	if collections == nil {
+		collections = map[string][]string{}
+	}
+	permissions := role.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	encodedCollections, _ := json.Marshal(collections)
+	encodedPermissions, _ := json.Marshal(permissions)
+
+	return map[string]any{
+		"name":        role.Name,
+		"description": role.Description,
+		"collections": string(encodedCollections),
+		"permissions": string(encodedPermissions),
+	}
+}
+
+func roleFromRecord(record *models.Record) *models.Role {
+	role := &models.Role{
+		ID:          record.ID,
+		Name:        record.GetString("name"),
+		Description: record.GetString("description"),
+		Collections: map[string][]string{},
+		Permissions: []string{},
+	}
+	_ = json.Unmarshal([]byte(record.GetString("collections")), &role.Collections)
+	_ = json.Unmarshal([]byte(record.GetString("permissions")), &role.Permissions)
+	return role
+}
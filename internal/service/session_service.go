@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+// RefreshTokenTTL is how long a refresh token stays valid after it was
+// issued. Each rotation issues a token with a fresh expiry.
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+// Session kinds. Token sessions are kept alive by rotating refresh tokens;
+// cookie sessions back the dashboard's HttpOnly session cookie.
+const (
+	SessionKindToken  = "token"
+	SessionKindCookie = "cookie"
+)
+
+// Cookie sessions end after an idle timeout without requests, and after a
+// maximum lifetime since login, unless configured otherwise.
+const (
+	DefaultCookieIdleTimeout = 30 * time.Minute
+	DefaultCookieSessionTTL  = 12 * time.Hour
+
+	// cookieTouchInterval limits how often a busy cookie session records
+	// its last use.
+	cookieTouchInterval = time.Minute
+)
+
+// SessionClient describes the client a session was started or refreshed from.
+type SessionClient struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionService issues and rotates refresh tokens. Every login starts a
+// token family; refreshing marks the presented token used and issues the next
+// token of the family. Presenting a used token revokes the whole family.
+type SessionService struct {
+	records    *RecordService
+	cookieIdle time.Duration
+	cookieTTL  time.Duration
+}
+
+func NewSessionService(records *RecordService) *SessionService {
+	return &SessionService{records: records, cookieIdle: DefaultCookieIdleTimeout, cookieTTL: DefaultCookieSessionTTL}
+}
+
+// SetCookieTimeouts sets the idle timeout and maximum lifetime of cookie
+// sessions. Values that are not positive keep the current setting.
+func (s *SessionService) SetCookieTimeouts(idle, ttl time.Duration) {
+	if idle > 0 {
+		s.cookieIdle = idle
+	}
+	if ttl > 0 {
+		s.cookieTTL = ttl
+	}
+}
+
+// Start begins a session for the record and returns its first refresh token.
+func (s *SessionService) Start(ctx context.Context, collection, recordID string, client SessionClient) (string, error) {
+	s.pruneExpired(ctx, collection, recordID)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	return s.issue(ctx, map[string]any{
+		"user_id":    recordID,
+		"collection": collection,
+		"family":     uuid.New().String(),
+		"started":    now,
+		"last_used":  now,
+		"user_agent": client.UserAgent,
+		"ip":         client.IP,
+	})
+}
+
+// StartCookie begins a cookie session for the record and returns the token
+// to store in the session cookie together with its expiry.
+func (s *SessionService) StartCookie(ctx context.Context, collection, recordID string, client SessionClient) (string, time.Time, error) {
+	s.pruneExpired(ctx, collection, recordID)
+
+	token, err := auth.GenerateSecureToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(s.cookieTTL)
+	_, err = s.records.CreateRecord(ctx, models.RefreshTokensCollection, map[string]any{
+		"token":      auth.HashToken(token),
+		"user_id":    recordID,
+		"collection": collection,
+		"family":     uuid.New().String(),
+		"kind":       SessionKindCookie,
+		"used":       false,
+		"started":    now.Format(time.RFC3339),
+		"last_used":  now.Format(time.RFC3339),
+		"user_agent": client.UserAgent,
+		"ip":         client.IP,
+		"expires":    expires.Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// ResolveCookie returns the claims of a cookie session that has neither
+// expired nor been idle for longer than the idle timeout.
+func (s *SessionService) ResolveCookie(ctx context.Context, token string) (*auth.Claims, error) {
+	if token == "" {
+		return nil, invalidSessionError()
+	}
+
+	records, _, err := s.records.ListRecords(ctx, models.RefreshTokensCollection, db.QueryParams{
+		Filter:  "token = " + db.QuoteFilterValue(auth.HashToken(token)) + " && kind = " + db.QuoteFilterValue(SessionKindCookie),
+		PerPage: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, invalidSessionError()
+	}
+
+	record := records[0]
+	lastUsed, _ := time.Parse(time.RFC3339, record.GetString("last_used"))
+	if expired(record) || time.Since(lastUsed) > s.cookieIdle {
+		_ = s.records.DeleteRecord(ctx, models.RefreshTokensCollection, record.ID)
+		return nil, invalidSessionError()
+	}
+
+	collection := tokenCollection(record)
+	recordID := record.GetString("user_id")
+	if _, err := s.records.FindRecordByID(ctx, collection, recordID); err != nil {
+		return nil, invalidSessionError()
+	}
+
+	if time.Since(lastUsed) > cookieTouchInterval {
+		if _, err := s.records.UpdateRecord(ctx, models.RefreshTokensCollection, record.ID, map[string]any{
+			"last_used": time.Now().UTC().Format(time.RFC3339),
+		}); err != nil {
+			slog.Warn("Failed to record session use", "collection", collection, "user_id", recordID, "error", err)
+		}
+	}
+
+	tokenType := auth.TokenTypeAuth
+	if collection == models.AdminsCollection {
+		tokenType = auth.TokenTypeAdmin
+	}
+	return &auth.Claims{RecordID: recordID, Collection: collection, Type: tokenType}, nil
+}
+
+// Rotate redeems a refresh token of the collection and returns the record ID
+// it belongs to together with the next refresh token of its session.
+func (s *SessionService) Rotate(ctx context.Context, collection, token string, client SessionClient) (string, string, error) {
+	record, err := s.find(ctx, collection, token)
+	if err != nil {
+		return "", "", err
+	}
+	if record.GetString("kind") == SessionKindCookie {
+		return "", "", invalidRefreshTokenError()
+	}
+
+	used := isTruthy(record.Data["used"])
+	if !used && expired(record) {
+		_ = s.records.DeleteRecord(ctx, models.RefreshTokensCollection, record.ID)
+		return "", "", invalidRefreshTokenError()
+	}
+
+	// Marking the token used is the check: of concurrent refreshes with the
+	// same token, only one claims it and the others count as reuse.
+	if !used {
+		claimed, err := s.records.ClaimRecord(ctx, models.RefreshTokensCollection, record.ID, "used")
+		if err != nil {
+			return "", "", err
+		}
+		used = !claimed
+	}
+	if used {
+		slog.Warn("Refresh token reuse detected, revoking session", "collection", collection, "user_id", record.GetString("user_id"), "ip", client.IP)
+		if err := s.revokeFamily(ctx, collection, record.GetString("user_id"), familyOf(record)); err != nil {
+			return "", "", err
+		}
+		return "", "", errors.NewError(http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token was already used; the session has been revoked")
+	}
+
+	started := record.GetString("started")
+	if started == "" {
+		started = record.Created
+	}
+	next, err := s.issue(ctx, map[string]any{
+		"user_id":    record.GetString("user_id"),
+		"collection": collection,
+		"family":     familyOf(record),
+		"started":    started,
+		"last_used":  time.Now().UTC().Format(time.RFC3339),
+		"user_agent": client.UserAgent,
+		"ip":         client.IP,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return record.GetString("user_id"), next, nil
+}
+
+// End revokes the session the refresh token belongs to.
+func (s *SessionService) End(ctx context.Context, collection, token string) error {
+	record, err := s.find(ctx, collection, token)
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, collection, record.GetString("user_id"), familyOf(record))
+}
+
+// List returns the active sessions of the record, most recently used first.
+func (s *SessionService) List(ctx context.Context, collection, recordID string) ([]*models.Session, error) {
+	records, err := s.tokensOf(ctx, collection, recordID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*models.Session, 0)
+	for _, record := range records {
+		// Tokens stored before hashing have no family and can no longer
+		// be redeemed, so they are not listed.
+		if isTruthy(record.Data["used"]) || expired(record) || record.GetString("family") == "" {
+			continue
+		}
+		created := record.GetString("started")
+		if created == "" {
+			created = record.Created
+		}
+		kind := record.GetString("kind")
+		if kind == "" {
+			kind = SessionKindToken
+		}
+		sessions = append(sessions, &models.Session{
+			ID:         familyOf(record),
+			Collection: collection,
+			RecordID:   recordID,
+			Kind:       kind,
+			UserAgent:  record.GetString("user_agent"),
+			IP:         record.GetString("ip"),
+			Created:    created,
+			LastUsed:   record.GetString("last_used"),
+			Expires:    record.GetString("expires"),
+		})
+	}
+
+	slices.SortFunc(sessions, func(a, b *models.Session) int {
+		switch {
+		case a.LastUsed > b.LastUsed:
+			return -1
+		case a.LastUsed < b.LastUsed:
+			return 1
+		}
+		return 0
+	})
+	return sessions, nil
+}
+
+// Revoke ends one session of the record.
+func (s *SessionService) Revoke(ctx context.Context, collection, recordID, sessionID string) error {
+	records, err := s.tokensOf(ctx, collection, recordID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(records, func(r *models.Record) bool { return familyOf(r) == sessionID }) {
+		return errors.NewError(http.StatusNotFound, "SESSION_NOT_FOUND", "Session not found")
+	}
+	return s.revokeFamily(ctx, collection, recordID, sessionID)
+}
+
+// RevokeAll ends every session of the record and returns how many refresh
+// tokens were deleted.
+func (s *SessionService) RevokeAll(ctx context.Context, collection, recordID string) (int, error) {
+	records, err := s.tokensOf(ctx, collection, recordID)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		if err := s.records.DeleteRecord(ctx, models.RefreshTokensCollection, record.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(records), nil
+}
+
+func (s *SessionService) issue(ctx context.Context, data map[string]any) (string, error) {
+	token, err := auth.GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	data["token"] = auth.HashToken(token)
+	data["used"] = false
+	data["expires"] = time.Now().Add(RefreshTokenTTL).UTC().Format(time.RFC3339)
+
+	if _, err := s.records.CreateRecord(ctx, models.RefreshTokensCollection, data); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *SessionService) find(ctx context.Context, collection, token string) (*models.Record, error) {
+	if token == "" {
+		return nil, invalidRefreshTokenError()
+	}
+
+	records, _, err := s.records.ListRecords(ctx, models.RefreshTokensCollection, db.QueryParams{Filter: "token = " + db.QuoteFilterValue(auth.HashToken(token)), PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || tokenCollection(records[0]) != collection {
+		return nil, invalidRefreshTokenError()
+	}
+	return records[0], nil
+}
+
+// tokensOf returns every refresh token, used or not, issued to the record.
+func (s *SessionService) tokensOf(ctx context.Context, collection, recordID string) ([]*models.Record, error) {
+	records, _, err := s.records.ListRecords(ctx, models.RefreshTokensCollection, db.QueryParams{Filter: "user_id = " + db.QuoteFilterValue(recordID), PerPage: 1000})
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(records, func(r *models.Record) bool {
+		return tokenCollection(r) != collection
+	}), nil
+}
+
+func (s *SessionService) revokeFamily(ctx context.Context, collection, recordID, family string) error {
+	records, err := s.tokensOf(ctx, collection, recordID)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if familyOf(record) != family {
+			continue
+		}
+		if err := s.records.DeleteRecord(ctx, models.RefreshTokensCollection, record.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneExpired drops the record's expired refresh tokens, including used
+// ones that are no longer needed for reuse detection.
+func (s *SessionService) pruneExpired(ctx context.Context, collection, recordID string) {
+	records, err := s.tokensOf(ctx, collection, recordID)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		if expired(record) {
+			_ = s.records.DeleteRecord(ctx, models.RefreshTokensCollection, record.ID)
+		}
+	}
+}
+
+// tokenCollection returns the auth collection of a refresh token. Tokens
+// issued before admins were split out carry no collection.
+func tokenCollection(record *models.Record) string {
+	if collection := record.GetString("collection"); collection != "" {
+		return collection
+	}
+	return "users"
+}
+
+// familyOf returns the session a refresh token belongs to. Tokens issued
+// before rotation each form their own session.
+func familyOf(record *models.Record) string {
+	if family := record.GetString("family"); family != "" {
+		return family
+	}
+	return record.ID
+}
+
+func expired(record *models.Record) bool {
+	expires, err := time.Parse(time.RFC3339, record.GetString("expires"))
+	return err != nil || time.Now().After(expires)
+}
+
+func invalidRefreshTokenError() error {
+	return errors.NewError(http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid or expired refresh token")
+}
+
+func invalidSessionError() error {
+	return errors.NewError(http.StatusUnauthorized, "INVALID_SESSION", "Invalid or expired session")
+}
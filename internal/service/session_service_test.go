@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func newTestRecordService(t *testing.T) *RecordService {
+	t.Helper()
+	ctx := context.Background()
+
+	database, err := db.Connect(ctx, filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	registry := db.NewSchemaRegistry(database)
+	if err := NewCollectionService(registry, db.NewMigrationEngine(database)).InitSystem(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return NewRecordService(db.NewRepository(database, registry), nil)
+}
+
+func TestSessionRotation(t *testing.T) {
+	ctx := context.Background()
+	sessions := NewSessionService(newTestRecordService(t))
+	client := SessionClient{UserAgent: "test", IP: "127.0.0.1"}
+
+	first, err := sessions.Start(ctx, "users", "usr_1", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := sessions.Start(ctx, "users", "usr_1", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordID, second, err := sessions.Rotate(ctx, "users", first, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recordID != "usr_1" || second == first {
+		t.Fatalf("unexpected rotation result %q %q", recordID, second)
+	}
+
+	if _, _, err := sessions.Rotate(ctx, "_admins", second, client); errorCode(err) != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("token accepted by another collection: %v", err)
+	}
+
+	// Replaying the spent token revokes its successor too.
+	if _, _, err := sessions.Rotate(ctx, "users", first, client); errorCode(err) != "REFRESH_TOKEN_REUSED" {
+		t.Fatalf("expected reuse detection, got %v", err)
+	}
+	if _, _, err := sessions.Rotate(ctx, "users", second, client); errorCode(err) != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("successor survived reuse: %v", err)
+	}
+
+	list, err := sessions.List(ctx, "users", "usr_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected the other session to remain, got %d", len(list))
+	}
+
+	if err := sessions.End(ctx, "users", other); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := sessions.List(ctx, "users", "usr_1"); len(list) != 0 {
+		t.Errorf("expected no sessions after logout, got %d", len(list))
+	}
+}
+
+func TestConcurrentRotation(t *testing.T) {
+	ctx := context.Background()
+	sessions := NewSessionService(newTestRecordService(t))
+	client := SessionClient{UserAgent: "test", IP: "127.0.0.1"}
+	token, err := sessions.Start(ctx, "users", "usr_1", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Updates of the token wait for the other refresh, so that both have
+	// read the token before either marks it used.
+	hooks := GetHooks(models.RefreshTokensCollection)
+	saved := hooks.BeforeUpdate
+	t.Cleanup(func() { hooks.BeforeUpdate = saved })
+	arrived := make(chan struct{}, 2)
+	hooks.BeforeUpdate = append(saved, func(context.Context, *models.Record) error {
+		arrived <- struct{}{}
+		for len(arrived) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+
+	// Of concurrent refreshes with the same token, only one succeeds.
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := sessions.Rotate(ctx, "users", token, client); err == nil {
+				succeeded.Add(1)
+			} else if code := errorCode(err); code != "REFRESH_TOKEN_REUSED" && code != "INVALID_REFRESH_TOKEN" {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := succeeded.Load(); n != 1 {
+		t.Errorf("expected exactly one rotation to succeed, got %d", n)
+	}
+}
+
+func TestCookieSession(t *testing.T) {
+	ctx := context.Background()
+	records := newTestRecordService(t)
+	sessions := NewSessionService(records)
+	client := SessionClient{UserAgent: "test", IP: "127.0.0.1"}
+
+	admin, err := records.CreateRecord(ctx, models.AdminsCollection, map[string]any{"username": "root", "email": "root@example.com", "password": "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, expires, err := sessions.StartCookie(ctx, models.AdminsCollection, admin.ID, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expires) > DefaultCookieSessionTTL {
+		t.Errorf("unexpected expiry %v", expires)
+	}
+
+	claims, err := sessions.ResolveCookie(ctx, token)
+	if err != nil || claims.RecordID != admin.ID || !claims.IsAdmin() {
+		t.Fatalf("expected the cookie to resolve to the admin, got %+v %v", claims, err)
+	}
+	if _, _, err := sessions.Rotate(ctx, models.AdminsCollection, token, client); errorCode(err) != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("expected a session cookie not to work as a refresh token, got %v", err)
+	}
+
+	list, _ := sessions.List(ctx, models.AdminsCollection, admin.ID)
+	if len(list) != 1 || list[0].Kind != SessionKindCookie {
+		t.Fatalf("expected the cookie session to be listed, got %+v", list)
+	}
+
+	// Sessions idle for longer than the idle timeout end.
+	sessions.SetCookieTimeouts(time.Minute, 0)
+	stored, _, _ := records.ListRecords(ctx, models.RefreshTokensCollection, db.QueryParams{Filter: "kind = 'cookie'"})
+	if _, err := records.UpdateRecord(ctx, models.RefreshTokensCollection, stored[0].ID, map[string]any{"last_used": time.Now().Add(-2 * time.Minute).UTC().Format(time.RFC3339)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.ResolveCookie(ctx, token); errorCode(err) != "INVALID_SESSION" {
+		t.Errorf("expected an idle session to end, got %v", err)
+	}
+	if list, _ := sessions.List(ctx, models.AdminsCollection, admin.ID); len(list) != 0 {
+		t.Errorf("expected the idle session to be removed, got %d", len(list))
+	}
+}
+
+func errorCode(err error) string {
+	if e, ok := err.(*errors.VaultError); ok {
+		return e.Code
+	}
+	return ""
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/auth"
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/db"
+	"github.com/zulfikawr/vault/internal/errors"
+	"github.com/zulfikawr/vault/internal/models"
+	"github.com/zulfikawr/vault/internal/storage"
+)
+
+// UploadsDir is the storage directory holding the chunks of resumable
+// uploads.
+const UploadsDir = "_uploads"
+
+// UploadService runs resumable uploads. The size of the file is declared
+// upfront and its bytes are sent in chunks, each written at the offset
+// received so far, until the complete file is attached to a file field of a
+// record. Storage backends cannot append to a file, so each chunk is stored
+// as a file of its own at _uploads/{id}/{offset}.
+type UploadService struct {
+	records *RecordService
+	files   *FileService
+	store   storage.Storage
+	config  *core.Config
+
+	// locks serialize the writes to an upload, striped by its id.
+	locks [32]sync.Mutex
+}
+
+func NewUploadService(records *RecordService, files *FileService, store storage.Storage, config *core.Config) *UploadService {
+	return &UploadService{records: records, files: files, store: store, config: config}
+}
+
+func (s *UploadService) expiry() time.Duration {
+	if s.config.UploadExpiryHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(s.config.UploadExpiryHours) * time.Hour
+}
+
+// Create starts the upload of a file of size bytes to the field of the
+// record, on behalf of owner. The field must accept a file of that size and
+// have room for one more file, and the file must fit in the storage quotas
+// along with the uploads already open. Guests, who share the empty owner,
+// get a secret that the upload is bound to, returned only here.
+func (s *UploadService) Create(ctx context.Context, col *models.Collection, record *models.Record, field, filename string, size int64, owner string) (*models.Upload, error) {
+	details := make(map[string]any)
+	if f := fileField(col, field); f == nil {
+		details["field"] = "not a file field"
+	} else if maxSize := s.files.MaxSize(f); size > maxSize {
+		details[field] = fmt.Sprintf("the file exceeds the maximum size of %d bytes", maxSize)
+	} else if options := f.FileOptions(); options.Multiple() && len(models.FileNames(record.Data[field])) >= options.MaxSelect {
+		details[field] = fmt.Sprintf("at most %d files are allowed", options.MaxSelect)
+	}
+	if size < 0 {
+		details["size"] = "must not be negative"
+	}
+	if len(details) > 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "VALIDATION_FAILED", "Data validation failed").WithDetails(details)
+	}
+	data := map[string]any{
+		"collection": col.Name,
+		"record_id":  record.ID,
+		"field":      field,
+		"filename":   filepath.Base(filename),
+		"size":       size,
+		"offset":     0,
+		"owner":      owner,
+		"expires":    time.Now().Add(s.expiry()).UTC().Format(time.RFC3339),
+	}
+	var secret string
+	if owner == "" {
+		var err error
+		if secret, err = auth.GenerateSecureToken(); err != nil {
+			return nil, err
+		}
+		data["secret"] = auth.HashToken(secret)
+	}
+
+	// The quotas are checked again when the upload is finalized.
+	var created *models.Record
+	err := s.files.quotas.Reserve(ctx, col.Name, owner, size, func() error {
+		var err error
+		created, err = s.records.CreateRecord(ctx, models.UploadsCollection, data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	upload := uploadFromRecord(created)
+	upload.Secret = secret
+	return upload, nil
+}
+
+// Allows reports whether the caller, identified by owner and the secret it
+// sent, created the upload.
+func (s *UploadService) Allows(upload *models.Upload, owner, secret string) bool {
+	if upload.Owner != owner {
+		return false
+	}
+	return owner != "" || subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(upload.SecretHash)) == 1
+}
+
+// Get returns an upload. Expired uploads are deleted and reported as
+// UPLOAD_EXPIRED.
+func (s *UploadService) Get(ctx context.Context, id string) (*models.Upload, error) {
+	record, err := s.records.FindRecordByID(ctx, models.UploadsCollection, id)
+	if err != nil {
+		return nil, errors.NewError(http.StatusNotFound, "UPLOAD_NOT_FOUND", "Upload not found")
+	}
+	upload := uploadFromRecord(record)
+	if uploadExpired(upload) {
+		if err := s.Delete(ctx, upload); err != nil {
+			errors.Log(ctx, err, "delete expired upload", "upload_id", upload.ID)
+		}
+		return nil, errors.NewError(http.StatusGone, "UPLOAD_EXPIRED", "Upload has expired")
+	}
+	return upload, nil
+}
+
+// WriteChunk writes data to the upload at offset, which must be the number
+// of bytes received so far, and returns the upload with its new offset. The
+// data may not run past the declared size. A chunk is only kept once
+// received in full, so a client resuming after a failure sends it again from
+// the offset Get reports.
+func (s *UploadService) WriteChunk(ctx context.Context, id string, offset int64, data io.Reader) (*models.Upload, error) {
+	lock := &s.locks[crc32.ChecksumIEEE([]byte(id))%uint32(len(s.locks))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return nil, errors.NewError(http.StatusConflict, "UPLOAD_OFFSET_MISMATCH", "Upload-Offset does not match the bytes received").WithDetails(map[string]any{
+			"offset": upload.Offset,
+		})
+	}
+
+	remaining := upload.Size - upload.Offset
+	counter := &countingReader{r: io.LimitReader(data, remaining+1)}
+	path := chunkPath(upload.ID, offset)
+	if err := s.store.Save(ctx, path, counter); err != nil {
+		s.deleteChunk(ctx, path)
+		return nil, err
+	}
+	if counter.n > remaining {
+		s.deleteChunk(ctx, path)
+		return nil, errors.NewError(http.StatusRequestEntityTooLarge, "UPLOAD_TOO_LARGE", "Chunk runs past the declared size of the upload").WithDetails(map[string]any{
+			"remaining": remaining,
+		})
+	}
+	if counter.n == 0 {
+		s.deleteChunk(ctx, path)
+		return upload, nil
+	}
+
+	updated, err := s.records.UpdateRecord(ctx, models.UploadsCollection, upload.ID, map[string]any{"offset": offset + counter.n})
+	if err != nil {
+		return nil, err
+	}
+	return uploadFromRecord(updated), nil
+}
+
+func (s *UploadService) deleteChunk(ctx context.Context, path string) {
+	if err := s.store.Delete(ctx, path); err != nil {
+		errors.Log(ctx, err, "delete upload chunk", "path", path)
+	}
+}
+
+// Prepare validates the complete upload for its field, as FileService.Prepare
+// validates a multipart upload, and sets the field's new value in data. The
+// changes are then saved and committed around the record update as for a
+// multipart upload, after which the upload is deleted.
+func (s *UploadService) Prepare(ctx context.Context, upload *models.Upload, col *models.Collection, existing *models.Record, data map[string]any) (*FileChanges, error) {
+	if !upload.Complete() {
+		return nil, errors.NewError(http.StatusConflict, "UPLOAD_INCOMPLETE", "Upload is not complete").WithDetails(map[string]any{
+			"offset": upload.Offset,
+			"size":   upload.Size,
+		})
+	}
+	chunks, err := s.chunks(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	source := fileSource{
+		filename: upload.Filename,
+		size:     upload.Size,
+		open: func() (io.ReadCloser, error) {
+			return &chunkReader{ctx: ctx, store: s.store, paths: chunks}, nil
+		},
+	}
+	return s.files.prepare(col, existing, data, map[string][]fileSource{upload.Field: {source}})
+}
+
+// Save stores the file of the complete upload, as FileService.Save does,
+// counting it against the quotas in place of the upload's reservation.
+func (s *UploadService) Save(ctx context.Context, upload *models.Upload, changes *FileChanges) error {
+	return s.files.Save(withUpload(ctx, upload.ID), upload.Collection, upload.RecordID, upload.Owner, changes)
+}
+
+// chunks returns the paths of the upload's chunks in order, checking that
+// they cover the whole file.
+func (s *UploadService) chunks(ctx context.Context, upload *models.Upload) ([]string, error) {
+	entries, err := s.store.List(ctx, UploadsDir+"/"+upload.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		sizes[entry.Path] = entry.Size
+	}
+
+	var paths []string
+	offset := int64(0)
+	for offset < upload.Size {
+		path := chunkPath(upload.ID, offset)
+		size, ok := sizes[path]
+		if !ok || size == 0 {
+			return nil, errors.NewError(http.StatusInternalServerError, "UPLOAD_CORRUPTED", "Upload is missing data").WithDetails(map[string]any{
+				"offset": offset,
+			})
+		}
+		paths = append(paths, path)
+		offset += size
+	}
+	return paths, nil
+}
+
+// Delete removes an upload along with its chunks.
+func (s *UploadService) Delete(ctx context.Context, upload *models.Upload) error {
+	if _, _, err := storage.RemoveAll(ctx, s.store, UploadsDir+"/"+upload.ID); err != nil {
+		return err
+	}
+	return s.records.DeleteRecord(ctx, models.UploadsCollection, upload.ID)
+}
+
+// DeleteExpired removes the uploads that expired before being finalized and
+// returns how many it removed.
+func (s *UploadService) DeleteExpired(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		records, _, err := s.records.ListRecords(ctx, models.UploadsCollection, db.QueryParams{Filter: "expires < @now", PerPage: 100, Sort: "expires"})
+		if err != nil {
+			return deleted, err
+		}
+		for _, record := range records {
+			if err := s.Delete(ctx, uploadFromRecord(record)); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(records) < 100 {
+			return deleted, nil
+		}
+	}
+}
+
+// Run deletes expired uploads every hour until the context is done.
+func (s *UploadService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if deleted, err := s.DeleteExpired(ctx); err != nil {
+			errors.Log(ctx, err, "delete expired uploads")
+		} else if deleted > 0 {
+			slog.Info("Deleted expired uploads", "count", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func chunkPath(id string, offset int64) string {
+	return fmt.Sprintf("%s/%s/%020d", UploadsDir, id, offset)
+}
+
+func uploadExpired(upload *models.Upload) bool {
+	expires, err := time.Parse(time.RFC3339, upload.Expires)
+	return err == nil && time.Now().After(expires)
+}
+
+func uploadFromRecord(record *models.Record) *models.Upload {
+	return &models.Upload{
+		ID:         record.ID,
+		Collection: record.GetString("collection"),
+		RecordID:   record.GetString("record_id"),
+		Field:      record.GetString("field"),
+		Filename:   record.GetString("filename"),
+		Size:       int64(record.GetInt("size")),
+		Offset:     int64(record.GetInt("offset")),
+		Owner:      record.GetString("owner"),
+		Expires:    record.GetString("expires"),
+		SecretHash: record.GetString("secret"),
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// chunkReader reads the chunks at paths one after the other.
+type chunkReader struct {
+	ctx     context.Context
+	store   storage.Storage
+	paths   []string
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.paths) == 0 {
+				return 0, io.EOF
+			}
+			file, err := c.store.Retrieve(c.ctx, c.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current, c.paths = file, c.paths[1:]
+		}
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			err = c.current.Close()
+			c.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/core"
+	"github.com/zulfikawr/vault/internal/models"
+)
+
+func TestResumableUpload(t *testing.T) {
+	ctx := context.Background()
+	docs := &models.Collection{Name: "docs", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "title", Type: models.FieldTypeText},
+		{Name: "file", Type: models.FieldTypeFile, Options: map[string]any{"max_size": 16}},
+	}}
+	files, records, store := newTestFileService(t, docs)
+	uploads := NewUploadService(records, files, store, &core.Config{UploadExpiryHours: 1})
+	record, err := records.CreateRecordWithID(ctx, "docs", "rec1", map[string]any{"title": "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		field string
+		size  int64
+	}{
+		"too large":   {"file", 17},
+		"negative":    {"file", -1},
+		"not a file":  {"title", 4},
+		"no field":    {"", 4},
+		"other field": {"missing", 4},
+	} {
+		if _, err := uploads.Create(ctx, docs, record, tc.field, "a.txt", tc.size, ""); errorCode(err) != "VALIDATION_FAILED" {
+			t.Errorf("%s: expected VALIDATION_FAILED, got %v", name, err)
+		}
+	}
+
+	upload, err := uploads.Create(ctx, docs, record, "file", "notes.txt", 10, "users/u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Offset != 0 || upload.Size != 10 || upload.Owner != "users/u1" || upload.Expires == "" {
+		t.Fatalf("unexpected upload %+v", upload)
+	}
+
+	if _, err := uploads.WriteChunk(ctx, upload.ID, 3, strings.NewReader("lo")); errorCode(err) != "UPLOAD_OFFSET_MISMATCH" {
+		t.Errorf("expected UPLOAD_OFFSET_MISMATCH, got %v", err)
+	}
+	if upload, err = uploads.WriteChunk(ctx, upload.ID, 0, strings.NewReader("hello")); err != nil || upload.Offset != 5 {
+		t.Fatalf("expected offset 5, got %+v %v", upload, err)
+	}
+	if _, err := uploads.Prepare(ctx, upload, docs, record, map[string]any{}); errorCode(err) != "UPLOAD_INCOMPLETE" {
+		t.Errorf("expected UPLOAD_INCOMPLETE, got %v", err)
+	}
+	if _, err := uploads.WriteChunk(ctx, upload.ID, 5, strings.NewReader(" world")); errorCode(err) != "UPLOAD_TOO_LARGE" {
+		t.Errorf("expected UPLOAD_TOO_LARGE, got %v", err)
+	}
+	if upload, err = uploads.Get(ctx, upload.ID); err != nil || upload.Offset != 5 {
+		t.Fatalf("expected a rejected chunk to leave the offset, got %+v %v", upload, err)
+	}
+	if upload, err = uploads.WriteChunk(ctx, upload.ID, 5, strings.NewReader("world")); err != nil || !upload.Complete() {
+		t.Fatalf("expected the upload to be complete, got %+v %v", upload, err)
+	}
+
+	// Finalizing attaches the assembled file to the record.
+	data := map[string]any{}
+	changes, err := uploads.Prepare(ctx, upload, docs, record, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Save(ctx, upload, changes); err != nil {
+		t.Fatal(err)
+	}
+	if record, err = records.UpdateRecord(ctx, "docs", "rec1", data); err != nil {
+		t.Fatal(err)
+	}
+	files.Commit(ctx, "docs", "rec1", changes)
+	if err := uploads.Delete(ctx, upload); err != nil {
+		t.Fatal(err)
+	}
+
+	name := record.GetString("file")
+	if !strings.HasSuffix(name, ".txt") {
+		t.Fatalf("expected the file in the record, got %v", record.Data)
+	}
+	file, err := store.Retrieve(ctx, FilePath("docs", "rec1", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(file)
+	_ = file.Close()
+	if string(content) != "helloworld" {
+		t.Errorf("expected the chunks in order, got %q", content)
+	}
+	if found, _ := store.Exists(ctx, UploadsDir+"/"+upload.ID); found {
+		t.Error("expected the chunks to be deleted")
+	}
+	if _, err := uploads.Get(ctx, upload.ID); errorCode(err) != "UPLOAD_NOT_FOUND" {
+		t.Errorf("expected UPLOAD_NOT_FOUND, got %v", err)
+	}
+
+	// Expired uploads are deleted along with their chunks.
+	expire := func(upload *models.Upload) {
+		t.Helper()
+		if _, err := records.UpdateRecord(ctx, models.UploadsCollection, upload.ID, map[string]any{"expires": time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	abandoned, err := uploads.Create(ctx, docs, record, "file", "a.txt", 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.WriteChunk(ctx, abandoned.ID, 0, strings.NewReader("ab")); err != nil {
+		t.Fatal(err)
+	}
+	expire(abandoned)
+	if _, err := uploads.Get(ctx, abandoned.ID); errorCode(err) != "UPLOAD_EXPIRED" {
+		t.Errorf("expected UPLOAD_EXPIRED, got %v", err)
+	}
+	if found, _ := store.Exists(ctx, UploadsDir+"/"+abandoned.ID); found {
+		t.Error("expected the expired upload's chunks to be deleted")
+	}
+
+	kept, err := uploads.Create(ctx, docs, record, "file", "b.txt", 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	abandoned, err = uploads.Create(ctx, docs, record, "file", "c.txt", 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(abandoned)
+	if deleted, err := uploads.DeleteExpired(ctx); err != nil || deleted != 1 {
+		t.Errorf("expected one expired upload to be deleted, got %d %v", deleted, err)
+	}
+	if _, err := uploads.Get(ctx, kept.ID); err != nil {
+		t.Errorf("expected the unexpired upload to remain, got %v", err)
+	}
+}
+
+func TestUploadReservations(t *testing.T) {
+	ctx := context.Background()
+	docs := &models.Collection{Name: "docs", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "files", Type: models.FieldTypeFile, Options: map[string]any{"max_select": 10}},
+	}, Options: models.CollectionOptions{QuotaBytes: 16}}
+	files, records, store := newTestFileService(t, docs)
+	uploads := NewUploadService(records, files, store, &core.Config{UploadExpiryHours: 1})
+	record, err := records.CreateRecordWithID(ctx, "docs", "rec1", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open uploads hold their declared size until they are finalized.
+	upload, err := uploads.Create(ctx, docs, record, "files", "a.txt", 10, "users/u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.Create(ctx, docs, record, "files", "b.txt", 10, "users/u2"); errorCode(err) != "QUOTA_EXCEEDED" {
+		t.Errorf("expected the open upload to count against the quota, got %v", err)
+	}
+	changes, err := files.Prepare(docs, record, map[string]any{}, formFiles(t, map[string][]string{"files": {"0123456789"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Save(ctx, "docs", "rec1", "users/u2", changes); errorCode(err) != "QUOTA_EXCEEDED" {
+		t.Errorf("expected the open upload to count against multipart uploads, got %v", err)
+	}
+
+	// Finalizing counts the file in place of the reservation.
+	if upload, err = uploads.WriteChunk(ctx, upload.ID, 0, strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{}
+	if changes, err = uploads.Prepare(ctx, upload, docs, record, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Save(ctx, upload, changes); err != nil {
+		t.Fatalf("expected the finalized upload to fit its reservation, got %v", err)
+	}
+	if usage, _ := files.quotas.Usage(ctx, models.UsageScopeCollection, "docs"); usage.Bytes != 10 || usage.Files != 1 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestGuestUploads(t *testing.T) {
+	ctx := context.Background()
+	docs := &models.Collection{Name: "docs", Type: models.CollectionTypeBase, Fields: []models.Field{
+		{Name: "file", Type: models.FieldTypeFile},
+	}}
+	files, records, store := newTestFileService(t, docs)
+	uploads := NewUploadService(records, files, store, &core.Config{UploadExpiryHours: 1})
+	record, err := records.CreateRecordWithID(ctx, "docs", "rec1", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guest, err := uploads.Create(ctx, docs, record, "file", "a.txt", 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := uploads.Create(ctx, docs, record, "file", "b.txt", 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owned, err := uploads.Create(ctx, docs, record, "file", "c.txt", 4, "users/u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guest.Secret == "" || owned.Secret != "" {
+		t.Fatalf("expected only guest uploads to get a secret, got %q and %q", guest.Secret, owned.Secret)
+	}
+	// The secret is only returned on creation.
+	secret := guest.Secret
+	if guest, err = uploads.Get(ctx, guest.ID); err != nil || guest.Secret != "" {
+		t.Fatalf("expected the stored upload without its secret, got %+v %v", guest, err)
+	}
+
+	for name, tc := range map[string]struct {
+		upload        *models.Upload
+		owner, secret string
+		allowed       bool
+	}{
+		"guest with secret":     {guest, "", secret, true},
+		"guest without secret":  {guest, "", "", false},
+		"other guest's secret":  {guest, "", other.Secret, false},
+		"owner":                 {owned, "users/u1", "", true},
+		"other owner":           {owned, "users/u2", "", false},
+		"guest on owned upload": {owned, "", "", false},
+	} {
+		if allowed := uploads.Allows(tc.upload, tc.owner, tc.secret); allowed != tc.allowed {
+			t.Errorf("%s: expected %v, got %v", name, tc.allowed, allowed)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/errors"
+)
+
+// BlobsDir is the directory Dedupe keeps blobs in, hidden from its
+// listings.
+const BlobsDir = "_blobs"
+
+// Ref maps the path of a file stored through Dedupe to the blob holding its
+// content, named by the content's SHA-256 hash.
+type Ref struct {
+	Path    string
+	Field   string
+	Hash    string
+	Size    int64
+	ModTime time.Time
+}
+
+// RefIndex keeps the references of a Dedupe store.
+type RefIndex interface {
+	// Get returns the reference of the path, or nil when there is none.
+	Get(ctx context.Context, path string) (*Ref, error)
+
+	// Put sets the reference of ref.Path, replacing any previous one.
+	Put(ctx context.Context, ref *Ref) error
+
+	Delete(ctx context.Context, path string) error
+
+	// List returns the references of the paths below the prefix, or every
+	// reference for an empty prefix.
+	List(ctx context.Context, prefix string) ([]*Ref, error)
+
+	// Count returns the number of references to the blob.
+	Count(ctx context.Context, hash string) (int, error)
+}
+
+// Dedupe stores the files of records, at {collection}/{record id}/{name},
+// once per distinct content. Each file is a reference to a blob at
+// _blobs/{hash[:2]}/{hash}, which is deleted with its last reference. Other
+// paths, such as thumbnails and directories starting with an underscore, are
+// passed to the backend unchanged, as are files stored before deduplication
+// was enabled.
+type Dedupe struct {
+	backend Storage
+	refs    RefIndex
+
+	// locks serialize the reference changes of a blob, striped by its hash.
+	locks [32]sync.Mutex
+}
+
+func NewDedupe(backend Storage, refs RefIndex) *Dedupe {
+	return &Dedupe{backend: backend, refs: refs}
+}
+
+type fieldKey struct{}
+
+// WithField notes the record field a file is saved for, which Dedupe keeps
+// in the file's reference.
+func WithField(ctx context.Context, field string) context.Context {
+	return context.WithValue(ctx, fieldKey{}, field)
+}
+
+func (d *Dedupe) Save(ctx context.Context, path string, data io.Reader) error {
+	if !deduplicated(path) {
+		return d.backend.Save(ctx, path, data)
+	}
+
+	// Hash the content into a temporary file, since it is only stored when
+	// no blob holds it yet.
+	tmp, err := os.CreateTemp("", "vault-blob-*")
+	if err != nil {
+		return errors.NewError(http.StatusInternalServerError, "STORAGE_CREATE_FAILED", "Failed to create file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), data)
+	if err != nil {
+		return errors.NewError(http.StatusInternalServerError, "STORAGE_WRITE_FAILED", "Failed to write data").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	previous, err := d.refs.Get(ctx, cleanPath(path))
+	if err != nil {
+		return err
+	}
+
+	unlock := d.lock(sum)
+	found, err := d.backend.Exists(ctx, blobPath(sum))
+	if err == nil && !found {
+		if _, err = tmp.Seek(0, io.SeekStart); err == nil {
+			err = d.backend.Save(ctx, blobPath(sum), tmp)
+		}
+	}
+	if err == nil {
+		field, _ := ctx.Value(fieldKey{}).(string)
+		err = d.refs.Put(ctx, &Ref{Path: cleanPath(path), Field: field, Hash: sum, Size: size, ModTime: time.Now().UTC()})
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	if previous != nil && previous.Hash != sum {
+		if err := d.release(ctx, previous.Hash); err != nil {
+			return err
+		}
+	}
+	// A file stored before deduplication would shadow nothing but waste
+	// space.
+	return d.backend.Delete(ctx, path)
+}
+
+// release deletes the blob once nothing references it.
+func (d *Dedupe) release(ctx context.Context, hash string) error {
+	unlock := d.lock(hash)
+	defer unlock()
+	count, err := d.refs.Count(ctx, hash)
+	if err != nil || count > 0 {
+		return err
+	}
+	return d.backend.Delete(ctx, blobPath(hash))
+}
+
+func (d *Dedupe) lock(hash string) func() {
+	lock := &d.locks[crc32.ChecksumIEEE([]byte(hash))%uint32(len(d.locks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (d *Dedupe) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	return d.RetrieveRange(ctx, path, 0, -1)
+}
+
+func (d *Dedupe) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	ref, err := d.ref(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if ref != nil {
+		path = blobPath(ref.Hash)
+	}
+	if offset == 0 && length < 0 {
+		return d.backend.Retrieve(ctx, path)
+	}
+	return d.backend.RetrieveRange(ctx, path, offset, length)
+}
+
+func (d *Dedupe) Delete(ctx context.Context, path string) error {
+	ref, err := d.ref(ctx, path)
+	if err != nil {
+		return err
+	}
+	if ref != nil {
+		if err := d.refs.Delete(ctx, ref.Path); err != nil {
+			return err
+		}
+		if err := d.release(ctx, ref.Hash); err != nil {
+			return err
+		}
+	}
+	return d.backend.Delete(ctx, path)
+}
+
+// Rename moves the references at or below the old path along with the
+// backend's files. References moved to a path that is not deduplicated are
+// copied out of their blob.
+func (d *Dedupe) Rename(ctx context.Context, oldPath, newPath string) error {
+	oldPath, newPath = cleanPath(oldPath), cleanPath(newPath)
+	refs, err := d.refs.List(ctx, oldPath)
+	if err != nil {
+		return err
+	}
+	if ref, err := d.ref(ctx, oldPath); err != nil {
+		return err
+	} else if ref != nil {
+		refs = append(refs, ref)
+	}
+
+	for _, ref := range refs {
+		target := newPath + strings.TrimPrefix(ref.Path, oldPath)
+		if deduplicated(target) {
+			replaced, err := d.refs.Get(ctx, target)
+			if err != nil {
+				return err
+			}
+			moved := *ref
+			moved.Path = target
+			if err := d.refs.Put(ctx, &moved); err != nil {
+				return err
+			}
+			if err := d.refs.Delete(ctx, ref.Path); err != nil {
+				return err
+			}
+			if replaced != nil && replaced.Hash != ref.Hash {
+				if err := d.release(ctx, replaced.Hash); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		blob, err := d.backend.Retrieve(ctx, blobPath(ref.Hash))
+		if err != nil {
+			return err
+		}
+		err = d.backend.Save(ctx, target, blob)
+		_ = blob.Close()
+		if err != nil {
+			return err
+		}
+		if err := d.Delete(ctx, ref.Path); err != nil {
+			return err
+		}
+	}
+
+	err = d.backend.Rename(ctx, oldPath, newPath)
+	if len(refs) > 0 && isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *Dedupe) CreateDir(ctx context.Context, path string) error {
+	return d.backend.CreateDir(ctx, path)
+}
+
+func (d *Dedupe) Exists(ctx context.Context, path string) (bool, error) {
+	if found, err := d.backend.Exists(ctx, path); err != nil || found {
+		return found, err
+	}
+	if ref, err := d.ref(ctx, path); err != nil || ref != nil {
+		return ref != nil, err
+	}
+	refs, err := d.refs.List(ctx, path)
+	return len(refs) > 0, err
+}
+
+// List merges the backend's files with the referenced files, and the
+// directories holding them, except for the blobs.
+func (d *Dedupe) List(ctx context.Context, prefix string, recursive bool) ([]FileInfo, error) {
+	dir := cleanPath(prefix)
+	entries, err := d.backend.List(ctx, dir, recursive)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := d.refs.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(entries)+len(refs))
+	files := make([]FileInfo, 0, len(entries)+len(refs))
+	add := func(info FileInfo) {
+		if !seen[info.Path] {
+			seen[info.Path] = true
+			files = append(files, info)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Path != BlobsDir && !strings.HasPrefix(entry.Path, BlobsDir+"/") {
+			add(entry)
+		}
+	}
+	for _, ref := range refs {
+		rel := ref.Path
+		if dir != "" {
+			rel = strings.TrimPrefix(ref.Path, dir+"/")
+		}
+		parts := strings.Split(rel, "/")
+		if !recursive {
+			parts = parts[:1]
+		}
+		for i := range parts {
+			path := pathpkg.Join(dir, strings.Join(parts[:i+1], "/"))
+			if path == ref.Path {
+				add(refInfo(ref))
+			} else {
+				add(FileInfo{Name: parts[i], Path: path, ModTime: ref.ModTime, IsDir: true})
+			}
+		}
+	}
+	return files, nil
+}
+
+func (d *Dedupe) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	ref, err := d.ref(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if ref != nil {
+		info := refInfo(ref)
+		return &info, nil
+	}
+	info, err := d.backend.Stat(ctx, path)
+	if !isNotFound(err) {
+		return info, err
+	}
+	// Directories may only hold references.
+	refs, listErr := d.refs.List(ctx, path)
+	if listErr != nil || len(refs) == 0 {
+		return nil, err
+	}
+	dir := cleanPath(path)
+	return &FileInfo{Name: pathpkg.Base(dir), Path: dir, ModTime: refs[0].ModTime, IsDir: true}, nil
+}
+
+// DedupeStats describe how much space deduplication saves. LogicalSize adds
+// up the size of every referenced file and StoredSize the size of the blobs
+// holding them.
+type DedupeStats struct {
+	References  int   `json:"references"`
+	Blobs       int   `json:"blobs"`
+	LogicalSize int64 `json:"logical_size"`
+	StoredSize  int64 `json:"stored_size"`
+	SavedSize   int64 `json:"saved_size"`
+}
+
+// Stats counts the references and blobs.
+func (d *Dedupe) Stats(ctx context.Context) (*DedupeStats, error) {
+	refs, err := d.refs.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	stats := &DedupeStats{References: len(refs)}
+	blobs := make(map[string]bool)
+	for _, ref := range refs {
+		stats.LogicalSize += ref.Size
+		if !blobs[ref.Hash] {
+			blobs[ref.Hash] = true
+			stats.StoredSize += ref.Size
+		}
+	}
+	stats.Blobs = len(blobs)
+	stats.SavedSize = stats.LogicalSize - stats.StoredSize
+	return stats, nil
+}
+
+// ref returns the reference of a deduplicated path, or nil.
+func (d *Dedupe) ref(ctx context.Context, path string) (*Ref, error) {
+	if !deduplicated(path) {
+		return nil, nil
+	}
+	return d.refs.Get(ctx, cleanPath(path))
+}
+
+// deduplicated reports whether files at the path are stored as blobs: the
+// files of records, outside the directories starting with an underscore.
+func deduplicated(path string) bool {
+	parts := strings.Split(cleanPath(path), "/")
+	return len(parts) == 3 && !strings.HasPrefix(parts[0], "_")
+}
+
+func blobPath(hash string) string {
+	return BlobsDir + "/" + hash[:2] + "/" + hash
+}
+
+func refInfo(ref *Ref) FileInfo {
+	name := pathpkg.Base(ref.Path)
+	return FileInfo{
+		Name:        name,
+		Path:        ref.Path,
+		Size:        ref.Size,
+		ModTime:     ref.ModTime,
+		ContentType: ContentType(name),
+		ETag:        ref.Hash[:32],
+	}
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*errors.VaultError)
+	return ok && e.Code == "FILE_NOT_FOUND"
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDedupe(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, NewDedupe(local, &memoryRefs{refs: make(map[string]*Ref)}))
+}
+
+func TestDedupeReferences(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := &memoryRefs{refs: make(map[string]*Ref)}
+	store := NewDedupe(local, refs)
+
+	save := func(path, content string) {
+		t.Helper()
+		if err := store.Save(WithField(ctx, "attachments"), path, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blobs := func() int {
+		t.Helper()
+		entries, err := local.List(ctx, BlobsDir, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for _, entry := range entries {
+			if !entry.IsDir {
+				count++
+			}
+		}
+		return count
+	}
+
+	save("posts/rec1/a.txt", "same content")
+	save("posts/rec2/b.txt", "same content")
+	save("posts/rec2/c.txt", "other")
+	if got := blobs(); got != 2 {
+		t.Fatalf("expected 2 blobs, got %d", got)
+	}
+	if ref, _ := refs.Get(ctx, "posts/rec2/b.txt"); ref == nil || ref.Field != "attachments" || ref.Size != 12 {
+		t.Errorf("unexpected reference %+v", ref)
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (DedupeStats{References: 3, Blobs: 2, LogicalSize: 29, StoredSize: 17, SavedSize: 12}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// The blob stays until its last reference is deleted.
+	if err := store.Delete(ctx, "posts/rec1/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if file, err := store.Retrieve(ctx, "posts/rec2/b.txt"); err != nil {
+		t.Fatalf("expected the shared blob to remain, got %v", err)
+	} else {
+		data, _ := io.ReadAll(file)
+		_ = file.Close()
+		if string(data) != "same content" {
+			t.Errorf("unexpected content %q", data)
+		}
+	}
+	if _, _, err := RemoveAll(ctx, store, "posts/rec2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := blobs(); got != 0 {
+		t.Errorf("expected every blob to be deleted, got %d", got)
+	}
+
+	// Overwriting a file releases its previous content.
+	save("posts/rec3/a.txt", "first")
+	save("posts/rec3/a.txt", "second")
+	if got := blobs(); got != 1 {
+		t.Errorf("expected the replaced blob to be deleted, got %d blobs", got)
+	}
+
+	// Blobs are hidden from listings.
+	entries, err := store.List(ctx, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Path == BlobsDir {
+			t.Error("expected the blobs to be hidden")
+		}
+	}
+}
+
+// memoryRefs is a RefIndex kept in memory.
+type memoryRefs struct {
+	mu   sync.Mutex
+	refs map[string]*Ref
+}
+
+func (m *memoryRefs) Get(ctx context.Context, path string) (*Ref, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ref, ok := m.refs[path]; ok {
+		copied := *ref
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryRefs) Put(ctx context.Context, ref *Ref) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *ref
+	m.refs[ref.Path] = &copied
+	return nil
+}
+
+func (m *memoryRefs) Delete(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.refs, path)
+	return nil
+}
+
+func (m *memoryRefs) List(ctx context.Context, prefix string) ([]*Ref, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var refs []*Ref
+	for path, ref := range m.refs {
+		if prefix == "" || strings.HasPrefix(path, prefix+"/") {
+			copied := *ref
+			refs = append(refs, &copied)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	return refs, nil
+}
+
+func (m *memoryRefs) Count(ctx context.Context, hash string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, ref := range m.refs {
+		if ref.Hash == hash {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -3,14 +3,39 @@ package storage
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type Storage interface {
 	Save(ctx context.Context, path string, data io.Reader) error
-	        Retrieve(ctx context.Context, path string) (io.ReadCloser, error)
-	                Delete(ctx context.Context, path string) error
-	                Rename(ctx context.Context, oldPath, newPath string) error
-	                CreateDir(ctx context.Context, path string) error
-	                Exists(ctx context.Context, path string) (bool, error)
-	        }
-	        
+	Retrieve(ctx context.Context, path string) (io.ReadCloser, error)
+	Delete(ctx context.Context, path string) error
+	Rename(ctx context.Context, oldPath, newPath string) error
+	CreateDir(ctx context.Context, path string) error
+	Exists(ctx context.Context, path string) (bool, error)
+
+	// List returns the files and directories in the directory at prefix,
+	// or every file and directory below it when recursive. A missing
+	// directory lists nothing.
+	List(ctx context.Context, prefix string, recursive bool) ([]FileInfo, error)
+
+	// Stat describes the file or directory at path, failing with
+	// FILE_NOT_FOUND when there is none.
+	Stat(ctx context.Context, path string) (*FileInfo, error)
+
+	// RetrieveRange reads at most length bytes of the file starting at
+	// offset, or the rest of the file when length is negative. Reading
+	// past the end returns no data.
+	RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// FileInfo describes a stored file or directory.
+type FileInfo struct {
+	Name        string
+	Path        string // slash-separated, relative to the storage root
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+	IsDir       bool
+}
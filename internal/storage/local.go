@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	pathpkg "path"
 	"path/filepath"
 
 	"github.com/zulfikawr/vault/internal/errors"
@@ -102,3 +104,95 @@ func (l *Local) Exists(ctx context.Context, path string) (bool, error) {
 	}
 	return false, errors.NewError(http.StatusInternalServerError, "STORAGE_STAT_FAILED", "Failed to stat file").WithDetails(map[string]any{"error": err.Error(), "path": path})
 }
+
+func (l *Local) List(ctx context.Context, prefix string, recursive bool) ([]FileInfo, error) {
+	dir := cleanPath(prefix)
+	fullPath := filepath.Join(l.basePath, dir)
+
+	var files []FileInfo
+	if !recursive {
+		entries, err := os.ReadDir(fullPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return files, nil
+			}
+			return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_LIST_FAILED", "Failed to list files").WithDetails(map[string]any{"error": err.Error(), "path": prefix})
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, localFileInfo(pathpkg.Join(dir, entry.Name()), info))
+		}
+		return files, nil
+	}
+
+	err := filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == fullPath {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if p == fullPath {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(fullPath, p)
+		files = append(files, localFileInfo(pathpkg.Join(dir, filepath.ToSlash(rel)), info))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_LIST_FAILED", "Failed to list files").WithDetails(map[string]any{"error": err.Error(), "path": prefix})
+	}
+	return files, nil
+}
+
+func (l *Local) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	info, err := os.Stat(filepath.Join(l.basePath, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "File not found")
+		}
+		return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_STAT_FAILED", "Failed to stat file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	fileInfo := localFileInfo(cleanPath(path), info)
+	return &fileInfo, nil
+}
+
+func (l *Local) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	file, err := l.Retrieve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.(*os.File).Seek(offset, io.SeekStart); err != nil {
+		errors.Defer(ctx, file.Close, "close storage file", "path", path)
+		return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_READ_FAILED", "Failed to read file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func localFileInfo(path string, info os.FileInfo) FileInfo {
+	fileInfo := FileInfo{
+		Name:    info.Name(),
+		Path:    path,
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+	if !info.IsDir() {
+		fileInfo.Size = info.Size()
+		fileInfo.ContentType = ContentType(info.Name())
+		fileInfo.ETag = fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	}
+	return fileInfo
+}
@@ -0,0 +1,587 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/errors"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config configures an S3-compatible bucket.
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, such as
+	// http://localhost:9000 for MinIO. It defaults to the AWS endpoint of
+	// the region.
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	// PathStyle addresses the bucket as {endpoint}/{bucket}/{key} instead
+	// of {bucket}.{endpoint host}/{key}.
+	PathStyle bool
+
+	// Client sends the requests; nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+// S3 stores files as objects of an S3-compatible bucket, signing requests
+// with AWS Signature Version 4. Object storage has no directories:
+// CreateDir writes an empty "{path}/" marker object, and Exists and Rename
+// treat a path with objects below it as a directory.
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage requires a bucket")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{config: config, endpoint: endpoint, client: client}, nil
+}
+
+func (s *S3) Save(ctx context.Context, path string, data io.Reader) error {
+	// S3 needs the length and hash of the body before sending it, so the
+	// data is spooled to a temporary file first.
+	spool, err := os.CreateTemp("", "vault-s3-*")
+	if err != nil {
+		return errors.NewError(http.StatusInternalServerError, "STORAGE_CREATE_FAILED", "Failed to create file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	defer errors.Defer(ctx, func() error { return os.Remove(spool.Name()) }, "remove storage spool", "path", path)
+	defer errors.Defer(ctx, spool.Close, "close storage spool", "path", path)
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), data)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return errors.NewError(http.StatusInternalServerError, "STORAGE_WRITE_FAILED", "Failed to write data").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+
+	key := cleanPath(path)
+	header := http.Header{}
+	header.Set("Content-Type", ContentType(key))
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, io.NopCloser(spool), size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return errors.NewError(http.StatusInternalServerError, "STORAGE_WRITE_FAILED", "Failed to write data").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	return s.close(resp, "STORAGE_WRITE_FAILED", "Failed to write data", path)
+}
+
+func (s *S3) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, cleanPath(path), nil, nil, nil, 0, "")
+	if err != nil {
+		return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_READ_FAILED", "Failed to read file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "File not found")
+	}
+	if resp.StatusCode >= 300 {
+		return nil, s.close(resp, "STORAGE_READ_FAILED", "Failed to read file", path)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, path string) error {
+	key := cleanPath(path)
+	// Deleting a missing object succeeds, which also covers the directory
+	// marker of a path that is a file.
+	for _, k := range []string{key, key + "/"} {
+		resp, err := s.do(ctx, http.MethodDelete, k, nil, nil, nil, 0, "")
+		if err != nil {
+			return errors.NewError(http.StatusInternalServerError, "STORAGE_DELETE_FAILED", "Failed to delete file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			_ = resp.Body.Close()
+			continue
+		}
+		if err := s.close(resp, "STORAGE_DELETE_FAILED", "Failed to delete file", path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) Rename(ctx context.Context, oldPath, newPath string) error {
+	oldKey, newKey := cleanPath(oldPath), cleanPath(newPath)
+
+	object, err := s.headObject(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+	moves := map[string]string{}
+	if object != nil {
+		moves[oldKey] = newKey
+	} else {
+		// Rename a directory by moving every object below it.
+		objects, _, err := s.listObjects(ctx, oldKey+"/", "", 0)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			moves[object.Key] = newKey + strings.TrimPrefix(object.Key, oldKey)
+		}
+	}
+	if len(moves) == 0 {
+		return errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "Original file not found")
+	}
+
+	for src, dst := range moves {
+		if err := s.copyObject(ctx, src, dst); err != nil {
+			return errors.NewError(http.StatusInternalServerError, "STORAGE_RENAME_FAILED", "Failed to rename file").WithDetails(map[string]any{"error": err.Error(), "old_path": oldPath, "new_path": newPath})
+		}
+		resp, err := s.do(ctx, http.MethodDelete, src, nil, nil, nil, 0, "")
+		if err != nil {
+			return errors.NewError(http.StatusInternalServerError, "STORAGE_RENAME_FAILED", "Failed to rename file").WithDetails(map[string]any{"error": err.Error(), "old_path": oldPath, "new_path": newPath})
+		}
+		if err := s.close(resp, "STORAGE_RENAME_FAILED", "Failed to rename file", oldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) CreateDir(ctx context.Context, path string) error {
+	key := cleanPath(path)
+	if key == "" {
+		return nil
+	}
+	resp, err := s.do(ctx, http.MethodPut, key+"/", nil, nil, nil, 0, "")
+	if err != nil {
+		return errors.NewError(http.StatusInternalServerError, "STORAGE_DIR_CREATE_FAILED", "Failed to create directory").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	return s.close(resp, "STORAGE_DIR_CREATE_FAILED", "Failed to create directory", path)
+}
+
+func (s *S3) Exists(ctx context.Context, path string) (bool, error) {
+	key := cleanPath(path)
+	if key == "" {
+		return true, nil
+	}
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		if e, ok := err.(*errors.VaultError); ok && e.Code == "FILE_NOT_FOUND" {
+			return false, nil
+		}
+		return false, err
+	}
+	return info != nil, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string, recursive bool) ([]FileInfo, error) {
+	dir := cleanPath(prefix)
+	if dir != "" {
+		dir += "/"
+	}
+	delimiter := "/"
+	if recursive {
+		delimiter = ""
+	}
+	objects, prefixes, err := s.listObjects(ctx, dir, delimiter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories are the common prefixes of a delimited listing, and the
+	// markers and parents of the objects of a recursive one.
+	dirs := map[string]bool{}
+	for _, p := range prefixes {
+		dirs[strings.TrimSuffix(p, "/")] = true
+	}
+	files := []FileInfo{}
+	for _, object := range objects {
+		if recursive {
+			for parent := pathpkg.Dir(object.Key); len(parent) >= len(dir) && parent != "." && parent+"/" != dir; parent = pathpkg.Dir(parent) {
+				dirs[parent] = true
+			}
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			if object.Key != dir {
+				dirs[strings.TrimSuffix(object.Key, "/")] = true
+			}
+			continue
+		}
+		files = append(files, FileInfo{
+			Name:        pathpkg.Base(object.Key),
+			Path:        object.Key,
+			Size:        object.Size,
+			ModTime:     object.LastModified,
+			ContentType: ContentType(object.Key),
+			ETag:        strings.Trim(object.ETag, `"`),
+		})
+	}
+	for d := range dirs {
+		files = append(files, FileInfo{Name: pathpkg.Base(d), Path: d, IsDir: true})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func (s *S3) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	key := cleanPath(path)
+	if key == "" {
+		return &FileInfo{Name: s.config.Bucket, IsDir: true}, nil
+	}
+	info, err := s.headObject(ctx, key)
+	if err != nil || info != nil {
+		return info, err
+	}
+	objects, _, err := s.listObjects(ctx, key+"/", "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "File not found")
+	}
+	return &FileInfo{Name: pathpkg.Base(key), Path: key, IsDir: true}, nil
+}
+
+func (s *S3) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		if _, err := s.Stat(ctx, path); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	header := http.Header{}
+	if length < 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	} else {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10))
+	}
+	resp, err := s.do(ctx, http.MethodGet, cleanPath(path), nil, header, nil, 0, "")
+	if err != nil {
+		return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_READ_FAILED", "Failed to read file").WithDetails(map[string]any{"error": err.Error(), "path": path})
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, errors.NewError(http.StatusNotFound, "FILE_NOT_FOUND", "File not found")
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The offset is past the end of the file.
+		_ = resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	case resp.StatusCode >= 300:
+		return nil, s.close(resp, "STORAGE_READ_FAILED", "Failed to read file", path)
+	}
+	return resp.Body, nil
+}
+
+// headObject describes the object, or returns nil when it does not exist.
+func (s *S3) headObject(ctx context.Context, key string) (*FileInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil, 0, "")
+	if err != nil {
+		return nil, errors.NewError(http.StatusInternalServerError, "STORAGE_STAT_FAILED", "Failed to stat file").WithDetails(map[string]any{"error": err.Error(), "path": key})
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, nil
+	}
+	if err := s.close(resp, "STORAGE_STAT_FAILED", "Failed to stat file", key); err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{
+		Name:        pathpkg.Base(key),
+		Path:        key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (s *S3) copyObject(ctx context.Context, src, dst string) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s.config.Bucket+"/"+s3Escape(src, true))
+	resp, err := s.do(ctx, http.MethodPut, dst, nil, header, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// A copy can fail after S3 sent a 200 status, reporting the error in
+	// the body instead.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 || bytes.Contains(body, []byte("<Error>")) {
+		return s3ErrorFrom(resp.Status, body)
+	}
+	return nil
+}
+
+// s3Object is an entry of a bucket listing.
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+type listBucketResult struct {
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	NextContinuationToken string           `xml:"NextContinuationToken"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjects returns the objects whose keys start with prefix, at most
+// limit of them when limit is positive. With a delimiter, keys containing
+// it after the prefix are grouped into the returned common prefixes.
+func (s *S3) listObjects(ctx context.Context, prefix, delimiter string, limit int) ([]s3Object, []string, error) {
+	var objects []s3Object
+	var prefixes []string
+	seen := map[string]bool{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if limit > 0 {
+			query.Set("max-keys", fmt.Sprint(limit-len(objects)))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil, 0, "")
+		if err != nil {
+			return nil, nil, errors.NewError(http.StatusInternalServerError, "STORAGE_LIST_FAILED", "Failed to list files").WithDetails(map[string]any{"error": err.Error(), "path": prefix})
+		}
+		if resp.StatusCode >= 300 {
+			return nil, nil, s.close(resp, "STORAGE_LIST_FAILED", "Failed to list files", prefix)
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, nil, errors.NewError(http.StatusInternalServerError, "STORAGE_LIST_FAILED", "Failed to list files").WithDetails(map[string]any{"error": err.Error(), "path": prefix})
+		}
+
+		objects = append(objects, result.Contents...)
+		for _, p := range result.CommonPrefixes {
+			if !seen[p.Prefix] {
+				seen[p.Prefix] = true
+				prefixes = append(prefixes, p.Prefix)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" || (limit > 0 && len(objects) >= limit) {
+			return objects, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for the object key, or for the bucket when key
+// is empty. payloadHash is the hex SHA-256 of body, empty for no body.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.ReadCloser, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil && size > 0 {
+		req.Body = body
+		req.ContentLength = size
+	} else if method == http.MethodPut {
+		req.Body = http.NoBody
+	}
+	if payloadHash == "" {
+		payloadHash = emptyPayloadHash
+	}
+
+	signV4(req, payloadHash, s.config.AccessKey, s.config.SecretKey, s.config.Region, time.Now())
+	return s.client.Do(req)
+}
+
+func (s *S3) objectURL(key string, query url.Values) string {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.config.PathStyle {
+		base += "/" + s.config.Bucket
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+
+	u.Path = base + "/" + key
+	u.RawPath = s3Escape(base, true) + "/" + s3Escape(key, true)
+	if key == "" && base != "" {
+		u.Path, u.RawPath = base, s3Escape(base, true)
+	}
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+// close reads the outcome of a request without a response body of interest,
+// turning error statuses into a storage error with the given code.
+func (s *S3) close(resp *http.Response, code, message, path string) error {
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return errors.NewError(http.StatusInternalServerError, code, message).WithDetails(map[string]any{"error": s3ErrorFrom(resp.Status, body).Error(), "path": path})
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3ErrorFrom(status string, body []byte) error {
+	var e s3Error
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3: %s: %s", e.Code, e.Message)
+	}
+	return fmt.Errorf("s3: %s", status)
+}
+
+// signV4 signs the request with AWS Signature Version 4 for the S3 service.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5" || name == "range" {
+			trimmed := make([]string, len(values))
+			for i, value := range values {
+				trimmed[i] = strings.Join(strings.Fields(value), " ")
+			}
+			headers[name] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by name, escaped as SigV4
+// requires.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes every byte but the unreserved characters, and
+// slashes when keepSlash is set.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && keepSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
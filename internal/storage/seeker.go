@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Seeker reads a stored file as an io.ReadSeeker, as http.ServeContent
+// needs. Each read after a seek opens a ranged read from the new offset, so
+// backends without random access only transfer the bytes that are read.
+type Seeker struct {
+	ctx    context.Context
+	store  Storage
+	path   string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewSeeker returns a Seeker for the file at path of the given size.
+func NewSeeker(ctx context.Context, store Storage, path string, size int64) *Seeker {
+	return &Seeker{ctx: ctx, store: store, path: path, size: size}
+}
+
+func (s *Seeker) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if s.body == nil {
+		body, err := s.store.RetrieveRange(s.ctx, s.path, s.offset, s.size-s.offset)
+		if err != nil {
+			return 0, err
+		}
+		s.body = body
+	}
+	n, err := s.body.Read(p)
+	s.offset += int64(n)
+	return n, err
+}
+
+func (s *Seeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: seek to a negative offset")
+	}
+	if offset != s.offset {
+		if err := s.Close(); err != nil {
+			return 0, err
+		}
+		s.offset = offset
+	}
+	return offset, nil
+}
+
+// Close ends the current ranged read, if any.
+func (s *Seeker) Close() error {
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
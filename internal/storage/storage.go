@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	pathpkg "path"
+	"sort"
+	"strings"
+
+	"github.com/zulfikawr/vault/internal/core"
+)
+
+// New returns the storage backend selected by the configuration's
+// storage_driver.
+func New(cfg *core.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "", "local":
+		local, err := NewLocal(cfg.StoragePath())
+		if err != nil {
+			return nil, err
+		}
+		return local, nil
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			Region:    cfg.S3Region,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// RemoveAll deletes the file or directory at path with everything below
+// it, returning the number and total size of the deleted files.
+func RemoveAll(ctx context.Context, store Storage, path string) (int, int64, error) {
+	entries, err := store.List(ctx, path, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Delete children before their directories.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path > entries[j].Path })
+
+	files, size := 0, int64(0)
+	for _, entry := range entries {
+		if err := store.Delete(ctx, entry.Path); err != nil {
+			return files, size, err
+		}
+		if !entry.IsDir {
+			files++
+			size += entry.Size
+		}
+	}
+	if cleanPath(path) == "" {
+		return files, size, nil
+	}
+	if info, err := store.Stat(ctx, path); err == nil && !info.IsDir {
+		files++
+		size += info.Size
+	}
+	return files, size, store.Delete(ctx, path)
+}
+
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+	".pdf":  "application/pdf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".zip":  "application/zip",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".txt":  "text/plain",
+	".json": "application/json",
+	".xml":  "application/xml",
+}
+
+// ContentType returns the media type of a file name's extension.
+func ContentType(name string) string {
+	ext := strings.ToLower(pathpkg.Ext(name))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// cleanPath turns a storage path into a clean slash-separated path relative
+// to the storage root, empty for the root itself.
+func cleanPath(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
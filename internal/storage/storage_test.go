@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/vault/internal/errors"
+)
+
+func TestLocal(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, store)
+}
+
+// testStorage runs the behaviour every Storage backend shares.
+func testStorage(t *testing.T, store Storage) {
+	ctx := context.Background()
+
+	save := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := store.Save(ctx, path, strings.NewReader(content)); err != nil {
+			t.Fatalf("save %s: %v", path, err)
+		}
+	}
+	read := func(t *testing.T, path string) string {
+		t.Helper()
+		file, err := store.Retrieve(ctx, path)
+		if err != nil {
+			t.Fatalf("retrieve %s: %v", path, err)
+		}
+		defer func() { _ = file.Close() }()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	exists := func(t *testing.T, path string) bool {
+		t.Helper()
+		found, err := store.Exists(ctx, path)
+		if err != nil {
+			t.Fatalf("exists %s: %v", path, err)
+		}
+		return found
+	}
+
+	t.Run("save and retrieve", func(t *testing.T) {
+		save(t, "posts/rec1/hello world!.txt", "hello")
+		if got := read(t, "posts/rec1/hello world!.txt"); got != "hello" {
+			t.Errorf("expected hello, got %q", got)
+		}
+		save(t, "posts/rec1/hello world!.txt", "replaced")
+		if got := read(t, "posts/rec1/hello world!.txt"); got != "replaced" {
+			t.Errorf("expected the file to be overwritten, got %q", got)
+		}
+		save(t, "empty.txt", "")
+		if got := read(t, "empty.txt"); got != "" {
+			t.Errorf("expected an empty file, got %q", got)
+		}
+		if !exists(t, "posts/rec1/hello world!.txt") || !exists(t, "posts/rec1") {
+			t.Error("expected the file and its directory to exist")
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		if _, err := store.Retrieve(ctx, "missing.txt"); errorCode(err) != "FILE_NOT_FOUND" {
+			t.Errorf("expected FILE_NOT_FOUND, got %v", err)
+		}
+		if exists(t, "missing.txt") {
+			t.Error("expected a missing file not to exist")
+		}
+		if err := store.Delete(ctx, "missing.txt"); err != nil {
+			t.Errorf("expected deleting a missing file to succeed, got %v", err)
+		}
+		if err := store.Rename(ctx, "missing.txt", "other.txt"); errorCode(err) != "FILE_NOT_FOUND" {
+			t.Errorf("expected FILE_NOT_FOUND, got %v", err)
+		}
+	})
+
+	t.Run("rename file", func(t *testing.T) {
+		save(t, "a/one.txt", "one")
+		if err := store.Rename(ctx, "a/one.txt", "b/two.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if exists(t, "a/one.txt") {
+			t.Error("expected the old path to be gone")
+		}
+		if got := read(t, "b/two.txt"); got != "one" {
+			t.Errorf("expected the content at the new path, got %q", got)
+		}
+	})
+
+	t.Run("directories", func(t *testing.T) {
+		if err := store.CreateDir(ctx, "empty/dir"); err != nil {
+			t.Fatal(err)
+		}
+		if !exists(t, "empty/dir") || !exists(t, "empty") {
+			t.Error("expected a created directory to exist")
+		}
+
+		save(t, "docs/old/a.txt", "a")
+		save(t, "docs/old/nested/b.txt", "b")
+		save(t, "docs/older.txt", "keep")
+		if err := store.Rename(ctx, "docs/old", "docs/new"); err != nil {
+			t.Fatal(err)
+		}
+		if exists(t, "docs/old") {
+			t.Error("expected the old directory to be gone")
+		}
+		if read(t, "docs/new/a.txt") != "a" || read(t, "docs/new/nested/b.txt") != "b" {
+			t.Error("expected the directory's files to move")
+		}
+		if read(t, "docs/older.txt") != "keep" {
+			t.Error("expected a sibling sharing the prefix to stay")
+		}
+	})
+
+	t.Run("list and stat", func(t *testing.T) {
+		save(t, "gallery/a.png", "png")
+		save(t, "gallery/sub/b.txt", "text")
+		if err := store.CreateDir(ctx, "gallery/empty"); err != nil {
+			t.Fatal(err)
+		}
+
+		list := func(prefix string, recursive bool) string {
+			entries, err := store.List(ctx, prefix, recursive)
+			if err != nil {
+				t.Fatalf("list %s: %v", prefix, err)
+			}
+			var paths []string
+			for _, entry := range entries {
+				if entry.IsDir {
+					paths = append(paths, entry.Path+"/")
+				} else {
+					paths = append(paths, entry.Path)
+				}
+			}
+			sort.Strings(paths)
+			return strings.Join(paths, " ")
+		}
+		if got := list("gallery", false); got != "gallery/a.png gallery/empty/ gallery/sub/" {
+			t.Errorf("unexpected listing %q", got)
+		}
+		if got := list("/gallery/", true); got != "gallery/a.png gallery/empty/ gallery/sub/ gallery/sub/b.txt" {
+			t.Errorf("unexpected recursive listing %q", got)
+		}
+		if got := list("nothing", false); got != "" {
+			t.Errorf("expected a missing directory to list nothing, got %q", got)
+		}
+
+		info, err := store.Stat(ctx, "gallery/a.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != "a.png" || info.Size != 3 || info.IsDir || info.ContentType != "image/png" || info.ETag == "" || time.Since(info.ModTime) > time.Minute {
+			t.Errorf("unexpected file info %+v", info)
+		}
+		save(t, "gallery/a.png", "changed")
+		if changed, _ := store.Stat(ctx, "gallery/a.png"); changed.ETag == info.ETag {
+			t.Error("expected the etag to change with the content")
+		}
+		if info, err := store.Stat(ctx, "gallery/sub"); err != nil || !info.IsDir {
+			t.Errorf("expected a directory, got %+v %v", info, err)
+		}
+		if _, err := store.Stat(ctx, "gallery/missing"); errorCode(err) != "FILE_NOT_FOUND" {
+			t.Errorf("expected FILE_NOT_FOUND, got %v", err)
+		}
+	})
+
+	t.Run("ranges", func(t *testing.T) {
+		save(t, "range.txt", "0123456789")
+		for _, tc := range []struct {
+			offset, length int64
+			want           string
+		}{
+			{2, 3, "234"},
+			{7, -1, "789"},
+			{8, 10, "89"},
+			{0, 0, ""},
+			{20, 5, ""},
+		} {
+			file, err := store.RetrieveRange(ctx, "range.txt", tc.offset, tc.length)
+			if err != nil {
+				t.Fatalf("range %d+%d: %v", tc.offset, tc.length, err)
+			}
+			data, _ := io.ReadAll(file)
+			_ = file.Close()
+			if string(data) != tc.want {
+				t.Errorf("range %d+%d: expected %q, got %q", tc.offset, tc.length, tc.want, data)
+			}
+		}
+		if _, err := store.RetrieveRange(ctx, "missing.txt", 0, 1); errorCode(err) != "FILE_NOT_FOUND" {
+			t.Errorf("expected FILE_NOT_FOUND, got %v", err)
+		}
+	})
+
+	t.Run("seeker", func(t *testing.T) {
+		save(t, "seek.txt", "0123456789")
+		seeker := NewSeeker(ctx, store, "seek.txt", 10)
+		defer func() { _ = seeker.Close() }()
+
+		head := make([]byte, 3)
+		if _, err := io.ReadFull(seeker, head); err != nil || string(head) != "012" {
+			t.Fatalf("expected 012, got %q %v", head, err)
+		}
+		if size, err := seeker.Seek(0, io.SeekEnd); err != nil || size != 10 {
+			t.Fatalf("expected the size, got %d %v", size, err)
+		}
+		if _, err := seeker.Seek(-4, io.SeekEnd); err != nil {
+			t.Fatal(err)
+		}
+		if rest, _ := io.ReadAll(seeker); string(rest) != "6789" {
+			t.Errorf("expected 6789, got %q", rest)
+		}
+	})
+
+	t.Run("remove all", func(t *testing.T) {
+		save(t, "trash/a.txt", "a")
+		save(t, "trash/b/c.txt", "cc")
+		if err := store.CreateDir(ctx, "trash/d"); err != nil {
+			t.Fatal(err)
+		}
+		files, size, err := RemoveAll(ctx, store, "trash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files != 2 || size != 3 {
+			t.Errorf("expected 2 files of 3 bytes, got %d files of %d bytes", files, size)
+		}
+		if exists(t, "trash") {
+			t.Error("expected the directory to be removed")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		save(t, "gone.txt", "bye")
+		if err := store.Delete(ctx, "gone.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if exists(t, "gone.txt") {
+			t.Error("expected a deleted file not to exist")
+		}
+	})
+}
+
+func errorCode(err error) string {
+	if e, ok := err.(*errors.VaultError); ok {
+		return e.Code
+	}
+	return ""
+}
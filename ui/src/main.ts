@@ -4,16 +4,31 @@ import './style.css';
 import App from './App.vue';
 import router from './router';
 import axios from 'axios';
+import { useAuthStore } from './stores/auth';
 
 const pinia = createPinia();
 const app = createApp(App);
 
-// Initialize axios
-const token = localStorage.getItem('token');
-if (token) {
-  axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
-}
+// Initialize axios. State-changing requests echo the CSRF cookie in a
+// header, which the server requires whenever the browser sends cookies.
+axios.defaults.xsrfCookieName = 'vault_csrf';
+axios.defaults.xsrfHeaderName = 'X-CSRF-Token';
+void axios.get('/api/csrf-token');
+
+// Tokens were kept in storage before the dashboard used cookie sessions.
+localStorage.removeItem('token');
 
 app.use(pinia);
 app.use(router);
+
+// Sign out when the session cookie expired, e.g. after the idle timeout.
+axios.interceptors.response.use(undefined, (error) => {
+  if (error.response?.status === 401) {
+    useAuthStore().clear();
+    void router.push('/login');
+  }
+  return Promise.reject(error);
+});
+
+void useAuthStore().restore();
 app.mount('#app');
@@ -1,43 +1,62 @@
 import { defineStore } from 'pinia';
 import axios from 'axios';
 
+// The dashboard signs in with a cookie session: the session lives in an
+// HttpOnly cookie the browser sends with every request, so no token is kept
+// in storage that scripts can read.
 export const useAuthStore = defineStore('auth', {
   state: () => ({
-    token: localStorage.getItem('token') || null,
     user: JSON.parse(localStorage.getItem('user') || 'null'),
   }),
   getters: {
-    isAuthenticated: (state) => !!state.token,
+    isAuthenticated: (state) => !!state.user,
   },
   actions: {
     async login(identity: string, password: string) {
       try {
-        const response = await axios.post('/api/collections/users/auth-with-password', {
+        const response = await axios.post('/api/admins/auth-with-password', {
           identity,
           password,
+          session: 'cookie',
         });
-        const { token, record } = response.data.data;
-        this.token = token;
+        const { record } = response.data.data;
         this.user = record;
-        localStorage.setItem('token', token);
         localStorage.setItem('user', JSON.stringify(record));
-        axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
         return true;
       } catch (error) {
         console.error('Login failed', error);
         return false;
       }
     },
-    logout() {
-      this.token = null;
+    // restore checks that the session cookie is still valid, signing out
+    // when it expired.
+    async restore() {
+      if (!this.user) {
+        return;
+      }
+      try {
+        const response = await axios.get('/api/admins/me');
+        this.user = response.data.data;
+        localStorage.setItem('user', JSON.stringify(this.user));
+      } catch {
+        this.clear();
+      }
+    },
+    async logout() {
+      try {
+        await axios.post('/api/admins/auth-logout');
+      } catch (error) {
+        console.error('Logout failed', error);
+      }
+      this.clear();
+    },
+    clear() {
       this.user = null;
-      localStorage.removeItem('token');
       localStorage.removeItem('user');
       const rememberMe = localStorage.getItem('rememberMe');
       if (!rememberMe) {
         localStorage.removeItem('rememberMeExpiry');
       }
-      delete axios.defaults.headers.common['Authorization'];
     },
   },
 });